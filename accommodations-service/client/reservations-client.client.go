@@ -256,3 +256,31 @@ func (rc ReservationsClient) GetAccommodationsBelowPrice(ctx context.Context, ma
 		return nil, errors.NewError(resp.Error, resp.Status)
 	}
 }
+
+// HasAvailability reports whether reservations-service stored any availability of the
+// accommodation.
+func (rc ReservationsClient) HasAvailability(ctx context.Context, accommodationID string) (bool, *errors.ErrorStruct) {
+	cbResp, err := rc.circuitBreaker.Execute(func() (interface{}, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s/%s/availability", rc.address, accommodationID), nil)
+		if err != nil {
+			return nil, err
+		}
+		return rc.client.Do(req)
+	})
+	if err != nil {
+		rc.logger.LogError("accommodations-client", fmt.Sprintf("Unable to get availability of accommodation %s: %v", accommodationID, err))
+		return false, errors.NewError("Internal server error", http.StatusInternalServerError)
+	}
+	resp := cbResp.(*http.Response)
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		rc.logger.LogError("accommodations-client", fmt.Sprintf("Unable to get availability of accommodation %s, status %d", accommodationID, resp.StatusCode))
+		return false, errors.NewError("Internal server error", http.StatusInternalServerError)
+	}
+	var availability []json.RawMessage
+	if err := json.NewDecoder(resp.Body).Decode(&availability); err != nil {
+		rc.logger.LogError("accommodations-client", fmt.Sprintf("Unable to decode availability of accommodation %s: %v", accommodationID, err))
+		return false, errors.NewError("Error decoding JSON", http.StatusInternalServerError)
+	}
+	return len(availability) > 0, nil
+}
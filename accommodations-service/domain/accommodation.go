@@ -63,6 +63,7 @@ type AccommodationDTO struct {
 	Rating           float32  `json:"rating"`
 	Status           string   `json:"status" bson:"status"`
 	Paying           string   `json:"paying" bson:"paying"`
+	SagaID           string   `json:"sagaId,omitempty"`
 }
 
 type SendCreateAccommodationAvailability struct {
@@ -76,4 +77,7 @@ type AccommodationStatus string
 const (
 	Pending AccommodationStatus = "Pending"
 	Created AccommodationStatus = "Created"
+	// Suspended accommodations belong to a host whose account is being deleted. They are
+	// hidden until the deletion finishes or is rolled back.
+	Suspended AccommodationStatus = "Suspended"
 )
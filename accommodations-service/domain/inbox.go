@@ -0,0 +1,19 @@
+package domain
+
+import "time"
+
+const (
+	InboxProcessing = "Processing"
+	InboxDone       = "Done"
+)
+
+// InboxMessage is a saga command that was received. Reply holds the reply sent for it, encoded
+// as JSON, once the command was handled. Owner is the replica handling it since ClaimedAt.
+type InboxMessage struct {
+	MessageID  string    `bson:"_id" json:"messageId"`
+	Status     string    `bson:"status" json:"status"`
+	Reply      string    `bson:"reply,omitempty" json:"reply,omitempty"`
+	ReceivedAt time.Time `bson:"receivedAt" json:"receivedAt"`
+	Owner      string    `bson:"owner,omitempty" json:"owner,omitempty"`
+	ClaimedAt  time.Time `bson:"claimedAt,omitempty" json:"claimedAt,omitempty"`
+}
@@ -0,0 +1,43 @@
+package domain
+
+import (
+	events "example/saga/create_accommodation"
+	"example/saga/orchestration"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// CreateAccommodationSaga is what the create-accommodation saga carries from step to step.
+type CreateAccommodationSaga struct {
+	HostID        string                                     `json:"hostId"`
+	Accommodation events.SendCreateAccommodationAvailability `json:"-"`
+}
+
+type CreateAccommodationSagaState = orchestration.State[CreateAccommodationSaga]
+
+// SagaState is how a create-accommodation saga is stored.
+type SagaState struct {
+	Id              primitive.ObjectID                         `bson:"_id,omitempty"`
+	Type            string                                     `bson:"type"`
+	AccommodationID string                                     `bson:"accommodationId"`
+	HostID          string                                     `bson:"hostId"`
+	Step            string                                     `bson:"step"`
+	Status          string                                     `bson:"status"`
+	Payload         events.SendCreateAccommodationAvailability `bson:"payload"`
+	Attempts        int                                        `bson:"attempts"`
+	Deadline        time.Time                                  `bson:"deadline"`
+	Version         int                                        `bson:"version"`
+	History         []SagaStepRecord                           `bson:"history"`
+	CreatedAt       time.Time                                  `bson:"createdAt"`
+	UpdatedAt       time.Time                                  `bson:"updatedAt"`
+}
+
+type SagaStepRecord struct {
+	Step      string    `bson:"step"`
+	Status    string    `bson:"status"`
+	Note      string    `bson:"note,omitempty"`
+	CommandID string    `bson:"commandId,omitempty"`
+	ReplyID   string    `bson:"replyId,omitempty"`
+	At        time.Time `bson:"at"`
+}
@@ -200,6 +200,21 @@ func (a *AccommodationsHandler) GetAccommodationById(rw http.ResponseWriter, r *
 	utils.WriteResp(accommodation, 201, rw)
 }
 
+func (a *AccommodationsHandler) GetCreationSaga(rw http.ResponseWriter, r *http.Request) {
+	ctx, span := a.Tracer.Start(r.Context(), "AccommodationsHandler.GetCreationSaga")
+	defer span.End()
+	sagaID := mux.Vars(r)["id"]
+	userID, _ := ctx.Value("userID").(string)
+
+	saga, err := a.AccommodationService.GetCreationSaga(ctx, userID, sagaID)
+	if err != nil {
+		a.Logger.LogError("accommodations-handler", fmt.Sprintf("Unable to get saga %s: %s", sagaID, err.GetErrorMessage()))
+		utils.WriteErrorResp(err.GetErrorMessage(), err.GetErrorStatus(), "api/accommodations/sagas/"+sagaID, rw)
+		return
+	}
+	utils.WriteResp(saga, http.StatusOK, rw)
+}
+
 func (a *AccommodationsHandler) FindAccommodationsByIds(rw http.ResponseWriter, r *http.Request) {
 	ctx, span := a.Tracer.Start(r.Context(), "AccommodationsHandler.FindAccommodationsByIds")
 	defer span.End()
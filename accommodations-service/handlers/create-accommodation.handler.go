@@ -3,6 +3,7 @@ package handlers
 import (
 	"accommodations-service/config"
 	"accommodations-service/services"
+	"context"
 	events "example/saga/create_accommodation"
 	saga "example/saga/messaging"
 	"fmt"
@@ -14,15 +15,17 @@ type CreateAccommodationCommandHandler struct {
 	accommodationService *services.AccommodationService
 	replyPublisher       saga.Publisher
 	commandSubscriber    saga.Subscriber
+	inbox                *services.Inbox
 	tracer               trace.Tracer
 	logger               *config.Logger
 }
 
-func NewCreateAccommodationCommandHandler(accommodationService *services.AccommodationService, publisher saga.Publisher, subscriber saga.Subscriber, tracer trace.Tracer, logger *config.Logger) (*CreateAccommodationCommandHandler, error) {
+func NewCreateAccommodationCommandHandler(accommodationService *services.AccommodationService, publisher saga.Publisher, subscriber saga.Subscriber, inbox *services.Inbox, tracer trace.Tracer, logger *config.Logger) (*CreateAccommodationCommandHandler, error) {
 	o := &CreateAccommodationCommandHandler{
 		accommodationService: accommodationService,
 		replyPublisher:       publisher,
 		commandSubscriber:    subscriber,
+		inbox:                inbox,
 		tracer:               tracer,
 		logger:               logger,
 	}
@@ -35,26 +38,45 @@ func NewCreateAccommodationCommandHandler(accommodationService *services.Accommo
 }
 
 func (handler *CreateAccommodationCommandHandler) handle(command *events.CreateAccommodationCommand) {
-	// ctx, span := handler.tracer.Start(ctx, "CreateAccommodationCommandHandler.handle")
-	// defer span.End()
+	if command.Type != events.UpdateAccommodation && command.Type != events.DenyAccommodation {
+		return
+	}
+	ctx, span := handler.tracer.Start(command.Envelope.Context(context.Background()), "CreateAccommodationCommandHandler.handle")
+	defer span.End()
 	handler.logger.LogInfo("saga-handler", fmt.Sprintf("USLO U CREATE KOD ACCOMMODATION %v", command.Type))
+	reply := events.CreateAccommodationReply{Envelope: command.Envelope.Reply(ctx), Payload: command.Payload}
+	send := handler.inbox.Process(ctx, command.MessageID, &reply, func() bool {
+		return handler.execute(command, &reply)
+	})
+	if !send {
+		return
+	}
+	if err := handler.replyPublisher.Publish(reply); err != nil {
+		handler.logger.LogError("saga-handler", fmt.Sprintf("Unable to reply to command %v: %v", command.Type, err))
+	}
+}
+
+// execute runs a command and sets the type of its reply. It reports whether there is a reply.
+func (handler *CreateAccommodationCommandHandler) execute(command *events.CreateAccommodationCommand, reply *events.CreateAccommodationReply) bool {
 	returnedValue := command.Payload
 	switch command.Type {
 	case events.UpdateAccommodation:
 		handler.logger.LogInfo("saga-handler", fmt.Sprintf("USLO U CREATE KOD ACCOMMODATION ZA UPDATE ACCOMMODATION %v", command.Type))
 		err := handler.accommodationService.ApproveAccommodation(returnedValue.AccommodationID)
 		if err != nil {
-			return
+			return false
 		}
-		break
+		reply.Type = events.AccommodationApproved
+		return true
 	case events.DenyAccommodation:
 		handler.logger.LogInfo("saga-handler", fmt.Sprintf("USLO U CREATE KOD ACCOMMODATION ZA DENY ACCOMMODATION %v", command.Type))
 		err := handler.accommodationService.DenyAccommodation(returnedValue.AccommodationID)
 		if err != nil {
-			return
+			return false
 		}
-		break
+		reply.Type = events.AccommodationDenied
+		return true
 	default:
-		break
+		return false
 	}
 }
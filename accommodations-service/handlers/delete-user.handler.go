@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"accommodations-service/config"
+	"accommodations-service/services"
+	"context"
+	goerrors "errors"
+	events "example/saga/delete_user"
+	saga "example/saga/messaging"
+	"fmt"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// DeleteUserCommandHandler runs the steps of the delete-user saga that belong to
+// accommodations-service, and drops the accommodations of an account once it is deleted.
+type DeleteUserCommandHandler struct {
+	accommodationService *services.AccommodationService
+	replyPublisher       saga.Publisher
+	tracer               trace.Tracer
+	logger               *config.Logger
+}
+
+func NewDeleteUserCommandHandler(accommodationService *services.AccommodationService, publisher saga.Publisher, commandSubscriber, accountDeletedSubscriber saga.Subscriber, tracer trace.Tracer, logger *config.Logger) (*DeleteUserCommandHandler, error) {
+	handler := &DeleteUserCommandHandler{
+		accommodationService: accommodationService,
+		replyPublisher:       publisher,
+		tracer:               tracer,
+		logger:               logger,
+	}
+	if err := saga.Subscribe(commandSubscriber, handler.handle); err != nil {
+		logger.LogError("delete-user-handler", fmt.Sprintf("Unable to subscribe to commandSubscriber: %v", err))
+		return nil, err
+	}
+	if err := saga.Subscribe(accountDeletedSubscriber, handler.accountDeleted); err != nil {
+		logger.LogError("delete-user-handler", fmt.Sprintf("Unable to subscribe to accountDeletedSubscriber: %v", err))
+		return nil, err
+	}
+	return handler, nil
+}
+
+// handle suspends or restores the accommodations of the user. Both leave accommodations
+// already in the wanted state as they are, so a command delivered again does no harm. A
+// restore that fails is delivered again, since the saga can't go on without it.
+func (handler *DeleteUserCommandHandler) handle(ctx context.Context, command *events.DeleteUserCommand) error {
+	if command.Type != events.SuspendAccommodations && command.Type != events.RestoreAccommodations {
+		return nil
+	}
+	ctx, span := handler.tracer.Start(ctx, "DeleteUserCommandHandler.handle")
+	defer span.End()
+	reply := events.DeleteUserReply{Envelope: command.Envelope.Reply(ctx), Payload: command.Payload}
+	switch command.Type {
+	case events.SuspendAccommodations:
+		reply.Type = events.AccommodationsSuspended
+		if err := handler.accommodationService.SuspendUserAccommodations(ctx, command.Payload.UserID); err != nil {
+			reply.Type = events.AccommodationsNotSuspended
+		}
+	case events.RestoreAccommodations:
+		if err := handler.accommodationService.RestoreUserAccommodations(ctx, command.Payload.UserID); err != nil {
+			return goerrors.New(err.GetErrorMessage())
+		}
+		reply.Type = events.AccommodationsRestored
+	}
+	if err := handler.replyPublisher.Publish(reply); err != nil {
+		handler.logger.LogError("delete-user-handler", fmt.Sprintf("Unable to reply to command %v: %v", command.Type, err))
+		return err
+	}
+	return nil
+}
+
+func (handler *DeleteUserCommandHandler) accountDeleted(ctx context.Context, event *events.AccountDeleted) error {
+	ctx, span := handler.tracer.Start(ctx, "DeleteUserCommandHandler.accountDeleted")
+	defer span.End()
+	if err := handler.accommodationService.DeleteAccommodationsByUserId(ctx, event.UserID); err != nil {
+		handler.logger.LogError("delete-user-handler", fmt.Sprintf("Unable to delete accommodations of deleted user %s: %s", event.UserID, err.GetErrorMessage()))
+		return goerrors.New(err.GetErrorMessage())
+	}
+	return nil
+}
@@ -17,6 +17,7 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/sony/gobreaker"
@@ -115,7 +116,8 @@ func main() {
 
 	accommodationRepo := repository.NewAccommodationRepository(
 		mongoService.GetCli(), loggerW, tracer)
-	publisher, err := nats.NewNATSPublisher(
+	publisher, err := nats.NewPublisher(
+		os.Getenv("MESSAGING_DRIVER"),
 		os.Getenv("NATS_HOST"),
 		os.Getenv("NATS_PORT"),
 		os.Getenv("NATS_USER"),
@@ -125,7 +127,8 @@ func main() {
 	if err != nil {
 		log.Fatal(err)
 	}
-	replySubscriber, err := nats.NewNATSSubscriber(
+	replySubscriber, err := nats.NewSubscriber(
+		os.Getenv("MESSAGING_DRIVER"),
 		os.Getenv("NATS_HOST"),
 		os.Getenv("NATS_PORT"),
 		os.Getenv("NATS_USER"),
@@ -135,7 +138,16 @@ func main() {
 	if err != nil {
 		log.Fatal(err)
 	}
-	orch, err := orchestrator.NewCreateAccommodationOrchestrator(publisher, replySubscriber, loggerW)
+	sagaRepo := repository.NewSagaRepository(mongoService.GetCli(), loggerW, tracer)
+	sagaStepTimeout, err := time.ParseDuration(os.Getenv("SAGA_STEP_TIMEOUT"))
+	if err != nil {
+		sagaStepTimeout = 30 * time.Second
+	}
+	sagaTimeoutInterval, err := time.ParseDuration(os.Getenv("SAGA_TIMEOUT_INTERVAL"))
+	if err != nil {
+		sagaTimeoutInterval = 10 * time.Second
+	}
+	orch, err := orchestrator.NewCreateAccommodationOrchestrator(publisher, replySubscriber, sagaRepo, reservationsClient, sagaStepTimeout, tracer, loggerW)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -144,7 +156,8 @@ func main() {
 	_ = fileStorage.CreateDirectories()
 	cache := repository.NewCache(loggerCach, tracer)
 	accommodationService := services.NewAccommodationService(accommodationRepo, validator, reservationsClient, userClient, fileStorage, cache, orch, tracer, loggerW)
-	publisher1, err := nats.NewNATSPublisher(
+	publisher1, err := nats.NewPublisher(
+		os.Getenv("MESSAGING_DRIVER"),
 		os.Getenv("NATS_HOST"),
 		os.Getenv("NATS_PORT"),
 		os.Getenv("NATS_USER"),
@@ -154,17 +167,87 @@ func main() {
 	if err != nil {
 		log.Fatal(err)
 	}
-	replySubscriber2, err := nats.NewNATSSubscriber(
+	replySubscriber2, err := nats.NewSubscriber(
+		os.Getenv("MESSAGING_DRIVER"),
 		os.Getenv("NATS_HOST"),
 		os.Getenv("NATS_PORT"),
 		os.Getenv("NATS_USER"),
 		os.Getenv("NATS_PASS"),
 		os.Getenv("CREATE_ACCOMMODATION_COMMAND_SUBJECT"),
 		"accommodations-service")
-	_, err = handlers.NewCreateAccommodationCommandHandler(accommodationService, publisher1, replySubscriber2, tracer, loggerW)
+	inbox := services.NewInbox(repository.NewInboxRepository(mongoService.GetCli(), loggerW, tracer), tracer, loggerW)
+	_, err = handlers.NewCreateAccommodationCommandHandler(accommodationService, publisher1, replySubscriber2, inbox, tracer, loggerW)
 	if err != nil {
 		log.Println(err)
 	}
+	deleteUserReplyPublisher, err := nats.NewPublisher(
+		os.Getenv("MESSAGING_DRIVER"),
+		os.Getenv("NATS_HOST"),
+		os.Getenv("NATS_PORT"),
+		os.Getenv("NATS_USER"),
+		os.Getenv("NATS_PASS"),
+		os.Getenv("DELETE_USER_REPLY_SUBJECT"),
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+	deleteUserCommandSubscriber, err := nats.NewSubscriber(
+		os.Getenv("MESSAGING_DRIVER"),
+		os.Getenv("NATS_HOST"),
+		os.Getenv("NATS_PORT"),
+		os.Getenv("NATS_USER"),
+		os.Getenv("NATS_PASS"),
+		os.Getenv("DELETE_USER_COMMAND_SUBJECT"),
+		"accommodations-service")
+	if err != nil {
+		log.Fatal(err)
+	}
+	accountDeletedSubscriber, err := nats.NewSubscriber(
+		os.Getenv("MESSAGING_DRIVER"),
+		os.Getenv("NATS_HOST"),
+		os.Getenv("NATS_PORT"),
+		os.Getenv("NATS_USER"),
+		os.Getenv("NATS_PASS"),
+		os.Getenv("ACCOUNT_DELETED_SUBJECT"),
+		"accommodations-service")
+	if err != nil {
+		log.Fatal(err)
+	}
+	_, err = handlers.NewDeleteUserCommandHandler(accommodationService, deleteUserReplyPublisher, deleteUserCommandSubscriber, accountDeletedSubscriber, tracer, loggerW)
+	if err != nil {
+		log.Println(err)
+	}
+	orch.Resume(context.Background())
+	sagaTimeoutContext, stopSagaTimeouts := context.WithCancel(context.Background())
+	defer stopSagaTimeouts()
+	orch.StartTimeouts(sagaTimeoutContext, sagaTimeoutInterval)
+
+	// The saga admin API listens on a port of its own, which the api gateway doesn't expose.
+	// SAGA_ADMIN_TOKENS gives every operator a token of their own, as name=token pairs
+	// separated by commas.
+	var adminServer *http.Server
+	if sagaAdminTokens := os.Getenv("SAGA_ADMIN_TOKENS"); sagaAdminTokens != "" {
+		sagaAdminPort := os.Getenv("SAGA_ADMIN_PORT")
+		if len(sagaAdminPort) == 0 {
+			sagaAdminPort = "8081"
+		}
+		sagaAdmin, err := orch.Admin(repository.NewSagaAuditRepository(mongoService.GetCli(), loggerW, tracer), sagaAdminTokens)
+		if err != nil {
+			log.Fatal(err)
+		}
+		adminServer = &http.Server{
+			Addr:         ":" + sagaAdminPort,
+			Handler:      sagaAdmin,
+			ReadTimeout:  5 * time.Second,
+			WriteTimeout: 30 * time.Second,
+		}
+		go func() {
+			if err := adminServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				loggerW.Println("Saga admin API stopped", err)
+			}
+		}()
+		loggerW.Println("Saga admin API listening on port", sagaAdminPort)
+	}
 
 	accommodationsHandler := handlers.AccommodationsHandler{
 		AccommodationService: accommodationService,
@@ -180,6 +263,7 @@ func main() {
 	// ro
 
 	router := mux.NewRouter()
+	router.HandleFunc("/health", nats.HealthHandler).Methods("GET")
 
 	router.HandleFunc("/recommended", accommodationsHandler.FindAccommodationsByIds).Methods("GET")
 
@@ -195,6 +279,8 @@ func main() {
 
 	router.HandleFunc("/search", accommodationsHandler.SearchAccommodations).Methods("GET")
 
+	router.HandleFunc("/sagas/{id}", middlewares.ValidateJWT(middlewares.RoleValidator("Host", accommodationsHandler.GetCreationSaga))).Methods("GET")
+
 	router.HandleFunc("/{id}", accommodationsHandler.GetAccommodationById).Methods("GET")
 
 	router.HandleFunc("/images/{id}", accommodationsHandler.MiddlewareCacheHit(accommodationsHandler.GetImage)).Methods("GET")
@@ -222,15 +308,26 @@ func main() {
 		}
 	}()
 
-	sigCh := make(chan os.Signal)
+	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, os.Interrupt)
 	signal.Notify(sigCh, os.Kill)
+	signal.Notify(sigCh, syscall.SIGTERM)
 
 	sig := <-sigCh
 	loggerW.Println("Received terminate, graceful shutdown", sig)
 
 	//Try to shutdown gracefully
-	if server.Shutdown(timeoutContext) != nil {
+	shutdownContext, cancelShutdown := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancelShutdown()
+	shutdownErr := server.Shutdown(shutdownContext)
+	if adminServer != nil {
+		_ = adminServer.Shutdown(shutdownContext)
+	}
+	// Handlers still running finish and buffered messages go out before the connection closes.
+	if err := nats.Drain(); err != nil {
+		loggerW.Println("Cannot drain messaging connections", err)
+	}
+	if shutdownErr != nil {
 		loggerW.Fatalf("Cannot gracefully shutdown...")
 	}
 	loggerW.Println("Server stopped")
@@ -1,64 +1,128 @@
 package orchestrator
 
 import (
+	"accommodations-service/client"
 	"accommodations-service/config"
+	"accommodations-service/domain"
+	"accommodations-service/errors"
+	"accommodations-service/repository"
+	"context"
+	goerrors "errors"
 	events "example/saga/create_accommodation"
 	saga "example/saga/messaging"
+	"example/saga/orchestration"
 	"fmt"
-	"log"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	sagaCreateAccommodation = "CreateAccommodation"
+
+	// The accommodation is stored pending before the saga starts, so its step has nothing to
+	// run and is compensated by denying the accommodation.
+	sagaStepCreateAccommodation  = "CreateAccommodation"
+	sagaStepCreateAvailability   = "CreateAvailability"
+	sagaStepApproveAccommodation = "ApproveAccommodation"
 )
 
 type CreateAccommodationOrchestrator struct {
-	commandPublisher saga.Publisher
-	replySubscriber  saga.Subscriber
-	logger           *config.Logger
+	saga   *orchestration.Orchestrator[domain.CreateAccommodationSaga, events.CreateAccommodationCommand, events.CreateAccommodationReply]
+	logger *config.Logger
 }
 
-func NewCreateAccommodationOrchestrator(publisher saga.Publisher, replySubscriber saga.Subscriber, logger *config.Logger) (*CreateAccommodationOrchestrator, error) {
-	orchestrator := &CreateAccommodationOrchestrator{
-		commandPublisher: publisher,
-		replySubscriber:  replySubscriber,
-		logger:           logger,
+func NewCreateAccommodationOrchestrator(publisher saga.Publisher, replySubscriber saga.Subscriber, repo *repository.SagaRepo, reservationsClient *client.ReservationsClient, stepTimeout time.Duration, tracer trace.Tracer, logger *config.Logger) (*CreateAccommodationOrchestrator, error) {
+	definition := orchestration.Definition[domain.CreateAccommodationSaga, events.CreateAccommodationCommand, events.CreateAccommodationReply]{
+		Name: sagaCreateAccommodation,
+		Steps: []orchestration.Step[domain.CreateAccommodationSaga, events.CreateAccommodationCommand]{
+			{
+				Name:         sagaStepCreateAccommodation,
+				Compensation: command(events.DenyAccommodation),
+			},
+			{
+				Name:         sagaStepCreateAvailability,
+				Action:       command(events.CreateAvailability),
+				Compensation: command(events.RollbackAccommodation),
+				Check: func(ctx context.Context, data domain.CreateAccommodationSaga) (bool, error) {
+					created, err := reservationsClient.HasAvailability(ctx, data.Accommodation.AccommodationID)
+					if err != nil {
+						return false, goerrors.New(err.GetErrorMessage())
+					}
+					return created, nil
+				},
+			},
+			{
+				Name:   sagaStepApproveAccommodation,
+				Action: command(events.UpdateAccommodation),
+			},
+		},
+		Outcome: func(reply *events.CreateAccommodationReply) (saga.Envelope, bool) {
+			switch reply.Type {
+			case events.AvailabilityCreated, events.AccommodationApproved, events.AvailabilityRolledBack, events.AccommodationDenied:
+				return reply.Envelope, true
+			default:
+				return reply.Envelope, false
+			}
+		},
+		StepTimeout: stepTimeout,
 	}
-	err := orchestrator.replySubscriber.Subscribe(orchestrator.handle)
+	orchestrator, err := orchestration.New(definition, repo, publisher, replySubscriber, tracer, logger)
 	if err != nil {
 		logger.LogError("accommodations-saga-orchestrator", fmt.Sprintf("Unable to subscribe to reply Subscriber"))
 		return nil, err
 	}
-	return orchestrator, nil
+	return &CreateAccommodationOrchestrator{saga: orchestrator, logger: logger}, nil
 }
 
-func (cao *CreateAccommodationOrchestrator) Start(accommodation *events.SendCreateAccommodationAvailability) error {
-	log.Println(accommodation.AccommodationID)
-	cao.logger.LogInfo("accommodation-saga-orchestrator", "Entered in start saga with id of accommodation "+accommodation.AccommodationID)
-	event := &events.CreateAccommodationCommand{
-		Type:    events.CreateAvailability,
-		Payload: *accommodation,
+// command builds the command of the given type for a step of the saga.
+func command(commandType events.CreateAccommodationCommandType) func(saga.Envelope, domain.CreateAccommodationSaga) events.CreateAccommodationCommand {
+	return func(envelope saga.Envelope, data domain.CreateAccommodationSaga) events.CreateAccommodationCommand {
+		return events.CreateAccommodationCommand{
+			Envelope: envelope,
+			Type:     commandType,
+			Payload:  data.Accommodation,
+		}
 	}
-	cao.logger.LogInfo("accommodation-saga-orchestrator", "Event created ")
-	log.Println("EVENT IZGLEDA OVAKO ", event)
-	return cao.commandPublisher.Publish(event)
 }
 
-func (cao *CreateAccommodationOrchestrator) handle(reply *events.CreateAccommodationReply) {
-	cao.logger.LogInfo("accommodation-saga-orchestrator", "Entered saga handle func")
-	command := events.CreateAccommodationCommand{Payload: reply.Payload}
-	command.Type = cao.nextCommandType(reply.Type)
-	if command.Type != events.UnknownCommand {
-		cao.logger.LogInfo("accommodation-saga-service", "Entered command publishing")
-		_ = cao.commandPublisher.Publish(command)
+// Start stores a new saga for the accommodation and asks reservations-service to create its
+// availability.
+func (cao *CreateAccommodationOrchestrator) Start(ctx context.Context, hostID string, accommodation *events.SendCreateAccommodationAvailability) (*domain.CreateAccommodationSagaState, *errors.ErrorStruct) {
+	cao.logger.LogInfo("accommodation-saga-orchestrator", "Entered in start saga with id of accommodation "+accommodation.AccommodationID)
+	state, err := cao.saga.Start(ctx, domain.CreateAccommodationSaga{HostID: hostID, Accommodation: *accommodation})
+	if err != nil {
+		return nil, errors.NewError(err.Error(), 500)
 	}
+	return state, nil
 }
 
-func (cao *CreateAccommodationOrchestrator) nextCommandType(reply events.CreateAccommodationReplyType) events.CreateAccommodationCommandType {
-	cao.logger.LogInfo("accommodation-saga-service", "Picking next command")
-	switch reply {
-	case events.AvailabilityCreated:
-		return events.UpdateAccommodation
-	case events.AvailabilityNotCreated:
-		return events.RollbackAccommodation
-	default:
-		return events.UnknownCommand
+// GetSaga returns the progress of a saga to the host whose accommodation it creates.
+func (cao *CreateAccommodationOrchestrator) GetSaga(ctx context.Context, hostID, id string) (*domain.CreateAccommodationSagaState, *errors.ErrorStruct) {
+	state, err := cao.saga.Get(ctx, id)
+	if goerrors.Is(err, orchestration.ErrNotFound) || (err == nil && state.Data.HostID != hostID) {
+		return nil, errors.NewError("Saga not found", 404)
 	}
+	if err != nil {
+		return nil, errors.NewError(err.Error(), 500)
+	}
+	return state, nil
+}
+
+// Resume publishes the current step of every saga that was in flight when the service
+// stopped.
+func (cao *CreateAccommodationOrchestrator) Resume(ctx context.Context) {
+	cao.saga.Resume(ctx)
+}
+
+// StartTimeouts retries overdue sagas every interval until ctx is done.
+func (cao *CreateAccommodationOrchestrator) StartTimeouts(ctx context.Context, interval time.Duration) {
+	cao.saga.StartTimeouts(ctx, interval)
+}
 
+// Admin returns the admin API operators use to inspect, retry and compensate the sagas.
+// operatorTokens holds the name=token pairs of the operators.
+func (cao *CreateAccommodationOrchestrator) Admin(audit orchestration.AuditLog, operatorTokens string) (http.Handler, error) {
+	return orchestration.NewAdmin(cao.saga, audit, operatorTokens)
 }
@@ -124,7 +124,7 @@ func (ar *AccommodationRepo) GetAllAccommodations(ctx context.Context) ([]*do.Ac
 	accommodationCollection := ar.cli.Database("accommodations-service").Collection("accommodations")
 	var accommodations []*do.Accommodation
 
-	cursor, err := accommodationCollection.Find(context.TODO(), bson.D{})
+	cursor, err := accommodationCollection.Find(context.TODO(), bson.M{"status": bson.M{"$ne": string(do.Suspended)}})
 	if err != nil {
 		ar.logger.LogError("accommodations-repo", fmt.Sprintf("Unable to find all accommodations"))
 		ar.logger.LogError("accommodation-repo", fmt.Sprintf("Error:"+err.Error()))
@@ -281,11 +281,53 @@ func (ar *AccommodationRepo) DeleteAccommodationsByUserId(ctx context.Context, i
 	return nil
 }
 
+// SuspendAccommodationsByUserId suspends the accommodations of a user, keeping the status
+// each had so it can be restored.
+func (ar *AccommodationRepo) SuspendAccommodationsByUserId(ctx context.Context, userID string) *errors.ErrorStruct {
+	ctx, span := ar.tracer.Start(ctx, "AccommodationRepo.SuspendAccommodationsByUserId")
+	defer span.End()
+	accommodationCollection := ar.cli.Database("accommodations-service").Collection("accommodations")
+	filter := bson.M{"userId": userID, "status": bson.M{"$ne": string(do.Suspended)}}
+	update := mongo.Pipeline{
+		{{Key: "$set", Value: bson.D{
+			{Key: "suspendedStatus", Value: "$status"},
+			{Key: "status", Value: string(do.Suspended)},
+		}}},
+	}
+	result, err := accommodationCollection.UpdateMany(ctx, filter, update)
+	if err != nil {
+		ar.logger.LogError("accommodation-repo", fmt.Sprintf("Unable to suspend accommodations of user %s: %v", userID, err))
+		return errors.NewError("Unable to suspend accommodations, database error", 500)
+	}
+	ar.logger.LogInfo("accommodation-repo", fmt.Sprintf("Suspended %d accommodations of user %s", result.ModifiedCount, userID))
+	return nil
+}
+
+// RestoreAccommodationsByUserId gives the suspended accommodations of a user back the status
+// they had before.
+func (ar *AccommodationRepo) RestoreAccommodationsByUserId(ctx context.Context, userID string) *errors.ErrorStruct {
+	ctx, span := ar.tracer.Start(ctx, "AccommodationRepo.RestoreAccommodationsByUserId")
+	defer span.End()
+	accommodationCollection := ar.cli.Database("accommodations-service").Collection("accommodations")
+	filter := bson.M{"userId": userID, "status": string(do.Suspended)}
+	update := mongo.Pipeline{
+		{{Key: "$set", Value: bson.D{{Key: "status", Value: "$suspendedStatus"}}}},
+		{{Key: "$unset", Value: "suspendedStatus"}},
+	}
+	result, err := accommodationCollection.UpdateMany(ctx, filter, update)
+	if err != nil {
+		ar.logger.LogError("accommodation-repo", fmt.Sprintf("Unable to restore accommodations of user %s: %v", userID, err))
+		return errors.NewError("Unable to restore accommodations, database error", 500)
+	}
+	ar.logger.LogInfo("accommodation-repo", fmt.Sprintf("Restored %d accommodations of user %s", result.ModifiedCount, userID))
+	return nil
+}
+
 func (ar *AccommodationRepo) SearchAccommodations(ctx context.Context, city, country string, numOfVisitors int, maxPrice int, conveniences []string) ([]do.Accommodation, *errors.ErrorStruct) {
 	ctx, span := ar.tracer.Start(ctx, "AccommodationRepo.SearchAccommodations")
 	defer span.End()
 	accommodationCollection := ar.cli.Database("accommodations-service").Collection("accommodations")
-	filter := bson.M{}
+	filter := bson.M{"status": bson.M{"$ne": string(do.Suspended)}}
 
 	log.Println("maximalnaCijena", maxPrice)
 	log.Println("convies", conveniences)
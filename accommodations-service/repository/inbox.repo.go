@@ -0,0 +1,118 @@
+package repository
+
+import (
+	"accommodations-service/config"
+	do "accommodations-service/domain"
+	"accommodations-service/errors"
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// inboxRetention is how long received messages are remembered, redeliveries come within
+// minutes.
+const inboxRetention = 7 * 24 * time.Hour
+
+type InboxRepo struct {
+	cli    *mongo.Client
+	logger *config.Logger
+	tracer trace.Tracer
+}
+
+func NewInboxRepository(cli *mongo.Client, logger *config.Logger, tracer trace.Tracer) *InboxRepo {
+	repo := &InboxRepo{
+		cli:    cli,
+		logger: logger,
+		tracer: tracer,
+	}
+	_, err := repo.collection().Indexes().CreateOne(context.TODO(), mongo.IndexModel{
+		Keys:    bson.M{"receivedAt": 1},
+		Options: options.Index().SetExpireAfterSeconds(int32(inboxRetention.Seconds())),
+	})
+	if err != nil {
+		logger.LogError("inbox-repo", fmt.Sprintf("Unable to create inbox expiry index: %v", err))
+	}
+	return repo
+}
+
+func (ir *InboxRepo) collection() *mongo.Collection {
+	return ir.cli.Database("accommodations-service").Collection("inbox")
+}
+
+// ClaimMessage records a received message as being handled by owner. A message received before
+// is taken over when it is still being handled by a claim made before staleBefore, otherwise
+// ClaimMessage returns false and the earlier record.
+func (ir *InboxRepo) ClaimMessage(ctx context.Context, messageID, owner string, staleBefore time.Time) (bool, *do.InboxMessage, *errors.ErrorStruct) {
+	ctx, span := ir.tracer.Start(ctx, "InboxRepo.ClaimMessage")
+	defer span.End()
+	now := time.Now().UTC()
+	message := do.InboxMessage{MessageID: messageID, Status: do.InboxProcessing, ReceivedAt: now, Owner: owner, ClaimedAt: now}
+	_, err := ir.collection().InsertOne(ctx, message)
+	if err == nil {
+		return true, nil, nil
+	}
+	if !mongo.IsDuplicateKeyError(err) {
+		ir.logger.LogError("inbox-repo", fmt.Sprintf("Unable to record message %s: %v", messageID, err))
+		return false, nil, errors.NewError("Unable to record message, database error", 500)
+	}
+	// Messages received before claims were recorded have no claimedAt, their age is told by
+	// receivedAt instead.
+	stale := bson.M{
+		"_id":    messageID,
+		"status": do.InboxProcessing,
+		"$or": bson.A{
+			bson.M{"claimedAt": bson.M{"$lt": staleBefore}},
+			bson.M{"claimedAt": bson.M{"$exists": false}, "receivedAt": bson.M{"$lt": staleBefore}},
+		},
+	}
+	var abandoned do.InboxMessage
+	err = ir.collection().FindOneAndUpdate(ctx, stale, bson.M{"$set": bson.M{"owner": owner, "claimedAt": now}}).Decode(&abandoned)
+	if err == nil {
+		ir.logger.LogWarn("inbox-repo", fmt.Sprintf("Took over message %s abandoned by %s", messageID, abandoned.Owner))
+		return true, nil, nil
+	}
+	if err != mongo.ErrNoDocuments {
+		ir.logger.LogError("inbox-repo", fmt.Sprintf("Unable to take over message %s: %v", messageID, err))
+		return false, nil, errors.NewError("Unable to record message, database error", 500)
+	}
+	var previous do.InboxMessage
+	if err := ir.collection().FindOne(ctx, bson.M{"_id": messageID}).Decode(&previous); err != nil {
+		ir.logger.LogError("inbox-repo", fmt.Sprintf("Unable to find message %s: %v", messageID, err))
+		return false, nil, errors.NewError("Unable to find message, database error", 500)
+	}
+	return false, &previous, nil
+}
+
+// CompleteMessage stores the reply sent for a message, as long as owner still holds the claim
+// on it.
+func (ir *InboxRepo) CompleteMessage(ctx context.Context, messageID, owner, reply string) *errors.ErrorStruct {
+	ctx, span := ir.tracer.Start(ctx, "InboxRepo.CompleteMessage")
+	defer span.End()
+	update := bson.M{"$set": bson.M{"status": do.InboxDone, "reply": reply}}
+	result, err := ir.collection().UpdateOne(ctx, bson.M{"_id": messageID, "owner": owner}, update)
+	if err != nil {
+		ir.logger.LogError("inbox-repo", fmt.Sprintf("Unable to record reply to message %s: %v", messageID, err))
+		return errors.NewError("Unable to record reply, database error", 500)
+	}
+	if result.MatchedCount == 0 {
+		ir.logger.LogWarn("inbox-repo", fmt.Sprintf("Message %s was taken over, its reply was not recorded", messageID))
+	}
+	return nil
+}
+
+// ReleaseMessage forgets a message that couldn't be handled, so a redelivery handles it. A
+// message taken over by another owner is left alone.
+func (ir *InboxRepo) ReleaseMessage(ctx context.Context, messageID, owner string) *errors.ErrorStruct {
+	ctx, span := ir.tracer.Start(ctx, "InboxRepo.ReleaseMessage")
+	defer span.End()
+	if _, err := ir.collection().DeleteOne(ctx, bson.M{"_id": messageID, "owner": owner}); err != nil {
+		ir.logger.LogError("inbox-repo", fmt.Sprintf("Unable to release message %s: %v", messageID, err))
+		return errors.NewError("Unable to release message, database error", 500)
+	}
+	return nil
+}
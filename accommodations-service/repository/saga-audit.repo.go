@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"accommodations-service/config"
+	"context"
+	"example/saga/orchestration"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// SagaAuditRepo keeps the actions operators took on sagas through the saga admin API. Entries
+// are never changed or removed.
+type SagaAuditRepo struct {
+	cli    *mongo.Client
+	logger *config.Logger
+	tracer trace.Tracer
+}
+
+var _ orchestration.AuditLog = (*SagaAuditRepo)(nil)
+
+func NewSagaAuditRepository(cli *mongo.Client, logger *config.Logger, tracer trace.Tracer) *SagaAuditRepo {
+	repo := &SagaAuditRepo{
+		cli:    cli,
+		logger: logger,
+		tracer: tracer,
+	}
+	_, err := repo.collection().Indexes().CreateOne(context.TODO(), mongo.IndexModel{
+		Keys: bson.D{{Key: "sagaid", Value: 1}, {Key: "at", Value: 1}},
+	})
+	if err != nil {
+		logger.LogError("saga-audit-repo", fmt.Sprintf("Unable to create saga audit index: %v", err))
+	}
+	return repo
+}
+
+func (ar *SagaAuditRepo) collection() *mongo.Collection {
+	return ar.cli.Database("accommodations-service").Collection("saga_audit")
+}
+
+func (ar *SagaAuditRepo) Append(ctx context.Context, entry orchestration.AuditEntry) error {
+	ctx, span := ar.tracer.Start(ctx, "SagaAuditRepo.Append")
+	defer span.End()
+	if _, err := ar.collection().InsertOne(ctx, entry); err != nil {
+		ar.logger.LogError("saga-audit-repo", fmt.Sprintf("Unable to audit %s of saga %s by %s: %v", entry.Action, entry.SagaID, entry.Operator, err))
+		return fmt.Errorf("unable to write audit entry, database error")
+	}
+	return nil
+}
+
+func (ar *SagaAuditRepo) Entries(ctx context.Context, sagaID string) ([]orchestration.AuditEntry, error) {
+	ctx, span := ar.tracer.Start(ctx, "SagaAuditRepo.Entries")
+	defer span.End()
+	cursor, err := ar.collection().Find(ctx, bson.M{"sagaid": sagaID}, options.Find().SetSort(bson.M{"at": 1}))
+	if err != nil {
+		ar.logger.LogError("saga-audit-repo", fmt.Sprintf("Unable to find audit entries of saga %s: %v", sagaID, err))
+		return nil, fmt.Errorf("unable to retrieve audit entries, database error")
+	}
+	defer cursor.Close(ctx)
+	var entries []orchestration.AuditEntry
+	if err := cursor.All(ctx, &entries); err != nil {
+		ar.logger.LogError("saga-audit-repo", fmt.Sprintf("Unable to decode audit entries of saga %s: %v", sagaID, err))
+		return nil, fmt.Errorf("unable to retrieve audit entries, database error")
+	}
+	return entries, nil
+}
@@ -0,0 +1,206 @@
+package repository
+
+import (
+	"accommodations-service/config"
+	do "accommodations-service/domain"
+	"context"
+	"example/saga/orchestration"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// SagaRepo stores create-accommodation sagas for the saga orchestrator.
+type SagaRepo struct {
+	cli    *mongo.Client
+	logger *config.Logger
+	tracer trace.Tracer
+}
+
+var _ orchestration.Store[do.CreateAccommodationSaga] = (*SagaRepo)(nil)
+
+func NewSagaRepository(cli *mongo.Client, logger *config.Logger, tracer trace.Tracer) *SagaRepo {
+	return &SagaRepo{
+		cli:    cli,
+		logger: logger,
+		tracer: tracer,
+	}
+}
+
+func (sr *SagaRepo) collection() *mongo.Collection {
+	return sr.cli.Database("accommodations-service").Collection("sagas")
+}
+
+func (sr *SagaRepo) NewID() string {
+	return primitive.NewObjectID().Hex()
+}
+
+// Save inserts a saga that was never saved, and otherwise replaces it only if its version is
+// still the one it was read at.
+func (sr *SagaRepo) Save(ctx context.Context, state *do.CreateAccommodationSagaState) error {
+	ctx, span := sr.tracer.Start(ctx, "SagaRepo.Save")
+	defer span.End()
+	saga, err := toSagaDocument(state)
+	if err != nil {
+		return err
+	}
+	saga.Version++
+	if state.Version == 0 {
+		_, err = sr.collection().InsertOne(ctx, saga)
+		if mongo.IsDuplicateKeyError(err) {
+			return orchestration.ErrConflict
+		}
+	} else {
+		var result *mongo.UpdateResult
+		result, err = sr.collection().ReplaceOne(ctx, bson.M{"_id": saga.Id, "version": state.Version}, saga)
+		if err == nil && result.MatchedCount == 0 {
+			return orchestration.ErrConflict
+		}
+	}
+	if err != nil {
+		sr.logger.LogError("saga-repo", fmt.Sprintf("Unable to save saga %s: %v", state.ID, err))
+		return fmt.Errorf("unable to save saga %s, database error", state.ID)
+	}
+	state.Version = saga.Version
+	return nil
+}
+
+func (sr *SagaRepo) Get(ctx context.Context, id string) (*do.CreateAccommodationSagaState, error) {
+	ctx, span := sr.tracer.Start(ctx, "SagaRepo.Get")
+	defer span.End()
+	sagaID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, orchestration.ErrNotFound
+	}
+	var saga do.SagaState
+	err = sr.collection().FindOne(ctx, bson.M{"_id": sagaID}).Decode(&saga)
+	if err == mongo.ErrNoDocuments {
+		return nil, orchestration.ErrNotFound
+	}
+	if err != nil {
+		sr.logger.LogError("saga-repo", fmt.Sprintf("Unable to find saga %s: %v", id, err))
+		return nil, fmt.Errorf("unable to retrieve saga %s, database error", id)
+	}
+	return fromSagaDocument(&saga), nil
+}
+
+func (sr *SagaRepo) InFlight(ctx context.Context) ([]*do.CreateAccommodationSagaState, error) {
+	ctx, span := sr.tracer.Start(ctx, "SagaRepo.InFlight")
+	defer span.End()
+	return sr.find(ctx, bson.M{"status": bson.M{"$in": []orchestration.Status{orchestration.Running, orchestration.Compensating}}}, 0)
+}
+
+func (sr *SagaRepo) Overdue(ctx context.Context, now time.Time) ([]*do.CreateAccommodationSagaState, error) {
+	ctx, span := sr.tracer.Start(ctx, "SagaRepo.Overdue")
+	defer span.End()
+	return sr.find(ctx, bson.M{
+		"status":   bson.M{"$in": []orchestration.Status{orchestration.Running, orchestration.Compensating}},
+		"deadline": bson.M{"$lte": now},
+	}, 0)
+}
+
+func (sr *SagaRepo) List(ctx context.Context, filter orchestration.Filter) ([]*do.CreateAccommodationSagaState, error) {
+	ctx, span := sr.tracer.Start(ctx, "SagaRepo.List")
+	defer span.End()
+	query := bson.M{}
+	if len(filter.Statuses) > 0 {
+		query["status"] = bson.M{"$in": filter.Statuses}
+	}
+	if !filter.CreatedBefore.IsZero() {
+		query["createdAt"] = bson.M{"$lt": filter.CreatedBefore}
+	}
+	return sr.find(ctx, query, int64(filter.Limit))
+}
+
+// find returns the sagas that match the filter, oldest first and at most limit of them unless
+// limit is 0.
+func (sr *SagaRepo) find(ctx context.Context, filter bson.M, limit int64) ([]*do.CreateAccommodationSagaState, error) {
+	opts := options.Find().SetSort(bson.M{"createdAt": 1})
+	if limit > 0 {
+		opts.SetLimit(limit)
+	}
+	cursor, err := sr.collection().Find(ctx, filter, opts)
+	if err != nil {
+		sr.logger.LogError("saga-repo", fmt.Sprintf("Unable to find sagas: %v", err))
+		return nil, fmt.Errorf("unable to retrieve sagas, database error")
+	}
+	defer cursor.Close(ctx)
+	var sagas []do.SagaState
+	if err := cursor.All(ctx, &sagas); err != nil {
+		sr.logger.LogError("saga-repo", fmt.Sprintf("Unable to decode sagas: %v", err))
+		return nil, fmt.Errorf("unable to retrieve sagas, database error")
+	}
+	states := make([]*do.CreateAccommodationSagaState, 0, len(sagas))
+	for i := range sagas {
+		states = append(states, fromSagaDocument(&sagas[i]))
+	}
+	return states, nil
+}
+
+func toSagaDocument(state *do.CreateAccommodationSagaState) (*do.SagaState, error) {
+	id, err := primitive.ObjectIDFromHex(state.ID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid saga id %s", state.ID)
+	}
+	history := make([]do.SagaStepRecord, 0, len(state.History))
+	for _, record := range state.History {
+		history = append(history, do.SagaStepRecord{
+			Step:      record.Step,
+			Status:    string(record.Status),
+			Note:      record.Note,
+			CommandID: record.CommandID,
+			ReplyID:   record.ReplyID,
+			At:        record.At,
+		})
+	}
+	return &do.SagaState{
+		Id:              id,
+		Type:            state.Saga,
+		AccommodationID: state.Data.Accommodation.AccommodationID,
+		HostID:          state.Data.HostID,
+		Step:            state.Step,
+		Status:          string(state.Status),
+		Payload:         state.Data.Accommodation,
+		Attempts:        state.Attempts,
+		Deadline:        state.Deadline,
+		Version:         state.Version,
+		History:         history,
+		CreatedAt:       state.CreatedAt,
+		UpdatedAt:       state.UpdatedAt,
+	}, nil
+}
+
+func fromSagaDocument(saga *do.SagaState) *do.CreateAccommodationSagaState {
+	history := make([]orchestration.Record, 0, len(saga.History))
+	for _, record := range saga.History {
+		history = append(history, orchestration.Record{
+			Step:      record.Step,
+			Status:    orchestration.Status(record.Status),
+			Note:      record.Note,
+			CommandID: record.CommandID,
+			ReplyID:   record.ReplyID,
+			At:        record.At,
+		})
+	}
+	return &do.CreateAccommodationSagaState{
+		ID:   saga.Id.Hex(),
+		Saga: saga.Type,
+		Data: do.CreateAccommodationSaga{
+			HostID:        saga.HostID,
+			Accommodation: saga.Payload,
+		},
+		Step:      saga.Step,
+		Status:    orchestration.Status(saga.Status),
+		Attempts:  saga.Attempts,
+		Deadline:  saga.Deadline,
+		Version:   saga.Version,
+		History:   history,
+		CreatedAt: saga.CreatedAt,
+		UpdatedAt: saga.UpdatedAt,
+	}
+}
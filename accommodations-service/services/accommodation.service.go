@@ -117,10 +117,10 @@ func (as *AccommodationService) CreateAccommodation(accommodation domain.CreateA
 		Location:        reqData.Location,
 		DateRange:       eventsDateRangeCasted,
 	}
-	err := as.orchestrator.Start(&reqDataCasted)
+	saga, err := as.orchestrator.Start(ctx, accommodation.UserId, &reqDataCasted)
 	if err != nil {
 		as.logger.LogError("accommodation-service", fmt.Sprintf("Error in starting orchestrator"))
-		as.logger.LogError("accommodation-service", fmt.Sprintf("Error:"+err.Error()))
+		as.logger.LogError("accommodation-service", fmt.Sprintf("Error:"+err.GetErrorMessage()))
 		as.DeleteAccommodation(ctx, id)
 		as.logger.LogInfo("accommodation-service", "Accommodation with id"+newAccommodation.Id.Hex()+"deleted")
 
@@ -142,9 +142,17 @@ func (as *AccommodationService) CreateAccommodation(accommodation domain.CreateA
 		ImageIds:         imageIds,
 		Status:           accommodation.Status,
 		Paying:           accommodation.Paying,
+		SagaID:           saga.ID,
 	}, nil
 }
 
+// GetCreationSaga returns how far the creation of a host's accommodation got.
+func (as *AccommodationService) GetCreationSaga(ctx context.Context, hostID, sagaID string) (*domain.CreateAccommodationSagaState, *errors.ErrorStruct) {
+	ctx, span := as.tracer.Start(ctx, "AccommodationService.GetCreationSaga")
+	defer span.End()
+	return as.orchestrator.GetSaga(ctx, hostID, sagaID)
+}
+
 func (as *AccommodationService) GetImage(ctx context.Context, id string) ([]byte, *errors.ErrorStruct) {
 	ctx, span := as.tracer.Start(ctx, "AccommodationService.GetImage")
 	defer span.End()
@@ -352,6 +360,22 @@ func (as *AccommodationService) DeleteAccommodationsByUserId(ctx context.Context
 
 	return nil
 }
+
+// SuspendUserAccommodations hides the accommodations of a host whose account is being deleted.
+func (as *AccommodationService) SuspendUserAccommodations(ctx context.Context, userID string) *errors.ErrorStruct {
+	ctx, span := as.tracer.Start(ctx, "AccommodationService.SuspendUserAccommodations")
+	defer span.End()
+	return as.accommodationRepository.SuspendAccommodationsByUserId(ctx, userID)
+}
+
+// RestoreUserAccommodations shows the accommodations of a host again after the deletion of
+// the account was rolled back.
+func (as *AccommodationService) RestoreUserAccommodations(ctx context.Context, userID string) *errors.ErrorStruct {
+	ctx, span := as.tracer.Start(ctx, "AccommodationService.RestoreUserAccommodations")
+	defer span.End()
+	return as.accommodationRepository.RestoreAccommodationsByUserId(ctx, userID)
+}
+
 func (as *AccommodationService) PutAccommodationRating(ctx context.Context, accommodationID string, accommodation domain.Accommodation) *errors.ErrorStruct {
 	ctx, span := as.tracer.Start(ctx, "AccommodationService.PutAccommodationRating")
 	defer span.End()
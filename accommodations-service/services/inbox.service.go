@@ -0,0 +1,79 @@
+package services
+
+import (
+	"accommodations-service/config"
+	"accommodations-service/domain"
+	"accommodations-service/repository"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// inboxClaimTimeout is how long a command may be handled before another replica takes it over,
+// it is well above the time a handler takes.
+const inboxClaimTimeout = 5 * time.Minute
+
+// Inbox makes saga command handlers idempotent. Every command is recorded by its message id,
+// and a command that is delivered again gets the reply recorded for it instead of being
+// handled twice. A command whose handler died with its replica is handled again once its
+// claim is older than inboxClaimTimeout.
+type Inbox struct {
+	repo   *repository.InboxRepo
+	owner  string
+	tracer trace.Tracer
+	logger *config.Logger
+}
+
+func NewInbox(repo *repository.InboxRepo, tracer trace.Tracer, logger *config.Logger) *Inbox {
+	hostname, _ := os.Hostname()
+	return &Inbox{repo: repo, owner: fmt.Sprintf("%s-%s", hostname, primitive.NewObjectID().Hex()), tracer: tracer, logger: logger}
+}
+
+// Process runs handle for a message received the first time. handle fills reply and reports
+// whether there is a reply to send, a message without one is forgotten so a redelivery is
+// handled again. For a message received before, the recorded reply is decoded into reply
+// instead. Process reports whether reply should be sent.
+func (in *Inbox) Process(ctx context.Context, messageID string, reply interface{}, handle func() bool) bool {
+	ctx, span := in.tracer.Start(ctx, "Inbox.Process")
+	defer span.End()
+	if messageID == "" {
+		return handle()
+	}
+	claimed, previous, err := in.repo.ClaimMessage(ctx, messageID, in.owner, time.Now().UTC().Add(-inboxClaimTimeout))
+	if err != nil {
+		in.logger.LogError("inbox", fmt.Sprintf("Dropping message %s: %s", messageID, err.GetErrorMessage()))
+		return false
+	}
+	if !claimed {
+		if previous.Status != domain.InboxDone {
+			in.logger.LogWarn("inbox", fmt.Sprintf("Message %s is already being handled", messageID))
+			return false
+		}
+		if err := json.Unmarshal([]byte(previous.Reply), reply); err != nil {
+			in.logger.LogError("inbox", fmt.Sprintf("Unable to decode reply to message %s: %v", messageID, err))
+			return false
+		}
+		in.logger.LogInfo("inbox", fmt.Sprintf("Message %s was handled before, sending its reply again", messageID))
+		return true
+	}
+	if !handle() {
+		if err := in.repo.ReleaseMessage(ctx, messageID, in.owner); err != nil {
+			in.logger.LogError("inbox", err.GetErrorMessage())
+		}
+		return false
+	}
+	encoded, encodeErr := json.Marshal(reply)
+	if encodeErr != nil {
+		in.logger.LogError("inbox", fmt.Sprintf("Unable to encode reply to message %s: %v", messageID, encodeErr))
+		return true
+	}
+	if err := in.repo.CompleteMessage(ctx, messageID, in.owner, string(encoded)); err != nil {
+		in.logger.LogError("inbox", err.GetErrorMessage())
+	}
+	return true
+}
@@ -9,6 +9,8 @@ type User struct {
 	Email     string             `json: "email" bson:"email"`
 	Role      string             `json: "role" bson:"role"`
 	Confirmed bool               `json: "confirmed" bson:"confirmed"`
+	// Disabled is set while the account is being deleted, so nobody can log in with it.
+	Disabled bool `json:"disabled" bson:"disabled"`
 }
 
 type UserDTO struct {
@@ -0,0 +1,83 @@
+package handler
+
+import (
+	"auth-service/config"
+	"auth-service/services"
+	"context"
+	goerrors "errors"
+	events "example/saga/delete_user"
+	saga "example/saga/messaging"
+	"fmt"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// DeleteUserCommandHandler runs the step of the delete-user saga that belongs to auth-service,
+// and removes the credentials of an account once it is deleted.
+type DeleteUserCommandHandler struct {
+	userService    *services.UserService
+	replyPublisher saga.Publisher
+	tracer         trace.Tracer
+	logger         *config.Logger
+}
+
+func NewDeleteUserCommandHandler(userService *services.UserService, replyPublisher saga.Publisher, commandSubscriber, accountDeletedSubscriber saga.Subscriber, tracer trace.Tracer, logger *config.Logger) (*DeleteUserCommandHandler, error) {
+	handler := &DeleteUserCommandHandler{
+		userService:    userService,
+		replyPublisher: replyPublisher,
+		tracer:         tracer,
+		logger:         logger,
+	}
+	if err := saga.Subscribe(commandSubscriber, handler.handle); err != nil {
+		logger.LogError("delete-user-handler", fmt.Sprintf("Unable to subscribe to commandSubscriber: %v", err))
+		return nil, err
+	}
+	if err := saga.Subscribe(accountDeletedSubscriber, handler.accountDeleted); err != nil {
+		logger.LogError("delete-user-handler", fmt.Sprintf("Unable to subscribe to accountDeletedSubscriber: %v", err))
+		return nil, err
+	}
+	return handler, nil
+}
+
+// handle disables or enables the credentials of the user. Both only set a flag, so a command
+// delivered again does no harm. Enabling credentials that fails is delivered again, since the
+// saga can't go on without it.
+func (handler *DeleteUserCommandHandler) handle(ctx context.Context, command *events.DeleteUserCommand) error {
+	if command.Type != events.DisableCredentials && command.Type != events.EnableCredentials {
+		return nil
+	}
+	ctx, span := handler.tracer.Start(ctx, "DeleteUserCommandHandler.handle")
+	defer span.End()
+	reply := events.DeleteUserReply{Envelope: command.Envelope.Reply(ctx), Payload: command.Payload}
+	switch command.Type {
+	case events.DisableCredentials:
+		reply.Type = events.CredentialsDisabled
+		if err := handler.userService.DisableCredentials(ctx, command.Payload.UserID); err != nil {
+			handler.logger.LogError("delete-user-handler", fmt.Sprintf("Unable to disable credentials of user %s: %s", command.Payload.UserID, err.GetErrorMessage()))
+			reply.Type = events.CredentialsNotDisabled
+		}
+	case events.EnableCredentials:
+		if err := handler.userService.EnableCredentials(ctx, command.Payload.UserID); err != nil {
+			handler.logger.LogError("delete-user-handler", fmt.Sprintf("Unable to enable credentials of user %s: %s", command.Payload.UserID, err.GetErrorMessage()))
+			return goerrors.New(err.GetErrorMessage())
+		}
+		reply.Type = events.CredentialsEnabled
+	}
+	if err := handler.replyPublisher.Publish(reply); err != nil {
+		handler.logger.LogError("delete-user-handler", fmt.Sprintf("Unable to reply to command %v: %v", command.Type, err))
+		return err
+	}
+	return nil
+}
+
+// accountDeleted removes the credentials of a deleted account. Credentials that can't be found
+// were removed by an earlier delivery.
+func (handler *DeleteUserCommandHandler) accountDeleted(ctx context.Context, event *events.AccountDeleted) error {
+	ctx, span := handler.tracer.Start(ctx, "DeleteUserCommandHandler.accountDeleted")
+	defer span.End()
+	if _, err := handler.userService.DeleteUserById(ctx, event.UserID); err != nil && err.GetErrorStatus() >= 500 {
+		handler.logger.LogError("delete-user-handler", fmt.Sprintf("Unable to delete credentials of deleted user %s: %s", event.UserID, err.GetErrorMessage()))
+		return goerrors.New(err.GetErrorMessage())
+	}
+	return nil
+}
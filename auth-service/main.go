@@ -11,9 +11,11 @@ import (
 	"auth-service/tracing"
 	"auth-service/utils"
 	"context"
+	"example/saga/messaging/nats"
 	"net/http"
 	"os"
 	"os/signal"
+	"syscall"
 	"time"
 
 	log "github.com/sirupsen/logrus"
@@ -118,6 +120,43 @@ func main() {
 		Tracer:      tracer,
 		Logger:      logger,
 	}
+	replyPublisher, err := nats.NewPublisher(
+		os.Getenv("MESSAGING_DRIVER"),
+		os.Getenv("NATS_HOST"),
+		os.Getenv("NATS_PORT"),
+		os.Getenv("NATS_USER"),
+		os.Getenv("NATS_PASS"),
+		os.Getenv("DELETE_USER_REPLY_SUBJECT"),
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+	commandSubscriber, err := nats.NewSubscriber(
+		os.Getenv("MESSAGING_DRIVER"),
+		os.Getenv("NATS_HOST"),
+		os.Getenv("NATS_PORT"),
+		os.Getenv("NATS_USER"),
+		os.Getenv("NATS_PASS"),
+		os.Getenv("DELETE_USER_COMMAND_SUBJECT"),
+		"auth-service")
+	if err != nil {
+		log.Fatal(err)
+	}
+	accountDeletedSubscriber, err := nats.NewSubscriber(
+		os.Getenv("MESSAGING_DRIVER"),
+		os.Getenv("NATS_HOST"),
+		os.Getenv("NATS_PORT"),
+		os.Getenv("NATS_USER"),
+		os.Getenv("NATS_PASS"),
+		os.Getenv("ACCOUNT_DELETED_SUBJECT"),
+		"auth-service")
+	if err != nil {
+		log.Fatal(err)
+	}
+	_, err = handler.NewDeleteUserCommandHandler(userService, replyPublisher, commandSubscriber, accountDeletedSubscriber, tracer, logger)
+	if err != nil {
+		log.Fatal(err)
+	}
 	accessControl := security.NewAccessControl()
 	err = accessControl.LoadAccessConfig("./security/rbac.json")
 	if err != nil {
@@ -126,15 +165,16 @@ func main() {
 	// router definitions
 
 	router := mux.NewRouter()
+	router.HandleFunc("/health", nats.HealthHandler).Methods("GET")
 	router.HandleFunc("/login", authHandler.LoginHandler).Methods("POST")
 	router.HandleFunc("/register", authHandler.RegisterHandler).Methods("POST")
 	router.HandleFunc("/confirm-account/{token}", authHandler.ConfirmAccount).Methods("POST")
 	router.HandleFunc("/request-reset-password", authHandler.RequestResetPassword).Methods("POST")
 	router.HandleFunc("/reset-password/{token}", authHandler.ResetPassword).Methods("POST")
-	router.HandleFunc("/change-password/{id}", middlewares.ValidateJWT(authHandler.ChangePassword)).Methods("POST")
-	router.HandleFunc("/update-credentials", middlewares.ValidateJWT(authHandler.UpdateCredentials)).Methods("POST")
+	router.HandleFunc("/change-password/{id}", middlewares.ValidateJWT(middlewares.ActiveAccount(userService, authHandler.ChangePassword))).Methods("POST")
+	router.HandleFunc("/update-credentials", middlewares.ValidateJWT(middlewares.ActiveAccount(userService, authHandler.UpdateCredentials))).Methods("POST")
 	router.HandleFunc("/{id}", authHandler.DeleteUser).Methods("DELETE")
-	router.HandleFunc("/all", middlewares.ValidateJWT(middlewares.RoleValidator(accessControl, authHandler.All))).Methods("GET")
+	router.HandleFunc("/all", middlewares.ValidateJWT(middlewares.ActiveAccount(userService, middlewares.RoleValidator(accessControl, authHandler.All)))).Methods("GET")
 	// server definitions
 
 	if len(port) == 0 {
@@ -160,15 +200,23 @@ func main() {
 		}
 	}()
 
-	sigCh := make(chan os.Signal)
+	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, os.Interrupt)
 	signal.Notify(sigCh, os.Kill)
+	signal.Notify(sigCh, syscall.SIGTERM)
 
 	sig := <-sigCh
 	logger.Println("Received terminate, graceful shutdown", sig)
 
 	//Try to shutdown gracefully
-	if server.Shutdown(timeoutContext) != nil {
+	shutdownContext, cancelShutdown := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancelShutdown()
+	shutdownErr := server.Shutdown(shutdownContext)
+	// Handlers still running finish and buffered messages go out before the connection closes.
+	if err := nats.Drain(); err != nil {
+		logger.Println("Cannot drain messaging connections", err)
+	}
+	if shutdownErr != nil {
 		logger.Fatalf("Cannot gracefully shutdown...")
 	}
 	logger.Println("Server stopped")
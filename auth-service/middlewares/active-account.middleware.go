@@ -0,0 +1,25 @@
+package middlewares
+
+import (
+	"auth-service/services"
+	"auth-service/utils"
+	"net/http"
+)
+
+// ActiveAccount turns away tokens of accounts that are being deleted or are gone. It runs after
+// ValidateJWT, which only checks the signature and expiry of the token.
+func ActiveAccount(users *services.UserService, next http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := r.Context().Value("userID").(string)
+		active, err := users.IsActive(r.Context(), userID)
+		if err != nil {
+			utils.WriteErrorResp(err.GetErrorMessage(), err.GetErrorStatus(), r.URL.Path, w)
+			return
+		}
+		if !active {
+			utils.WriteErrorResp("Unathorized", 401, r.URL.Path, w)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
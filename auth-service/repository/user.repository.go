@@ -237,3 +237,27 @@ func (u UserRepository) DeleteUserById(ctx context.Context, id string) (*domains
 	}
 	return user, nil
 }
+
+// SetUserDisabled disables or enables logging in with the credentials of a user. Setting the
+// value the user already has is not an error.
+func (u UserRepository) SetUserDisabled(ctx context.Context, id string, disabled bool) *errors.ErrorStruct {
+	ctx, span := u.tracer.Start(ctx, "UserRepository.SetUserDisabled")
+	defer span.End()
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		u.logger.LogError("auth-db", err.Error())
+		return errors.NewError(err.Error(), 400)
+	}
+	collection := u.cli.Database("auth").Collection("user")
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "disabled", Value: disabled}}}}
+	result, err := collection.UpdateOne(ctx, bson.M{"_id": objectID}, update)
+	if err != nil {
+		u.logger.LogError("auth-db", err.Error())
+		return errors.NewError(err.Error(), 500)
+	}
+	if result.MatchedCount == 0 {
+		return errors.NewError("User not found", 404)
+	}
+	u.logger.LogInfo("auth-db", fmt.Sprintf("Set disabled to %v for user ID %v", disabled, id))
+	return nil
+}
@@ -1,9 +1,16 @@
 package services
 
 import (
+	"time"
+
 	"github.com/golang-jwt/jwt/v5"
 )
 
+// TokenTTL is how long a token is accepted. The other services only check the signature and
+// expiry of a token, so a deleted account can keep using a token issued before its deletion
+// for up to TokenTTL. auth-service itself turns such tokens away right away.
+const TokenTTL = 24 * time.Hour
+
 type JwtService struct {
 	key []byte
 }
@@ -15,9 +22,10 @@ func NewJWTService(key []byte) *JwtService {
 }
 func (j JwtService) CreateKey(email, role, userID string) (*string, error) {
 	t := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"name": email,
-		"role": role,
+		"name":   email,
+		"role":   role,
 		"userID": userID,
+		"exp":    time.Now().Add(TokenTTL).Unix(),
 	})
 	signed, err := t.SignedString(j.key)
 	if err != nil {
@@ -142,6 +142,10 @@ func (u *UserService) LoginUser(ctx context.Context, loginData domains.LoginUser
 		u.logger.LogError("user-service", "Bad credentials for user "+loginData.Email)
 		return nil, errors.NewError("Bad credentials", 401)
 	}
+	if user.Disabled {
+		u.logger.LogError("user-service", "Login to disabled account "+loginData.Email)
+		return nil, errors.NewError("Account is being deleted", 403)
+	}
 	jwtToken, foundError := u.jwtService.CreateKey(user.Email, user.Role, user.ID.Hex())
 	if foundError != nil {
 		u.logger.LogError("user-service", foundError.Error())
@@ -377,3 +381,31 @@ func (u UserService) DeleteUserById(ctx context.Context, id string) (*domains.Us
 		Confirmed: user.Confirmed,
 	}, nil
 }
+
+// IsActive tells whether the user still has an account that isn't being deleted.
+func (u UserService) IsActive(ctx context.Context, id string) (bool, *errors.ErrorStruct) {
+	ctx, span := u.tracer.Start(ctx, "UserService.IsActive")
+	defer span.End()
+	user, err := u.userRepository.FindUserById(ctx, id)
+	if err != nil {
+		if err.GetErrorStatus() == 401 {
+			return false, nil
+		}
+		return false, err
+	}
+	return !user.Disabled, nil
+}
+
+// DisableCredentials stops the user from logging in while the account is being deleted.
+func (u UserService) DisableCredentials(ctx context.Context, id string) *errors.ErrorStruct {
+	ctx, span := u.tracer.Start(ctx, "UserService.DisableCredentials")
+	defer span.End()
+	return u.userRepository.SetUserDisabled(ctx, id, true)
+}
+
+// EnableCredentials lets the user log in again after deleting the account was rolled back.
+func (u UserService) EnableCredentials(ctx context.Context, id string) *errors.ErrorStruct {
+	ctx, span := u.tracer.Start(ctx, "UserService.EnableCredentials")
+	defer span.End()
+	return u.userRepository.SetUserDisabled(ctx, id, false)
+}
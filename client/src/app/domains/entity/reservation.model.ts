@@ -14,6 +14,7 @@
 	IsActive          bool       `json:"isActive"`
 	Country           string     `json:"country"`
 	HostID            string     `json:"hostId"`
+	Guests            Guests     `json:"guests"`
 */
 
 export interface Reservation {
@@ -32,4 +33,12 @@ export interface Reservation {
     isActive: boolean
     country: string
     hostId: string
+    guests: Guests
+}
+
+export interface Guests {
+    adults: number
+    children: number
+    infants: number
+    pets: number
 }
\ No newline at end of file
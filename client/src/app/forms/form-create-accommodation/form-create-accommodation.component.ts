@@ -30,6 +30,7 @@ export class FormCreateAccommodationComponent {
     'Air Conditioning',
     'Free Parking',
     'Pool',
+    'Pets Allowed',
   ];
   errors: string = '';
   user: UserAuth | null = null;
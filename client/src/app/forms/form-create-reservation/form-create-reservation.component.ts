@@ -40,6 +40,10 @@ export class ReservationFormComponent implements OnInit {
   initializeForm() {
     this.reservationForm = this.fb.group({
       range: ['', [Validators.required]],
+      adults: [1, [Validators.required, Validators.min(1)]],
+      children: [0, [Validators.min(0)]],
+      infants: [0, [Validators.min(0)]],
+      pets: [0, [Validators.min(0)]],
     });
   }
 
@@ -75,6 +79,12 @@ export class ReservationFormComponent implements OnInit {
     let numOfDays: number = this.reservationForm.value.range.length;
     let dateRange: string[] = this.reservationForm.value.range;
     let hostID: string = this.accommodation.userId
+    let guests = {
+      adults: Number(this.reservationForm.value.adults),
+      children: Number(this.reservationForm.value.children),
+      infants: Number(this.reservationForm.value.infants),
+      pets: Number(this.reservationForm.value.pets),
+    };
     console.log(this.accommodation)
     let reservationData = {"userID": userID,
     "accommodationID": accommodationID,
@@ -86,7 +96,9 @@ export class ReservationFormComponent implements OnInit {
     "price": price,
     "numOfDays": numOfDays,
     "dateRange": dateRange,
-    "hostID" : hostID
+    "hostID" : hostID,
+    "guests": guests,
+    "paymentToken": "tok_visa"
   }
   console.log(reservationData)
   this.reservationService.createReservation(reservationData)
@@ -1,6 +1,14 @@
 package domains
 
 type NotificationMail struct {
-	Text  string `json:"text"`
-	Email string `json:"email"`
-}
\ No newline at end of file
+	Text        string       `json:"text"`
+	Email       string       `json:"email"`
+	Attachments []Attachment `json:"attachments,omitempty"`
+}
+
+// Attachment is a file mailed along with a message, the content is base64 encoded in JSON.
+type Attachment struct {
+	Filename    string `json:"filename"`
+	ContentType string `json:"contentType"`
+	Content     []byte `json:"content"`
+}
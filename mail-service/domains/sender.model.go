@@ -2,6 +2,7 @@ package domains
 
 import (
 	"bytes"
+	"encoding/base64"
 	"fmt"
 	"github.com/XenZi/airbnb-clone/mail-service/errors"
 	"html/template"
@@ -23,7 +24,7 @@ func NewEmailSender(email, password, SMTPServer string, SMTPServerPort int) *Sen
 	return &Sender{Email: email, Password: password, SMTPServer: SMTPServer, SMTPServerPort: SMTPServerPort}
 }
 
-func (s *Sender) SendHTMLEmail(templatePath string, to, cc []string, subject string, data interface{}, files []string) *errors.ErrorStruct {
+func (s *Sender) SendHTMLEmail(templatePath string, to, cc []string, subject string, data interface{}, attachments []Attachment) *errors.ErrorStruct {
 	if templatePath == "" {
 		log.Println("Error while reading template, not exist on this path: " + templatePath)
 		return errors.NewError("Error while reading template, not exist on this path", 500)
@@ -33,15 +34,15 @@ func (s *Sender) SendHTMLEmail(templatePath string, to, cc []string, subject str
 		log.Println(err)
 		return err
 	}
-	body := s.writeEmail(to, cc, "text/html", subject, tmpl, files)
+	body := s.writeEmail(to, cc, "text/html", subject, tmpl, attachments)
 	if err := s.sendEmail(to, subject, body); err != nil {
 		log.Println(err)
 		return errors.NewError(err.Error(), 500)
 	}
 	return nil
 }
-func (s *Sender) SendPlainEmail(to, cc []string, subject, data string, files []string) *errors.ErrorStruct {
-	body := s.writeEmail(to, cc, "text/plain", subject, data, files)
+func (s *Sender) SendPlainEmail(to, cc []string, subject, data string, attachments []Attachment) *errors.ErrorStruct {
+	body := s.writeEmail(to, cc, "text/plain", subject, data, attachments)
 	if err := s.sendEmail(to, subject, body); err != nil {
 		log.Println(err)
 		return errors.NewError(err.Error(), 500)
@@ -49,7 +50,7 @@ func (s *Sender) SendPlainEmail(to, cc []string, subject, data string, files []s
 	return nil
 }
 
-func (s *Sender) writeEmail(to, cc []string, ct, subj, body string, files []string) string {
+func (s *Sender) writeEmail(to, cc []string, ct, subj, body string, attachments []Attachment) string {
 	// Define variables.
 	var message string
 	var encodedBody bytes.Buffer
@@ -84,8 +85,23 @@ func (s *Sender) writeEmail(to, cc []string, ct, subj, body string, files []stri
 	message += fmt.Sprintf("--%s\r\n", delimiter)
 	message += fmt.Sprintf("Content-Transfer-Encoding: quoted-printable\r\n")
 	message += fmt.Sprintf("Content-Type: %s; charset=\"utf-8\"\r\n", ct)
-	message += fmt.Sprintf("Content-Disposition: inline\r\n")
+	message += fmt.Sprintf("Content-Disposition: inline\r\n\r\n")
 	message += fmt.Sprintf("%s\r\n", body)
+
+	// Add attachments, base64 encoded in lines of 76 characters.
+	for _, attachment := range attachments {
+		encoded := base64.StdEncoding.EncodeToString(attachment.Content)
+		message += fmt.Sprintf("--%s\r\n", delimiter)
+		message += fmt.Sprintf("Content-Type: %s; name=\"%s\"\r\n", attachment.ContentType, attachment.Filename)
+		message += fmt.Sprintf("Content-Transfer-Encoding: base64\r\n")
+		message += fmt.Sprintf("Content-Disposition: attachment; filename=\"%s\"\r\n\r\n", attachment.Filename)
+		for len(encoded) > 76 {
+			message += encoded[:76] + "\r\n"
+			encoded = encoded[76:]
+		}
+		message += encoded + "\r\n"
+	}
+	message += fmt.Sprintf("--%s--\r\n", delimiter)
 	return message
 }
 
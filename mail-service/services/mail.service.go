@@ -45,7 +45,7 @@ func (m MailService) SendRegisterConfirmationEmail(accountConfirmation domains.A
 		ConfirmMailLink{
 			Link: "http://localhost:4200/confirm-account/" + accountConfirmation.Token,
 		},
-		[]string{}); err != nil {
+		[]domains.Attachment{}); err != nil {
 		m.logger.LogError("mail-service", fmt.Sprintf("Error while sending email to %v", accountConfirmation.Email))
 		return err
 	}
@@ -66,7 +66,7 @@ func (m MailService) SendPasswordReset(requestResetPassword domains.RequestReset
 		ConfirmMailLink{
 			Link: "http://localhost:4200/reset-password/" + requestResetPassword.Token,
 		},
-		[]string{}); err != nil {
+		[]domains.Attachment{}); err != nil {
 		m.logger.LogError("mail-service", fmt.Sprintf("Error while sending email to %v", requestResetPassword.Email))
 
 		return err
@@ -85,7 +85,7 @@ func (m MailService) SendNotification(mailNotification domains.NotificationMail)
 		[]string{},
 		"Notification",
 		mailNotification,
-		[]string{}); err != nil {
+		mailNotification.Attachments); err != nil {
 		m.logger.LogError("mail-service", fmt.Sprintf("Error while sending email to %v", mailNotification.Email))
 		return err
 	}
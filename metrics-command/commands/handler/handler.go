@@ -91,6 +91,10 @@ func (h Handler) createUserReserved(command *user_reserved.UserReservedCommand)
 			command.UserID,
 			command.AccommodationID,
 			command.ReservedAt,
+			command.Adults,
+			command.Children,
+			command.Infants,
+			command.Pets,
 			-1),
 		nil
 }
@@ -6,12 +6,20 @@ type UserReservedCommand struct {
 	UserID          string
 	AccommodationID string
 	ReservedAt      string
+	Adults          int
+	Children        int
+	Infants         int
+	Pets            int
 }
 
-func NewCommand(userID, accommodationID, reservedAt string) commands.Command {
+func NewCommand(userID, accommodationID, reservedAt string, adults, children, infants, pets int) commands.Command {
 	return &UserReservedCommand{
 		UserID:          userID,
 		AccommodationID: accommodationID,
 		ReservedAt:      reservedAt,
+		Adults:          adults,
+		Children:        children,
+		Infants:         infants,
+		Pets:            pets,
 	}
 }
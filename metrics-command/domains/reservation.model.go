@@ -4,4 +4,8 @@ type Reservation struct {
 	UserID          string `json:"userID"`
 	AccommodationID string `json:"accommodationID"`
 	ReservedAt      string `json:"reservedAt"`
+	Adults          int    `json:"adults"`
+	Children        int    `json:"children"`
+	Infants         int    `json:"infants"`
+	Pets            int    `json:"pets"`
 }
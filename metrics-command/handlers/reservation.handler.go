@@ -28,7 +28,7 @@ func (h ReservationHandler) CreateReserved(w http.ResponseWriter, r *http.Reques
 		utils.WriteErrorResp(err.Error(), 400, "api/metrics/joinedAt", w)
 		return
 	}
-	command := user_reserved.NewCommand(req.UserID, req.AccommodationID, req.ReservedAt)
+	command := user_reserved.NewCommand(req.UserID, req.AccommodationID, req.ReservedAt, req.Adults, req.Children, req.Infants, req.Pets)
 	err = h.handler.Handle(command)
 	if err != nil {
 		log.Println(err)
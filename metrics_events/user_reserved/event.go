@@ -9,15 +9,23 @@ type Event struct {
 	UserID                  string
 	AccommodationID         string
 	ReservedAt              string
+	Adults                  int
+	Children                int
+	Infants                 int
+	Pets                    int
 	expectedLastEventNumber int64
 	number                  uint64
 }
 
-func NewEvent(userID, accommodationID, reservedAt string, expectedLastEventNumber int64) metrics_events.Event {
+func NewEvent(userID, accommodationID, reservedAt string, adults, children, infants, pets int, expectedLastEventNumber int64) metrics_events.Event {
 	return &Event{
 		UserID:                  userID,
 		AccommodationID:         accommodationID,
 		ReservedAt:              reservedAt,
+		Adults:                  adults,
+		Children:                children,
+		Infants:                 infants,
+		Pets:                    pets,
 		expectedLastEventNumber: expectedLastEventNumber,
 	}
 }
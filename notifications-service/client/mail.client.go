@@ -12,6 +12,7 @@ import (
 type MailNotification struct {
 	Text string `json:"text"`
 	Email string `json:"email"`
+	Attachments []domains.Attachment `json:"attachments,omitempty"`
 }
 
 type MailClient struct {
@@ -51,6 +52,7 @@ func (mc MailClient) SendMailNotification(notification domains.Notification, ema
 	req := MailNotification{
 		Email: email,
 		Text: notification.Text,
+		Attachments: notification.Attachments,
 	}
 	requestURL := mc.address + "/send-notification-information"
 	res, err := mc.request(http.MethodPost, requestURL, req)
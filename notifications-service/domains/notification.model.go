@@ -12,6 +12,14 @@ type Notification struct {
 	Text string `json:"text"`
 	CreatedAt string `json:"createdAt"`
 	IsOpened bool `json:"isOpened"`
+	// Attachments are only mailed along, they aren't stored with the notification.
+	Attachments []Attachment `json:"attachments,omitempty" bson:"-"`
+}
+
+type Attachment struct {
+	Filename string `json:"filename"`
+	ContentType string `json:"contentType"`
+	Content []byte `json:"content"`
 }
 
 type UserNotificationDTO struct {
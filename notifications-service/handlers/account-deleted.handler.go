@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	events "example/saga/delete_user"
+	saga "example/saga/messaging"
+	"fmt"
+	"notifications-service/config"
+	"notifications-service/services"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// AccountDeletedHandler drops the notifications of accounts deleted in user-service.
+type AccountDeletedHandler struct {
+	service *services.NotificationService
+	tracer  trace.Tracer
+	logger  *config.Logger
+}
+
+func NewAccountDeletedHandler(service *services.NotificationService, subscriber saga.Subscriber, tracer trace.Tracer, logger *config.Logger) (*AccountDeletedHandler, error) {
+	handler := &AccountDeletedHandler{
+		service: service,
+		tracer:  tracer,
+		logger:  logger,
+	}
+	if err := saga.Subscribe(subscriber, handler.handle); err != nil {
+		return nil, err
+	}
+	return handler, nil
+}
+
+func (ah AccountDeletedHandler) handle(ctx context.Context, event *events.AccountDeleted) error {
+	ctx, span := ah.tracer.Start(ctx, "AccountDeletedHandler.handle")
+	defer span.End()
+	if err := ah.service.DeleteUserNotifications(ctx, event.UserID); err != nil {
+		ah.logger.LogError("account-deleted-handler", fmt.Sprintf("Unable to delete notifications of user %s: %s", event.UserID, err.GetErrorMessage()))
+		return errors.New(err.GetErrorMessage())
+	}
+	return nil
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"example/saga/messaging/nats"
 	"log"
 	"net/http"
 	"notifications-service/client"
@@ -13,6 +14,7 @@ import (
 
 	"os"
 	"os/signal"
+	"syscall"
 	"time"
 
 	gorillaHandlers "github.com/gorilla/handlers"
@@ -89,10 +91,26 @@ func main() {
 	notificationRepository := repository.NewNotificationRepository(mongoService.GetCli(), logger, tracer)
 	notificationService := services.NewNotificationService(notificationRepository, mailClient, userClient, logger, tracer)
 	notificationHandler := handlers.NewNotificationHandler(notificationService, tracer)
+	accountDeletedSubscriber, err := nats.NewSubscriber(
+		os.Getenv("MESSAGING_DRIVER"),
+		os.Getenv("NATS_HOST"),
+		os.Getenv("NATS_PORT"),
+		os.Getenv("NATS_USER"),
+		os.Getenv("NATS_PASS"),
+		os.Getenv("ACCOUNT_DELETED_SUBJECT"),
+		"notifications-service")
+	if err != nil {
+		log.Fatal(err)
+	}
+	_, err = handlers.NewAccountDeletedHandler(notificationService, accountDeletedSubscriber, tracer, logger)
+	if err != nil {
+		log.Fatal(err)
+	}
 
 	// router definitions
 
 	router := mux.NewRouter()
+	router.HandleFunc("/health", nats.HealthHandler).Methods("GET")
 	router.HandleFunc("/create-new-user-notification/{id}", notificationHandler.CreateNewUserNotification).Methods("POST")
 	router.HandleFunc("/{id}", notificationHandler.CreateNewNotificationForUser).Methods("POST")
 	router.HandleFunc("/{id}", notificationHandler.ReadAllNotifications).Methods("PUT")
@@ -123,16 +141,24 @@ func main() {
 		}
 	}()
 
-	sigCh := make(chan os.Signal)
+	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, os.Interrupt)
 	signal.Notify(sigCh, os.Kill)
+	signal.Notify(sigCh, syscall.SIGTERM)
 
 	sig := <-sigCh
 	logger.Println("Received terminate, graceful shutdown", sig)
 
 	//Try to shutdown gracefully
-	if server.Shutdown(timeoutContext) != nil {
-		logger.Fatalln(err.Error())
+	shutdownContext, cancelShutdown := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancelShutdown()
+	shutdownErr := server.Shutdown(shutdownContext)
+	// Handlers still running finish and buffered messages go out before the connection closes.
+	if err := nats.Drain(); err != nil {
+		logger.Println("Cannot drain messaging connections", err)
+	}
+	if shutdownErr != nil {
+		logger.Fatalln(shutdownErr.Error())
 	}
 	logger.Println("Server stopped")
 
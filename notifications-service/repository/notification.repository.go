@@ -92,3 +92,21 @@ func (nr NotificationRepository) UpdateNotificationByID(ctx context.Context, use
 	nr.logger.LogInfo("notifications-repository", "Updating user notifications.")
 	return userNotification, nil
 }
+
+func (nr NotificationRepository) DeleteUserNotificationByID(ctx context.Context, id string) *errors.ErrorStruct {
+	ctx, span := nr.tracer.Start(ctx, "NotificationRepository.DeleteUserNotificationByID")
+	defer span.End()
+	notificationCollection := nr.cli.Database("notifications").Collection("notifications")
+	primitiveObjectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		nr.logger.LogError("notification-repository", err.Error())
+		return errors.NewError(err.Error(), 400)
+	}
+	_, err = notificationCollection.DeleteOne(ctx, bson.M{"_id": primitiveObjectID})
+	if err != nil {
+		nr.logger.LogError("notification-repository", err.Error())
+		return errors.NewError(err.Error(), 500)
+	}
+	nr.logger.LogInfo("notifications-repository", "Deleted user notifications.")
+	return nil
+}
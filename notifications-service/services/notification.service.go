@@ -114,6 +114,14 @@ func (ns NotificationService) FindAllNotificationsByID(ctx context.Context, id s
 	}, nil
 }
 
+// DeleteUserNotifications drops the notifications of a deleted account.
+func (ns NotificationService) DeleteUserNotifications(ctx context.Context, id string) *errors.ErrorStruct {
+	ctx, span := ns.tracer.Start(ctx, "NotificationService.DeleteUserNotifications")
+	defer span.End()
+	ns.logger.LogInfo("notification-service", fmt.Sprintf("Deleting notifications of deleted user with id %v", id))
+	return ns.repo.DeleteUserNotificationByID(ctx, id)
+}
+
 func (ns NotificationService) makeAllNotificationsOpened(notifications *[]domains.Notification) *[]domains.Notification {
 	for i := range *notifications {
 		if (*notifications)[i].IsOpened {
@@ -31,3 +31,11 @@ type Host struct {
 type Accommodation struct {
 	ID string `json:"id"`
 }
+
+// RecomputedRating is the new average rating of a host or an accommodation after ratings were
+// removed.
+type RecomputedRating struct {
+	ID        string
+	Host      bool
+	AvgRating float64
+}
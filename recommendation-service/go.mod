@@ -1,6 +1,6 @@
 module recommendation-service
 
-go 1.21.2
+go 1.21.6
 
 require (
 	github.com/gorilla/handlers v1.5.2
@@ -9,7 +9,23 @@ require (
 )
 
 require (
-	github.com/eapache/go-resiliency v1.4.0 // indirect
+	github.com/go-logr/logr v1.4.1 // indirect
+	github.com/go-logr/stdr v1.2.2 // indirect
+	github.com/nats-io/nats.go v1.32.0 // indirect
+	github.com/nats-io/nkeys v0.4.7 // indirect
+	github.com/nats-io/nuid v1.0.1 // indirect
+	go.opentelemetry.io/otel/metric v1.22.0 // indirect
+	golang.org/x/crypto v0.18.0 // indirect
+	golang.org/x/sys v0.16.0 // indirect
+)
+
+require (
+	example/saga v1.0.0
 	github.com/felixge/httpsnoop v1.0.3 // indirect
-	github.com/sony/gobreaker v0.5.0 // indirect
+	github.com/klauspost/compress v1.17.6 // indirect
+	github.com/sony/gobreaker v0.5.0
+	go.opentelemetry.io/otel v1.22.0 // indirect
+	go.opentelemetry.io/otel/trace v1.22.0 // indirect
 )
+
+replace example/saga => ../saga
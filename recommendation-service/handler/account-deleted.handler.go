@@ -0,0 +1,33 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	events "example/saga/delete_user"
+	saga "example/saga/messaging"
+	"log"
+	"recommendation-service/services"
+)
+
+// AccountDeletedHandler removes deleted accounts from the rating graph.
+type AccountDeletedHandler struct {
+	service *services.RatingService
+}
+
+func NewAccountDeletedHandler(service *services.RatingService, subscriber saga.Subscriber) (*AccountDeletedHandler, error) {
+	handler := &AccountDeletedHandler{
+		service: service,
+	}
+	if err := saga.Subscribe(subscriber, handler.handle); err != nil {
+		return nil, err
+	}
+	return handler, nil
+}
+
+func (ah AccountDeletedHandler) handle(ctx context.Context, event *events.AccountDeleted) error {
+	if err := ah.service.DeleteUser(ctx, event.UserID, event.Role); err != nil {
+		log.Printf("Unable to delete ratings of user %s: %s", event.UserID, err.GetErrorMessage())
+		return errors.New(err.GetErrorMessage())
+	}
+	return nil
+}
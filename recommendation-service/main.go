@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"example/saga/messaging/nats"
 	"log"
 	"net/http"
 	"os"
@@ -10,6 +11,7 @@ import (
 	"recommendation-service/handler"
 	"recommendation-service/repository"
 	"recommendation-service/services"
+	"syscall"
 	"time"
 
 	gorillaHandlers "github.com/gorilla/handlers"
@@ -18,9 +20,6 @@ import (
 )
 
 func main() {
-	timeoutContext, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-
 	//os env
 	port := os.Getenv("PORT")
 
@@ -98,9 +97,25 @@ func main() {
 	recommendationRepository := repository.NewRecommendationRepository(neo4jService.GetDriver())
 	recommendationService := services.NewRecommendationService(recommendationRepository, accommodationClient)
 	recommendationHandler := handler.NewRecommendationHandler(recommendationService)
+	accountDeletedSubscriber, err := nats.NewSubscriber(
+		os.Getenv("MESSAGING_DRIVER"),
+		os.Getenv("NATS_HOST"),
+		os.Getenv("NATS_PORT"),
+		os.Getenv("NATS_USER"),
+		os.Getenv("NATS_PASS"),
+		os.Getenv("ACCOUNT_DELETED_SUBJECT"),
+		"recommendation-service")
+	if err != nil {
+		log.Fatal(err)
+	}
+	_, err = handler.NewAccountDeletedHandler(ratingService, accountDeletedSubscriber)
+	if err != nil {
+		log.Fatal(err)
+	}
 	// routes
 
 	router := mux.NewRouter()
+	router.HandleFunc("/health", nats.HealthHandler).Methods("GET")
 	router.HandleFunc("/top-rated", recommendationHandler.GetAllRecommendationsByRating).Methods("GET")
 	router.HandleFunc("/rating/accommodation/{accommodationID}/{guestID}", ratingHandler.DeleteRatingForAccommodation).Methods("DELETE")
 	router.HandleFunc("/rating/host/{id}", ratingHandler.GetAllRatingsForHost).Methods("GET")
@@ -138,15 +153,23 @@ func main() {
 		}
 	}()
 
-	sigCh := make(chan os.Signal)
+	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, os.Interrupt)
 	signal.Notify(sigCh, os.Kill)
+	signal.Notify(sigCh, syscall.SIGTERM)
 
 	sig := <-sigCh
 	log.Println("Received terminate, graceful shutdown", sig)
 
 	//Try to shutdown gracefully
-	if server.Shutdown(timeoutContext) != nil {
+	shutdownContext, cancelShutdown := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancelShutdown()
+	shutdownErr := server.Shutdown(shutdownContext)
+	// Handlers still running finish and buffered messages go out before the connection closes.
+	if err := nats.Drain(); err != nil {
+		log.Println("Cannot drain messaging connections", err)
+	}
+	if shutdownErr != nil {
 		log.Fatal("Cannot gracefully shutdown...")
 	}
 	log.Println("Server stopped")
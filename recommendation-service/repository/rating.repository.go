@@ -632,3 +632,81 @@ func (r RatingRepository) GetRatingByGuestForHost(guestID, hostID string) (*doma
 	rateHostResult := rateHost.(domains.RateHost)
 	return &rateHostResult, nil
 }
+
+// DeleteGuest removes a deleted guest with all of their ratings, and returns the new average
+// rating of everything they rated.
+func (r RatingRepository) DeleteGuest(guestID string) ([]domains.RecomputedRating, *errors.ErrorStruct) {
+	ctx := context.Background()
+	session := r.driver.NewSession(ctx, neo4j.SessionConfig{
+		DatabaseName: "neo4j",
+	})
+	defer session.Close(ctx)
+
+	data, err := session.ExecuteWrite(ctx,
+		func(transaction neo4j.ManagedTransaction) (any, error) {
+			result, err := transaction.Run(ctx,
+				`MATCH (g:Guest {id: $guestId})
+				OPTIONAL MATCH (g)-[:RATED]->(rated)
+				WITH g, COLLECT(DISTINCT rated) AS rated
+				DETACH DELETE g
+				WITH rated
+				UNWIND rated AS n
+				OPTIONAL MATCH (n)<-[r:RATED]-()
+				WITH n, COALESCE(AVG(r.rate), 0.0) AS avgRating
+				FOREACH (_ IN CASE WHEN n:Accommodation THEN [1] ELSE [] END | SET n.averageRating = avgRating)
+				FOREACH (_ IN CASE WHEN n:Host THEN [1] ELSE [] END | SET n.avgRating = avgRating)
+				RETURN n.id AS id, n:Host AS host, avgRating`,
+				map[string]any{
+					"guestId": guestID,
+				})
+			if err != nil {
+				return nil, err
+			}
+			var recomputed []domains.RecomputedRating
+			for result.Next(ctx) {
+				record := result.Record()
+				id, _ := record.Get("id")
+				host, _ := record.Get("host")
+				avgRating, _ := record.Get("avgRating")
+				recomputed = append(recomputed, domains.RecomputedRating{
+					ID:        id.(string),
+					Host:      host.(bool),
+					AvgRating: avgRating.(float64),
+				})
+			}
+			return recomputed, result.Err()
+		})
+
+	if err != nil {
+		return nil, errors.NewError(err.Error(), 500)
+	}
+	return data.([]domains.RecomputedRating), nil
+}
+
+// DeleteHost removes a deleted host together with the ratings they received.
+func (r RatingRepository) DeleteHost(hostID string) *errors.ErrorStruct {
+	ctx := context.Background()
+	session := r.driver.NewSession(ctx, neo4j.SessionConfig{
+		DatabaseName: "neo4j",
+	})
+	defer session.Close(ctx)
+
+	_, err := session.ExecuteWrite(ctx,
+		func(transaction neo4j.ManagedTransaction) (any, error) {
+			result, err := transaction.Run(ctx,
+				`MATCH (h:Host {id: $hostId})
+				DETACH DELETE h`,
+				map[string]any{
+					"hostId": hostID,
+				})
+			if err != nil {
+				return nil, err
+			}
+			return result.Consume(ctx)
+		})
+
+	if err != nil {
+		return errors.NewError(err.Error(), 500)
+	}
+	return nil
+}
@@ -139,3 +139,26 @@ func (rs RatingService) GetRatingByGuestForHost(guestID, hostID string) (*domain
 	}
 	return rate, nil
 }
+
+// DeleteUser removes what is kept of a deleted account. The averages of everything a deleted
+// guest rated are sent out again, as if each rating was deleted on its own.
+func (rs RatingService) DeleteUser(ctx context.Context, userID, role string) *errors.ErrorStruct {
+	if role != "Guest" {
+		return rs.repo.DeleteHost(userID)
+	}
+	recomputed, err := rs.repo.DeleteGuest(userID)
+	if err != nil {
+		return err
+	}
+	for _, rating := range recomputed {
+		if rating.Host {
+			err = rs.userClient.SendNewRatingForUser(ctx, rating.AvgRating, rating.ID)
+		} else {
+			err = rs.accommodationClient.SendNewRatingForAccommodation(ctx, rating.AvgRating, rating.ID)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
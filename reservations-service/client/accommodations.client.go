@@ -0,0 +1,67 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reservation-service/domain"
+	"reservation-service/errors"
+
+	"github.com/sony/gobreaker"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type AccommodationsClient struct {
+	address        string
+	client         *http.Client
+	circuitBreaker *gobreaker.CircuitBreaker
+	tracer         trace.Tracer
+}
+
+type accommodationResponse struct {
+	Status int                  `json:"status"`
+	Data   domain.Accommodation `json:"data"`
+}
+
+func NewAccommodationsClient(host, port string, client *http.Client, circuitBreaker *gobreaker.CircuitBreaker, tracer trace.Tracer) *AccommodationsClient {
+	return &AccommodationsClient{
+		address:        fmt.Sprintf("http://%s:%s", host, port),
+		client:         client,
+		circuitBreaker: circuitBreaker,
+		tracer:         tracer,
+	}
+}
+
+// GetAccommodation fetches the booking rules of an accommodation.
+func (ac AccommodationsClient) GetAccommodation(ctx context.Context, id string) (*domain.Accommodation, *errors.ReservationError) {
+	ctx, span := ac.tracer.Start(ctx, "AccommodationsClient.GetAccommodation")
+	defer span.End()
+	cbResp, err := ac.circuitBreaker.Execute(func() (interface{}, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, ac.address+"/"+id, http.NoBody)
+		if err != nil {
+			return nil, err
+		}
+		return ac.client.Do(req)
+	})
+	if err != nil {
+		return nil, errors.NewReservationError(503, "Accommodations service is unavailable")
+	}
+	resp := cbResp.(*http.Response)
+	defer resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 400 {
+		baseResp := accommodationResponse{}
+		if err := json.NewDecoder(resp.Body).Decode(&baseResp); err != nil {
+			return nil, errors.NewReservationError(500, err.Error())
+		}
+		return &baseResp.Data, nil
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, errors.NewReservationError(404, "Accommodation not found")
+	}
+	baseResp := domain.BaseErrorHttpResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(&baseResp); err != nil {
+		return nil, errors.NewReservationError(500, err.Error())
+	}
+	return nil, errors.NewReservationError(resp.StatusCode, baseResp.Error)
+}
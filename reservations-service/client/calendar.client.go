@@ -0,0 +1,116 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+// maxCalendarSize is the largest calendar feed that is read, a bigger one is refused.
+const maxCalendarSize = 5 << 20
+
+type CalendarClient struct {
+	client *http.Client
+	// allowLocal lets feeds be served over http and from local and private addresses.
+	allowLocal bool
+}
+
+// NewCalendarClient creates a client for calendar feeds. Feed URLs come from hosts, so the
+// client only connects to public addresses and doesn't go through a proxy, whatever the host
+// names of the feeds resolve to when they are fetched. allowLocal lifts these limits for feeds
+// served locally, in development and tests, and must stay off in production.
+func NewCalendarClient(timeout time.Duration, allowLocal bool) *CalendarClient {
+	dialer := &net.Dialer{Timeout: 10 * time.Second, KeepAlive: 30 * time.Second, Control: dialPublic}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	if allowLocal {
+		dialer.Control = nil
+	}
+	transport.DialContext = dialer.DialContext
+	return &CalendarClient{
+		allowLocal: allowLocal,
+		client: &http.Client{
+			Timeout:   timeout,
+			Transport: transport,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				if req.URL.Scheme != "https" && !allowLocal {
+					return fmt.Errorf("calendar feed redirected to %s, only https is followed", req.URL.Scheme)
+				}
+				if len(via) >= 5 {
+					return fmt.Errorf("calendar feed redirected too often")
+				}
+				return nil
+			},
+		},
+	}
+}
+
+// CheckURL tells whether a calendar feed URL may be registered: it must be an https URL of a
+// host that resolves to public addresses only. A client that allows local feeds takes any http
+// or https URL.
+func (cc CalendarClient) CheckURL(ctx context.Context, feedURL string) error {
+	parsed, err := url.Parse(feedURL)
+	if cc.allowLocal && err == nil && (parsed.Scheme == "http" || parsed.Scheme == "https") && parsed.Hostname() != "" {
+		return nil
+	}
+	if err != nil || parsed.Scheme != "https" || parsed.Hostname() == "" {
+		return fmt.Errorf("calendar feed URL must be an https URL")
+	}
+	addresses, err := net.DefaultResolver.LookupIPAddr(ctx, parsed.Hostname())
+	if err != nil {
+		return fmt.Errorf("unable to resolve calendar feed host %s", parsed.Hostname())
+	}
+	for _, address := range addresses {
+		if !isPublic(address.IP) {
+			return fmt.Errorf("calendar feed host %s is not a public host", parsed.Hostname())
+		}
+	}
+	return nil
+}
+
+// FetchCalendar downloads an iCalendar feed published by another platform.
+func (cc CalendarClient) FetchCalendar(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/calendar")
+	resp, err := cc.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("calendar feed %s responded with status %d", url, resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxCalendarSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > maxCalendarSize {
+		return nil, fmt.Errorf("calendar feed %s is larger than %d bytes", url, maxCalendarSize)
+	}
+	return body, nil
+}
+
+// dialPublic refuses to connect to an address that isn't public.
+func dialPublic(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || !isPublic(ip) {
+		return fmt.Errorf("calendar feed address %s is not public", host)
+	}
+	return nil
+}
+
+func isPublic(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast())
+}
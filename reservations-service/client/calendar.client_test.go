@@ -0,0 +1,101 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testCalendar = "BEGIN:VCALENDAR\r\nEND:VCALENDAR\r\n"
+
+func serveCalendar(t *testing.T, status int, body string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.WriteHeader(status)
+		_, _ = rw.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestFetchCalendarReadsFeed(t *testing.T) {
+	srv := serveCalendar(t, http.StatusOK, testCalendar)
+	cc := &CalendarClient{client: srv.Client()}
+	body, err := cc.FetchCalendar(context.Background(), srv.URL)
+	if err != nil {
+		t.Fatalf("fetching calendar: %v", err)
+	}
+	if string(body) != testCalendar {
+		t.Fatalf("got %q, want %q", body, testCalendar)
+	}
+}
+
+func TestFetchCalendarRefusesFailedResponse(t *testing.T) {
+	srv := serveCalendar(t, http.StatusNotFound, "")
+	cc := &CalendarClient{client: srv.Client()}
+	if _, err := cc.FetchCalendar(context.Background(), srv.URL); err == nil {
+		t.Fatal("fetching a missing calendar succeeded")
+	}
+}
+
+func TestFetchCalendarRefusesOversizedFeed(t *testing.T) {
+	srv := serveCalendar(t, http.StatusOK, strings.Repeat("x", maxCalendarSize+1))
+	cc := &CalendarClient{client: srv.Client()}
+	if _, err := cc.FetchCalendar(context.Background(), srv.URL); err == nil {
+		t.Fatal("fetching an oversized calendar succeeded")
+	}
+}
+
+func TestFetchCalendarRefusesLoopbackAddress(t *testing.T) {
+	srv := serveCalendar(t, http.StatusOK, testCalendar)
+	cc := NewCalendarClient(5*time.Second, false)
+	if _, err := cc.FetchCalendar(context.Background(), srv.URL); err == nil {
+		t.Fatal("fetching a calendar from a loopback address succeeded")
+	}
+}
+
+func TestCheckURL(t *testing.T) {
+	cc := NewCalendarClient(5*time.Second, false)
+	tests := []struct {
+		url   string
+		valid bool
+	}{
+		{"https://1.1.1.1/calendar.ics", true},
+		{"http://1.1.1.1/calendar.ics", false},
+		{"ftp://1.1.1.1/calendar.ics", false},
+		{"https:///calendar.ics", false},
+		{"https://127.0.0.1/calendar.ics", false},
+		{"https://localhost/calendar.ics", false},
+		{"https://10.0.0.5/calendar.ics", false},
+		{"https://192.168.1.1/calendar.ics", false},
+		{"https://169.254.169.254/latest/meta-data", false},
+		{"https://[::1]/calendar.ics", false},
+		{"https://0.0.0.0/calendar.ics", false},
+	}
+	for _, tt := range tests {
+		err := cc.CheckURL(context.Background(), tt.url)
+		if tt.valid && err != nil {
+			t.Errorf("CheckURL(%q) = %v, want it accepted", tt.url, err)
+		}
+		if !tt.valid && err == nil {
+			t.Errorf("CheckURL(%q) accepted it, want it refused", tt.url)
+		}
+	}
+}
+
+func TestLocalFeedsWhenAllowed(t *testing.T) {
+	srv := serveCalendar(t, http.StatusOK, testCalendar)
+	cc := NewCalendarClient(5*time.Second, true)
+	if err := cc.CheckURL(context.Background(), srv.URL+"/calendar.ics"); err != nil {
+		t.Fatalf("CheckURL(%q) = %v, want it accepted", srv.URL, err)
+	}
+	if err := cc.CheckURL(context.Background(), "ftp://localhost/calendar.ics"); err == nil {
+		t.Fatal("CheckURL accepted an ftp URL")
+	}
+	if _, err := cc.FetchCalendar(context.Background(), srv.URL); err != nil {
+		t.Fatalf("fetching a local calendar: %v", err)
+	}
+}
@@ -24,6 +24,10 @@ type ReservationMetrics struct {
 	UserID          string `json:"userId"`
 	AccommodationID string `json:"accommodationId"`
 	ReservedAt      string `json:"reservedAt"`
+	Adults          int    `json:"adults"`
+	Children        int    `json:"children"`
+	Infants         int    `json:"infants"`
+	Pets            int    `json:"pets"`
 }
 
 func NewMetricsClient(host, port string, client *http.Client, circuitBreaker *gobreaker.CircuitBreaker) *MetricsClient {
@@ -33,7 +37,7 @@ func NewMetricsClient(host, port string, client *http.Client, circuitBreaker *go
 		circuitBreaker: circuitBreaker,
 	}
 }
-func (mc MetricsClient) SendReserved(ctx context.Context, userID, accommodationID string) *errors.ReservationError {
+func (mc MetricsClient) SendReserved(ctx context.Context, userID, accommodationID string, guests domain.Guests) *errors.ReservationError {
 	log.Println(fmt.Sprintf("vrednosti: %v %v", userID, accommodationID))
 
 	now := time.Now()
@@ -44,6 +48,10 @@ func (mc MetricsClient) SendReserved(ctx context.Context, userID, accommodationI
 		UserID:          userID,
 		AccommodationID: accommodationID,
 		ReservedAt:      formattedTime,
+		Adults:          guests.Adults,
+		Children:        guests.Children,
+		Infants:         guests.Infants,
+		Pets:            guests.Pets,
 	}
 	jsonData, err := json.Marshal(metrics)
 	if err != nil {
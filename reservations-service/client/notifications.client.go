@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"reservation-service/domain"
 	"time"
 
 	"github.com/sony/gobreaker"
@@ -21,6 +22,8 @@ type ReservationNotification struct {
 	Text      string `json:"text"`
 	CreatedAt string `json:"createdAt"`
 	IsOpened  bool   `json:"isOpened"`
+	// Attachments are mailed along with the notification, they aren't stored.
+	Attachments []domain.Document `json:"attachments,omitempty"`
 }
 
 func NewNotificationClient(host, port string, client *http.Client, circuitBreaker *gobreaker.CircuitBreaker) *NotificationClient {
@@ -79,3 +82,80 @@ func (nc NotificationClient) SendReservationCanceledNotification(ctx context.Con
 		return
 	}
 }
+
+func (nc NotificationClient) SendReservationModifiedNotification(ctx context.Context, userId, message string) {
+	req := ReservationNotification{
+		Text:      message,
+		CreatedAt: time.Now().String(),
+		IsOpened:  false,
+	}
+	reqURL := nc.address + "/" + userId
+	res, err := nc.request(http.MethodPost, reqURL, req)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		log.Println("Modification notification rejected with status", res.StatusCode)
+	}
+}
+
+func (nc NotificationClient) SendWaitlistNotification(ctx context.Context, userId, message string) {
+	req := ReservationNotification{
+		Text:      message,
+		CreatedAt: time.Now().String(),
+		IsOpened:  false,
+	}
+	reqURL := nc.address + "/" + userId
+	res, err := nc.request(http.MethodPost, reqURL, req)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 300 {
+		log.Println("Waitlist notification rejected with status", res.StatusCode)
+	}
+}
+
+func (nc NotificationClient) SendReminderNotification(ctx context.Context, userId, message string) {
+	req := ReservationNotification{
+		Text:      message,
+		CreatedAt: time.Now().String(),
+		IsOpened:  false,
+	}
+	reqURL := nc.address + "/" + userId
+	res, err := nc.request(http.MethodPost, reqURL, req)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 300 {
+		log.Println("Reminder notification rejected with status", res.StatusCode)
+	}
+}
+
+// SendReservationConfirmation notifies the guest that the reservation is confirmed and mails
+// the confirmation document along.
+func (nc NotificationClient) SendReservationConfirmation(ctx context.Context, userId, message string, confirmation *domain.Document) {
+	req := ReservationNotification{
+		Text:        message,
+		CreatedAt:   time.Now().String(),
+		IsOpened:    false,
+		Attachments: []domain.Document{*confirmation},
+	}
+	reqURL := nc.address + "/" + userId
+	res, err := nc.request(http.MethodPost, reqURL, req)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 300 {
+		log.Println("Confirmation notification rejected with status", res.StatusCode)
+		return
+	}
+	log.Println("Confirmation for reservation has been sent")
+}
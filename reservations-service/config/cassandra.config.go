@@ -0,0 +1,143 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type CassandraConfig struct {
+	Hosts []string
+	// DataCenterReplication maps data center names to their replication factor. When it is empty
+	// the keyspace uses SimpleStrategy with ReplicationFactor.
+	DataCenterReplication map[string]int
+	ReplicationFactor     int
+	Keyspace              string
+	LocalDataCenter       string
+	ReadConsistency       string
+	WriteConsistency      string
+	RetryAttempts         int
+	RetryMinBackoff       time.Duration
+	RetryMaxBackoff       time.Duration
+	ReconnectInterval     time.Duration
+	ReconnectAttempts     int
+	Timeout               time.Duration
+	Username              string
+	Password              string
+	TLSCAPath             string
+	TLSCertPath           string
+	TLSKeyPath            string
+	TLSSkipVerify         bool
+}
+
+// GetCassandraConfig reads the Cassandra settings from the environment. CASS_DB may hold a comma
+// separated list of contact points and CASS_REPLICATION a list of dc:factor pairs, e.g. "dc1:3,dc2:3".
+func GetCassandraConfig() (CassandraConfig, error) {
+	cfg := CassandraConfig{
+		Keyspace:         getEnv("CASS_KEYSPACE", "reservation"),
+		LocalDataCenter:  os.Getenv("CASS_LOCAL_DC"),
+		ReadConsistency:  getEnv("CASS_READ_CONSISTENCY", "LOCAL_ONE"),
+		WriteConsistency: getEnv("CASS_WRITE_CONSISTENCY", "LOCAL_QUORUM"),
+		Username:         os.Getenv("CASS_USER"),
+		Password:         os.Getenv("CASS_PASS"),
+		TLSCAPath:        os.Getenv("CASS_TLS_CA"),
+		TLSCertPath:      os.Getenv("CASS_TLS_CERT"),
+		TLSKeyPath:       os.Getenv("CASS_TLS_KEY"),
+	}
+	for _, host := range strings.Split(os.Getenv("CASS_DB"), ",") {
+		if host = strings.TrimSpace(host); host != "" {
+			cfg.Hosts = append(cfg.Hosts, host)
+		}
+	}
+	if len(cfg.Hosts) == 0 {
+		return cfg, fmt.Errorf("CASS_DB must hold at least one contact point")
+	}
+
+	if replication := os.Getenv("CASS_REPLICATION"); replication != "" {
+		cfg.DataCenterReplication = make(map[string]int)
+		for _, pair := range strings.Split(replication, ",") {
+			dc, factor, found := strings.Cut(strings.TrimSpace(pair), ":")
+			value, err := strconv.Atoi(factor)
+			if !found || err != nil || dc == "" || value < 1 {
+				return cfg, fmt.Errorf("invalid CASS_REPLICATION entry %q, expected dc:factor", pair)
+			}
+			cfg.DataCenterReplication[dc] = value
+		}
+	}
+
+	var err error
+	if cfg.ReplicationFactor, err = getEnvInt("CASS_REPLICATION_FACTOR", 1); err != nil {
+		return cfg, err
+	}
+	if cfg.RetryAttempts, err = getEnvInt("CASS_RETRY_ATTEMPTS", 3); err != nil {
+		return cfg, err
+	}
+	if cfg.ReconnectAttempts, err = getEnvInt("CASS_RECONNECT_ATTEMPTS", 10); err != nil {
+		return cfg, err
+	}
+	if cfg.RetryMinBackoff, err = getEnvDuration("CASS_RETRY_MIN_BACKOFF", 100*time.Millisecond); err != nil {
+		return cfg, err
+	}
+	if cfg.RetryMaxBackoff, err = getEnvDuration("CASS_RETRY_MAX_BACKOFF", 2*time.Second); err != nil {
+		return cfg, err
+	}
+	if cfg.ReconnectInterval, err = getEnvDuration("CASS_RECONNECT_INTERVAL", time.Second); err != nil {
+		return cfg, err
+	}
+	if cfg.Timeout, err = getEnvDuration("CASS_TIMEOUT", 5*time.Second); err != nil {
+		return cfg, err
+	}
+	cfg.TLSSkipVerify = os.Getenv("CASS_TLS_SKIP_VERIFY") == "true"
+	return cfg, nil
+}
+
+// ReplicationOptions renders the replication map of the keyspace's CREATE KEYSPACE statement.
+func (c CassandraConfig) ReplicationOptions() string {
+	if len(c.DataCenterReplication) == 0 {
+		return fmt.Sprintf("{'class' : 'SimpleStrategy', 'replication_factor' : %d}", c.ReplicationFactor)
+	}
+	dataCenters := make([]string, 0, len(c.DataCenterReplication))
+	for dc := range c.DataCenterReplication {
+		dataCenters = append(dataCenters, dc)
+	}
+	sort.Strings(dataCenters)
+	options := []string{"'class' : 'NetworkTopologyStrategy'"}
+	for _, dc := range dataCenters {
+		options = append(options, fmt.Sprintf("'%s' : %d", dc, c.DataCenterReplication[dc]))
+	}
+	return "{" + strings.Join(options, ", ") + "}"
+}
+
+func getEnv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func getEnvInt(key string, fallback int) (int, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback, nil
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be a number: %w", key, err)
+	}
+	return parsed, nil
+}
+
+func getEnvDuration(key string, fallback time.Duration) (time.Duration, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback, nil
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be a duration: %w", key, err)
+	}
+	return parsed, nil
+}
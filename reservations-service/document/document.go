@@ -0,0 +1,184 @@
+// Package document renders booking confirmations and invoices from the reservation data, as
+// HTML for the browser and as PDF for mail attachments.
+package document
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"html/template"
+	"reservation-service/domain"
+	"strings"
+	"time"
+)
+
+const dateLayout = "2006-01-02"
+
+//go:embed templates/*.html
+var templateFS embed.FS
+
+var templates = template.Must(template.ParseFS(templateFS, "templates/*.html"))
+
+// Booking is the data a document is rendered from. Payment is nil for reservations made before
+// payments were introduced, Currency is used for them.
+type Booking struct {
+	Reservation *domain.Reservation
+	Payment     *domain.Payment
+	Currency    string
+	IssuedAt    time.Time
+}
+
+type row struct {
+	Label string
+	Value string
+}
+
+type section struct {
+	Title string
+	Rows  []row
+}
+
+type page struct {
+	Title    string
+	Intro    string
+	Sections []section
+	Footer   string
+}
+
+// Render renders the confirmation or the invoice of a booking in the requested format.
+func Render(kind, format string, booking Booking) (*domain.Document, error) {
+	var p page
+	switch kind {
+	case domain.DocumentConfirmation:
+		p = confirmation(booking)
+	case domain.DocumentInvoice:
+		p = invoice(booking)
+	default:
+		return nil, fmt.Errorf("unknown document %q", kind)
+	}
+	filename := fmt.Sprintf("%s-%s", kind, booking.Reservation.Id.String())
+	switch format {
+	case domain.DocumentFormatHTML:
+		var out bytes.Buffer
+		if err := templates.ExecuteTemplate(&out, "document.html", p); err != nil {
+			return nil, err
+		}
+		return &domain.Document{Filename: filename + ".html", ContentType: "text/html; charset=utf-8", Content: out.Bytes()}, nil
+	case domain.DocumentFormatPDF:
+		return &domain.Document{Filename: filename + ".pdf", ContentType: "application/pdf", Content: WritePDF(p.Title, p.lines())}, nil
+	default:
+		return nil, fmt.Errorf("unknown document format %q", format)
+	}
+}
+
+func confirmation(b Booking) page {
+	r := b.Reservation
+	return page{
+		Title: "Booking confirmation",
+		Intro: fmt.Sprintf("Your reservation at %s is confirmed.", r.AccommodationName),
+		Sections: []section{
+			{Title: "Reservation", Rows: []row{
+				{"Confirmation number", r.Id.String()},
+				{"Guest", r.Username},
+				{"Party", r.Guests.String()},
+			}},
+			stay(r),
+			{Title: "Payment", Rows: paymentRows(b)},
+		},
+		Footer: fmt.Sprintf("Issued on %s.", b.IssuedAt.Format(dateLayout)),
+	}
+}
+
+func invoice(b Booking) page {
+	r := b.Reservation
+	return page{
+		Title: "Invoice",
+		Intro: fmt.Sprintf("Invoice %s for the reservation of %s.", InvoiceNumber(r), r.Username),
+		Sections: []section{
+			{Title: "Invoice", Rows: []row{
+				{"Invoice number", InvoiceNumber(r)},
+				{"Date of issue", b.IssuedAt.Format(dateLayout)},
+				{"Reservation", r.Id.String()},
+				{"Billed to", r.Username},
+			}},
+			stay(r),
+			{Title: "Charges", Rows: []row{
+				{fmt.Sprintf("%s, %s", r.AccommodationName, nights(r.NumberOfDays)), money(r.Price, currency(b))},
+				{"Total", money(r.Price, currency(b))},
+			}},
+			{Title: "Payment", Rows: paymentRows(b)},
+		},
+		Footer: "Thank you for your stay.",
+	}
+}
+
+// InvoiceNumber is derived from the reservation so the same invoice is issued every time.
+func InvoiceNumber(r *domain.Reservation) string {
+	return fmt.Sprintf("INV-%s-%s", strings.ReplaceAll(r.StartDate, "-", ""), strings.ToUpper(r.Id.String()[:8]))
+}
+
+func stay(r *domain.Reservation) section {
+	return section{Title: "Stay", Rows: []row{
+		{"Accommodation", r.AccommodationName},
+		{"Location", strings.TrimSuffix(fmt.Sprintf("%s, %s", r.Location, r.Country), ", ")},
+		{"Check-in", r.StartDate},
+		{"Check-out", checkOut(r.EndDate)},
+		{"Nights", fmt.Sprint(r.NumberOfDays)},
+	}}
+}
+
+func paymentRows(b Booking) []row {
+	if b.Payment == nil {
+		return []row{{"Amount", money(b.Reservation.Price, currency(b))}, {"Status", "paid at the accommodation"}}
+	}
+	p := b.Payment
+	rows := []row{
+		{"Amount", money(p.Amount, p.Currency)},
+		{"Status", p.Status},
+	}
+	if p.CapturedAmount > 0 {
+		rows = append(rows, row{"Charged", money(p.CapturedAmount, p.Currency)})
+	}
+	if p.RefundedAmount > 0 {
+		rows = append(rows, row{"Refunded", money(p.RefundedAmount, p.Currency)})
+	}
+	return rows
+}
+
+func currency(b Booking) string {
+	if b.Payment != nil {
+		return b.Payment.Currency
+	}
+	return b.Currency
+}
+
+func money(amount int, currency string) string {
+	return fmt.Sprintf("%d.00 %s", amount, currency)
+}
+
+func nights(count int) string {
+	if count == 1 {
+		return "1 night"
+	}
+	return fmt.Sprintf("%d nights", count)
+}
+
+// checkOut is the day after the last night of the stay.
+func checkOut(lastNight string) string {
+	date, err := time.Parse(dateLayout, lastNight)
+	if err != nil {
+		return lastNight
+	}
+	return date.AddDate(0, 0, 1).Format(dateLayout)
+}
+
+func (p page) lines() []PDFLine {
+	lines := []PDFLine{{Text: p.Title, Heading: true}, {}, {Text: p.Intro}}
+	for _, s := range p.Sections {
+		lines = append(lines, PDFLine{}, PDFLine{Text: s.Title, Heading: true})
+		for _, r := range s.Rows {
+			lines = append(lines, PDFLine{Text: fmt.Sprintf("%s: %s", r.Label, r.Value)})
+		}
+	}
+	return append(lines, PDFLine{}, PDFLine{Text: p.Footer})
+}
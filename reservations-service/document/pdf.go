@@ -0,0 +1,105 @@
+package document
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+const (
+	pdfPageWidth    = 595 // A4 in points
+	pdfPageHeight   = 842
+	pdfMargin       = 56
+	pdfFontSize     = 11
+	pdfLineHeight   = 16
+	pdfLinesPerPage = (pdfPageHeight - 2*pdfMargin) / pdfLineHeight
+)
+
+// PDFLine is a line of text in a generated PDF. Headings are set in bold.
+type PDFLine struct {
+	Text    string
+	Heading bool
+}
+
+// WritePDF lays out lines of text on as many A4 pages as needed, using the standard Helvetica
+// fonts so no font has to be embedded.
+func WritePDF(title string, lines []PDFLine) []byte {
+	var pages [][]PDFLine
+	for len(lines) > pdfLinesPerPage {
+		pages = append(pages, lines[:pdfLinesPerPage])
+		lines = lines[pdfLinesPerPage:]
+	}
+	pages = append(pages, lines)
+
+	// Objects 1 and 2 are the catalog and the page tree, 3 and 4 the fonts, 5 the document info.
+	// Every page then takes two objects, the page and its content stream.
+	var objects []string
+	objects = append(objects, "<< /Type /Catalog /Pages 2 0 R >>")
+	kids := make([]string, len(pages))
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 6+2*i)
+	}
+	objects = append(objects, fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)))
+	objects = append(objects, "<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	objects = append(objects, "<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	objects = append(objects, fmt.Sprintf("<< /Title (%s) /Producer (reservations-service) >>", escapePDFText(title)))
+	for i, page := range pages {
+		objects = append(objects, fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>",
+			pdfPageWidth, pdfPageHeight, 7+2*i))
+		content := pageContent(page)
+		objects = append(objects, fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(content), content))
+	}
+
+	var out bytes.Buffer
+	out.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = out.Len()
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R /Info 5 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return out.Bytes()
+}
+
+func pageContent(lines []PDFLine) string {
+	var b strings.Builder
+	b.WriteString("BT\n")
+	fmt.Fprintf(&b, "%d TL\n", pdfLineHeight)
+	fmt.Fprintf(&b, "%d %d Td\n", pdfMargin, pdfPageHeight-pdfMargin)
+	for _, line := range lines {
+		font := "F1"
+		if line.Heading {
+			font = "F2"
+		}
+		fmt.Fprintf(&b, "/%s %d Tf\n(%s) Tj\nT*\n", font, pdfFontSize, escapePDFText(line.Text))
+	}
+	b.WriteString("ET")
+	return b.String()
+}
+
+// escapePDFText escapes a string for a PDF literal. Characters outside Latin-1 can't be shown
+// with the standard fonts and are replaced.
+func escapePDFText(text string) string {
+	var b strings.Builder
+	for _, r := range text {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < 32:
+			b.WriteByte(' ')
+		case r < 128:
+			b.WriteRune(r)
+		case r < 256:
+			fmt.Fprintf(&b, "\\%03o", r)
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,27 @@
+package domain
+
+const (
+	PayingPerGuest         = "Per Guest"
+	PayingPerAccommodation = "Per Accommodation"
+	PetsAllowedConvenience = "Pets Allowed"
+)
+
+// Accommodation holds the booking rules of an accommodation as returned by accommodations-service.
+type Accommodation struct {
+	Id               string   `json:"id"`
+	UserId           string   `json:"userId"`
+	Name             string   `json:"name"`
+	Conveniences     []string `json:"conveniences"`
+	MinNumOfVisitors int      `json:"minNumOfVisitors"`
+	MaxNumOfVisitors int      `json:"maxNumOfVisitors"`
+	Paying           string   `json:"paying"`
+}
+
+func (a Accommodation) AllowsPets() bool {
+	for _, convenience := range a.Conveniences {
+		if convenience == PetsAllowedConvenience {
+			return true
+		}
+	}
+	return false
+}
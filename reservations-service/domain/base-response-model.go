@@ -6,8 +6,9 @@ type BaseHttpResponse struct {
 }
 
 type BaseErrorHttpResponse struct {
-	Status int    `json:"status"`
-	Path   string `json:"path"`
-	Time   string `json:"time"`
-	Error  string `json:"error"`
+	Status  int         `json:"status"`
+	Path    string      `json:"path"`
+	Time    string      `json:"time"`
+	Error   string      `json:"error"`
+	Details interface{} `json:"details,omitempty"`
 }
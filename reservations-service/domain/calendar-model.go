@@ -0,0 +1,77 @@
+package domain
+
+import "github.com/gocql/gocql"
+
+type DayStatus string
+
+const (
+	DayAvailable DayStatus = "available"
+	DayBooked    DayStatus = "booked"
+	DayBlocked   DayStatus = "blocked"
+	DayHeld      DayStatus = "held"
+)
+
+type BlockedDate struct {
+	AccommodationID string `json:"accommodationId"`
+	Date            string `json:"date"`
+	Reason          string `json:"reason"`
+}
+
+type CalendarDay struct {
+	Date   string    `json:"date"`
+	Status DayStatus `json:"status"`
+	Price  int       `json:"price"`
+}
+
+type AvailabilityCalendar struct {
+	AccommodationID string        `json:"accommodationId"`
+	From            string        `json:"from"`
+	To              string        `json:"to"`
+	Days            []CalendarDay `json:"days"`
+}
+
+type AvailabilityRange struct {
+	Id              gocql.UUID `json:"id"`
+	AccommodationID string     `json:"accommodationId"`
+	Location        string     `json:"location"`
+	Price           int        `json:"price"`
+	Continent       string     `json:"continent"`
+	Country         string     `json:"country"`
+	DateRange       []string   `json:"dateRange"`
+}
+
+type BlockDatesRequest struct {
+	Dates  []string `json:"dates"`
+	Reason string   `json:"reason"`
+}
+
+type SplitAvailabilityRequest struct {
+	Date string `json:"date"`
+}
+
+type MergeAvailabilityRequest struct {
+	Ids   []string `json:"ids"`
+	Price int      `json:"price"`
+}
+
+type BulkPriceRequest struct {
+	Dates []string `json:"dates"`
+	Price int      `json:"price"`
+}
+
+type AvailabilityConflict struct {
+	Dates          []string `json:"dates"`
+	ReservationIDs []string `json:"reservationIds"`
+}
+
+type CalendarFeed struct {
+	AccommodationID string `json:"accommodationId"`
+	URL             string `json:"url"`
+	LastSynced      string `json:"lastSynced"`
+}
+
+type CalendarImportResult struct {
+	BlockedDates    []string `json:"blockedDates"`
+	UnblockedDates  []string `json:"unblockedDates"`
+	ConflictedDates []string `json:"conflictedDates"`
+}
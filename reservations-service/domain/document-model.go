@@ -0,0 +1,17 @@
+package domain
+
+const (
+	DocumentConfirmation = "confirmation"
+	DocumentInvoice      = "invoice"
+
+	DocumentFormatHTML = "html"
+	DocumentFormatPDF  = "pdf"
+)
+
+// Document is a rendered booking document. It is sent as-is to the mail service as an
+// attachment, the content is base64 encoded in JSON.
+type Document struct {
+	Filename    string `json:"filename"`
+	ContentType string `json:"contentType"`
+	Content     []byte `json:"content"`
+}
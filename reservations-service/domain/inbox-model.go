@@ -0,0 +1,19 @@
+package domain
+
+import "time"
+
+const (
+	InboxProcessing = "processing"
+	InboxDone       = "done"
+)
+
+// InboxMessage is a saga command that was received. Reply holds the reply sent for it, encoded
+// as JSON, once the command was handled. Owner is the replica handling it since ClaimedAt.
+type InboxMessage struct {
+	MessageID  string    `json:"messageId"`
+	Status     string    `json:"status"`
+	Reply      string    `json:"reply"`
+	ReceivedAt time.Time `json:"receivedAt"`
+	Owner      string    `json:"owner"`
+	ClaimedAt  time.Time `json:"claimedAt"`
+}
@@ -0,0 +1,43 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+const (
+	JobCheckInReminder   = "check_in_reminder"
+	JobReviewPrompt      = "review_prompt"
+	JobExpireUnconfirmed = "expire_unconfirmed"
+	JobMarkInactive      = "mark_inactive"
+	JobRefund            = "refund"
+
+	JobPending = "pending"
+	JobRunning = "running"
+	JobDone    = "done"
+	JobFailed  = "failed"
+)
+
+// Job is a unit of work that runs once at RunAt. Jobs are stored in buckets of the hour they
+// are due in.
+type Job struct {
+	Bucket    string     `json:"bucket"`
+	RunAt     time.Time  `json:"runAt"`
+	Id        gocql.UUID `json:"id"`
+	Kind      string     `json:"kind"`
+	Payload   string     `json:"payload"`
+	Status    string     `json:"status"`
+	Attempts  int        `json:"attempts"`
+	Owner     string     `json:"owner"`
+	ClaimedAt time.Time  `json:"claimedAt"`
+	LastError string     `json:"lastError"`
+}
+
+// ReservationJob is the payload of the jobs that concern a reservation. Date is the date of the
+// stay the job was scheduled for, a job whose reservation has moved since does nothing.
+type ReservationJob struct {
+	ReservationID string `json:"reservationId"`
+	UserID        string `json:"userId"`
+	Date          string `json:"date"`
+}
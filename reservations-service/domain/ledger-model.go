@@ -0,0 +1,71 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+// Types of ledger transactions.
+const (
+	LedgerCharge     = "charge"
+	LedgerFee        = "fee"
+	LedgerPayout     = "payout"
+	LedgerRefund     = "refund"
+	LedgerAdjustment = "adjustment"
+)
+
+// Ledger accounts. The host payable account is kept per host, the platform accounts are shared.
+const (
+	AccountPlatformCash    = "platform_cash"
+	AccountHostPayable     = "host_payable"
+	AccountPlatformRevenue = "platform_revenue"
+)
+
+// LedgerEntry is one posting of a double-entry transaction. Debits are positive and credits
+// negative, so the entries of a transaction always sum up to zero.
+type LedgerEntry struct {
+	EntryID       gocql.UUID `json:"entryId"`
+	TransactionID gocql.UUID `json:"transactionId"`
+	HostID        string     `json:"hostId"`
+	ReservationID gocql.UUID `json:"reservationId"`
+	Account       string     `json:"account"`
+	Amount        int        `json:"amount"`
+	Currency      string     `json:"currency"`
+	Type          string     `json:"type"`
+	Description   string     `json:"description"`
+	CreatedAt     time.Time  `json:"createdAt"`
+}
+
+// HostBalance is what the platform owes a host, broken down by transaction type. Every amount is
+// seen from the host's side, earnings are positive and fees, refunds and payouts negative.
+type HostBalance struct {
+	HostID   string `json:"hostId"`
+	Currency string `json:"currency"`
+	Balance  int    `json:"balance"`
+	Charges  int    `json:"charges"`
+	Fees     int    `json:"fees"`
+	Refunds  int    `json:"refunds"`
+	Payouts  int    `json:"payouts"`
+	Adjusted int    `json:"adjustments"`
+}
+
+type StatementLine struct {
+	CreatedAt     time.Time  `json:"createdAt"`
+	TransactionID gocql.UUID `json:"transactionId"`
+	ReservationID gocql.UUID `json:"reservationId"`
+	Type          string     `json:"type"`
+	Description   string     `json:"description"`
+	Amount        int        `json:"amount"`
+	Balance       int        `json:"balance"`
+}
+
+type HostStatement struct {
+	HostID         string          `json:"hostId"`
+	From           string          `json:"from"`
+	To             string          `json:"to"`
+	Currency       string          `json:"currency"`
+	OpeningBalance int             `json:"openingBalance"`
+	ClosingBalance int             `json:"closingBalance"`
+	Lines          []StatementLine `json:"lines"`
+}
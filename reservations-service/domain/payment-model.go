@@ -0,0 +1,45 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+const (
+	PaymentAuthorized = "authorized"
+	// PaymentCapturedUnrecorded is a payment the provider captured whose charge is not in the
+	// ledger yet. The capture sweep books the charge and moves the payment on to captured.
+	PaymentCapturedUnrecorded = "captured_unrecorded"
+	PaymentCaptured           = "captured"
+	// PaymentAdjustmentUnrecorded is a captured payment whose captured total the provider
+	// reported differently, with the difference, its unrecorded amount, not in the ledger yet.
+	PaymentAdjustmentUnrecorded = "adjustment_unrecorded"
+	// PaymentRefundUnrecorded is a payment the provider refunded whose refund, its unrecorded
+	// amount, is not in the ledger yet. The next refund of the payment or webhook about it books
+	// the refund and moves the payment on to refunded.
+	PaymentRefundUnrecorded = "refund_unrecorded"
+	PaymentRefunded         = "refunded"
+	PaymentVoided           = "voided"
+	PaymentFailed           = "failed"
+)
+
+// Payment is the payment of a reservation. The amount is authorized when the reservation is
+// made, captured at check-in and refunded when the reservation is canceled.
+type Payment struct {
+	ReservationID    gocql.UUID `json:"reservationId"`
+	UserID           string     `json:"userId"`
+	HostID           string     `json:"hostId"`
+	AccommodationID  string     `json:"accommodationId"`
+	CheckIn          string     `json:"checkIn"`
+	Provider         string     `json:"provider"`
+	AuthorizationID  string     `json:"authorizationId"`
+	Amount           int        `json:"amount"`
+	CapturedAmount   int        `json:"capturedAmount"`
+	RefundedAmount   int        `json:"refundedAmount"`
+	UnrecordedAmount int        `json:"unrecordedAmount"`
+	Currency         string     `json:"currency"`
+	Status           string     `json:"status"`
+	CreatedAt        time.Time  `json:"createdAt"`
+	UpdatedAt        time.Time  `json:"updatedAt"`
+}
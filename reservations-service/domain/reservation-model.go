@@ -2,7 +2,9 @@ package domain
 
 import (
 	"encoding/json"
+	"fmt"
 	"io"
+	"strings"
 
 	"github.com/gocql/gocql"
 )
@@ -23,6 +25,47 @@ type Reservation struct {
 	IsActive          bool       `json:"isActive"`
 	Country           string     `json:"country"`
 	HostID            string     `json:"hostId"`
+	Guests            Guests     `json:"guests"`
+	// Status is derived from the dates when reservations are listed, it is not stored.
+	Status string `json:"status,omitempty"`
+	// PaymentToken identifies the guest's payment method at the payment provider. It is only
+	// used to authorize the payment and is never stored.
+	PaymentToken string   `json:"paymentToken,omitempty"`
+	Payment      *Payment `json:"payment,omitempty"`
+}
+
+// Guests is the party a reservation is made for. Adults and children count towards the
+// accommodation's visitor limits, infants and pets don't.
+type Guests struct {
+	Adults   int `json:"adults"`
+	Children int `json:"children"`
+	Infants  int `json:"infants"`
+	Pets     int `json:"pets"`
+}
+
+func (g Guests) Visitors() int {
+	return g.Adults + g.Children
+}
+
+func (g Guests) String() string {
+	parts := []string{plural(g.Adults, "adult", "adults")}
+	if g.Children > 0 {
+		parts = append(parts, plural(g.Children, "child", "children"))
+	}
+	if g.Infants > 0 {
+		parts = append(parts, plural(g.Infants, "infant", "infants"))
+	}
+	if g.Pets > 0 {
+		parts = append(parts, plural(g.Pets, "pet", "pets"))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func plural(count int, singular, pluralForm string) string {
+	if count == 1 {
+		return fmt.Sprintf("%d %s", count, singular)
+	}
+	return fmt.Sprintf("%d %s", count, pluralForm)
 }
 
 type FreeReservation struct {
@@ -52,6 +95,25 @@ type GetAvailabilityForAccommodation struct {
 	Id        string   `json:"id"`
 }
 
+// ModifyReservationRequest changes the dates or the party of a reservation. Fields that are left
+// out keep their current value.
+type ModifyReservationRequest struct {
+	Id        string   `json:"id"`
+	UserID    string   `json:"userId"`
+	DateRange []string `json:"dateRange"`
+	Guests    *Guests  `json:"guests,omitempty"`
+	// PaymentToken pays a price above the authorized amount, a lower price is taken from the
+	// existing authorization.
+	PaymentToken string `json:"paymentToken,omitempty"`
+}
+
+type ReservationModification struct {
+	Reservation     *Reservation `json:"reservation"`
+	OldPrice        int          `json:"oldPrice"`
+	NewPrice        int          `json:"newPrice"`
+	PriceDifference int          `json:"priceDifference"`
+}
+
 type ReservationById []*Reservation
 
 func NewReservation(id gocql.UUID, userID, accommodationID string, startDate, endDate, username, accommodationName, location string, price, numOfDays int, continent string, dateRange []string, isActive bool, country string) *Reservation {
@@ -83,3 +145,42 @@ func (ac *Reservation) FromJSON(r io.Reader) error {
 	d := json.NewDecoder(r)
 	return d.Decode(ac)
 }
+
+const (
+	ReservationUpcoming  = "upcoming"
+	ReservationOngoing   = "ongoing"
+	ReservationCompleted = "completed"
+)
+
+// ReservationFilter narrows down a list of reservations. Empty fields don't filter, From and To
+// select the stays that overlap the window. A Size of zero lists every matching reservation,
+// otherwise Size reservations are listed from where PageState, returned with the previous page,
+// left off.
+type ReservationFilter struct {
+	Status          string
+	From            string
+	To              string
+	AccommodationID string
+	Size            int
+	PageState       []byte
+}
+
+// ReservationPage is one page of a filtered list of reservations. NextPageState is empty on the
+// last page.
+type ReservationPage struct {
+	Reservations  []Reservation `json:"reservations"`
+	Size          int           `json:"size"`
+	NextPageState []byte        `json:"nextPageState,omitempty"`
+}
+
+// StayStatus tells whether the stay is still ahead, in progress or over on the given day.
+func (ac *Reservation) StayStatus(today string) string {
+	switch {
+	case ac.EndDate < today:
+		return ReservationCompleted
+	case ac.StartDate > today:
+		return ReservationUpcoming
+	default:
+		return ReservationOngoing
+	}
+}
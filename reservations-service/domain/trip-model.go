@@ -0,0 +1,61 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+const (
+	TripLegActive   = "active"
+	TripLegCanceled = "canceled"
+)
+
+// Trip books several accommodations as one. Every leg is a reservation of its own, the legs
+// are created together or not at all and can be canceled one by one.
+type Trip struct {
+	Id        gocql.UUID `json:"id"`
+	UserID    string     `json:"userId"`
+	Legs      []TripLeg  `json:"legs"`
+	Price     int        `json:"price"`
+	CreatedAt time.Time  `json:"createdAt"`
+}
+
+type TripLeg struct {
+	ReservationID     gocql.UUID `json:"reservationId"`
+	AccommodationID   string     `json:"accommodationId"`
+	AccommodationName string     `json:"accommodationName"`
+	HostID            string     `json:"hostId"`
+	Country           string     `json:"country"`
+	DateRange         []string   `json:"dateRange"`
+	Guests            Guests     `json:"guests"`
+	Price             int        `json:"price"`
+	Status            string     `json:"status"`
+	Payment           *Payment   `json:"payment,omitempty"`
+}
+
+// TripRequest holds the reservations of a trip. The legs are reservations like the ones
+// CreateReservation takes, they are all made for the requesting guest and paid with the same
+// payment token.
+type TripRequest struct {
+	Legs         []Reservation `json:"legs"`
+	PaymentToken string        `json:"paymentToken,omitempty"`
+}
+
+// TripQuote is the combined price of a trip.
+type TripQuote struct {
+	Legs     []TripLeg `json:"legs"`
+	Total    int       `json:"total"`
+	Currency string    `json:"currency"`
+}
+
+// ActivePrice is the price of the legs that aren't canceled.
+func (t *Trip) ActivePrice() int {
+	total := 0
+	for _, leg := range t.Legs {
+		if leg.Status == TripLegActive {
+			total += leg.Price
+		}
+	}
+	return total
+}
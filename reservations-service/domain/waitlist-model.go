@@ -0,0 +1,51 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+const (
+	WaitlistWaiting = "waiting"
+	WaitlistOffered = "offered"
+	WaitlistBooked  = "booked"
+	WaitlistExpired = "expired"
+)
+
+// WaitlistEntry is a guest waiting for dates of a fully booked accommodation. Entries are
+// offered the dates in the order they joined, an offered entry holds the nights until
+// HoldExpiresAt.
+type WaitlistEntry struct {
+	Id                gocql.UUID `json:"id"`
+	AccommodationID   string     `json:"accommodationId"`
+	AccommodationName string     `json:"accommodationName"`
+	UserID            string     `json:"userId"`
+	DateRange         []string   `json:"dateRange"`
+	Guests            Guests     `json:"guests"`
+	Status            string     `json:"status"`
+	HoldExpiresAt     *time.Time `json:"holdExpiresAt,omitempty"`
+}
+
+type WaitlistRequest struct {
+	AccommodationID string   `json:"accommodationId"`
+	DateRange       []string `json:"dateRange"`
+	Guests          Guests   `json:"guests"`
+}
+
+// Hold keeps a night free for the guest of a waitlist entry.
+type Hold struct {
+	AccommodationID string     `json:"accommodationId"`
+	Date            string     `json:"date"`
+	UserID          string     `json:"userId"`
+	EntryID         gocql.UUID `json:"entryId"`
+	ExpiresAt       time.Time  `json:"expiresAt"`
+}
+
+// WaitlistOffer points at an offered entry whose hold runs out at ExpiresAt.
+type WaitlistOffer struct {
+	Day             string
+	ExpiresAt       time.Time
+	AccommodationID string
+	EntryID         gocql.UUID
+}
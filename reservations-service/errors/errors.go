@@ -5,8 +5,9 @@ import (
 )
 
 type ReservationError struct {
-	Status  int    `json: "status"`
-	Message string `json: "message"`
+	Status  int         `json: "status"`
+	Message string      `json: "message"`
+	Details interface{} `json:"details"`
 }
 
 func NewReservationError(status int, message string) *ReservationError {
@@ -16,6 +17,14 @@ func NewReservationError(status int, message string) *ReservationError {
 	}
 }
 
+func NewReservationErrorWithDetails(status int, message string, details interface{}) *ReservationError {
+	return &ReservationError{
+		Status:  status,
+		Message: message,
+		Details: details,
+	}
+}
+
 func (e *ReservationError) Error() string {
 	return fmt.Sprintf("ReservationError - Status: %d, Message: %s", e.Status, e.Message)
 }
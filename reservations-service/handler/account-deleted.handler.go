@@ -0,0 +1,50 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	events "example/saga/delete_user"
+	saga "example/saga/messaging"
+	"fmt"
+	"reservation-service/config"
+	"reservation-service/service"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// AccountDeletedHandler drops what reservations-service still keeps of accounts deleted in
+// user-service: waitlist entries, the nights held for them and trip legs that haven't started.
+type AccountDeletedHandler struct {
+	waitlistService *service.WaitlistService
+	tripService     *service.TripService
+	tracer          trace.Tracer
+	logger          *config.Logger
+}
+
+func NewAccountDeletedHandler(waitlistService *service.WaitlistService, tripService *service.TripService, subscriber saga.Subscriber, tracer trace.Tracer, logger *config.Logger) (*AccountDeletedHandler, error) {
+	handler := &AccountDeletedHandler{
+		waitlistService: waitlistService,
+		tripService:     tripService,
+		tracer:          tracer,
+		logger:          logger,
+	}
+	if err := saga.Subscribe(subscriber, handler.handle); err != nil {
+		return nil, err
+	}
+	return handler, nil
+}
+
+// handle is safe to run again, entries that are gone and legs that are canceled are skipped.
+func (ah AccountDeletedHandler) handle(ctx context.Context, event *events.AccountDeleted) error {
+	ctx, span := ah.tracer.Start(ctx, "AccountDeletedHandler.handle")
+	defer span.End()
+	if err := ah.waitlistService.LeaveAll(ctx, event.UserID); err != nil {
+		ah.logger.LogError("account-deleted-handler", fmt.Sprintf("Unable to remove user %s from waitlists: %s", event.UserID, err.Message))
+		return errors.New(err.Message)
+	}
+	if err := ah.tripService.CancelPendingTrips(ctx, event.UserID); err != nil {
+		ah.logger.LogError("account-deleted-handler", fmt.Sprintf("Unable to cancel trips of user %s: %s", event.UserID, err.Message))
+		return errors.New(err.Message)
+	}
+	return nil
+}
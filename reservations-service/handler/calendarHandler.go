@@ -0,0 +1,82 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"reservation-service/domain"
+	"reservation-service/service"
+	"reservation-service/utils"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// maxImportSize bounds the body of an uploaded calendar.
+const maxImportSize = 5 << 20
+
+type CalendarHandler struct {
+	CalendarSyncService *service.CalendarSyncService
+	ReservationService  *service.ReservationService
+	Tracer              trace.Tracer
+}
+
+func (ch *CalendarHandler) ExportCalendar(rw http.ResponseWriter, r *http.Request) {
+	ctx, span := ch.Tracer.Start(r.Context(), "CalendarHandler.ExportCalendar")
+	defer span.End()
+	accommodationID := mux.Vars(r)["accommodationId"]
+	var body bytes.Buffer
+	if err := ch.CalendarSyncService.ExportCalendar(ctx, accommodationID, &body); err != nil {
+		utils.WriteErrorResp(err.Message, err.Status, "api/reservations/{accommodationId}/calendar.ics", rw)
+		return
+	}
+	rw.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	rw.Header().Set("Content-Disposition", "attachment; filename=\""+accommodationID+".ics\"")
+	rw.WriteHeader(http.StatusOK)
+	_, _ = rw.Write(body.Bytes())
+}
+
+func (ch *CalendarHandler) ImportCalendar(rw http.ResponseWriter, r *http.Request) {
+	ctx, span := ch.Tracer.Start(r.Context(), "CalendarHandler.ImportCalendar")
+	defer span.End()
+	accommodationID := mux.Vars(r)["accommodationId"]
+	if !ch.authorizeHost(ctx, r, accommodationID, "api/reservations/{accommodationId}/calendar/import", rw) {
+		return
+	}
+	result, err := ch.CalendarSyncService.ImportCalendar(ctx, accommodationID, http.MaxBytesReader(rw, r.Body, maxImportSize))
+	if err != nil {
+		utils.WriteErrorResp(err.Message, err.Status, "api/reservations/{accommodationId}/calendar/import", rw)
+		return
+	}
+	utils.WriteResp(result, 200, rw)
+}
+
+func (ch *CalendarHandler) RegisterFeed(rw http.ResponseWriter, r *http.Request) {
+	ctx, span := ch.Tracer.Start(r.Context(), "CalendarHandler.RegisterFeed")
+	defer span.End()
+	accommodationID := mux.Vars(r)["accommodationId"]
+	if !ch.authorizeHost(ctx, r, accommodationID, "api/reservations/{accommodationId}/calendar/feed", rw) {
+		return
+	}
+	var feed domain.CalendarFeed
+	if err := json.NewDecoder(r.Body).Decode(&feed); err != nil {
+		utils.WriteErrorResp(err.Error(), 400, "api/reservations/{accommodationId}/calendar/feed", rw)
+		return
+	}
+	saved, err := ch.CalendarSyncService.RegisterFeed(ctx, accommodationID, feed)
+	if err != nil {
+		utils.WriteErrorResp(err.Message, err.Status, "api/reservations/{accommodationId}/calendar/feed", rw)
+		return
+	}
+	utils.WriteResp(saved, 200, rw)
+}
+
+func (ch *CalendarHandler) authorizeHost(ctx context.Context, r *http.Request, accommodationID, path string, rw http.ResponseWriter) bool {
+	hostID, _ := r.Context().Value("userID").(string)
+	if err := ch.ReservationService.AuthorizeHost(ctx, accommodationID, hostID); err != nil {
+		utils.WriteErrorResp(err.Message, err.Status, path, rw)
+		return false
+	}
+	return true
+}
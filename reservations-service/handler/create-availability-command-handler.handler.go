@@ -8,12 +8,16 @@ import (
 	"reservation-service/config"
 	"reservation-service/domain"
 	"reservation-service/service"
+
+	"go.opentelemetry.io/otel/trace"
 )
 
 type CreateAvailabilityCommandHandler struct {
 	reservationService *service.ReservationService
 	replyPublisher     saga.Publisher
 	commandSubscriber  saga.Subscriber
+	inbox              *service.Inbox
+	tracer             trace.Tracer
 	logger             *config.Logger
 }
 
@@ -30,11 +34,13 @@ type AvailableAccommodationDates struct {
 	Price           int      `json:"price"`
 }
 
-func NewCreateAvailabilityCommandHandler(reservationService *service.ReservationService, replyPublisher saga.Publisher, commandSubscriber saga.Subscriber, logger *config.Logger) (*CreateAvailabilityCommandHandler, error) {
+func NewCreateAvailabilityCommandHandler(reservationService *service.ReservationService, replyPublisher saga.Publisher, commandSubscriber saga.Subscriber, inbox *service.Inbox, tracer trace.Tracer, logger *config.Logger) (*CreateAvailabilityCommandHandler, error) {
 	o := &CreateAvailabilityCommandHandler{
 		reservationService: reservationService,
 		replyPublisher:     replyPublisher,
 		commandSubscriber:  commandSubscriber,
+		inbox:              inbox,
+		tracer:             tracer,
 		logger:             logger,
 	}
 	err := o.commandSubscriber.Subscribe(o.handle)
@@ -45,9 +51,24 @@ func NewCreateAvailabilityCommandHandler(reservationService *service.Reservation
 }
 
 func (handler CreateAvailabilityCommandHandler) handle(command *events.CreateAccommodationCommand) {
+	if command.Type != events.CreateAvailability && command.Type != events.RollbackAccommodation {
+		return
+	}
+	ctx, span := handler.tracer.Start(command.Envelope.Context(context.Background()), "CreateAvailabilityCommandHandler.handle")
+	defer span.End()
 	handler.logger.LogInfo("create-availability-handler", fmt.Sprintf("USLA KOMANDA U CREATE AVAILIABILIY %v", command.Type))
+	reply := events.CreateAccommodationReply{Envelope: command.Envelope.Reply(ctx), Payload: command.Payload}
+	send := handler.inbox.Process(ctx, command.MessageID, &reply, func() bool {
+		return handler.execute(ctx, command, &reply)
+	})
+	if send {
+		_ = handler.replyPublisher.Publish(reply)
+	}
+}
+
+// execute runs a command and sets the type of its reply. It reports whether there is a reply.
+func (handler CreateAvailabilityCommandHandler) execute(ctx context.Context, command *events.CreateAccommodationCommand, reply *events.CreateAccommodationReply) bool {
 	valueFromCommand := command.Payload
-	reply := events.CreateAccommodationReply{Payload: valueFromCommand}
 	switch command.Type {
 	case events.CreateAvailability:
 		var dateRangeCasted []domain.DateRangeWithPrice
@@ -64,20 +85,23 @@ func (handler CreateAvailabilityCommandHandler) handle(command *events.CreateAcc
 			DateRange:       dateRangeCasted,
 		}
 
-		_, err := handler.reservationService.CreateAvailability(context.Background(), freeAccommodation)
+		_, err := handler.reservationService.CreateAvailability(ctx, freeAccommodation)
 		if err != nil {
 			handler.logger.LogInfo("create-availability-handler", "VRACANJE NOT CREATED AVAILABILITY")
 			reply.Type = events.AvailabilityNotCreated
-			break
+			return true
 		}
 		handler.logger.LogInfo("create-availability-handler", "VRACANJE CREATED AVAILABILITY")
 		reply.Type = events.AvailabilityCreated
-		break
+		return true
+	case events.RollbackAccommodation:
+		if err := handler.reservationService.RollbackAvailability(ctx, valueFromCommand.AccommodationID); err != nil {
+			handler.logger.LogError("create-availability-handler", fmt.Sprintf("Unable to roll back availability of %s: %s", valueFromCommand.AccommodationID, err.Message))
+			return false
+		}
+		reply.Type = events.AvailabilityRolledBack
+		return true
 	default:
-		reply.Type = events.UnknownReply
-		break
-	}
-	if reply.Type != events.UnknownReply {
-		_ = handler.replyPublisher.Publish(reply)
+		return false
 	}
 }
@@ -0,0 +1,58 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	events "example/saga/delete_user"
+	saga "example/saga/messaging"
+	"fmt"
+	"reservation-service/config"
+	"reservation-service/service"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// DeleteUserCommandHandler answers whether a user whose account is being deleted still has
+// reservations that are not over.
+type DeleteUserCommandHandler struct {
+	reservationService *service.ReservationService
+	replyPublisher     saga.Publisher
+	commandSubscriber  saga.Subscriber
+	tracer             trace.Tracer
+	logger             *config.Logger
+}
+
+func NewDeleteUserCommandHandler(reservationService *service.ReservationService, replyPublisher saga.Publisher, commandSubscriber saga.Subscriber, tracer trace.Tracer, logger *config.Logger) (*DeleteUserCommandHandler, error) {
+	o := &DeleteUserCommandHandler{
+		reservationService: reservationService,
+		replyPublisher:     replyPublisher,
+		commandSubscriber:  commandSubscriber,
+		tracer:             tracer,
+		logger:             logger,
+	}
+	err := saga.Subscribe(o.commandSubscriber, o.handle)
+	if err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// handle only reads reservations, so a command delivered again is answered again.
+func (handler DeleteUserCommandHandler) handle(ctx context.Context, command *events.DeleteUserCommand) error {
+	if command.Type != events.CheckReservations {
+		return nil
+	}
+	ctx, span := handler.tracer.Start(ctx, "DeleteUserCommandHandler.handle")
+	defer span.End()
+	user := command.Payload
+	open, err := handler.reservationService.HasOpenReservations(ctx, user.UserID, user.Role)
+	if err != nil {
+		handler.logger.LogError("delete-user-handler", fmt.Sprintf("Unable to check reservations of user %s: %s", user.UserID, err.Message))
+		return errors.New(err.Message)
+	}
+	reply := events.DeleteUserReply{Envelope: command.Envelope.Reply(ctx), Type: events.NoOpenReservations, Payload: user}
+	if open {
+		reply.Type = events.OpenReservations
+	}
+	return handler.replyPublisher.Publish(reply)
+}
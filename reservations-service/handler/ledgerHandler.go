@@ -0,0 +1,70 @@
+package handler
+
+import (
+	"bytes"
+	"net/http"
+	"reservation-service/service"
+	"reservation-service/utils"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// LedgerHandler serves the earnings of the host that is logged in.
+type LedgerHandler struct {
+	LedgerService *service.LedgerService
+	Tracer        trace.Tracer
+}
+
+func hostIDFromContext(r *http.Request) string {
+	hostID, _ := r.Context().Value("userID").(string)
+	return hostID
+}
+
+func (lh *LedgerHandler) GetBalance(rw http.ResponseWriter, r *http.Request) {
+	ctx, span := lh.Tracer.Start(r.Context(), "LedgerHandler.GetBalance")
+	defer span.End()
+	balance, err := lh.LedgerService.GetBalance(ctx, hostIDFromContext(r))
+	if err != nil {
+		utils.WriteErrorResp(err.Message, err.Status, "api/reservations/ledger/balance", rw)
+		return
+	}
+	utils.WriteResp(balance, 200, rw)
+}
+
+func (lh *LedgerHandler) GetStatement(rw http.ResponseWriter, r *http.Request) {
+	ctx, span := lh.Tracer.Start(r.Context(), "LedgerHandler.GetStatement")
+	defer span.End()
+	query := r.URL.Query()
+	statement, err := lh.LedgerService.GetStatement(ctx, hostIDFromContext(r), query.Get("from"), query.Get("to"))
+	if err != nil {
+		utils.WriteErrorResp(err.Message, err.Status, "api/reservations/ledger/statement", rw)
+		return
+	}
+	utils.WriteResp(statement, 200, rw)
+}
+
+func (lh *LedgerHandler) ExportStatementCSV(rw http.ResponseWriter, r *http.Request) {
+	ctx, span := lh.Tracer.Start(r.Context(), "LedgerHandler.ExportStatementCSV")
+	defer span.End()
+	query := r.URL.Query()
+	var body bytes.Buffer
+	if err := lh.LedgerService.WriteStatementCSV(ctx, hostIDFromContext(r), query.Get("from"), query.Get("to"), &body); err != nil {
+		utils.WriteErrorResp(err.Message, err.Status, "api/reservations/ledger/statement.csv", rw)
+		return
+	}
+	rw.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	rw.Header().Set("Content-Disposition", "attachment; filename=\"statement-"+query.Get("from")+"-"+query.Get("to")+".csv\"")
+	rw.WriteHeader(http.StatusOK)
+	_, _ = rw.Write(body.Bytes())
+}
+
+func (lh *LedgerHandler) CreatePayout(rw http.ResponseWriter, r *http.Request) {
+	ctx, span := lh.Tracer.Start(r.Context(), "LedgerHandler.CreatePayout")
+	defer span.End()
+	balance, err := lh.LedgerService.RecordPayout(ctx, hostIDFromContext(r))
+	if err != nil {
+		utils.WriteErrorResp(err.Message, err.Status, "api/reservations/ledger/payouts", rw)
+		return
+	}
+	utils.WriteResp(balance, 201, rw)
+}
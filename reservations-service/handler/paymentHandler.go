@@ -0,0 +1,47 @@
+package handler
+
+import (
+	"io"
+	"net/http"
+	"reservation-service/service"
+	"reservation-service/utils"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type PaymentHandler struct {
+	PaymentService *service.PaymentService
+	Tracer         trace.Tracer
+}
+
+func (ph *PaymentHandler) GetPayment(rw http.ResponseWriter, r *http.Request) {
+	ctx, span := ph.Tracer.Start(r.Context(), "PaymentHandler.GetPayment")
+	defer span.End()
+	payment, err := ph.PaymentService.GetPayment(ctx, mux.Vars(r)["reservationId"])
+	if err != nil {
+		utils.WriteErrorResp(err.Message, err.Status, "api/reservations/payments/{reservationId}", rw)
+		return
+	}
+	// Only the guest who pays and the host who is paid see the payment.
+	if userID, _ := r.Context().Value("userID").(string); userID != payment.UserID && userID != payment.HostID {
+		utils.WriteErrorResp("Forbidden", 403, "api/reservations/payments/{reservationId}", rw)
+		return
+	}
+	utils.WriteResp(payment, 200, rw)
+}
+
+func (ph *PaymentHandler) Webhook(rw http.ResponseWriter, r *http.Request) {
+	ctx, span := ph.Tracer.Start(r.Context(), "PaymentHandler.Webhook")
+	defer span.End()
+	payload, readErr := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if readErr != nil {
+		utils.WriteErrorResp(readErr.Error(), 400, "api/reservations/payments/webhook", rw)
+		return
+	}
+	if err := ph.PaymentService.HandleWebhook(ctx, payload, r.Header.Get(ph.PaymentService.WebhookSignatureHeader())); err != nil {
+		utils.WriteErrorResp(err.Message, err.Status, "api/reservations/payments/webhook", rw)
+		return
+	}
+	rw.WriteHeader(http.StatusNoContent)
+}
@@ -1,6 +1,8 @@
 package handler
 
 import (
+	"context"
+	"encoding/base64"
 	"encoding/json"
 	"log"
 	"net/http"
@@ -18,11 +20,12 @@ type KeyProduct struct{}
 type ReservationHandler struct {
 	logger             *log.Logger
 	ReservationService *service.ReservationService
+	TripService        *service.TripService
 	Tracer             trace.Tracer
 }
 
-func NewReservationsHandler(l *log.Logger, rs *service.ReservationService, tr trace.Tracer) *ReservationHandler {
-	return &ReservationHandler{l, rs, tr}
+func NewReservationsHandler(l *log.Logger, rs *service.ReservationService, ts *service.TripService, tr trace.Tracer) *ReservationHandler {
+	return &ReservationHandler{l, rs, ts, tr}
 }
 
 func (r *ReservationHandler) CreateReservation(rw http.ResponseWriter, h *http.Request) {
@@ -32,12 +35,12 @@ func (r *ReservationHandler) CreateReservation(rw http.ResponseWriter, h *http.R
 	decoder.DisallowUnknownFields()
 	var res domain.Reservation
 	if err := decoder.Decode(&res); err != nil {
-		utils.WriteErrorResp(err.Error(), 500, "api/reservations", rw)
+		utils.WriteErrorResp(err.Error(), 400, "api/reservations", rw)
 		return
 	}
 	newRes, err := r.ReservationService.CreateReservation(ctx, res)
 	if err != nil {
-		utils.WriteErrorResp(err.Message, err.Status, "api/reservations", rw)
+		utils.WriteErrorRespWithDetails(err.Message, err.Status, "api/reservations", err.Details, rw)
 		return
 	}
 	utils.WriteResp(newRes, 201, rw)
@@ -67,15 +70,20 @@ func (rh *ReservationHandler) GetReservationsByUser(rw http.ResponseWriter, r *h
 	defer span.End()
 	vars := mux.Vars(r)
 	userID := vars["userId"]
+	filter, validationErrors := utils.NewValidator().ParseReservationFilter(r.URL.Query())
+	if len(validationErrors) > 0 {
+		utils.WriteErrorRespWithDetails("Invalid filter", 400, "api/reservations/user/guest/{userId}", validationErrors, rw)
+		return
+	}
 
-	reservations, err := rh.ReservationService.GetReservationsByUser(ctx, userID)
+	page, err := rh.ReservationService.GetReservationsByUser(ctx, userID, filter)
 	if err != nil {
 		utils.WriteErrorResp(err.Message, err.Status, "api/reservations/user/guest/{userId}", rw)
 		return
 	}
 
-	rw.Header().Set("Content-Type", "application/json")
-	utils.WriteResp(reservations, 200, rw)
+	writePageHeaders(rw, page)
+	utils.WriteResp(page.Reservations, 200, rw)
 }
 
 func (rh *ReservationHandler) GetReservationsByHost(rw http.ResponseWriter, r *http.Request) {
@@ -83,15 +91,65 @@ func (rh *ReservationHandler) GetReservationsByHost(rw http.ResponseWriter, r *h
 	defer span.End()
 	vars := mux.Vars(r)
 	hostID := vars["hostId"]
+	filter, validationErrors := utils.NewValidator().ParseReservationFilter(r.URL.Query())
+	if len(validationErrors) > 0 {
+		utils.WriteErrorRespWithDetails("Invalid filter", 400, "api/reservations/user/{hostId}", validationErrors, rw)
+		return
+	}
 
-	reservations, err := rh.ReservationService.GetReservationsByHost(ctx, hostID)
+	page, err := rh.ReservationService.GetReservationsByHost(ctx, hostID, filter)
 	if err != nil {
 		utils.WriteErrorResp(err.Message, err.Status, "api/reservations/user/{hostId}", rw)
 		return
 	}
 
+	writePageHeaders(rw, page)
 	rw.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(rw).Encode(reservations)
+	json.NewEncoder(rw).Encode(page.Reservations)
+}
+
+// writePageHeaders describes the page in headers, so the body keeps the shape of an unpaginated
+// list. The next page is asked for with the pageState the last page came with, there is none
+// after the last page.
+func writePageHeaders(rw http.ResponseWriter, page *domain.ReservationPage) {
+	if page.Size == 0 {
+		return
+	}
+	rw.Header().Set("X-Page-Size", strconv.Itoa(page.Size))
+	if len(page.NextPageState) > 0 {
+		rw.Header().Set("X-Next-Page-State", base64.RawURLEncoding.EncodeToString(page.NextPageState))
+	}
+}
+
+// GetReservationDocument serves the confirmation or the invoice of one of the guest's own
+// reservations, as PDF unless HTML is asked for.
+func (rh *ReservationHandler) GetReservationDocument(rw http.ResponseWriter, r *http.Request) {
+	ctx, span := rh.Tracer.Start(r.Context(), "ReservationHandler.GetReservationDocument")
+	defer span.End()
+	vars := mux.Vars(r)
+	if userID, _ := r.Context().Value("userID").(string); userID != vars["userId"] {
+		utils.WriteErrorResp("Forbidden", 403, "api/reservations/user/guest/{userId}/{id}/{document}", rw)
+		return
+	}
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = domain.DocumentFormatPDF
+	}
+	if format != domain.DocumentFormatPDF && format != domain.DocumentFormatHTML {
+		utils.WriteErrorResp("Format must be pdf or html", 400, "api/reservations/user/guest/{userId}/{id}/{document}", rw)
+		return
+	}
+	document, err := rh.ReservationService.GetReservationDocument(ctx, vars["userId"], vars["id"], vars["document"], format)
+	if err != nil {
+		utils.WriteErrorResp(err.Message, err.Status, "api/reservations/user/guest/{userId}/{id}/{document}", rw)
+		return
+	}
+	rw.Header().Set("Content-Type", document.ContentType)
+	if format == domain.DocumentFormatPDF {
+		rw.Header().Set("Content-Disposition", `attachment; filename="`+document.Filename+`"`)
+	}
+	rw.WriteHeader(200)
+	rw.Write(document.Content)
 }
 
 func (rh *ReservationHandler) GetAvailabilityForAccommodation(rw http.ResponseWriter, r *http.Request) {
@@ -162,18 +220,18 @@ func (rh ReservationHandler) ReservationsInDateRangeHandler(w http.ResponseWrite
 	utils.WriteResp(reservations, 201, w)
 }
 
+// DeleteReservationById cancels one of the guest's own reservations, the user comes from the token.
 func (rh *ReservationHandler) DeleteReservationById(rw http.ResponseWriter, r *http.Request) {
 	ctx, span := rh.Tracer.Start(r.Context(), "ReservationHandler.DeleteReservationById")
 	defer span.End()
 	vars := mux.Vars(r)
-	id := vars["id"]
-	country := vars["country"]
-	userID := vars["userID"]
-	hostID := vars["hostID"]
-	accommodationID := vars["accommodationID"]
-	endDate := vars["endDate"]
+	userID, _ := r.Context().Value("userID").(string)
+	if userID != vars["userID"] {
+		utils.WriteErrorResp("Reservation belongs to another user", 403, "api/reservations/{country}/{id}/{userID}/{hostID}/{accommodationID}/{endDate}", rw)
+		return
+	}
 
-	deletedReservation, err := rh.ReservationService.DeleteReservationById(ctx, country, id, userID, hostID, accommodationID, endDate)
+	deletedReservation, err := rh.TripService.CancelReservation(ctx, userID, vars["id"])
 	if err != nil {
 		utils.WriteErrorResp(err.Message, err.Status, "api/reservations/{country}/{id}/{userID}/{hostID}/{accommodationID}/{endDate}", rw)
 		return
@@ -235,25 +293,20 @@ func (rh *ReservationHandler) UpdateAvailability(w http.ResponseWriter, r *http.
 	vars := mux.Vars(r)
 	accommodationID := vars["accommodationId"]
 	id := vars["id"]
-	country := vars["country"]
-	priceStr := vars["price"]
-
-	price, err := strconv.Atoi(priceStr)
-	if err != nil {
-		http.Error(w, "Invalid price parameter", http.StatusBadRequest)
+	if !rh.authorizeHost(ctx, r, accommodationID, "api/reservations/{accommodationId}/{id}/{country}/{price}", w) {
 		return
 	}
 
 	var updatedReservation domain.FreeReservation
-	err = json.NewDecoder(r.Body).Decode(&updatedReservation)
+	err := json.NewDecoder(r.Body).Decode(&updatedReservation)
 	if err != nil {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
-	result, reservationErr := rh.ReservationService.UpdateAvailability(ctx, accommodationID, id, country, price, &updatedReservation)
+	result, reservationErr := rh.ReservationService.UpdateAvailability(ctx, accommodationID, id, &updatedReservation)
 	if reservationErr != nil {
-		http.Error(w, reservationErr.Message, 500)
+		utils.WriteErrorRespWithDetails(reservationErr.Message, reservationErr.Status, "api/reservations/{accommodationId}/{id}/{country}/{price}", reservationErr.Details, w)
 		return
 	}
 
@@ -281,3 +334,159 @@ func (rh *ReservationHandler) GetAccommodationIDsByMaxPrice(rw http.ResponseWrit
 	rw.Header().Set("Content-Type", "application/json")
 	utils.WriteResp(accommodations, http.StatusOK, rw)
 }
+
+func (rh *ReservationHandler) ModifyReservation(rw http.ResponseWriter, r *http.Request) {
+	ctx, span := rh.Tracer.Start(r.Context(), "ReservationHandler.ModifyReservation")
+	defer span.End()
+	var request domain.ModifyReservationRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		utils.WriteErrorResp(err.Error(), 400, "api/reservations/modify", rw)
+		return
+	}
+	// Guests modify their own reservations only, the user comes from the token.
+	userID, _ := r.Context().Value("userID").(string)
+	if request.UserID != "" && request.UserID != userID {
+		utils.WriteErrorResp("Reservation belongs to another user", 403, "api/reservations/modify", rw)
+		return
+	}
+	request.UserID = userID
+	modification, err := rh.ReservationService.ModifyReservation(ctx, request)
+	if err != nil {
+		utils.WriteErrorRespWithDetails(err.Message, err.Status, "api/reservations/modify", err.Details, rw)
+		return
+	}
+	utils.WriteResp(modification, 200, rw)
+}
+
+func (rh *ReservationHandler) GetAvailabilityCalendar(rw http.ResponseWriter, r *http.Request) {
+	ctx, span := rh.Tracer.Start(r.Context(), "ReservationHandler.GetAvailabilityCalendar")
+	defer span.End()
+	vars := mux.Vars(r)
+	accommodationID := vars["accommodationId"]
+	month := r.URL.Query().Get("month")
+	months := 1
+	if monthsStr := r.URL.Query().Get("months"); monthsStr != "" {
+		parsed, err := strconv.Atoi(monthsStr)
+		if err != nil {
+			utils.WriteErrorResp("Invalid months parameter", 400, "api/reservations/{accommodationId}/calendar", rw)
+			return
+		}
+		months = parsed
+	}
+
+	calendar, err := rh.ReservationService.GetAvailabilityCalendar(ctx, accommodationID, month, months)
+	if err != nil {
+		utils.WriteErrorResp(err.Message, err.Status, "api/reservations/{accommodationId}/calendar", rw)
+		return
+	}
+	utils.WriteResp(calendar, 200, rw)
+}
+
+func (rh *ReservationHandler) BlockDates(rw http.ResponseWriter, r *http.Request) {
+	ctx, span := rh.Tracer.Start(r.Context(), "ReservationHandler.BlockDates")
+	defer span.End()
+	accommodationID := mux.Vars(r)["accommodationId"]
+	if !rh.authorizeHost(ctx, r, accommodationID, "api/reservations/{accommodationId}/blocks", rw) {
+		return
+	}
+	var request domain.BlockDatesRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		utils.WriteErrorResp(err.Error(), 400, "api/reservations/{accommodationId}/blocks", rw)
+		return
+	}
+	if err := rh.ReservationService.BlockDates(ctx, accommodationID, request); err != nil {
+		utils.WriteErrorRespWithDetails(err.Message, err.Status, "api/reservations/{accommodationId}/blocks", err.Details, rw)
+		return
+	}
+	utils.WriteResp(request, 201, rw)
+}
+
+func (rh *ReservationHandler) UnblockDates(rw http.ResponseWriter, r *http.Request) {
+	ctx, span := rh.Tracer.Start(r.Context(), "ReservationHandler.UnblockDates")
+	defer span.End()
+	accommodationID := mux.Vars(r)["accommodationId"]
+	if !rh.authorizeHost(ctx, r, accommodationID, "api/reservations/{accommodationId}/blocks", rw) {
+		return
+	}
+	var request domain.BlockDatesRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		utils.WriteErrorResp(err.Error(), 400, "api/reservations/{accommodationId}/blocks", rw)
+		return
+	}
+	if err := rh.ReservationService.UnblockDates(ctx, accommodationID, request); err != nil {
+		utils.WriteErrorResp(err.Message, err.Status, "api/reservations/{accommodationId}/blocks", rw)
+		return
+	}
+	utils.WriteResp(request, 200, rw)
+}
+
+func (rh *ReservationHandler) SplitAvailability(rw http.ResponseWriter, r *http.Request) {
+	ctx, span := rh.Tracer.Start(r.Context(), "ReservationHandler.SplitAvailability")
+	defer span.End()
+	vars := mux.Vars(r)
+	if !rh.authorizeHost(ctx, r, vars["accommodationId"], "api/reservations/{accommodationId}/availability/{id}/split", rw) {
+		return
+	}
+	var request domain.SplitAvailabilityRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		utils.WriteErrorResp(err.Error(), 400, "api/reservations/{accommodationId}/availability/{id}/split", rw)
+		return
+	}
+	ranges, err := rh.ReservationService.SplitAvailability(ctx, vars["accommodationId"], vars["id"], request)
+	if err != nil {
+		utils.WriteErrorResp(err.Message, err.Status, "api/reservations/{accommodationId}/availability/{id}/split", rw)
+		return
+	}
+	utils.WriteResp(ranges, 200, rw)
+}
+
+func (rh *ReservationHandler) MergeAvailability(rw http.ResponseWriter, r *http.Request) {
+	ctx, span := rh.Tracer.Start(r.Context(), "ReservationHandler.MergeAvailability")
+	defer span.End()
+	accommodationID := mux.Vars(r)["accommodationId"]
+	if !rh.authorizeHost(ctx, r, accommodationID, "api/reservations/{accommodationId}/availability/merge", rw) {
+		return
+	}
+	var request domain.MergeAvailabilityRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		utils.WriteErrorResp(err.Error(), 400, "api/reservations/{accommodationId}/availability/merge", rw)
+		return
+	}
+	merged, err := rh.ReservationService.MergeAvailability(ctx, accommodationID, request)
+	if err != nil {
+		utils.WriteErrorResp(err.Message, err.Status, "api/reservations/{accommodationId}/availability/merge", rw)
+		return
+	}
+	utils.WriteResp(merged, 200, rw)
+}
+
+func (rh *ReservationHandler) BulkEditPrices(rw http.ResponseWriter, r *http.Request) {
+	ctx, span := rh.Tracer.Start(r.Context(), "ReservationHandler.BulkEditPrices")
+	defer span.End()
+	accommodationID := mux.Vars(r)["accommodationId"]
+	if !rh.authorizeHost(ctx, r, accommodationID, "api/reservations/{accommodationId}/availability/prices", rw) {
+		return
+	}
+	var request domain.BulkPriceRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		utils.WriteErrorResp(err.Error(), 400, "api/reservations/{accommodationId}/availability/prices", rw)
+		return
+	}
+	ranges, err := rh.ReservationService.BulkEditPrices(ctx, accommodationID, request)
+	if err != nil {
+		utils.WriteErrorResp(err.Message, err.Status, "api/reservations/{accommodationId}/availability/prices", rw)
+		return
+	}
+	utils.WriteResp(ranges, 200, rw)
+}
+
+// authorizeHost answers with an error and returns false unless the user of the token hosts the
+// accommodation.
+func (rh *ReservationHandler) authorizeHost(ctx context.Context, r *http.Request, accommodationID, path string, rw http.ResponseWriter) bool {
+	hostID, _ := r.Context().Value("userID").(string)
+	if err := rh.ReservationService.AuthorizeHost(ctx, accommodationID, hostID); err != nil {
+		utils.WriteErrorResp(err.Message, err.Status, path, rw)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,96 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"reservation-service/domain"
+	"reservation-service/service"
+	"reservation-service/utils"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type TripHandler struct {
+	TripService *service.TripService
+	Tracer      trace.Tracer
+}
+
+func decodeTripRequest(r *http.Request) (domain.TripRequest, error) {
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	var request domain.TripRequest
+	err := decoder.Decode(&request)
+	return request, err
+}
+
+func (th *TripHandler) Quote(rw http.ResponseWriter, r *http.Request) {
+	ctx, span := th.Tracer.Start(r.Context(), "TripHandler.Quote")
+	defer span.End()
+	request, decodeErr := decodeTripRequest(r)
+	if decodeErr != nil {
+		utils.WriteErrorResp(decodeErr.Error(), 400, "api/reservations/trips/quote", rw)
+		return
+	}
+	userID, _ := r.Context().Value("userID").(string)
+	quote, err := th.TripService.Quote(ctx, userID, request)
+	if err != nil {
+		utils.WriteErrorRespWithDetails(err.Message, err.Status, "api/reservations/trips/quote", err.Details, rw)
+		return
+	}
+	utils.WriteResp(quote, 200, rw)
+}
+
+func (th *TripHandler) CreateTrip(rw http.ResponseWriter, r *http.Request) {
+	ctx, span := th.Tracer.Start(r.Context(), "TripHandler.CreateTrip")
+	defer span.End()
+	request, decodeErr := decodeTripRequest(r)
+	if decodeErr != nil {
+		utils.WriteErrorResp(decodeErr.Error(), 400, "api/reservations/trips", rw)
+		return
+	}
+	userID, _ := r.Context().Value("userID").(string)
+	trip, err := th.TripService.CreateTrip(ctx, userID, request)
+	if err != nil {
+		utils.WriteErrorRespWithDetails(err.Message, err.Status, "api/reservations/trips", err.Details, rw)
+		return
+	}
+	utils.WriteResp(trip, 201, rw)
+}
+
+func (th *TripHandler) GetTrips(rw http.ResponseWriter, r *http.Request) {
+	ctx, span := th.Tracer.Start(r.Context(), "TripHandler.GetTrips")
+	defer span.End()
+	userID, _ := r.Context().Value("userID").(string)
+	trips, err := th.TripService.GetTripsByUser(ctx, userID)
+	if err != nil {
+		utils.WriteErrorResp(err.Message, err.Status, "api/reservations/trips", rw)
+		return
+	}
+	utils.WriteResp(trips, 200, rw)
+}
+
+func (th *TripHandler) GetTrip(rw http.ResponseWriter, r *http.Request) {
+	ctx, span := th.Tracer.Start(r.Context(), "TripHandler.GetTrip")
+	defer span.End()
+	userID, _ := r.Context().Value("userID").(string)
+	trip, err := th.TripService.GetTrip(ctx, userID, mux.Vars(r)["tripId"])
+	if err != nil {
+		utils.WriteErrorResp(err.Message, err.Status, "api/reservations/trips/{tripId}", rw)
+		return
+	}
+	utils.WriteResp(trip, 200, rw)
+}
+
+func (th *TripHandler) CancelLeg(rw http.ResponseWriter, r *http.Request) {
+	ctx, span := th.Tracer.Start(r.Context(), "TripHandler.CancelLeg")
+	defer span.End()
+	vars := mux.Vars(r)
+	userID, _ := r.Context().Value("userID").(string)
+	trip, err := th.TripService.CancelLeg(ctx, userID, vars["tripId"], vars["reservationId"])
+	if err != nil {
+		utils.WriteErrorResp(err.Message, err.Status, "api/reservations/trips/{tripId}/legs/{reservationId}", rw)
+		return
+	}
+	utils.WriteResp(trip, 200, rw)
+}
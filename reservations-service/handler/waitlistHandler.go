@@ -0,0 +1,60 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"reservation-service/domain"
+	"reservation-service/service"
+	"reservation-service/utils"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type WaitlistHandler struct {
+	WaitlistService *service.WaitlistService
+	Tracer          trace.Tracer
+}
+
+func (wh *WaitlistHandler) Join(rw http.ResponseWriter, r *http.Request) {
+	ctx, span := wh.Tracer.Start(r.Context(), "WaitlistHandler.Join")
+	defer span.End()
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	var request domain.WaitlistRequest
+	if err := decoder.Decode(&request); err != nil {
+		utils.WriteErrorResp(err.Error(), 400, "api/reservations/waitlist", rw)
+		return
+	}
+	userID, _ := r.Context().Value("userID").(string)
+	entry, err := wh.WaitlistService.Join(ctx, userID, request)
+	if err != nil {
+		utils.WriteErrorRespWithDetails(err.Message, err.Status, "api/reservations/waitlist", err.Details, rw)
+		return
+	}
+	utils.WriteResp(entry, 201, rw)
+}
+
+func (wh *WaitlistHandler) GetByUser(rw http.ResponseWriter, r *http.Request) {
+	ctx, span := wh.Tracer.Start(r.Context(), "WaitlistHandler.GetByUser")
+	defer span.End()
+	userID, _ := r.Context().Value("userID").(string)
+	entries, err := wh.WaitlistService.GetByUser(ctx, userID)
+	if err != nil {
+		utils.WriteErrorResp(err.Message, err.Status, "api/reservations/waitlist", rw)
+		return
+	}
+	utils.WriteResp(entries, 200, rw)
+}
+
+func (wh *WaitlistHandler) Leave(rw http.ResponseWriter, r *http.Request) {
+	ctx, span := wh.Tracer.Start(r.Context(), "WaitlistHandler.Leave")
+	defer span.End()
+	vars := mux.Vars(r)
+	userID, _ := r.Context().Value("userID").(string)
+	if err := wh.WaitlistService.Leave(ctx, userID, vars["accommodationId"], vars["id"]); err != nil {
+		utils.WriteErrorResp(err.Message, err.Status, "api/reservations/waitlist/{accommodationId}/{id}", rw)
+		return
+	}
+	rw.WriteHeader(http.StatusNoContent)
+}
@@ -10,9 +10,12 @@ import (
 	"reservation-service/config"
 	"reservation-service/handler"
 	"reservation-service/middlewares"
+	"reservation-service/payment"
 	"reservation-service/repository"
 	"reservation-service/service"
 	"reservation-service/utils"
+	"strconv"
+	"syscall"
 	"time"
 
 	log "github.com/sirupsen/logrus"
@@ -36,8 +39,6 @@ func main() {
 		port = "8080"
 	}
 
-	timeoutContext, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
 	logger := config.NewLogger("./logs/log.log")
 	//storeLogger := log.New(os.Stdout, "[reservation-store]", log.LstdFlags)
 	notificationServiceHost := os.Getenv("NOTIFICATION_SERVICE_HOST")
@@ -48,6 +49,8 @@ func main() {
 	log.Println("HOST", metricsCommandHost)
 	metricsCommandPort := os.Getenv("COMMAND_SERVICE_PORT")
 	log.Println("PORT", metricsCommandPort)
+	accommodationServiceHost := os.Getenv("ACCOMMODATION_SERVICE_HOST")
+	accommodationServicePort := os.Getenv("ACCOMMODATION_SERVICE_PORT")
 	customNotificationServiceClient := &http.Client{
 		Transport: &http.Transport{
 			MaxIdleConns:        10,
@@ -88,6 +91,26 @@ func main() {
 		},
 	)
 
+	customAccommodationServiceClient := &http.Client{
+		Transport: &http.Transport{
+			MaxIdleConns:        10,
+			MaxIdleConnsPerHost: 10,
+			MaxConnsPerHost:     10,
+		},
+	}
+
+	accommodationServiceCircuitBreaker := gobreaker.NewCircuitBreaker(
+		gobreaker.Settings{
+			Name:        "accommodations-service",
+			MaxRequests: 1,
+			Timeout:     10 * time.Second,
+			Interval:    0,
+			OnStateChange: func(name string, from gobreaker.State, to gobreaker.State) {
+				log.Printf("Circuit Breaker %v: %v -> %v", name, from, to)
+			},
+		},
+	)
+
 	validator := utils.NewValidator()
 	notificationsClient := client.NewNotificationClient(notificationServiceHost, notificationServicePort, customNotificationServiceClient, notificationServiceCircuitBreaker)
 	metricsClient := client.NewMetricsClient(metricsCommandHost, metricsCommandPort, customMetricsServiceClient, metricsServiceCircuitBreaker)
@@ -97,13 +120,21 @@ func main() {
 		log.Fatal("JaegerTraceProvider failed to Initialize", err)
 	}
 	tracer := tracerProvider.Tracer("reservations-service")
+	accommodationsClient := client.NewAccommodationsClient(accommodationServiceHost, accommodationServicePort, customAccommodationServiceClient, accommodationServiceCircuitBreaker, tracer)
 
 	otel.SetTextMapPropagator(propagation.TraceContext{})
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	store, err := repository.New(logger, tracer)
+	cassandraConfig, err := config.GetCassandraConfig()
+	if err != nil {
+		logger.Fatal("Invalid Cassandra configuration", log.Fields{
+			"module": "server-main",
+			"error":  err.Error(),
+		})
+	}
+	store, err := repository.New(cassandraConfig, logger, tracer)
 	if err != nil {
 		logger.Fatal("Error while server is listening and serving requests", log.Fields{
 			"module": "server-main",
@@ -111,12 +142,20 @@ func main() {
 		})
 	}
 	defer store.CloseSession()
-	store.CreateTables()
-	reservationRepo, err := repository.New(logger, tracer)
+	// Migrations don't run under the startup timeout: waiting for another replica's migration
+	// lock and backfilling tables take as long as they take on real data.
+	if err := store.Migrate(context.Background()); err != nil {
+		logger.Fatal("Unable to migrate the reservation keyspace", log.Fields{
+			"module": "server-main",
+			"error":  err.Error(),
+		})
+	}
+	reservationRepo, err := repository.New(cassandraConfig, logger, tracer)
 	if err != nil {
 		return
 	}
-	publisher, err := nats.NewNATSPublisher(
+	publisher, err := nats.NewPublisher(
+		os.Getenv("MESSAGING_DRIVER"),
 		os.Getenv("NATS_HOST"),
 		os.Getenv("NATS_PORT"),
 		os.Getenv("NATS_USER"),
@@ -126,7 +165,8 @@ func main() {
 	if err != nil {
 		log.Fatal(err)
 	}
-	commandSubscriber, err := nats.NewNATSSubscriber(
+	commandSubscriber, err := nats.NewSubscriber(
+		os.Getenv("MESSAGING_DRIVER"),
 		os.Getenv("NATS_HOST"),
 		os.Getenv("NATS_PORT"),
 		os.Getenv("NATS_USER"),
@@ -137,15 +177,138 @@ func main() {
 		log.Fatal(err)
 	}
 
-	reservationService := service.NewReservationService(reservationRepo, validator, notificationsClient, logger, tracer, metricsClient)
-	_, err = handler.NewCreateAvailabilityCommandHandler(reservationService, publisher, commandSubscriber, logger)
+	paymentProvider, err := payment.New(os.Getenv("PAYMENT_PROVIDER"), os.Getenv("PAYMENT_API_KEY"), os.Getenv("PAYMENT_WEBHOOK_SECRET"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	paymentCurrency := os.Getenv("PAYMENT_CURRENCY")
+	if paymentCurrency == "" {
+		paymentCurrency = "EUR"
+	}
+	paymentCaptureInterval, err := time.ParseDuration(os.Getenv("PAYMENT_CAPTURE_INTERVAL"))
+	if err != nil {
+		paymentCaptureInterval = time.Hour
+	}
+	platformFeePercent, err := strconv.Atoi(os.Getenv("PLATFORM_FEE_PERCENT"))
+	if err != nil {
+		platformFeePercent = 3
+	}
+	ledgerService := service.NewLedgerService(reservationRepo, platformFeePercent, logger, tracer)
+	ledgerHandler := handler.LedgerHandler{
+		LedgerService: ledgerService,
+		Tracer:        tracer,
+	}
+	jobLookback, err := time.ParseDuration(os.Getenv("JOB_LOOKBACK"))
+	if err != nil {
+		jobLookback = 72 * time.Hour
+	}
+	jobInterval, err := time.ParseDuration(os.Getenv("JOB_INTERVAL"))
+	if err != nil {
+		jobInterval = time.Minute
+	}
+	jobScheduler := service.NewJobScheduler(reservationRepo, jobLookback, logger, tracer)
+	bookingConfirmationGrace, err := time.ParseDuration(os.Getenv("BOOKING_CONFIRMATION_GRACE"))
+	if err != nil {
+		bookingConfirmationGrace = 24 * time.Hour
+	}
+	paymentService := service.NewPaymentService(reservationRepo, paymentProvider, paymentCurrency, ledgerService, jobScheduler, bookingConfirmationGrace, logger, tracer)
+	jobScheduler.Every("payment-capture", paymentCaptureInterval, paymentService.CaptureDuePayments)
+	paymentHandler := handler.PaymentHandler{
+		PaymentService: paymentService,
+		Tracer:         tracer,
+	}
+
+	waitlistHoldDuration, err := time.ParseDuration(os.Getenv("WAITLIST_HOLD_DURATION"))
+	if err != nil {
+		waitlistHoldDuration = 24 * time.Hour
+	}
+	waitlistExpiryInterval, err := time.ParseDuration(os.Getenv("WAITLIST_EXPIRY_INTERVAL"))
+	if err != nil {
+		waitlistExpiryInterval = 5 * time.Minute
+	}
+	waitlistService := service.NewWaitlistService(reservationRepo, validator, accommodationsClient, notificationsClient, waitlistHoldDuration, logger, tracer)
+	jobScheduler.Every("waitlist-expiry", waitlistExpiryInterval, waitlistService.ExpireHolds)
+	waitlistHandler := handler.WaitlistHandler{
+		WaitlistService: waitlistService,
+		Tracer:          tracer,
+	}
+
+	reservationService := service.NewReservationService(reservationRepo, validator, notificationsClient, logger, tracer, metricsClient, accommodationsClient, paymentService, waitlistService, jobScheduler)
+	reservationService.RegisterJobs(jobScheduler)
+	paymentService.RegisterJobs(jobScheduler)
+	_, err = handler.NewCreateAvailabilityCommandHandler(reservationService, publisher, commandSubscriber, service.NewInbox(reservationRepo, logger, tracer), tracer, logger)
+	if err != nil {
+		log.Fatal(err)
+	}
+	deleteUserReplyPublisher, err := nats.NewPublisher(
+		os.Getenv("MESSAGING_DRIVER"),
+		os.Getenv("NATS_HOST"),
+		os.Getenv("NATS_PORT"),
+		os.Getenv("NATS_USER"),
+		os.Getenv("NATS_PASS"),
+		os.Getenv("DELETE_USER_REPLY_SUBJECT"),
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+	deleteUserCommandSubscriber, err := nats.NewSubscriber(
+		os.Getenv("MESSAGING_DRIVER"),
+		os.Getenv("NATS_HOST"),
+		os.Getenv("NATS_PORT"),
+		os.Getenv("NATS_USER"),
+		os.Getenv("NATS_PASS"),
+		os.Getenv("DELETE_USER_COMMAND_SUBJECT"),
+		"reservations-service")
 	if err != nil {
 		log.Fatal(err)
 	}
+	_, err = handler.NewDeleteUserCommandHandler(reservationService, deleteUserReplyPublisher, deleteUserCommandSubscriber, tracer, logger)
+	if err != nil {
+		log.Fatal(err)
+	}
+	tripService := service.NewTripService(reservationRepo, reservationService, paymentService, logger, tracer)
+	accountDeletedSubscriber, err := nats.NewSubscriber(
+		os.Getenv("MESSAGING_DRIVER"),
+		os.Getenv("NATS_HOST"),
+		os.Getenv("NATS_PORT"),
+		os.Getenv("NATS_USER"),
+		os.Getenv("NATS_PASS"),
+		os.Getenv("ACCOUNT_DELETED_SUBJECT"),
+		"reservations-service")
+	if err != nil {
+		log.Fatal(err)
+	}
+	_, err = handler.NewAccountDeletedHandler(waitlistService, tripService, accountDeletedSubscriber, tracer, logger)
+	if err != nil {
+		log.Fatal(err)
+	}
+	tripHandler := handler.TripHandler{
+		TripService: tripService,
+		Tracer:      tracer,
+	}
 	reservationsHandler := handler.ReservationHandler{
 		ReservationService: reservationService,
+		TripService:        tripService,
 		Tracer:             tracer,
 	}
+
+	calendarSyncInterval, err := time.ParseDuration(os.Getenv("CALENDAR_SYNC_INTERVAL"))
+	if err != nil {
+		calendarSyncInterval = time.Hour
+	}
+	// Only for development and tests, where feeds are served locally.
+	allowLocalCalendarFeeds, _ := strconv.ParseBool(os.Getenv("CALENDAR_ALLOW_LOCAL_FEEDS"))
+	calendarClient := client.NewCalendarClient(30*time.Second, allowLocalCalendarFeeds)
+	calendarSyncService := service.NewCalendarSyncService(reservationRepo, calendarClient, logger, tracer)
+	jobScheduler.Every("calendar-sync", calendarSyncInterval, calendarSyncService.SyncFeeds)
+	jobContext, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+	jobScheduler.Start(jobContext, jobInterval)
+	calendarHandler := handler.CalendarHandler{
+		CalendarSyncService: calendarSyncService,
+		ReservationService:  reservationService,
+		Tracer:              tracer,
+	}
 	/*
 			tracer, closer := tracing.Init("reservations-service")
 			defer closer.Close()
@@ -154,27 +317,54 @@ func main() {
 		middlewares.ValidateJWT(middlewares.RoleValidator("Host", reservationsHandler.GetReservationsByHost))
 	*/
 	router := mux.NewRouter()
+	router.HandleFunc("/health", nats.HealthHandler).Methods("GET")
 	router.HandleFunc("/user/guest/{userId}", reservationsHandler.GetReservationsByUser).Methods("GET")
+	router.HandleFunc("/user/guest/{userId}/{id}/{document:confirmation|invoice}", middlewares.ValidateJWT(middlewares.RoleValidator("Guest", reservationsHandler.GetReservationDocument))).Methods("GET")
 	router.HandleFunc("/", middlewares.ValidateJWT(middlewares.RoleValidator("Guest", reservationsHandler.CreateReservation))).Methods("POST")
+	router.HandleFunc("/modify", middlewares.ValidateJWT(middlewares.RoleValidator("Guest", reservationsHandler.ModifyReservation))).Methods("PUT")
+	router.HandleFunc("/waitlist", middlewares.ValidateJWT(middlewares.RoleValidator("Guest", waitlistHandler.Join))).Methods("POST")
+	router.HandleFunc("/waitlist", middlewares.ValidateJWT(middlewares.RoleValidator("Guest", waitlistHandler.GetByUser))).Methods("GET")
+	router.HandleFunc("/waitlist/{accommodationId}/{id}", middlewares.ValidateJWT(middlewares.RoleValidator("Guest", waitlistHandler.Leave))).Methods("DELETE")
+	router.HandleFunc("/trips/quote", middlewares.ValidateJWT(middlewares.RoleValidator("Guest", tripHandler.Quote))).Methods("POST")
+	router.HandleFunc("/trips", middlewares.ValidateJWT(middlewares.RoleValidator("Guest", tripHandler.CreateTrip))).Methods("POST")
+	router.HandleFunc("/trips", middlewares.ValidateJWT(middlewares.RoleValidator("Guest", tripHandler.GetTrips))).Methods("GET")
+	router.HandleFunc("/trips/{tripId}", middlewares.ValidateJWT(middlewares.RoleValidator("Guest", tripHandler.GetTrip))).Methods("GET")
+	router.HandleFunc("/trips/{tripId}/legs/{reservationId}", middlewares.ValidateJWT(middlewares.RoleValidator("Guest", tripHandler.CancelLeg))).Methods("DELETE")
+	router.HandleFunc("/payments/webhook", paymentHandler.Webhook).Methods("POST")
+	router.HandleFunc("/ledger/balance", middlewares.ValidateJWT(middlewares.RoleValidator("Host", ledgerHandler.GetBalance))).Methods("GET")
+	router.HandleFunc("/ledger/statement", middlewares.ValidateJWT(middlewares.RoleValidator("Host", ledgerHandler.GetStatement))).Methods("GET")
+	router.HandleFunc("/ledger/statement.csv", middlewares.ValidateJWT(middlewares.RoleValidator("Host", ledgerHandler.ExportStatementCSV))).Methods("GET")
+	router.HandleFunc("/ledger/payouts", middlewares.ValidateJWT(middlewares.RoleValidator("Host", ledgerHandler.CreatePayout))).Methods("POST")
+	router.HandleFunc("/payments/{reservationId}", middlewares.ValidateJWT(paymentHandler.GetPayment)).Methods("GET")
 	router.HandleFunc("/accommodations", reservationsHandler.ReservationsInDateRangeHandler).Methods("GET")
 	router.HandleFunc("/availability", reservationsHandler.CreateAvailability).Methods("POST")
 	router.HandleFunc("/user/host/{hostId}", reservationsHandler.GetReservationsByHost).Methods("GET")
 	//router.HandleFunc("/accommodations/{accommodationID}", reservationsHandler.GetReservationsByAccommodation).Methods("GET")
 	router.HandleFunc("/accommodation/dates", reservationsHandler.GetAvailableDates).Methods("GET")
-	router.HandleFunc("/{country}/{id}/{userID}/{hostID}/{accommodationID}/{endDate}", reservationsHandler.DeleteReservationById).Methods("PUT")
+	router.HandleFunc("/{country}/{id}/{userID}/{hostID}/{accommodationID}/{endDate}", middlewares.ValidateJWT(middlewares.RoleValidator("Guest", reservationsHandler.DeleteReservationById))).Methods("PUT")
 	router.HandleFunc("/{accommodationId}/availability", reservationsHandler.GetAvailabilityForAccommodation).Methods("GET")
+	router.HandleFunc("/{accommodationId}/calendar", reservationsHandler.GetAvailabilityCalendar).Methods("GET")
+	router.HandleFunc("/{accommodationId}/calendar.ics", calendarHandler.ExportCalendar).Methods("GET")
+	router.HandleFunc("/{accommodationId}/calendar/import", middlewares.ValidateJWT(middlewares.RoleValidator("Host", calendarHandler.ImportCalendar))).Methods("POST")
+	router.HandleFunc("/{accommodationId}/calendar/feed", middlewares.ValidateJWT(middlewares.RoleValidator("Host", calendarHandler.RegisterFeed))).Methods("PUT")
+	router.HandleFunc("/{accommodationId}/blocks", middlewares.ValidateJWT(middlewares.RoleValidator("Host", reservationsHandler.BlockDates))).Methods("POST")
+	router.HandleFunc("/{accommodationId}/blocks", middlewares.ValidateJWT(middlewares.RoleValidator("Host", reservationsHandler.UnblockDates))).Methods("DELETE")
+	router.HandleFunc("/{accommodationId}/availability/merge", middlewares.ValidateJWT(middlewares.RoleValidator("Host", reservationsHandler.MergeAvailability))).Methods("POST")
+	router.HandleFunc("/{accommodationId}/availability/prices", middlewares.ValidateJWT(middlewares.RoleValidator("Host", reservationsHandler.BulkEditPrices))).Methods("PUT")
+	router.HandleFunc("/{accommodationId}/availability/{id}/split", middlewares.ValidateJWT(middlewares.RoleValidator("Host", reservationsHandler.SplitAvailability))).Methods("POST")
 	router.HandleFunc("/percentage-cancelation/{hostId}", reservationsHandler.GetCancelationPercentage).Methods("GET")
 	router.HandleFunc("/{accommodationId}/{userId}", reservationsHandler.GetReservationsByAccommodationWithEndDate).Methods("GET")
 	router.HandleFunc("/host/{hostId}/{userId}", reservationsHandler.GetReservationsByHostWithEndDate).Methods("GET")
-	router.HandleFunc("/{accommodationId}/{id}/{country}/{price}", reservationsHandler.UpdateAvailability).Methods("POST")
+	router.HandleFunc("/{accommodationId}/{id}/{country}/{price}", middlewares.ValidateJWT(middlewares.RoleValidator("Host", reservationsHandler.UpdateAvailability))).Methods("POST")
 	router.HandleFunc("/price/myPrice/{maxPrice}", reservationsHandler.GetAccommodationIDsByMaxPrice).Methods("GET")
 
 	headersOk := gorillaHandlers.AllowedHeaders([]string{"X-Requested-With", "Content-Type", "Authorization"})
 	methodsOk := gorillaHandlers.AllowedMethods([]string{"GET", "HEAD", "POST", "PUT", "OPTIONS", "DELETE"})
 	originsOk := gorillaHandlers.AllowedOrigins([]string{"http://localhost:4200"})
+	exposedOk := gorillaHandlers.ExposedHeaders([]string{"X-Page-Size", "X-Next-Page-State", "Content-Disposition"})
 	server := http.Server{
 		Addr:         ":" + port,
-		Handler:      gorillaHandlers.CORS(headersOk, methodsOk, originsOk)(router),
+		Handler:      gorillaHandlers.CORS(headersOk, methodsOk, originsOk, exposedOk)(router),
 		IdleTimeout:  120 * time.Second,
 		ReadTimeout:  1 * time.Second,
 		WriteTimeout: 1 * time.Second,
@@ -192,18 +382,26 @@ func main() {
 		}
 	}()
 
-	sigCh := make(chan os.Signal)
+	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, os.Interrupt)
 	signal.Notify(sigCh, os.Kill)
+	signal.Notify(sigCh, syscall.SIGTERM)
 
 	sig := <-sigCh
 	logger.Println("Received terminate, graceful shutdown", sig)
 
 	//Try to shutdown gracefully
-	if server.Shutdown(timeoutContext) != nil {
+	shutdownContext, cancelShutdown := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancelShutdown()
+	shutdownErr := server.Shutdown(shutdownContext)
+	// Handlers still running finish and buffered messages go out before the connection closes.
+	if err := nats.Drain(); err != nil {
+		logger.Println("Cannot drain messaging connections", err)
+	}
+	if shutdownErr != nil {
 		logger.Fatal("Error during graceful shutdown", log.Fields{
 			"module": "server-main",
-			"error":  err.Error(),
+			"error":  shutdownErr.Error(),
 		})
 	}
 	logger.LogInfo("server-main", "Server shut down")
@@ -0,0 +1,10 @@
+package migrations
+
+import "embed"
+
+// Files holds the ordered CQL migrations of the reservation keyspace. A migration file is named
+// <version>_<name>.cql and its statements are separated by semicolons. Migrations are applied
+// once and never edited afterwards, schema changes go into a new file.
+//
+//go:embed *.cql
+var Files embed.FS
@@ -0,0 +1,152 @@
+// Package paymenttest provides a payment provider for tests.
+package paymenttest
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reservation-service/payment"
+	"sync"
+)
+
+// Payment tokens the fake provider declines. Every other non-empty token is approved.
+const (
+	TokenDeclined          = "tok_declined"
+	TokenInsufficientFunds = "tok_insufficient_funds"
+)
+
+type fakeAuthorization struct {
+	amount   int
+	captured int
+	refunded int
+	released bool
+}
+
+// SignatureHeader is the header the fake provider expects webhook signatures in.
+const SignatureHeader = "X-Payment-Signature"
+
+// FakeProvider keeps payments in memory and hands out sequential ids, so the same calls always
+// produce the same results. Webhooks are signed with HMAC-SHA256 of the payload.
+type FakeProvider struct {
+	mu             sync.Mutex
+	webhookSecret  []byte
+	sequence       int
+	authorizations map[string]*fakeAuthorization
+	transactions   map[string]*payment.Transaction
+}
+
+var _ payment.Provider = (*FakeProvider)(nil)
+
+func NewFakeProvider(webhookSecret string) *FakeProvider {
+	return &FakeProvider{
+		webhookSecret:  []byte(webhookSecret),
+		authorizations: make(map[string]*fakeAuthorization),
+		transactions:   make(map[string]*payment.Transaction),
+	}
+}
+
+func (fp *FakeProvider) Name() string {
+	return "fake"
+}
+
+func (fp *FakeProvider) WebhookSignatureHeader() string {
+	return SignatureHeader
+}
+
+func (fp *FakeProvider) Authorize(ctx context.Context, request payment.AuthorizeRequest) (*payment.Authorization, error) {
+	switch {
+	case request.PaymentToken == "":
+		return nil, &payment.DeclinedError{Reason: "missing payment method"}
+	case request.PaymentToken == TokenDeclined:
+		return nil, &payment.DeclinedError{Reason: "card declined"}
+	case request.PaymentToken == TokenInsufficientFunds:
+		return nil, &payment.DeclinedError{Reason: "insufficient funds"}
+	case request.Amount <= 0:
+		return nil, &payment.DeclinedError{Reason: "amount must be positive"}
+	}
+	fp.mu.Lock()
+	defer fp.mu.Unlock()
+	id := fp.nextID("auth")
+	fp.authorizations[id] = &fakeAuthorization{amount: request.Amount}
+	return &payment.Authorization{ID: id, Amount: request.Amount, Currency: request.Currency}, nil
+}
+
+func (fp *FakeProvider) Capture(ctx context.Context, authorizationID string, amount int, idempotencyKey string) (*payment.Transaction, error) {
+	fp.mu.Lock()
+	defer fp.mu.Unlock()
+	if transaction, ok := fp.transactions[idempotencyKey]; ok {
+		return transaction, nil
+	}
+	authorization, ok := fp.authorizations[authorizationID]
+	if !ok {
+		return nil, fmt.Errorf("authorization %s not found", authorizationID)
+	}
+	if authorization.released {
+		return nil, fmt.Errorf("authorization %s was released", authorizationID)
+	}
+	if amount <= 0 || authorization.captured+amount > authorization.amount {
+		return nil, fmt.Errorf("capture of %d exceeds the authorized amount of %s", amount, authorizationID)
+	}
+	authorization.captured += amount
+	return fp.remember(idempotencyKey, &payment.Transaction{ID: fp.nextID("cap"), AuthorizationID: authorizationID, Amount: amount}), nil
+}
+
+func (fp *FakeProvider) Refund(ctx context.Context, authorizationID string, amount int, idempotencyKey string) (*payment.Transaction, error) {
+	fp.mu.Lock()
+	defer fp.mu.Unlock()
+	if transaction, ok := fp.transactions[idempotencyKey]; ok {
+		return transaction, nil
+	}
+	authorization, ok := fp.authorizations[authorizationID]
+	if !ok {
+		return nil, fmt.Errorf("authorization %s not found", authorizationID)
+	}
+	if authorization.captured == 0 {
+		if authorization.released {
+			return nil, fmt.Errorf("authorization %s was already released", authorizationID)
+		}
+		authorization.released = true
+		return fp.remember(idempotencyKey, &payment.Transaction{ID: fp.nextID("void"), AuthorizationID: authorizationID, Amount: authorization.amount}), nil
+	}
+	if amount <= 0 || authorization.refunded+amount > authorization.captured {
+		return nil, fmt.Errorf("refund of %d exceeds the captured amount of %s", amount, authorizationID)
+	}
+	authorization.refunded += amount
+	return fp.remember(idempotencyKey, &payment.Transaction{ID: fp.nextID("ref"), AuthorizationID: authorizationID, Amount: amount}), nil
+}
+
+func (fp *FakeProvider) VerifyWebhook(payload []byte, signature string) (*payment.WebhookEvent, error) {
+	expected := fp.SignWebhook(payload)
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return nil, payment.ErrInvalidSignature
+	}
+	var event payment.WebhookEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+// SignWebhook returns the signature the fake provider expects for a webhook payload.
+func (fp *FakeProvider) SignWebhook(payload []byte) string {
+	mac := hmac.New(sha256.New, fp.webhookSecret)
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// remember keeps the transaction under its idempotency key, a call without a key is not
+// remembered.
+func (fp *FakeProvider) remember(idempotencyKey string, transaction *payment.Transaction) *payment.Transaction {
+	if idempotencyKey != "" {
+		fp.transactions[idempotencyKey] = transaction
+	}
+	return transaction
+}
+
+func (fp *FakeProvider) nextID(prefix string) string {
+	fp.sequence++
+	return fmt.Sprintf("fake_%s_%06d", prefix, fp.sequence)
+}
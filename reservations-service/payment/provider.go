@@ -0,0 +1,88 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+const (
+	EventCaptured             = "payment.captured"
+	EventRefunded             = "payment.refunded"
+	EventFailed               = "payment.failed"
+	EventAuthorizationExpired = "authorization.expired"
+)
+
+var ErrInvalidSignature = errors.New("invalid webhook signature")
+
+// Provider is a payment gateway. Amounts are in the smallest unit the accommodation prices use.
+// Refunding an authorization that was not captured yet releases the held amount. A capture or
+// refund sent again with the same idempotency key returns the transaction of the first one
+// without moving money again, so a call whose outcome was lost can be retried.
+type Provider interface {
+	Name() string
+	// WebhookSignatureHeader is the header webhooks carry their signature in.
+	WebhookSignatureHeader() string
+	Authorize(ctx context.Context, request AuthorizeRequest) (*Authorization, error)
+	Capture(ctx context.Context, authorizationID string, amount int, idempotencyKey string) (*Transaction, error)
+	Refund(ctx context.Context, authorizationID string, amount int, idempotencyKey string) (*Transaction, error)
+	VerifyWebhook(payload []byte, signature string) (*WebhookEvent, error)
+}
+
+type AuthorizeRequest struct {
+	Reference    string
+	Amount       int
+	Currency     string
+	PaymentToken string
+}
+
+type Authorization struct {
+	ID       string
+	Amount   int
+	Currency string
+}
+
+type Transaction struct {
+	ID              string
+	AuthorizationID string
+	Amount          int
+}
+
+// WebhookEvent is an asynchronous update of an authorization. Amount is the total captured or
+// refunded on the authorization so far, so replaying an event is harmless.
+type WebhookEvent struct {
+	ID              string `json:"id"`
+	Type            string `json:"type"`
+	AuthorizationID string `json:"authorizationId"`
+	Amount          int    `json:"amount"`
+}
+
+// DeclinedError is returned by Authorize when the provider refuses the payment method.
+type DeclinedError struct {
+	Reason string
+}
+
+func (e *DeclinedError) Error() string {
+	return "payment declined: " + e.Reason
+}
+
+// New returns the provider configured by name. Payments that only live in memory can't be
+// captured after a restart or on another replica, and webhooks signed with an empty secret can
+// be forged by anyone, so there is no default provider and the webhook secret is required. The
+// fake provider of the paymenttest package is for tests only.
+func New(name, apiKey, webhookSecret string) (Provider, error) {
+	if webhookSecret == "" {
+		return nil, errors.New("payment webhook secret is required")
+	}
+	switch name {
+	case "stripe":
+		if apiKey == "" {
+			return nil, errors.New("stripe payment provider needs an API key")
+		}
+		return NewStripeProvider(apiKey, webhookSecret), nil
+	case "":
+		return nil, errors.New("payment provider is required")
+	default:
+		return nil, fmt.Errorf("unknown payment provider %q", name)
+	}
+}
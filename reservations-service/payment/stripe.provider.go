@@ -0,0 +1,265 @@
+package payment
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	stripeAPIURL = "https://api.stripe.com"
+	// stripeSignatureTolerance is how old a webhook may be, an older one is taken for a replay.
+	stripeSignatureTolerance = 5 * time.Minute
+)
+
+// StripeProvider takes payments through Stripe payment intents. An authorization is a payment
+// intent confirmed with manual capture, which holds the amount until it is captured or
+// canceled. Amounts are sent as they are, in the smallest unit of the currency.
+type StripeProvider struct {
+	apiURL        string
+	apiKey        string
+	webhookSecret []byte
+	client        *http.Client
+	now           func() time.Time
+}
+
+var _ Provider = (*StripeProvider)(nil)
+
+func NewStripeProvider(apiKey, webhookSecret string) *StripeProvider {
+	return &StripeProvider{
+		apiURL:        stripeAPIURL,
+		apiKey:        apiKey,
+		webhookSecret: []byte(webhookSecret),
+		client:        &http.Client{Timeout: 30 * time.Second},
+		now:           time.Now,
+	}
+}
+
+type stripePaymentIntent struct {
+	ID                 string `json:"id"`
+	Status             string `json:"status"`
+	Amount             int    `json:"amount"`
+	AmountReceived     int    `json:"amount_received"`
+	Currency           string `json:"currency"`
+	LatestCharge       string `json:"latest_charge"`
+	CancellationReason string `json:"cancellation_reason"`
+}
+
+type stripeCharge struct {
+	ID             string `json:"id"`
+	PaymentIntent  string `json:"payment_intent"`
+	AmountRefunded int    `json:"amount_refunded"`
+}
+
+type stripeRefund struct {
+	ID     string `json:"id"`
+	Amount int    `json:"amount"`
+}
+
+type stripeError struct {
+	Type        string `json:"type"`
+	Code        string `json:"code"`
+	DeclineCode string `json:"decline_code"`
+	Message     string `json:"message"`
+}
+
+type stripeEvent struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+	Data struct {
+		Object json.RawMessage `json:"object"`
+	} `json:"data"`
+}
+
+func (sp *StripeProvider) Name() string {
+	return "stripe"
+}
+
+func (sp *StripeProvider) WebhookSignatureHeader() string {
+	return "Stripe-Signature"
+}
+
+func (sp *StripeProvider) Authorize(ctx context.Context, request AuthorizeRequest) (*Authorization, error) {
+	if request.PaymentToken == "" {
+		return nil, &DeclinedError{Reason: "missing payment method"}
+	}
+	form := url.Values{}
+	form.Set("amount", strconv.Itoa(request.Amount))
+	form.Set("currency", strings.ToLower(request.Currency))
+	form.Set("payment_method", request.PaymentToken)
+	form.Set("capture_method", "manual")
+	form.Set("confirm", "true")
+	form.Set("automatic_payment_methods[enabled]", "true")
+	form.Set("automatic_payment_methods[allow_redirects]", "never")
+	form.Set("metadata[reference]", request.Reference)
+	var intent stripePaymentIntent
+	if err := sp.post(ctx, "/v1/payment_intents", form, "authorize-"+request.Reference, &intent); err != nil {
+		return nil, err
+	}
+	if intent.Status != "requires_capture" {
+		return nil, &DeclinedError{Reason: "payment is " + strings.ReplaceAll(intent.Status, "_", " ")}
+	}
+	return &Authorization{ID: intent.ID, Amount: intent.Amount, Currency: strings.ToUpper(intent.Currency)}, nil
+}
+
+func (sp *StripeProvider) Capture(ctx context.Context, authorizationID string, amount int, idempotencyKey string) (*Transaction, error) {
+	form := url.Values{}
+	form.Set("amount_to_capture", strconv.Itoa(amount))
+	var intent stripePaymentIntent
+	if err := sp.post(ctx, "/v1/payment_intents/"+url.PathEscape(authorizationID)+"/capture", form, idempotencyKey, &intent); err != nil {
+		return nil, err
+	}
+	return &Transaction{ID: intent.LatestCharge, AuthorizationID: intent.ID, Amount: intent.AmountReceived}, nil
+}
+
+// Refund cancels a payment intent that wasn't captured yet, which releases the held amount, and
+// refunds a captured one.
+func (sp *StripeProvider) Refund(ctx context.Context, authorizationID string, amount int, idempotencyKey string) (*Transaction, error) {
+	var intent stripePaymentIntent
+	if err := sp.get(ctx, "/v1/payment_intents/"+url.PathEscape(authorizationID), &intent); err != nil {
+		return nil, err
+	}
+	switch intent.Status {
+	case "canceled":
+		// Released by an earlier call whose outcome was lost.
+		return &Transaction{ID: intent.ID, AuthorizationID: intent.ID, Amount: intent.Amount}, nil
+	case "requires_capture":
+		if err := sp.post(ctx, "/v1/payment_intents/"+url.PathEscape(authorizationID)+"/cancel", url.Values{}, idempotencyKey, &intent); err != nil {
+			return nil, err
+		}
+		return &Transaction{ID: intent.ID, AuthorizationID: intent.ID, Amount: intent.Amount}, nil
+	}
+	form := url.Values{}
+	form.Set("payment_intent", authorizationID)
+	form.Set("amount", strconv.Itoa(amount))
+	var refund stripeRefund
+	if err := sp.post(ctx, "/v1/refunds", form, idempotencyKey, &refund); err != nil {
+		return nil, err
+	}
+	return &Transaction{ID: refund.ID, AuthorizationID: authorizationID, Amount: refund.Amount}, nil
+}
+
+// VerifyWebhook checks the Stripe-Signature of a webhook, an HMAC-SHA256 of its timestamp and
+// payload, and turns the events the service follows into WebhookEvents. Other events keep their
+// Stripe type and are ignored by the service.
+func (sp *StripeProvider) VerifyWebhook(payload []byte, signature string) (*WebhookEvent, error) {
+	var timestamp string
+	var signatures []string
+	for _, part := range strings.Split(signature, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return nil, ErrInvalidSignature
+	}
+	if age := sp.now().Sub(time.Unix(seconds, 0)); age > stripeSignatureTolerance || age < -stripeSignatureTolerance {
+		return nil, ErrInvalidSignature
+	}
+	mac := hmac.New(sha256.New, sp.webhookSecret)
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(payload)
+	expected := []byte(hex.EncodeToString(mac.Sum(nil)))
+	valid := false
+	for _, candidate := range signatures {
+		if hmac.Equal(expected, []byte(candidate)) {
+			valid = true
+		}
+	}
+	if !valid {
+		return nil, ErrInvalidSignature
+	}
+
+	var event stripeEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, err
+	}
+	result := &WebhookEvent{ID: event.ID, Type: event.Type}
+	switch event.Type {
+	case "payment_intent.succeeded", "payment_intent.payment_failed", "payment_intent.canceled":
+		var intent stripePaymentIntent
+		if err := json.Unmarshal(event.Data.Object, &intent); err != nil {
+			return nil, err
+		}
+		result.AuthorizationID = intent.ID
+		switch {
+		case event.Type == "payment_intent.succeeded":
+			result.Type = EventCaptured
+			result.Amount = intent.AmountReceived
+		case event.Type == "payment_intent.payment_failed":
+			result.Type = EventFailed
+		case intent.CancellationReason == "automatic":
+			// Only an authorization that ran out is canceled automatically, the service cancels
+			// the others itself.
+			result.Type = EventAuthorizationExpired
+		}
+	case "charge.refunded":
+		var charge stripeCharge
+		if err := json.Unmarshal(event.Data.Object, &charge); err != nil {
+			return nil, err
+		}
+		result.Type = EventRefunded
+		result.AuthorizationID = charge.PaymentIntent
+		result.Amount = charge.AmountRefunded
+	}
+	return result, nil
+}
+
+func (sp *StripeProvider) get(ctx context.Context, path string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, sp.apiURL+path, nil)
+	if err != nil {
+		return err
+	}
+	return sp.do(req, out)
+}
+
+// post sends a form to the API. Requests with the same idempotency key are answered with the
+// response to the first one, without doing anything again.
+func (sp *StripeProvider) post(ctx context.Context, path string, form url.Values, idempotencyKey string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sp.apiURL+path, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if idempotencyKey != "" {
+		req.Header.Set("Idempotency-Key", idempotencyKey)
+	}
+	return sp.do(req, out)
+}
+
+func (sp *StripeProvider) do(req *http.Request, out interface{}) error {
+	req.SetBasicAuth(sp.apiKey, "")
+	resp, err := sp.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+	var failure struct {
+		Error stripeError `json:"error"`
+	}
+	_ = json.NewDecoder(resp.Body).Decode(&failure)
+	if failure.Error.Type == "card_error" {
+		reason := failure.Error.Message
+		if reason == "" {
+			reason = strings.ReplaceAll(failure.Error.DeclineCode, "_", " ")
+		}
+		return &DeclinedError{Reason: reason}
+	}
+	return fmt.Errorf("stripe responded to %s %s with status %d: %s", req.Method, req.URL.Path, resp.StatusCode, failure.Error.Message)
+}
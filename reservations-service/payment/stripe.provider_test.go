@@ -0,0 +1,116 @@
+package payment
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func newTestStripeProvider(t *testing.T, handler http.HandlerFunc) *StripeProvider {
+	t.Helper()
+	provider := NewStripeProvider("sk_test", "whsec_test")
+	if handler != nil {
+		srv := httptest.NewServer(handler)
+		t.Cleanup(srv.Close)
+		provider.apiURL = srv.URL
+		provider.client = srv.Client()
+	}
+	return provider
+}
+
+func signStripe(secret string, at time.Time, payload []byte) string {
+	timestamp := strconv.FormatInt(at.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(payload)
+	return "t=" + timestamp + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestStripeVerifyWebhook(t *testing.T) {
+	provider := newTestStripeProvider(t, nil)
+	payload := []byte(`{"id":"evt_1","type":"charge.refunded","data":{"object":{"id":"ch_1","payment_intent":"pi_1","amount_refunded":150}}}`)
+
+	event, err := provider.VerifyWebhook(payload, signStripe("whsec_test", time.Now(), payload))
+	if err != nil {
+		t.Fatalf("verifying webhook: %v", err)
+	}
+	if *event != (WebhookEvent{ID: "evt_1", Type: EventRefunded, AuthorizationID: "pi_1", Amount: 150}) {
+		t.Fatalf("got %+v", event)
+	}
+
+	for name, signature := range map[string]string{
+		"wrong secret": signStripe("other", time.Now(), payload),
+		"replayed":     signStripe("whsec_test", time.Now().Add(-time.Hour), payload),
+		"empty":        "",
+	} {
+		if _, err := provider.VerifyWebhook(payload, signature); !errors.Is(err, ErrInvalidSignature) {
+			t.Errorf("%s signature got %v, want %v", name, err, ErrInvalidSignature)
+		}
+	}
+}
+
+func TestStripeWebhookExpiresOnlyAutomaticCancellation(t *testing.T) {
+	provider := newTestStripeProvider(t, nil)
+	for reason, want := range map[string]string{"automatic": EventAuthorizationExpired, "requested_by_customer": "payment_intent.canceled"} {
+		payload := []byte(`{"id":"evt_1","type":"payment_intent.canceled","data":{"object":{"id":"pi_1","cancellation_reason":"` + reason + `"}}}`)
+		event, err := provider.VerifyWebhook(payload, signStripe("whsec_test", time.Now(), payload))
+		if err != nil {
+			t.Fatalf("verifying webhook: %v", err)
+		}
+		if event.Type != want {
+			t.Errorf("cancellation %s is %s, want %s", reason, event.Type, want)
+		}
+	}
+}
+
+func TestStripeAuthorize(t *testing.T) {
+	provider := newTestStripeProvider(t, func(rw http.ResponseWriter, r *http.Request) {
+		if user, _, _ := r.BasicAuth(); user != "sk_test" || r.Header.Get("Idempotency-Key") != "authorize-res-1" {
+			rw.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_ = r.ParseForm()
+		if r.PostForm.Get("payment_method") == "pm_card_declined" {
+			rw.WriteHeader(http.StatusPaymentRequired)
+			_, _ = rw.Write([]byte(`{"error":{"type":"card_error","decline_code":"generic_decline","message":"Your card was declined."}}`))
+			return
+		}
+		if r.PostForm.Get("capture_method") != "manual" {
+			rw.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		_, _ = rw.Write([]byte(`{"id":"pi_1","status":"requires_capture","amount":` + r.PostForm.Get("amount") + `,"currency":"eur"}`))
+	})
+
+	authorization, err := provider.Authorize(context.Background(), AuthorizeRequest{Reference: "res-1", Amount: 200, Currency: "EUR", PaymentToken: "pm_card_visa"})
+	if err != nil {
+		t.Fatalf("authorizing: %v", err)
+	}
+	if *authorization != (Authorization{ID: "pi_1", Amount: 200, Currency: "EUR"}) {
+		t.Fatalf("got %+v", authorization)
+	}
+
+	_, err = provider.Authorize(context.Background(), AuthorizeRequest{Reference: "res-1", Amount: 200, Currency: "EUR", PaymentToken: "pm_card_declined"})
+	var declined *DeclinedError
+	if !errors.As(err, &declined) {
+		t.Fatalf("declined card got %v, want a DeclinedError", err)
+	}
+}
+
+func TestNewRefusesMissingProviderAndSecret(t *testing.T) {
+	for _, config := range [][3]string{{"", "sk_test", "whsec"}, {"fake", "sk_test", "whsec"}, {"stripe", "", "whsec"}, {"stripe", "sk_test", ""}} {
+		if _, err := New(config[0], config[1], config[2]); err == nil {
+			t.Errorf("New(%q, %q, %q) succeeded", config[0], config[1], config[2])
+		}
+	}
+	if _, err := New("stripe", "sk_test", "whsec"); err != nil {
+		t.Fatalf("New with stripe: %v", err)
+	}
+}
@@ -0,0 +1,230 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"reservation-service/errors"
+	"sort"
+
+	"github.com/gocql/gocql"
+)
+
+// conflictConsistency is what the reads a booking is checked against run at, so they see every
+// booking, block and hold written at the write consistency instead of a replica that missed it.
+const conflictConsistency = gocql.LocalQuorum
+
+// night is a row of availability_by_date. The table keeps one row per night of an accommodation,
+// partitioned by accommodation and month, so a date range check is a slice over at most a couple of partitions instead of a
+// date_range CONTAINS query per night. A night is free when availability_id is set and booked when
+// reservation_id is set.
+type night struct {
+	date           string
+	price          int
+	availabilityID gocql.UUID
+	reservationID  gocql.UUID
+}
+
+func (n night) isFree() bool {
+	return n.availabilityID != (gocql.UUID{})
+}
+
+func (n night) isReserved() bool {
+	return n.reservationID != (gocql.UUID{})
+}
+
+func monthOf(date string) string {
+	if len(date) < 7 {
+		return date
+	}
+	return date[:7]
+}
+
+// nightsInRange returns the stored nights of an accommodation between the first and the last date
+// of dateRange, keyed by date.
+func (rr *ReservationRepo) nightsInRange(ctx context.Context, accommodationID string, dateRange []string) (map[string]night, error) {
+	nights := make(map[string]night)
+	if len(dateRange) == 0 {
+		return nights, nil
+	}
+	dates := append([]string(nil), dateRange...)
+	sort.Strings(dates)
+	var months []string
+	for _, date := range dates {
+		if month := monthOf(date); len(months) == 0 || months[len(months)-1] != month {
+			months = append(months, month)
+		}
+	}
+
+	iter := rr.session.Query(`SELECT date, price, availability_id, reservation_id FROM availability_by_date
+		WHERE accommodation_id = ? AND month IN ? AND date >= ? AND date <= ?`,
+		accommodationID, months, dates[0], dates[len(dates)-1]).Consistency(conflictConsistency).Iter()
+	var n night
+	for iter.Scan(&n.date, &n.price, &n.availabilityID, &n.reservationID) {
+		nights[n.date] = n
+		n = night{}
+	}
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+	return nights, nil
+}
+
+func addFreeNights(batch *gocql.Batch, accommodationID string, availabilityID gocql.UUID, price int, dates []string) {
+	for _, date := range dates {
+		batch.Query(`INSERT INTO availability_by_date (accommodation_id, month, date, price, availability_id) VALUES(?, ?, ?, ?, ?)`,
+			accommodationID, monthOf(date), date, price, availabilityID)
+	}
+}
+
+// removeFreeNights takes the nights out of availability. Only the availability columns are
+// cleared, a night that is still reserved keeps its reservation.
+func removeFreeNights(batch *gocql.Batch, accommodationID string, dates []string) {
+	for _, date := range dates {
+		batch.Query(`UPDATE availability_by_date SET price = null, availability_id = null WHERE accommodation_id = ? AND month = ? AND date = ?`,
+			accommodationID, monthOf(date), date)
+	}
+}
+
+func reserveNights(batch *gocql.Batch, accommodationID string, reservationID gocql.UUID, dates []string) {
+	for _, date := range dates {
+		batch.Query(`UPDATE availability_by_date SET reservation_id = ? WHERE accommodation_id = ? AND month = ? AND date = ?`,
+			reservationID, accommodationID, monthOf(date), date)
+	}
+}
+
+// claimNights reserves nights of an accommodation for a reservation, every night only if no
+// reservation has it yet. The nights of a month share a partition and are claimed in one
+// conditional batch. When another reservation got any of the nights first, the nights claimed so
+// far are given back and claimNights returns false.
+func (rr *ReservationRepo) claimNights(ctx context.Context, accommodationID string, reservationID gocql.UUID, dates []string) (bool, *errors.ReservationError) {
+	var claimed []string
+	for _, monthDates := range byMonth(dates) {
+		batch := rr.newBatch(gocql.LoggedBatch)
+		for _, date := range monthDates {
+			batch.Query(`UPDATE availability_by_date SET reservation_id = ? WHERE accommodation_id = ? AND month = ? AND date = ?
+				IF reservation_id = null`, reservationID, accommodationID, monthOf(date), date)
+		}
+		applied, iter, err := rr.session.MapExecuteBatchCAS(batch, map[string]interface{}{})
+		if iter != nil {
+			_ = iter.Close()
+		}
+		if err != nil || !applied {
+			rr.unclaimNights(ctx, accommodationID, reservationID, claimed)
+			if err != nil {
+				return false, rr.availabilityDatabaseError(err)
+			}
+			rr.logger.LogWarn("reservationRepo", fmt.Sprintf("Nights of accommodation %s in %s were reserved by another reservation first",
+				accommodationID, monthOf(monthDates[0])))
+			return false, nil
+		}
+		claimed = append(claimed, monthDates...)
+	}
+	return true, nil
+}
+
+// unclaimNights gives back nights claimed for a reservation that couldn't be stored. Nights
+// another reservation has meanwhile are left as they are.
+func (rr *ReservationRepo) unclaimNights(ctx context.Context, accommodationID string, reservationID gocql.UUID, dates []string) {
+	for _, monthDates := range byMonth(dates) {
+		batch := rr.newBatch(gocql.LoggedBatch)
+		for _, date := range monthDates {
+			batch.Query(`UPDATE availability_by_date SET reservation_id = null WHERE accommodation_id = ? AND month = ? AND date = ?
+				IF reservation_id = ?`, accommodationID, monthOf(date), date, reservationID)
+		}
+		_, iter, err := rr.session.MapExecuteBatchCAS(batch, map[string]interface{}{})
+		if iter != nil {
+			_ = iter.Close()
+		}
+		if err != nil {
+			rr.logger.LogError("reservationsRepo", fmt.Sprintf("Unable to give back nights %v of accommodation %s: %v", monthDates, accommodationID, err))
+		}
+	}
+}
+
+// byMonth groups sorted copies of dates by the month, and so the partition, they fall into.
+func byMonth(dates []string) [][]string {
+	sorted := append([]string(nil), dates...)
+	sort.Strings(sorted)
+	var months [][]string
+	for i, date := range sorted {
+		if i == 0 || monthOf(date) != monthOf(sorted[i-1]) {
+			months = append(months, nil)
+		}
+		months[len(months)-1] = append(months[len(months)-1], date)
+	}
+	return months
+}
+
+// subtractDates returns the dates that are not in other.
+func subtractDates(dates, other []string) []string {
+	excluded := make(map[string]struct{}, len(other))
+	for _, date := range other {
+		excluded[date] = struct{}{}
+	}
+	var result []string
+	for _, date := range dates {
+		if _, ok := excluded[date]; !ok {
+			result = append(result, date)
+		}
+	}
+	return result
+}
+
+func releaseNights(batch *gocql.Batch, accommodationID string, dates []string) {
+	for _, date := range dates {
+		batch.Query(`UPDATE availability_by_date SET reservation_id = null WHERE accommodation_id = ? AND month = ? AND date = ?`,
+			accommodationID, monthOf(date), date)
+	}
+}
+
+// BackfillAvailabilityByDate fills availability_by_date from free_accommodation and
+// reservation_by_accommodation. Every write is an upsert, so running it again is harmless.
+func (rr *ReservationRepo) BackfillAvailabilityByDate(ctx context.Context) error {
+	ctx, span := rr.tracer.Start(ctx, "ReservationRepo.BackfillAvailabilityByDate")
+	defer span.End()
+	var accommodationID string
+	var id gocql.UUID
+	var price int
+	var dateRange []string
+
+	freeNights := 0
+	iter := rr.session.Query(`SELECT accommodation_id, id, price, date_range FROM free_accommodation`).Iter()
+	for iter.Scan(&accommodationID, &id, &price, &dateRange) {
+		batch := rr.newBatch(gocql.UnloggedBatch)
+		addFreeNights(batch, accommodationID, id, price, dateRange)
+		if err := rr.session.ExecuteBatch(batch); err != nil {
+			_ = iter.Close()
+			return err
+		}
+		freeNights += len(dateRange)
+	}
+	if err := iter.Close(); err != nil {
+		return err
+	}
+
+	reservedNights := 0
+	var isActive bool
+	iter = rr.session.Query(`SELECT accommodation_id, id, date_range, is_active FROM reservation_by_accommodation`).Iter()
+	for iter.Scan(&accommodationID, &id, &dateRange, &isActive) {
+		if !isActive {
+			continue
+		}
+		batch := rr.newBatch(gocql.UnloggedBatch)
+		reserveNights(batch, accommodationID, id, dateRange)
+		if err := rr.session.ExecuteBatch(batch); err != nil {
+			_ = iter.Close()
+			return err
+		}
+		reservedNights += len(dateRange)
+	}
+	if err := iter.Close(); err != nil {
+		return err
+	}
+	rr.logger.LogInfo("reservationRepo", fmt.Sprintf("Backfilled availability_by_date with %d free and %d reserved nights", freeNights, reservedNights))
+	return nil
+}
+
+func (rr *ReservationRepo) availabilityDatabaseError(err error) *errors.ReservationError {
+	rr.logger.LogError("reservationsRepo", err.Error())
+	return errors.NewReservationError(500, "Unable to check availability, database error")
+}
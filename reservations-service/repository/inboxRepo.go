@@ -0,0 +1,93 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"reservation-service/domain"
+	"reservation-service/errors"
+	"time"
+)
+
+// ClaimInboxMessage records a received message as being handled by owner. A message received
+// before is taken over when it is still being handled by a claim made before staleBefore,
+// otherwise ClaimInboxMessage returns false and the earlier record.
+func (rr *ReservationRepo) ClaimInboxMessage(ctx context.Context, messageID, owner string, staleBefore time.Time) (bool, *domain.InboxMessage, *errors.ReservationError) {
+	ctx, span := rr.tracer.Start(ctx, "ReservationRepo.ClaimInboxMessage")
+	defer span.End()
+	now := time.Now().UTC()
+	existing := map[string]interface{}{}
+	applied, err := rr.session.Query(`INSERT INTO saga_inbox (message_id, status, received_at, owner, claimed_at) VALUES(?, ?, ?, ?, ?) IF NOT EXISTS`,
+		messageID, domain.InboxProcessing, now, owner, now).MapScanCAS(existing)
+	if err != nil {
+		rr.logger.LogError("reservationsRepo", err.Error())
+		return false, nil, errors.NewReservationError(500, "Unable to record message, database error")
+	}
+	if applied {
+		return true, nil, nil
+	}
+	message := &domain.InboxMessage{MessageID: messageID}
+	message.Status, _ = existing["status"].(string)
+	message.Reply, _ = existing["reply"].(string)
+	message.ReceivedAt, _ = existing["received_at"].(time.Time)
+	message.Owner, _ = existing["owner"].(string)
+	message.ClaimedAt, _ = existing["claimed_at"].(time.Time)
+	if message.Status != domain.InboxProcessing {
+		return false, message, nil
+	}
+	// Messages received before claims were recorded have no claimed_at, their age is told by
+	// received_at instead.
+	var takeover string
+	var claimedBefore time.Time
+	if message.ClaimedAt.IsZero() {
+		takeover = `UPDATE saga_inbox SET owner = ?, claimed_at = ? WHERE message_id = ? IF status = ? AND claimed_at = null AND received_at < ?`
+		claimedBefore = message.ReceivedAt
+	} else {
+		takeover = `UPDATE saga_inbox SET owner = ?, claimed_at = ? WHERE message_id = ? IF status = ? AND claimed_at < ?`
+		claimedBefore = message.ClaimedAt
+	}
+	if !claimedBefore.Before(staleBefore) {
+		return false, message, nil
+	}
+	applied, err = rr.session.Query(takeover, owner, now, messageID, domain.InboxProcessing, staleBefore).
+		MapScanCAS(map[string]interface{}{})
+	if err != nil {
+		rr.logger.LogError("reservationsRepo", err.Error())
+		return false, nil, errors.NewReservationError(500, "Unable to record message, database error")
+	}
+	if applied {
+		rr.logger.LogWarn("reservationsRepo", fmt.Sprintf("Took over message %s abandoned by %s", messageID, message.Owner))
+		return true, nil, nil
+	}
+	return false, message, nil
+}
+
+// CompleteInboxMessage stores the reply sent for a message, as long as owner still holds the
+// claim on it.
+func (rr *ReservationRepo) CompleteInboxMessage(ctx context.Context, messageID, owner, reply string) *errors.ReservationError {
+	ctx, span := rr.tracer.Start(ctx, "ReservationRepo.CompleteInboxMessage")
+	defer span.End()
+	applied, err := rr.session.Query(`UPDATE saga_inbox SET status = ?, reply = ? WHERE message_id = ? IF owner = ?`,
+		domain.InboxDone, reply, messageID, owner).Consistency(rr.writeConsistency).MapScanCAS(map[string]interface{}{})
+	if err != nil {
+		rr.logger.LogError("reservationsRepo", err.Error())
+		return errors.NewReservationError(500, "Unable to record reply, database error")
+	}
+	if !applied {
+		rr.logger.LogWarn("reservationsRepo", fmt.Sprintf("Message %s was taken over, its reply was not recorded", messageID))
+	}
+	return nil
+}
+
+// ReleaseInboxMessage forgets a message that couldn't be handled, so a redelivery handles it.
+// A message taken over by another owner is left alone.
+func (rr *ReservationRepo) ReleaseInboxMessage(ctx context.Context, messageID, owner string) *errors.ReservationError {
+	ctx, span := rr.tracer.Start(ctx, "ReservationRepo.ReleaseInboxMessage")
+	defer span.End()
+	_, err := rr.session.Query(`DELETE FROM saga_inbox WHERE message_id = ? IF owner = ?`, messageID, owner).
+		Consistency(rr.writeConsistency).MapScanCAS(map[string]interface{}{})
+	if err != nil {
+		rr.logger.LogError("reservationsRepo", err.Error())
+		return errors.NewReservationError(500, "Unable to release message, database error")
+	}
+	return nil
+}
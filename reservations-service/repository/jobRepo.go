@@ -0,0 +1,135 @@
+package repository
+
+import (
+	"context"
+	"reservation-service/domain"
+	"reservation-service/errors"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+const jobBucketLayout = "2006-01-02T15"
+
+// JobBucket is the bucket of the hour a job runs in.
+func JobBucket(runAt time.Time) string {
+	return runAt.UTC().Format(jobBucketLayout)
+}
+
+func (rr *ReservationRepo) InsertJob(ctx context.Context, job *domain.Job) *errors.ReservationError {
+	ctx, span := rr.tracer.Start(ctx, "ReservationRepo.InsertJob")
+	defer span.End()
+	err := rr.session.Query(`INSERT INTO scheduled_jobs (bucket, run_at, id, kind, payload, status, attempts) VALUES(?, ?, ?, ?, ?, ?, ?)`,
+		job.Bucket, job.RunAt, job.Id, job.Kind, job.Payload, job.Status, job.Attempts).Consistency(rr.writeConsistency).Exec()
+	if err != nil {
+		rr.logger.LogError("reservationsRepo", err.Error())
+		return errors.NewReservationError(500, "Unable to schedule job, database error")
+	}
+	return nil
+}
+
+// GetJobs returns the jobs of a bucket that are due by now.
+func (rr *ReservationRepo) GetJobs(ctx context.Context, bucket string, now time.Time) ([]domain.Job, *errors.ReservationError) {
+	ctx, span := rr.tracer.Start(ctx, "ReservationRepo.GetJobs")
+	defer span.End()
+	iter := rr.session.Query(`SELECT bucket, run_at, id, kind, payload, status, attempts, owner, claimed_at, last_error
+		FROM scheduled_jobs WHERE bucket = ? AND run_at <= ?`, bucket, now).Iter()
+	jobs := []domain.Job{}
+	var job domain.Job
+	for iter.Scan(&job.Bucket, &job.RunAt, &job.Id, &job.Kind, &job.Payload, &job.Status, &job.Attempts, &job.Owner,
+		&job.ClaimedAt, &job.LastError) {
+		jobs = append(jobs, job)
+	}
+	if err := iter.Close(); err != nil {
+		rr.logger.LogError("reservationsRepo", err.Error())
+		return nil, errors.NewReservationError(500, "Unable to retrieve jobs, database error")
+	}
+	return jobs, nil
+}
+
+// ClaimJob marks a pending job as running for owner. Only one claim of a job succeeds.
+func (rr *ReservationRepo) ClaimJob(ctx context.Context, job *domain.Job, owner string, claimedAt time.Time) (bool, *errors.ReservationError) {
+	ctx, span := rr.tracer.Start(ctx, "ReservationRepo.ClaimJob")
+	defer span.End()
+	applied, err := rr.session.Query(`UPDATE scheduled_jobs SET status = ?, owner = ?, claimed_at = ?
+		WHERE bucket = ? AND run_at = ? AND id = ? IF status = ?`,
+		domain.JobRunning, owner, claimedAt, job.Bucket, job.RunAt, job.Id, domain.JobPending).MapScanCAS(map[string]interface{}{})
+	if err != nil {
+		rr.logger.LogError("reservationsRepo", err.Error())
+		return false, errors.NewReservationError(500, "Unable to claim job, database error")
+	}
+	if applied {
+		job.Status = domain.JobRunning
+		job.Owner = owner
+		job.ClaimedAt = claimedAt
+	}
+	return applied, nil
+}
+
+// FinishJob stores the outcome of a job, as long as the job is still claimed by its owner. It
+// tells whether the outcome was stored.
+func (rr *ReservationRepo) FinishJob(ctx context.Context, job *domain.Job) (bool, *errors.ReservationError) {
+	ctx, span := rr.tracer.Start(ctx, "ReservationRepo.FinishJob")
+	defer span.End()
+	applied, err := rr.session.Query(`UPDATE scheduled_jobs SET status = ?, attempts = ?, last_error = ?
+		WHERE bucket = ? AND run_at = ? AND id = ? IF owner = ? AND claimed_at = ?`,
+		job.Status, job.Attempts, job.LastError, job.Bucket, job.RunAt, job.Id, job.Owner, job.ClaimedAt).MapScanCAS(map[string]interface{}{})
+	if err != nil {
+		rr.logger.LogError("reservationsRepo", err.Error())
+		return false, errors.NewReservationError(500, "Unable to finish job, database error")
+	}
+	return applied, nil
+}
+
+// ReleaseJob puts a job that was claimed at claimedAt and never finished back to pending.
+func (rr *ReservationRepo) ReleaseJob(ctx context.Context, job *domain.Job) (bool, *errors.ReservationError) {
+	ctx, span := rr.tracer.Start(ctx, "ReservationRepo.ReleaseJob")
+	defer span.End()
+	applied, err := rr.session.Query(`UPDATE scheduled_jobs SET status = ? WHERE bucket = ? AND run_at = ? AND id = ?
+		IF status = ? AND claimed_at = ?`,
+		domain.JobPending, job.Bucket, job.RunAt, job.Id, domain.JobRunning, job.ClaimedAt).MapScanCAS(map[string]interface{}{})
+	if err != nil {
+		rr.logger.LogError("reservationsRepo", err.Error())
+		return false, errors.NewReservationError(500, "Unable to release job, database error")
+	}
+	return applied, nil
+}
+
+// AcquireLease takes the lease for owner if nobody holds it, or extends it if owner already
+// does. The lease runs out after ttl unless it is renewed.
+func (rr *ReservationRepo) AcquireLease(ctx context.Context, name, owner string, ttl time.Duration) (bool, *errors.ReservationError) {
+	ctx, span := rr.tracer.Start(ctx, "ReservationRepo.AcquireLease")
+	defer span.End()
+	seconds := int(ttl.Seconds())
+	applied, err := rr.session.Query(`INSERT INTO job_leases (name, owner) VALUES(?, ?) IF NOT EXISTS USING TTL ?`,
+		name, owner, seconds).MapScanCAS(map[string]interface{}{})
+	if err == nil && !applied {
+		applied, err = rr.session.Query(`UPDATE job_leases USING TTL ? SET owner = ? WHERE name = ? IF owner = ?`,
+			seconds, owner, name, owner).MapScanCAS(map[string]interface{}{})
+	}
+	if err != nil {
+		rr.logger.LogError("reservationsRepo", err.Error())
+		return false, errors.NewReservationError(500, "Unable to acquire lease, database error")
+	}
+	return applied, nil
+}
+
+// DeactivateReservation marks a reservation as no longer active in every reservation table.
+func (rr *ReservationRepo) DeactivateReservation(ctx context.Context, reservation *domain.Reservation) *errors.ReservationError {
+	ctx, span := rr.tracer.Start(ctx, "ReservationRepo.DeactivateReservation")
+	defer span.End()
+	batch := rr.newBatch(gocql.LoggedBatch)
+	batch.Query(`UPDATE reservations SET is_active = false WHERE continent = ? AND country = ? AND id = ?`,
+		reservation.Continent, reservation.Country, reservation.Id)
+	batch.Query(`UPDATE reservation_by_user SET is_active = false WHERE user_id = ? AND id = ?`,
+		reservation.UserID, reservation.Id)
+	batch.Query(`UPDATE reservation_by_host SET is_active = false WHERE host_id = ? AND user_id = ? AND end_date = ? AND id = ?`,
+		reservation.HostID, reservation.UserID, reservation.EndDate, reservation.Id)
+	batch.Query(`UPDATE reservation_by_accommodation SET is_active = false WHERE accommodation_id = ? AND user_id = ? AND end_date = ? AND id = ?`,
+		reservation.AccommodationID, reservation.UserID, reservation.EndDate, reservation.Id)
+	if err := rr.session.ExecuteBatch(batch); err != nil {
+		rr.logger.LogError("reservationsRepo", err.Error())
+		return errors.NewReservationError(500, "Unable to deactivate reservation, database error")
+	}
+	return nil
+}
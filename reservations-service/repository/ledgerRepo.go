@@ -0,0 +1,133 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"reservation-service/domain"
+	"reservation-service/errors"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+// InsertLedgerTransactions stores the entries of one or more transactions of a host in a single
+// logged batch, so they are recorded together or not at all. Entries with the same id as stored
+// ones replace them.
+func (rr *ReservationRepo) InsertLedgerTransactions(ctx context.Context, entries []domain.LedgerEntry) *errors.ReservationError {
+	ctx, span := rr.tracer.Start(ctx, "ReservationRepo.InsertLedgerTransactions")
+	defer span.End()
+	batch, err := rr.ledgerBatch(entries)
+	if err != nil {
+		return err
+	}
+	if err := rr.session.ExecuteBatch(batch); err != nil {
+		rr.logger.LogError("reservationsRepo", err.Error())
+		return errors.NewReservationError(500, "Unable to record ledger transaction, database error")
+	}
+	rr.logger.LogInfo("reservationRepo", fmt.Sprintf("Recorded %s ledger transaction %s for host %s", entries[0].Type, entries[0].TransactionID, entries[0].HostID))
+	return nil
+}
+
+// InsertLedgerPayout stores the entries of a payout if the ledger of the host is still at
+// version, and moves the ledger to the next version. Otherwise nothing is stored, and the
+// version the ledger is at is returned.
+func (rr *ReservationRepo) InsertLedgerPayout(ctx context.Context, entries []domain.LedgerEntry, version int) (bool, int, *errors.ReservationError) {
+	ctx, span := rr.tracer.Start(ctx, "ReservationRepo.InsertLedgerPayout")
+	defer span.End()
+	batch, err := rr.ledgerBatch(entries)
+	if err != nil {
+		return false, 0, err
+	}
+	// The ledger of a host that never had a payout has no version yet.
+	if version == 0 {
+		batch.Query(`UPDATE ledger_entries SET version = ? WHERE host_id = ? IF version = null`, 1, entries[0].HostID)
+	} else {
+		batch.Query(`UPDATE ledger_entries SET version = ? WHERE host_id = ? IF version = ?`, version+1, entries[0].HostID, version)
+	}
+	current := map[string]interface{}{}
+	applied, iter, casErr := rr.session.MapExecuteBatchCAS(batch, current)
+	if iter != nil {
+		_ = iter.Close()
+	}
+	if casErr != nil {
+		rr.logger.LogError("reservationsRepo", casErr.Error())
+		return false, 0, errors.NewReservationError(500, "Unable to record payout, database error")
+	}
+	if !applied {
+		currentVersion, _ := current["version"].(int)
+		return false, currentVersion, nil
+	}
+	rr.logger.LogInfo("reservationRepo", fmt.Sprintf("Recorded payout %s for host %s at ledger version %d", entries[0].TransactionID, entries[0].HostID, version+1))
+	return true, version + 1, nil
+}
+
+// GetLedgerVersion returns the version the ledger of a host is at, 0 before its first payout.
+func (rr *ReservationRepo) GetLedgerVersion(ctx context.Context, hostID string) (int, *errors.ReservationError) {
+	ctx, span := rr.tracer.Start(ctx, "ReservationRepo.GetLedgerVersion")
+	defer span.End()
+	var version int
+	err := rr.session.Query(`SELECT version FROM ledger_entries WHERE host_id = ? LIMIT 1`, hostID).
+		Consistency(conflictConsistency).Scan(&version)
+	if err != nil && err != gocql.ErrNotFound {
+		rr.logger.LogError("reservationsRepo", err.Error())
+		return 0, errors.NewReservationError(500, "Unable to retrieve ledger version, database error")
+	}
+	return version, nil
+}
+
+// ledgerBatch checks that the entries belong to a single host and that each of their
+// transactions balances out, and returns the batch that inserts them.
+func (rr *ReservationRepo) ledgerBatch(entries []domain.LedgerEntry) (*gocql.Batch, *errors.ReservationError) {
+	if len(entries) < 2 {
+		return nil, errors.NewReservationError(500, "A ledger transaction needs at least two entries")
+	}
+	sums := make(map[gocql.UUID]int)
+	for _, entry := range entries {
+		if entry.HostID != entries[0].HostID {
+			return nil, errors.NewReservationError(500, "Ledger entries of a batch must share the host")
+		}
+		sums[entry.TransactionID] += entry.Amount
+	}
+	for transactionID, sum := range sums {
+		if sum != 0 {
+			return nil, errors.NewReservationError(500, fmt.Sprintf("Ledger transaction %s is unbalanced by %d", transactionID, sum))
+		}
+	}
+	batch := rr.newBatch(gocql.LoggedBatch)
+	for _, entry := range entries {
+		batch.Query(`INSERT INTO ledger_entries (host_id, entry_id, transaction_id, reservation_id, account, amount, currency, type, description)
+			VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?)`, entry.HostID, entry.EntryID, entry.TransactionID, entry.ReservationID,
+			entry.Account, entry.Amount, entry.Currency, entry.Type, entry.Description)
+	}
+	return batch, nil
+}
+
+// GetLedgerEntries returns the entries of a host created in [from, to], oldest first. A zero
+// from or to leaves that side open. Entries are read at the consistency conflicts are checked
+// with, so a payout sees every entry written before it.
+func (rr *ReservationRepo) GetLedgerEntries(ctx context.Context, hostID string, from, to time.Time) ([]domain.LedgerEntry, *errors.ReservationError) {
+	ctx, span := rr.tracer.Start(ctx, "ReservationRepo.GetLedgerEntries")
+	defer span.End()
+	if from.IsZero() {
+		from = time.Unix(0, 0)
+	}
+	if to.IsZero() {
+		to = time.Now().Add(time.Hour)
+	}
+	iter := rr.session.Query(`SELECT entry_id, transaction_id, reservation_id, account, amount, currency, type, description
+		FROM ledger_entries WHERE host_id = ? AND entry_id >= minTimeuuid(?) AND entry_id <= maxTimeuuid(?)`,
+		hostID, from, to).Consistency(conflictConsistency).Iter()
+	var entries []domain.LedgerEntry
+	entry := domain.LedgerEntry{HostID: hostID}
+	for iter.Scan(&entry.EntryID, &entry.TransactionID, &entry.ReservationID, &entry.Account, &entry.Amount,
+		&entry.Currency, &entry.Type, &entry.Description) {
+		entry.CreatedAt = entry.EntryID.Time()
+		entries = append(entries, entry)
+		entry = domain.LedgerEntry{HostID: hostID}
+	}
+	if err := iter.Close(); err != nil {
+		rr.logger.LogError("reservationsRepo", err.Error())
+		return nil, errors.NewReservationError(500, "Unable to retrieve ledger entries, database error")
+	}
+	return entries, nil
+}
@@ -0,0 +1,198 @@
+package repository
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"os"
+	"reservation-service/migrations"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+const (
+	// migrationLockTTL frees the lock of a replica that died while migrating.
+	migrationLockTTL  = 10 * time.Minute
+	migrationLockWait = 2 * time.Second
+)
+
+type migration struct {
+	version    int
+	name       string
+	checksum   string
+	statements []string
+	apply      func(ctx context.Context) error
+}
+
+// codeMigrations are the migrations that can't be expressed in CQL, such as data backfills.
+// They share the version sequence with the files in the migrations package.
+func (rr *ReservationRepo) codeMigrations() []migration {
+	return []migration{
+		{version: 4, name: "backfill_availability_by_date", apply: rr.BackfillAvailabilityByDate},
+		{version: 14, name: "backfill_trip_by_reservation", apply: rr.BackfillTripByReservation},
+	}
+}
+
+// Migrate applies every migration that isn't recorded in schema_migrations yet, in version order.
+// It stops at the first failing migration and refuses to continue when an applied migration file
+// was changed afterwards. Replicas starting together take turns through a lock row, the ones
+// waiting find the migrations recorded once they get the lock.
+func (rr *ReservationRepo) Migrate(ctx context.Context) error {
+	ctx, span := rr.tracer.Start(ctx, "ReservationRepo.Migrate")
+	defer span.End()
+	err := rr.session.Query(`CREATE TABLE IF NOT EXISTS schema_migrations
+		(version int, name text, checksum text, applied_at timestamp, PRIMARY KEY(version))`).Exec()
+	if err != nil {
+		return fmt.Errorf("unable to create schema_migrations: %w", err)
+	}
+	err = rr.session.Query(`CREATE TABLE IF NOT EXISTS schema_migration_lock (name text, owner text, PRIMARY KEY(name))`).Exec()
+	if err != nil {
+		return fmt.Errorf("unable to create schema_migration_lock: %w", err)
+	}
+	owner, err := rr.lockMigrations(ctx)
+	if err != nil {
+		return err
+	}
+	defer rr.unlockMigrations(owner)
+
+	applied := make(map[int]string)
+	iter := rr.session.Query(`SELECT version, checksum FROM schema_migrations`).Iter()
+	var version int
+	var checksum string
+	for iter.Scan(&version, &checksum) {
+		applied[version] = checksum
+	}
+	if err := iter.Close(); err != nil {
+		return fmt.Errorf("unable to read schema_migrations: %w", err)
+	}
+
+	pending, err := rr.loadMigrations()
+	if err != nil {
+		return err
+	}
+	for _, m := range pending {
+		if appliedChecksum, ok := applied[m.version]; ok {
+			if appliedChecksum != m.checksum {
+				return fmt.Errorf("migration %04d_%s was changed after it had been applied", m.version, m.name)
+			}
+			continue
+		}
+		rr.logger.LogInfo("reservationRepo", fmt.Sprintf("Applying migration %04d_%s", m.version, m.name))
+		for _, statement := range m.statements {
+			if err := rr.session.Query(statement).Exec(); err != nil && !alreadyApplied(err) {
+				return fmt.Errorf("migration %04d_%s failed: %w", m.version, m.name, err)
+			}
+		}
+		if m.apply != nil {
+			if err := m.apply(ctx); err != nil {
+				return fmt.Errorf("migration %04d_%s failed: %w", m.version, m.name, err)
+			}
+		}
+		err := rr.session.Query(`INSERT INTO schema_migrations (version, name, checksum, applied_at) VALUES(?, ?, ?, ?)`,
+			m.version, m.name, m.checksum, time.Now().UTC()).Consistency(rr.writeConsistency).Exec()
+		if err != nil {
+			return fmt.Errorf("unable to record migration %04d_%s: %w", m.version, m.name, err)
+		}
+	}
+	rr.logger.LogInfo("reservationRepo", fmt.Sprintf("Schema is up to date, %d migrations known", len(pending)))
+	return nil
+}
+
+// lockMigrations waits until it holds the migration lock and returns the owner it holds it as.
+func (rr *ReservationRepo) lockMigrations(ctx context.Context) (string, error) {
+	hostname, _ := os.Hostname()
+	instance, _ := gocql.RandomUUID()
+	owner := fmt.Sprintf("%s-%s", hostname, instance)
+	for {
+		locked, err := rr.session.Query(`INSERT INTO schema_migration_lock (name, owner) VALUES('migrate', ?) IF NOT EXISTS USING TTL ?`,
+			owner, int(migrationLockTTL.Seconds())).MapScanCAS(map[string]interface{}{})
+		if err != nil {
+			return "", fmt.Errorf("unable to take the migration lock: %w", err)
+		}
+		if locked {
+			return owner, nil
+		}
+		rr.logger.LogInfo("reservationRepo", "Another replica is migrating the schema, waiting")
+		select {
+		case <-ctx.Done():
+			return "", fmt.Errorf("gave up waiting for the migration lock: %w", ctx.Err())
+		case <-time.After(migrationLockWait):
+		}
+	}
+}
+
+func (rr *ReservationRepo) unlockMigrations(owner string) {
+	_, err := rr.session.Query(`DELETE FROM schema_migration_lock WHERE name = 'migrate' IF owner = ?`, owner).
+		MapScanCAS(map[string]interface{}{})
+	if err != nil {
+		rr.logger.LogError("reservationRepo", fmt.Sprintf("Unable to release the migration lock, it expires in %s: %v", migrationLockTTL, err))
+	}
+}
+
+// alreadyApplied tells whether a statement failed because the change it makes is already in the
+// schema, such as a column added by a migration that was interrupted before it was recorded.
+func alreadyApplied(err error) bool {
+	message := err.Error()
+	return strings.Contains(message, "conflicts with an existing column") || strings.Contains(message, "already exists")
+}
+
+func (rr *ReservationRepo) loadMigrations() ([]migration, error) {
+	files, err := fs.Glob(migrations.Files, "*.cql")
+	if err != nil {
+		return nil, err
+	}
+	var result []migration
+	for _, file := range files {
+		versionPart, name, found := strings.Cut(strings.TrimSuffix(file, ".cql"), "_")
+		version, convErr := strconv.Atoi(versionPart)
+		if !found || convErr != nil {
+			return nil, fmt.Errorf("migration file %s must be named <version>_<name>.cql", file)
+		}
+		content, err := fs.ReadFile(migrations.Files, file)
+		if err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256(content)
+		result = append(result, migration{
+			version:    version,
+			name:       name,
+			checksum:   hex.EncodeToString(sum[:]),
+			statements: splitStatements(string(content)),
+		})
+	}
+	for _, m := range rr.codeMigrations() {
+		sum := sha256.Sum256([]byte(m.name))
+		m.checksum = hex.EncodeToString(sum[:])
+		result = append(result, m)
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].version < result[j].version })
+	for i := 1; i < len(result); i++ {
+		if result[i].version == result[i-1].version {
+			return nil, fmt.Errorf("duplicate migration version %d", result[i].version)
+		}
+	}
+	return result, nil
+}
+
+func splitStatements(content string) []string {
+	var lines []string
+	for _, line := range strings.Split(content, "\n") {
+		if !strings.HasPrefix(strings.TrimSpace(line), "--") {
+			lines = append(lines, line)
+		}
+	}
+	var statements []string
+	for _, statement := range strings.Split(strings.Join(lines, "\n"), ";") {
+		if statement = strings.TrimSpace(statement); statement != "" {
+			statements = append(statements, statement)
+		}
+	}
+	return statements
+}
@@ -0,0 +1,205 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"reservation-service/domain"
+	"reservation-service/errors"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+// SavePayment stores a payment. Authorized payments are also queued in pending_captures under
+// their check-in date, payments in any other state are removed from the queue.
+func (rr *ReservationRepo) SavePayment(ctx context.Context, payment *domain.Payment) *errors.ReservationError {
+	ctx, span := rr.tracer.Start(ctx, "ReservationRepo.SavePayment")
+	defer span.End()
+	batch := rr.newBatch(gocql.LoggedBatch)
+	batch.Query(`INSERT INTO payments (reservation_id, user_id, host_id, accommodation_id, check_in, provider, authorization_id,
+		amount, captured_amount, refunded_amount, unrecorded_amount, currency, status, created_at, updated_at)
+		VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		payment.ReservationID, payment.UserID, payment.HostID, payment.AccommodationID, payment.CheckIn, payment.Provider,
+		payment.AuthorizationID, payment.Amount, payment.CapturedAmount, payment.RefundedAmount, payment.UnrecordedAmount,
+		payment.Currency, payment.Status, payment.CreatedAt, payment.UpdatedAt)
+	batch.Query(`INSERT INTO payments_by_authorization (authorization_id, reservation_id) VALUES(?, ?)`,
+		payment.AuthorizationID, payment.ReservationID)
+	if payment.Status == domain.PaymentAuthorized {
+		batch.Query(`INSERT INTO pending_captures (month, check_in, reservation_id) VALUES(?, ?, ?)`,
+			monthOf(payment.CheckIn), payment.CheckIn, payment.ReservationID)
+	} else {
+		batch.Query(`DELETE FROM pending_captures WHERE month = ? AND check_in = ? AND reservation_id = ?`,
+			monthOf(payment.CheckIn), payment.CheckIn, payment.ReservationID)
+	}
+	if err := rr.session.ExecuteBatch(batch); err != nil {
+		rr.logger.LogError("reservationsRepo", err.Error())
+		return errors.NewReservationError(500, "Unable to save payment, database error")
+	}
+	rr.logger.LogInfo("reservationRepo", fmt.Sprintf("Saved payment of reservation %s with status %s", payment.ReservationID, payment.Status))
+	return nil
+}
+
+// UpdatePayment stores the amounts and status of a payment, as long as the payment is still in
+// the status from. It tells whether the payment was updated, a payment that moved on meanwhile
+// is left as it is. Payments that have nothing left to capture or book leave pending_captures.
+func (rr *ReservationRepo) UpdatePayment(ctx context.Context, payment *domain.Payment, from string) (bool, *errors.ReservationError) {
+	ctx, span := rr.tracer.Start(ctx, "ReservationRepo.UpdatePayment")
+	defer span.End()
+	applied, err := rr.session.Query(`UPDATE payments SET captured_amount = ?, refunded_amount = ?, unrecorded_amount = ?, status = ?,
+		updated_at = ? WHERE reservation_id = ? IF status = ?`,
+		payment.CapturedAmount, payment.RefundedAmount, payment.UnrecordedAmount, payment.Status, payment.UpdatedAt,
+		payment.ReservationID, from).
+		MapScanCAS(map[string]interface{}{})
+	if err != nil {
+		rr.logger.LogError("reservationsRepo", err.Error())
+		return false, errors.NewReservationError(500, "Unable to update payment, database error")
+	}
+	if !applied {
+		rr.logger.LogWarn("reservationRepo", fmt.Sprintf("Payment of reservation %s is no longer %s, left it as it is", payment.ReservationID, from))
+		return false, nil
+	}
+	if payment.Status != domain.PaymentAuthorized && payment.Status != domain.PaymentCapturedUnrecorded {
+		err = rr.session.Query(`DELETE FROM pending_captures WHERE month = ? AND check_in = ? AND reservation_id = ?`,
+			monthOf(payment.CheckIn), payment.CheckIn, payment.ReservationID).Consistency(rr.writeConsistency).Exec()
+		if err != nil {
+			// The capture sweep skips payments that are no longer authorized, a row left behind
+			// only costs it a read.
+			rr.logger.LogError("reservationsRepo", err.Error())
+		}
+	}
+	rr.logger.LogInfo("reservationRepo", fmt.Sprintf("Payment of reservation %s went from %s to %s", payment.ReservationID, from, payment.Status))
+	return true, nil
+}
+
+// ChangePayment stores the amount, authorization and check-in of a payment of a modified
+// reservation, as long as the payment is still authorized under the previous authorization. It
+// tells whether the payment was changed. The payment is queued in pending_captures under its new
+// check-in before it is changed and leaves the old one after, the capture sweep skips a payment
+// whose check-in isn't the one it was queued under.
+func (rr *ReservationRepo) ChangePayment(ctx context.Context, payment *domain.Payment, previous *domain.Payment) (bool, *errors.ReservationError) {
+	ctx, span := rr.tracer.Start(ctx, "ReservationRepo.ChangePayment")
+	defer span.End()
+	batch := rr.newBatch(gocql.LoggedBatch)
+	batch.Query(`INSERT INTO pending_captures (month, check_in, reservation_id) VALUES(?, ?, ?)`,
+		monthOf(payment.CheckIn), payment.CheckIn, payment.ReservationID)
+	if payment.AuthorizationID != previous.AuthorizationID {
+		batch.Query(`INSERT INTO payments_by_authorization (authorization_id, reservation_id) VALUES(?, ?)`,
+			payment.AuthorizationID, payment.ReservationID)
+	}
+	if err := rr.session.ExecuteBatch(batch); err != nil {
+		rr.logger.LogError("reservationsRepo", err.Error())
+		return false, errors.NewReservationError(500, "Unable to update payment, database error")
+	}
+	applied, err := rr.session.Query(`UPDATE payments SET amount = ?, authorization_id = ?, check_in = ?, updated_at = ?
+		WHERE reservation_id = ? IF status = ? AND authorization_id = ?`,
+		payment.Amount, payment.AuthorizationID, payment.CheckIn, payment.UpdatedAt, payment.ReservationID,
+		domain.PaymentAuthorized, previous.AuthorizationID).MapScanCAS(map[string]interface{}{})
+	if err != nil {
+		rr.logger.LogError("reservationsRepo", err.Error())
+		return false, errors.NewReservationError(500, "Unable to update payment, database error")
+	}
+	if !applied {
+		rr.logger.LogWarn("reservationRepo", fmt.Sprintf("Payment of reservation %s changed meanwhile, left it as it is", payment.ReservationID))
+		return false, nil
+	}
+	// Webhooks of the replaced authorization no longer find the payment. Rows left behind only
+	// cost the sweep a read.
+	batch = rr.newBatch(gocql.LoggedBatch)
+	if payment.CheckIn != previous.CheckIn {
+		batch.Query(`DELETE FROM pending_captures WHERE month = ? AND check_in = ? AND reservation_id = ?`,
+			monthOf(previous.CheckIn), previous.CheckIn, payment.ReservationID)
+	}
+	if payment.AuthorizationID != previous.AuthorizationID {
+		batch.Query(`DELETE FROM payments_by_authorization WHERE authorization_id = ?`, previous.AuthorizationID)
+	}
+	if batch.Size() > 0 {
+		if err := rr.session.ExecuteBatch(batch); err != nil {
+			rr.logger.LogError("reservationsRepo", err.Error())
+		}
+	}
+	rr.logger.LogInfo("reservationRepo", fmt.Sprintf("Changed payment of reservation %s to %d with check-in %s",
+		payment.ReservationID, payment.Amount, payment.CheckIn))
+	return true, nil
+}
+
+// ClaimWebhookEvent records a webhook event of the payment provider as handled. It returns
+// false if the event was recorded before.
+func (rr *ReservationRepo) ClaimWebhookEvent(ctx context.Context, eventID string) (bool, *errors.ReservationError) {
+	ctx, span := rr.tracer.Start(ctx, "ReservationRepo.ClaimWebhookEvent")
+	defer span.End()
+	applied, err := rr.session.Query(`INSERT INTO payment_webhook_events (event_id, received_at) VALUES(?, ?) IF NOT EXISTS`,
+		eventID, time.Now().UTC()).MapScanCAS(map[string]interface{}{})
+	if err != nil {
+		rr.logger.LogError("reservationsRepo", err.Error())
+		return false, errors.NewReservationError(500, "Unable to record webhook event, database error")
+	}
+	return applied, nil
+}
+
+// ReleaseWebhookEvent forgets a webhook event that couldn't be handled, so it is handled when
+// the provider sends it again.
+func (rr *ReservationRepo) ReleaseWebhookEvent(ctx context.Context, eventID string) *errors.ReservationError {
+	ctx, span := rr.tracer.Start(ctx, "ReservationRepo.ReleaseWebhookEvent")
+	defer span.End()
+	err := rr.session.Query(`DELETE FROM payment_webhook_events WHERE event_id = ?`, eventID).Consistency(rr.writeConsistency).Exec()
+	if err != nil {
+		rr.logger.LogError("reservationsRepo", err.Error())
+		return errors.NewReservationError(500, "Unable to release webhook event, database error")
+	}
+	return nil
+}
+
+func (rr *ReservationRepo) GetPayment(ctx context.Context, reservationID gocql.UUID) (*domain.Payment, *errors.ReservationError) {
+	ctx, span := rr.tracer.Start(ctx, "ReservationRepo.GetPayment")
+	defer span.End()
+	var payment domain.Payment
+	err := rr.session.Query(`SELECT reservation_id, user_id, host_id, accommodation_id, check_in, provider, authorization_id,
+		amount, captured_amount, refunded_amount, unrecorded_amount, currency, status, created_at, updated_at FROM payments
+		WHERE reservation_id = ?`,
+		reservationID).Scan(&payment.ReservationID, &payment.UserID, &payment.HostID, &payment.AccommodationID, &payment.CheckIn,
+		&payment.Provider, &payment.AuthorizationID, &payment.Amount, &payment.CapturedAmount, &payment.RefundedAmount,
+		&payment.UnrecordedAmount, &payment.Currency, &payment.Status, &payment.CreatedAt, &payment.UpdatedAt)
+	if err == gocql.ErrNotFound {
+		return nil, errors.NewReservationError(404, "Payment not found")
+	}
+	if err != nil {
+		rr.logger.LogError("reservationsRepo", err.Error())
+		return nil, errors.NewReservationError(500, "Unable to retrieve payment, database error")
+	}
+	return &payment, nil
+}
+
+func (rr *ReservationRepo) GetPaymentByAuthorization(ctx context.Context, authorizationID string) (*domain.Payment, *errors.ReservationError) {
+	ctx, span := rr.tracer.Start(ctx, "ReservationRepo.GetPaymentByAuthorization")
+	defer span.End()
+	var reservationID gocql.UUID
+	err := rr.session.Query(`SELECT reservation_id FROM payments_by_authorization WHERE authorization_id = ?`,
+		authorizationID).Scan(&reservationID)
+	if err == gocql.ErrNotFound {
+		return nil, errors.NewReservationError(404, "Payment not found")
+	}
+	if err != nil {
+		rr.logger.LogError("reservationsRepo", err.Error())
+		return nil, errors.NewReservationError(500, "Unable to retrieve payment, database error")
+	}
+	return rr.GetPayment(ctx, reservationID)
+}
+
+// GetDueCaptures returns the reservations whose payment is still to be captured or booked and
+// whose check-in is on or before today, looking at the months given.
+func (rr *ReservationRepo) GetDueCaptures(ctx context.Context, months []string, today string) ([]gocql.UUID, *errors.ReservationError) {
+	ctx, span := rr.tracer.Start(ctx, "ReservationRepo.GetDueCaptures")
+	defer span.End()
+	iter := rr.session.Query(`SELECT reservation_id FROM pending_captures WHERE month IN ? AND check_in <= ?`,
+		months, today).Iter()
+	var result []gocql.UUID
+	var reservationID gocql.UUID
+	for iter.Scan(&reservationID) {
+		result = append(result, reservationID)
+	}
+	if err := iter.Close(); err != nil {
+		rr.logger.LogError("reservationsRepo", err.Error())
+		return nil, errors.NewReservationError(500, "Unable to retrieve pending captures, database error")
+	}
+	return result, nil
+}
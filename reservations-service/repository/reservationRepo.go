@@ -3,9 +3,7 @@ package repository
 import (
 	"context"
 	"fmt"
-	"log"
 
-	"os"
 	"reservation-service/config"
 	"reservation-service/domain"
 	"reservation-service/errors"
@@ -19,17 +17,54 @@ import (
 )
 
 type ReservationRepo struct {
-	session *gocql.Session
-	logger  *config.Logger
-	tracer  trace.Tracer
+	session          *gocql.Session
+	logger           *config.Logger
+	tracer           trace.Tracer
+	writeConsistency gocql.Consistency
 }
 
 // db config and creating keyspace
-func New(logger *config.Logger, tracer trace.Tracer) (*ReservationRepo, error) {
-	db := os.Getenv("CASS_DB")
+func New(cfg config.CassandraConfig, logger *config.Logger, tracer trace.Tracer) (*ReservationRepo, error) {
+	readConsistency, err := gocql.ParseConsistencyWrapper(cfg.ReadConsistency)
+	if err != nil {
+		return nil, err
+	}
+	writeConsistency, err := gocql.ParseConsistencyWrapper(cfg.WriteConsistency)
+	if err != nil {
+		return nil, err
+	}
 
-	cluster := gocql.NewCluster(db)
+	cluster := gocql.NewCluster(cfg.Hosts...)
 	cluster.Keyspace = "system"
+	cluster.Timeout = cfg.Timeout
+	cluster.ConnectTimeout = cfg.Timeout
+	cluster.RetryPolicy = &gocql.ExponentialBackoffRetryPolicy{
+		NumRetries: cfg.RetryAttempts,
+		Min:        cfg.RetryMinBackoff,
+		Max:        cfg.RetryMaxBackoff,
+	}
+	cluster.ReconnectInterval = cfg.ReconnectInterval
+	cluster.ReconnectionPolicy = &gocql.ConstantReconnectionPolicy{
+		MaxRetries: cfg.ReconnectAttempts,
+		Interval:   cfg.ReconnectInterval,
+	}
+	if cfg.LocalDataCenter != "" {
+		cluster.PoolConfig.HostSelectionPolicy = gocql.TokenAwareHostPolicy(gocql.DCAwareRoundRobinPolicy(cfg.LocalDataCenter))
+	}
+	if cfg.Username != "" {
+		cluster.Authenticator = gocql.PasswordAuthenticator{
+			Username: cfg.Username,
+			Password: cfg.Password,
+		}
+	}
+	if cfg.TLSCAPath != "" || cfg.TLSCertPath != "" {
+		cluster.SslOpts = &gocql.SslOptions{
+			CaPath:                 cfg.TLSCAPath,
+			CertPath:               cfg.TLSCertPath,
+			KeyPath:                cfg.TLSKeyPath,
+			EnableHostVerification: !cfg.TLSSkipVerify,
+		}
+	}
 	session, err := cluster.CreateSession()
 	if err != nil {
 		logger.Println(err)
@@ -37,10 +72,7 @@ func New(logger *config.Logger, tracer trace.Tracer) (*ReservationRepo, error) {
 	}
 
 	err = session.Query(fmt.Sprintf(`CREATE KEYSPACE IF NOT EXISTS %s
-	WITH replication = {
-		'class' : 'SimpleStrategy',
-		'replication_factor' : %d
-	}`, "reservation", 1)).Exec()
+	WITH replication = %s`, cfg.Keyspace, cfg.ReplicationOptions())).Exec()
 
 	if err != nil {
 		logger.Println(err)
@@ -48,8 +80,8 @@ func New(logger *config.Logger, tracer trace.Tracer) (*ReservationRepo, error) {
 
 	session.Close()
 
-	cluster.Keyspace = "reservation"
-	cluster.Consistency = gocql.One
+	cluster.Keyspace = cfg.Keyspace
+	cluster.Consistency = readConsistency
 	session, err = cluster.CreateSession()
 	if err != nil {
 		logger.Println(err)
@@ -57,175 +89,84 @@ func New(logger *config.Logger, tracer trace.Tracer) (*ReservationRepo, error) {
 	}
 
 	return &ReservationRepo{
-		session: session,
-		logger:  logger,
-		tracer:  tracer,
+		session:          session,
+		logger:           logger,
+		tracer:           tracer,
+		writeConsistency: writeConsistency,
 	}, nil
 }
 
+// newBatch creates a batch that is written with the configured write consistency.
+func (rr *ReservationRepo) newBatch(batchType gocql.BatchType) *gocql.Batch {
+	batch := rr.session.NewBatch(batchType)
+	batch.SetConsistency(rr.writeConsistency)
+	return batch
+}
+
 func (rr *ReservationRepo) CloseSession() {
 	rr.session.Close()
 }
 
-func (rr *ReservationRepo) CreateTables() {
-	// Drop existing tables first
-	rr.DropTables()
-
-	// Create new tables
-	err := rr.session.Query(
-		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s
-		(id UUID, user_id text, accommodation_id text, start_date text, end_date text, username text, accommodation_name text,location text,price int,
-			num_of_days int,continent text, date_range set<text>,is_active boolean,country text,host_id text,
-		PRIMARY KEY((continent),country,id)) WITH CLUSTERING ORDER BY (country ASC,id ASC)`, "reservations")).Exec()
+func (rr *ReservationRepo) GetReservationsByUser(ctx context.Context, id string, filter domain.ReservationFilter, today string) ([]domain.Reservation, []byte, error) {
+	ctx, span := rr.tracer.Start(ctx, "ReservationRepo.GetReservationsByUser")
+	defer span.End()
+	reservations, nextPageState, err := rr.findReservations(ctx, "reservation_by_user", "user_id", id, filter, today)
 	if err != nil {
-		rr.logger.Println(err)
+		return nil, nil, err
 	}
-	err = rr.session.Query(
-		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s
-			(id UUID, accommodation_id text,  location text, price int, continent text, country text, date_range set<text>,
-			 PRIMARY KEY((accommodation_id),country,id))
-			WITH CLUSTERING ORDER BY(country ASC,id ASC)`, "free_accommodation")).Exec()
+	rr.logger.LogInfo("reservationRepo", fmt.Sprintf("Found %d reservations by userID %s", len(reservations), id))
+	return reservations, nextPageState, nil
+}
 
+func (rr *ReservationRepo) GetReservationsByHost(ctx context.Context, id string, filter domain.ReservationFilter, today string) ([]domain.Reservation, []byte, error) {
+	ctx, span := rr.tracer.Start(ctx, "ReservationRepo.GetReservationsByHost")
+	defer span.End()
+	reservations, nextPageState, err := rr.findReservations(ctx, "reservation_by_host", "host_id", id, filter, today)
 	if err != nil {
-		rr.logger.Println(err)
+		return nil, nil, err
 	}
-	err = rr.session.Query(
-		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s
-			(id UUID, accommodation_id text,  location text, price int, continent text, country text, date_range set<text>,is_active boolean,
-			 PRIMARY KEY((is_active),price,id))
-			WITH CLUSTERING ORDER BY(price ASC,id ASC)`, "avl_by_price")).Exec()
-
-	if err != nil {
-		rr.logger.Println(err)
-	}
-
-	err = rr.session.Query(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
-		id UUID,
-		user_id text,
-		accommodation_id text,
-		start_date text,
-		end_date text,
-		username text,
-		accommodation_name text,
-		location text,
-		price int,
-		num_of_days int,
-		continent text,
-		date_range set<text>,
-		is_active boolean,
-		country text,
-		host_id text,
-		PRIMARY KEY (user_id, id)
-	) WITH CLUSTERING ORDER BY ( id ASC)`, "reservation_by_user")).Exec()
-
-	if err != nil {
-		rr.logger.Println(err)
-	}
-
-	err = rr.session.Query(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
-		id UUID,
-		user_id text,
-		accommodation_id text,
-		start_date text,
-		end_date text,
-		username text,
-		accommodation_name text,
-		location text,
-		price int,
-		num_of_days int,
-		continent text,
-		date_range set<text>,
-		is_active boolean,
-		country text,
-		host_id text,
-		PRIMARY KEY (host_id,user_id,end_date, id)
-	) WITH CLUSTERING ORDER BY (user_id ASC,end_date ASC, id ASC)`, "reservation_by_host")).Exec()
-
-	if err != nil {
-		rr.logger.Println(err)
-	}
-	err = rr.session.Query(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
-			id UUID,
-			user_id text,
-			accommodation_id text,
-			start_date text,
-			end_date text,
-			username text,
-			accommodation_name text,
-			location text,
-			price int,
-			num_of_days int,
-			continent text,
-			date_range set<text>,
-			is_active boolean,
-			country text,
-			host_id text,
-			PRIMARY KEY (accommodation_id,user_id,end_date, id)
-		) WITH CLUSTERING ORDER BY (user_id ASC,end_date ASC, id ASC)`, "reservation_by_accommodation")).Exec()
+	rr.logger.LogInfo("reservationRepo", fmt.Sprintf("Found %d reservations by hostID %s", len(reservations), id))
+	return reservations, nextPageState, nil
+}
 
+// findReservations lists the reservations of one partition of table that match the filter. The
+// filter runs in Cassandra within the partition, and a filter with a size reads a single page
+// from its page state on. Rows come in clustering order.
+func (rr *ReservationRepo) findReservations(ctx context.Context, table, keyColumn, key string, filter domain.ReservationFilter, today string) ([]domain.Reservation, []byte, error) {
+	conditions, values, err := reservationFilterConditions(filter, today)
 	if err != nil {
-		rr.logger.Println(err)
+		return nil, nil, err
 	}
-
-	err = rr.session.Query(
-		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s
-			(id UUID, host_id text, ,
-			 PRIMARY KEY((host_id),id))
-			WITH CLUSTERING ORDER BY(id ASC)`, "deleted_reservations")).Exec()
-
-	if err != nil {
-		rr.logger.Println(err)
+	statement := fmt.Sprintf(`SELECT id,accommodation_id, user_id, start_date, end_date,username,accommodation_name,location,price,
+	num_of_days,date_range,is_active,country,host_id,adults,children,infants,pets FROM %s WHERE %s = ?`, table, keyColumn)
+	for _, condition := range conditions {
+		statement += " AND " + condition
 	}
-
-	err = rr.session.Query(fmt.Sprintf("CREATE INDEX ON reservation_by_accommodation (date_range);")).Exec()
-	if err != nil {
-		rr.logger.Println(err)
+	if len(conditions) > 0 {
+		statement += " ALLOW FILTERING"
 	}
-	err = rr.session.Query(fmt.Sprintf("CREATE INDEX ON free_accommodation (date_range);")).Exec()
-	if err != nil {
-		rr.logger.Println(err)
+	query := rr.session.Query(statement, append([]interface{}{key}, values...)...)
+	if filter.Size > 0 {
+		query = query.PageSize(filter.Size).PageState(filter.PageState)
 	}
-
-}
-
-func (rr *ReservationRepo) DropTables() {
-	dropTable := func(tableName string) {
-		err := rr.session.Query(fmt.Sprintf("DROP TABLE IF EXISTS %s", tableName)).Exec()
-		if err != nil {
-			rr.logger.Println(err)
-		} else {
-			rr.logger.Printf("Table %s dropped successfully", tableName)
-		}
+	iter := query.Iter()
+	var nextPageState []byte
+	if filter.Size > 0 {
+		nextPageState = iter.PageState()
 	}
+	scanner := iter.Scanner()
 
-	dropTable("reservations")
-	//dropTable("free_accommodation")
-	dropTable("reservation_by_user")
-	dropTable("reservation_by_host")
-	dropTable("reservation_by_accommodation")
-	dropTable("deleted_reservations")
-	//	dropTable("avl_by_price")
-
-}
-
-func (rr *ReservationRepo) GetReservationsByUser(ctx context.Context, id string) ([]domain.Reservation, error) {
-	ctx, span := rr.tracer.Start(ctx, "ReservationRepo.GetReservationsByUser")
-	defer span.End()
-	scanner := rr.session.Query(`SELECT id,accommodation_id, user_id, start_date, end_date,username,accommodation_name,location,price,
-	num_of_days,date_range,is_active,country,host_id FROM reservation_by_user
-	 WHERE user_id = ?`,
-		id).Iter().Scanner()
-
-	var reservations []domain.Reservation
+	reservations := []domain.Reservation{}
 	for scanner.Next() {
 		var reservation domain.Reservation
 
 		err := scanner.Scan(&reservation.Id, &reservation.AccommodationID, &reservation.UserID, &reservation.StartDate,
 			&reservation.EndDate, &reservation.Username, &reservation.AccommodationName, &reservation.Location, &reservation.Price,
-			&reservation.NumberOfDays, &reservation.DateRange, &reservation.IsActive, &reservation.Country, &reservation.HostID)
+			&reservation.NumberOfDays, &reservation.DateRange, &reservation.IsActive, &reservation.Country, &reservation.HostID,
+			&reservation.Guests.Adults, &reservation.Guests.Children, &reservation.Guests.Infants, &reservation.Guests.Pets)
 		if err != nil {
 			rr.logger.LogError("reservationsRepo", err.Error())
-			return nil, err
+			return nil, nil, err
 		}
 
 		reservations = append(reservations, reservation)
@@ -233,41 +174,71 @@ func (rr *ReservationRepo) GetReservationsByUser(ctx context.Context, id string)
 
 	if err := scanner.Err(); err != nil {
 		rr.logger.LogError("reservationsRepo", err.Error())
-		return nil, err
+		return nil, nil, err
 	}
-	rr.logger.LogInfo("reservationRepo", fmt.Sprintf("Found reservations by userID: %v", reservations))
-	return reservations, nil
+	return reservations, nextPageState, nil
 }
 
-func (rr *ReservationRepo) GetReservationsByHost(ctx context.Context, id string) ([]domain.Reservation, error) {
-	ctx, span := rr.tracer.Start(ctx, "ReservationRepo.GetReservationsByHost")
-	defer span.End()
-	scanner := rr.session.Query(`SELECT id,accommodation_id, user_id, start_date, end_date,username,accommodation_name,location,price,
-	num_of_days,date_range,is_active,country,host_id FROM reservation_by_host
-	 WHERE  host_id = ?`,
-		id).Iter().Scanner()
-
-	var reservations []domain.Reservation
-	for scanner.Next() {
-		var reservation domain.Reservation
-
-		err := scanner.Scan(&reservation.Id, &reservation.AccommodationID, &reservation.UserID, &reservation.StartDate,
-			&reservation.EndDate, &reservation.Username, &reservation.AccommodationName, &reservation.Location, &reservation.Price,
-			&reservation.NumberOfDays, &reservation.DateRange, &reservation.IsActive, &reservation.Country, &reservation.HostID)
+// reservationFilterConditions turns a filter into CQL conditions. The status is a window on the
+// stay dates relative to today, and the bounds on each date column are merged into one range,
+// as CQL takes a single lower and upper bound per column.
+func reservationFilterConditions(filter domain.ReservationFilter, today string) ([]string, []interface{}, error) {
+	startBefore, endAfter, endBefore, startAfter := filter.To, filter.From, "", ""
+	switch filter.Status {
+	case domain.ReservationUpcoming:
+		tomorrow, err := shiftDate(today, 1)
 		if err != nil {
-			rr.logger.LogError("reservationsRepo", err.Error())
-			return nil, err
+			return nil, nil, err
+		}
+		startAfter = tomorrow
+	case domain.ReservationOngoing:
+		startBefore = earliest(startBefore, today)
+		endAfter = latest(endAfter, today)
+	case domain.ReservationCompleted:
+		yesterday, err := shiftDate(today, -1)
+		if err != nil {
+			return nil, nil, err
+		}
+		endBefore = yesterday
+	}
+	var conditions []string
+	var values []interface{}
+	add := func(condition, value string) {
+		if value != "" {
+			conditions = append(conditions, condition)
+			values = append(values, value)
 		}
+	}
+	add("accommodation_id = ?", filter.AccommodationID)
+	add("start_date >= ?", startAfter)
+	add("start_date <= ?", startBefore)
+	add("end_date >= ?", endAfter)
+	add("end_date <= ?", endBefore)
+	return conditions, values, nil
+}
 
-		reservations = append(reservations, reservation)
+func shiftDate(date string, days int) (string, error) {
+	day, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return "", err
 	}
+	return day.AddDate(0, 0, days).Format("2006-01-02"), nil
+}
 
-	if err := scanner.Err(); err != nil {
-		rr.logger.LogError("reservationsRepo", err.Error())
-		return nil, err
+// earliest returns the earlier of two dates, an empty date is no bound.
+func earliest(a, b string) string {
+	if a == "" || (b != "" && b < a) {
+		return b
 	}
-	rr.logger.LogInfo("reservationRepo", fmt.Sprintf("Found reservations by hostID: %v", reservations))
-	return reservations, nil
+	return a
+}
+
+// latest returns the later of two dates, an empty date is no bound.
+func latest(a, b string) string {
+	if a == "" || (b != "" && b > a) {
+		return b
+	}
+	return a
 }
 
 func (rr *ReservationRepo) InsertAvailability(ctx context.Context, reservation *domain.FreeReservation) (*domain.FreeReservation, error) {
@@ -284,7 +255,7 @@ func (rr *ReservationRepo) InsertAvailability(ctx context.Context, reservation *
 	}
 
 	for _, drwp := range reservation.DateRange {
-		batch := rr.session.NewBatch(gocql.LoggedBatch)
+		batch := rr.newBatch(gocql.LoggedBatch)
 		ID, _ := gocql.RandomUUID()
 		batch.Query(`
 				INSERT INTO free_accommodation (id, accommodation_id, location, price, continent, country, date_range)
@@ -294,6 +265,7 @@ func (rr *ReservationRepo) InsertAvailability(ctx context.Context, reservation *
 				INSERT INTO avl_by_price (id, accommodation_id, location, price, continent, country, date_range,is_active)
 				VALUES(?, ?, ?, ?, ?, ?, ?,?)
 			`, ID, reservation.AccommodationID, reservation.Location, drwp.Price, continent, country, drwp.DateRange, true)
+		addFreeNights(batch, reservation.AccommodationID, ID, drwp.Price, drwp.DateRange)
 
 		if err := rr.session.ExecuteBatch(batch); err != nil {
 			rr.logger.LogError("reservationsRepo", err.Error())
@@ -336,60 +308,85 @@ func (rr *ReservationRepo) AvailableDates(ctx context.Context, accommodationID s
 	return result, nil
 }
 
-func (rr *ReservationRepo) InsertReservation(ctx context.Context, reservation *domain.Reservation) (*domain.Reservation, error) {
+// InsertReservation stores a new reservation. Its nights are claimed first, a reservation whose
+// nights another reservation got first is not stored and fails with 409.
+func (rr *ReservationRepo) InsertReservation(ctx context.Context, reservation *domain.Reservation) (*domain.Reservation, *errors.ReservationError) {
 	ctx, span := rr.tracer.Start(ctx, "ReservationRepo.InsertReservation")
 	defer span.End()
-	Id, _ := gocql.RandomUUID()
+	batch := rr.newBatch(gocql.LoggedBatch)
+	if err := rr.addReservation(batch, reservation); err != nil {
+		return nil, errors.NewReservationError(500, err.Error())
+	}
+	claimed, claimErr := rr.claimNights(ctx, reservation.AccommodationID, reservation.Id, reservation.DateRange)
+	if claimErr != nil {
+		return nil, claimErr
+	}
+	if !claimed {
+		return nil, errors.NewReservationError(409, "Accommodation is not available for the specified date range")
+	}
+
+	if err := rr.session.ExecuteBatch(batch); err != nil {
+		rr.logger.LogError("reservationsRepo", err.Error())
+		rr.unclaimNights(ctx, reservation.AccommodationID, reservation.Id, reservation.DateRange)
+		return nil, errors.NewReservationError(500, err.Error())
+	}
+	rr.logger.LogInfo("reservationRepo", fmt.Sprintf("Inserted reservation: %v", reservation))
+
+	return reservation, nil
+}
+
+// addReservation adds the rows of a new reservation to batch and completes the reservation with
+// its id, country and continent. The nights it takes are claimed separately.
+func (rr *ReservationRepo) addReservation(batch *gocql.Batch, reservation *domain.Reservation) error {
+	Id := reservation.Id
+	if Id == (gocql.UUID{}) {
+		Id, _ = gocql.RandomUUID()
+	}
 	country, err := utils.GetCountry(reservation.Location)
 	if err != nil {
-		return nil, errors.NewReservationError(500, err.Error())
+		return errors.NewReservationError(500, err.Error())
 	}
 
 	continent, err := utils.GetContinent(reservation.Location)
 	if err != nil {
-		return nil, errors.NewReservationError(500, err.Error())
+		return errors.NewReservationError(500, err.Error())
 	}
-	log.Println("COUNTRY< COUNTINET", country, continent)
 	startDate := reservation.DateRange[0]
 	endDate := reservation.DateRange[len(reservation.DateRange)-1]
-	println(startDate, endDate)
-
-	batch := rr.session.NewBatch(gocql.LoggedBatch)
+	rr.logger.LogInfo("reservationRepo", fmt.Sprintf("Adding reservation of accommodation %s in %s, %s from %s to %s",
+		reservation.AccommodationID, country, continent, startDate, endDate))
 
 	// Insert into reservations table
 	batch.Query(`INSERT INTO reservations (id,user_id,accommodation_id,start_date,end_date,username,accommodation_name,location,price,num_of_days,
-	    continent,date_range,is_active,country,host_id)
-	    VALUES(?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)`, Id, reservation.UserID, reservation.AccommodationID, startDate,
+	    continent,date_range,is_active,country,host_id,adults,children,infants,pets)
+	    VALUES(?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)`, Id, reservation.UserID, reservation.AccommodationID, startDate,
 		endDate, reservation.Username, reservation.AccommodationName, reservation.Location,
-		reservation.Price, reservation.NumberOfDays, continent, reservation.DateRange, true, country, reservation.HostID)
+		reservation.Price, reservation.NumberOfDays, continent, reservation.DateRange, true, country, reservation.HostID,
+		reservation.Guests.Adults, reservation.Guests.Children, reservation.Guests.Infants, reservation.Guests.Pets)
 	batch.Query(`INSERT INTO reservation_by_user (id,user_id,accommodation_id,start_date,end_date,username,accommodation_name,location,price,num_of_days,
-	    continent,date_range,is_active,country,host_id)
-	    VALUES(?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)`, Id, reservation.UserID, reservation.AccommodationID, startDate,
+	    continent,date_range,is_active,country,host_id,adults,children,infants,pets)
+	    VALUES(?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)`, Id, reservation.UserID, reservation.AccommodationID, startDate,
 		endDate, reservation.Username, reservation.AccommodationName, reservation.Location,
-		reservation.Price, reservation.NumberOfDays, continent, reservation.DateRange, true, country, reservation.HostID)
+		reservation.Price, reservation.NumberOfDays, continent, reservation.DateRange, true, country, reservation.HostID,
+		reservation.Guests.Adults, reservation.Guests.Children, reservation.Guests.Infants, reservation.Guests.Pets)
 	batch.Query(`INSERT INTO reservation_by_host (id,user_id,accommodation_id,start_date,end_date,username,accommodation_name,location,price,num_of_days,
-	    continent,date_range,is_active,country,host_id)
-	    VALUES(?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)`, Id, reservation.UserID, reservation.AccommodationID, startDate,
+	    continent,date_range,is_active,country,host_id,adults,children,infants,pets)
+	    VALUES(?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)`, Id, reservation.UserID, reservation.AccommodationID, startDate,
 		endDate, reservation.Username, reservation.AccommodationName, reservation.Location,
-		reservation.Price, reservation.NumberOfDays, continent, reservation.DateRange, true, country, reservation.HostID)
+		reservation.Price, reservation.NumberOfDays, continent, reservation.DateRange, true, country, reservation.HostID,
+		reservation.Guests.Adults, reservation.Guests.Children, reservation.Guests.Infants, reservation.Guests.Pets)
 	batch.Query(`INSERT INTO reservation_by_accommodation (id,user_id,accommodation_id,start_date,end_date,username,accommodation_name,location,price,num_of_days,
-			continent,date_range,is_active,country,host_id)
-			VALUES(?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)`, Id, reservation.UserID, reservation.AccommodationID, startDate,
+			continent,date_range,is_active,country,host_id,adults,children,infants,pets)
+			VALUES(?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)`, Id, reservation.UserID, reservation.AccommodationID, startDate,
 		endDate, reservation.Username, reservation.AccommodationName, reservation.Location,
-		reservation.Price, reservation.NumberOfDays, continent, reservation.DateRange, true, country, reservation.HostID)
-
-	if err := rr.session.ExecuteBatch(batch); err != nil {
-		rr.logger.LogError("reservationsRepo", err.Error())
-		return nil, err
-	}
+		reservation.Price, reservation.NumberOfDays, continent, reservation.DateRange, true, country, reservation.HostID,
+		reservation.Guests.Adults, reservation.Guests.Children, reservation.Guests.Infants, reservation.Guests.Pets)
 
 	reservation.Id = Id
 	reservation.Country = country
 	reservation.Continent = continent
 	reservation.IsActive = true
-	rr.logger.LogInfo("reservationRepo", fmt.Sprintf("Inserted reservation: %v", reservation))
-
-	return reservation, nil
+	return nil
 }
 
 func (rr *ReservationRepo) DeleteById(ctx context.Context, country string, id, userID, hostID, accommodationID, endDate string) (*domain.Reservation, *errors.ReservationError) {
@@ -402,13 +399,20 @@ func (rr *ReservationRepo) DeleteById(ctx context.Context, country string, id, u
 		return nil, errors.NewReservationError(500, err.Error())
 	}
 	continent := result.Continent
-	batch := rr.session.NewBatch(gocql.LoggedBatch)
+	var dateRange []string
+	err = rr.session.Query(`SELECT date_range FROM reservation_by_user WHERE user_id = ? AND id = ?`, userID, id).Scan(&dateRange)
+	if err != nil && err != gocql.ErrNotFound {
+		rr.logger.LogError("reservationsRepo", err.Error())
+		return nil, errors.NewReservationError(500, "Unable to cancel the reservation")
+	}
+	batch := rr.newBatch(gocql.LoggedBatch)
 
 	batch.Query(`DELETE FROM reservations WHERE continent = ? AND country = ? AND id = ?`, continent, country, id)
 	batch.Query(`DELETE FROM reservation_by_user WHERE user_id = ? AND id = ?`, userID, id)
 	batch.Query(`DELETE FROM reservation_by_host WHERE host_id = ? AND user_id = ? AND end_date = ? AND id = ? `, hostID, userID, endDate, id)
 	batch.Query(`DELETE FROM reservation_by_accommodation WHERE accommodation_id = ? AND user_id = ? AND end_date = ? AND id = ?`, accommodationID, userID, endDate, id)
 	batch.Query(`INSERT INTO deleted_reservations(id,host_id) VALUES(?,?)`, id, hostID)
+	releaseNights(batch, accommodationID, dateRange)
 
 	if err := rr.session.ExecuteBatch(batch); err != nil {
 		rr.logger.LogError("reservationsRepo", err.Error())
@@ -416,65 +420,52 @@ func (rr *ReservationRepo) DeleteById(ctx context.Context, country string, id, u
 	}
 	rr.logger.LogInfo("reservationRepo", fmt.Sprintf("Deleted reservation by ID: %v", id))
 
-	return nil, nil
+	reservationID, _ := gocql.ParseUUID(id)
+	return &domain.Reservation{Id: reservationID, UserID: userID, HostID: hostID, AccommodationID: accommodationID,
+		EndDate: endDate, Country: country, Continent: continent, DateRange: dateRange}, nil
 }
 
 func (rr *ReservationRepo) ReservationsInDateRange(ctx context.Context, accommodationIDs []string, dateRange []string) ([]string, *errors.ReservationError) {
 	ctx, span := rr.tracer.Start(ctx, "ReservationRepo.ReservationsInDateRange")
 	defer span.End()
-	uniqueReservations := make(map[string]struct{})
+	wanted := make(map[string]struct{}, len(dateRange))
 	for _, date := range dateRange {
-		for _, accommodationID := range accommodationIDs {
-			query := `SELECT accommodation_id FROM reservation_by_accommodation WHERE accommodation_id = ? AND date_range CONTAINS ?`
-
-			iter := rr.session.Query(query, accommodationID, date).Iter()
-
-			var reservation string
-			for iter.Scan(&reservation) {
-				uniqueReservations[reservation] = struct{}{}
-			}
-			if err := iter.Close(); err != nil {
-				rr.logger.LogError("reservationsRepo", err.Error())
-				return nil, errors.NewReservationError(500, "Unable to retrieve reservations, database error")
+		wanted[date] = struct{}{}
+	}
+	result := make([]string, 0)
+	for _, accommodationID := range accommodationIDs {
+		nights, err := rr.nightsInRange(ctx, accommodationID, dateRange)
+		if err != nil {
+			rr.logger.LogError("reservationsRepo", err.Error())
+			return nil, errors.NewReservationError(500, "Unable to retrieve reservations, database error")
+		}
+		for date, n := range nights {
+			if _, ok := wanted[date]; ok && n.isReserved() {
+				result = append(result, accommodationID)
+				break
 			}
 		}
 	}
-
-	result := make([]string, 0, len(uniqueReservations))
-	for key := range uniqueReservations {
-		result = append(result, key)
-	}
 	rr.logger.LogInfo("reservationRepo", fmt.Sprintf("Found reservation by accommodationIDs and dateRange: %v", result))
 
 	return result, nil
 }
 
+// IsAvailable reports whether every date of dateRange is part of the accommodation's availability.
 func (rr *ReservationRepo) IsAvailable(ctx context.Context, accommodationID string, dateRange []string) (bool, *errors.ReservationError) {
 	ctx, span := rr.tracer.Start(ctx, "ReservationRepo.IsAvailable")
 	defer span.End()
+	nights, err := rr.nightsInRange(ctx, accommodationID, dateRange)
+	if err != nil {
+		return false, rr.availabilityDatabaseError(err)
+	}
 	for _, date := range dateRange {
-		query := `
-	SELECT id
-	FROM free_accommodation 
-	WHERE accommodation_id = ? 
-	AND date_range CONTAINS ?
-	`
-
-		iter := rr.session.Query(query, accommodationID, date).Iter()
-
-		var reservationID string
-		if iter.Scan(&reservationID) {
-			return true, nil
-		}
-
-		if err := iter.Close(); err != nil {
-			rr.logger.LogError("reservationsRepo", err.Error())
-			return false, errors.NewReservationError(500, "Unable to check availability, database error")
+		if n, ok := nights[date]; !ok || !n.isFree() {
+			rr.logger.LogInfo("reservationRepo", fmt.Sprintf("Found out is accommodation available or not by accommodationID and dateRange: %v", false))
+			return false, nil
 		}
 	}
-	rr.logger.LogInfo("reservationRepo", fmt.Sprintf("Found out is accommodation available or not by accommodationID and dateRange: %v", false))
-
-	return false, nil
+	return len(dateRange) > 0, nil
 }
 
 func (rr *ReservationRepo) CheckAvailabilityForAccommodation(ctx context.Context, accommodationID string) ([]domain.GetAvailabilityForAccommodation, *errors.ReservationError) {
@@ -513,30 +504,21 @@ func (rr *ReservationRepo) IsReserved(ctx context.Context, accommodationID strin
 	ctx, span := rr.tracer.Start(ctx, "ReservationRepo.IsReserved")
 	defer span.End()
 
+	nights, err := rr.nightsInRange(ctx, accommodationID, dateRange)
+	if err != nil {
+		rr.logger.LogError("reservationsRepo", err.Error())
+		return false, errors.NewReservationError(500, "Unable to check is reserved, database error")
+	}
 	for _, date := range dateRange {
-		query := `
-		SELECT id
-		FROM reservation_by_accommodation
-		WHERE accommodation_id = ? 
-		AND date_range CONTAINS ?
-		`
-		iter := rr.session.Query(query, accommodationID, date).Iter()
-
-		var reservationID string
-		if iter.Scan(&reservationID) {
+		if n, ok := nights[date]; ok && n.isReserved() {
 			return true, nil
 		}
-
-		if err := iter.Close(); err != nil {
-			rr.logger.LogError("reservationsRepo", err.Error())
-			return false, errors.NewReservationError(500, "Unable to check is reserved, database error")
-		}
-
 	}
 	rr.logger.LogInfo("reservationRepo", fmt.Sprintf("Checked if is accommodation reserved by accommodationID and dateRanges: %v", false))
 
 	return false, nil
 }
+
 func (rr *ReservationRepo) GetNumberOfCanceledReservations(ctx context.Context, hostID string) (int, *errors.ReservationError) {
 	ctx, span := rr.tracer.Start(ctx, "ReservationRepo.GetNumberOfCanceledReservations")
 	defer span.End()
@@ -567,7 +549,7 @@ func (rr *ReservationRepo) GetReservationsByAccommodationWithEndDate(ctx context
 	defer span.End()
 	currentDate := time.Now().Format("2006-01-02")
 	scanner := rr.session.Query(`SELECT id,accommodation_id, user_id, start_date, end_date,username,accommodation_name,location,price,
-	num_of_days,date_range,is_active,country,host_id FROM reservation_by_accommodation
+	num_of_days,date_range,is_active,country,host_id,adults,children,infants,pets FROM reservation_by_accommodation
 	 WHERE  accommodation_id = ? AND user_id = ? AND end_date <= ?`,
 		accommodationID, userID, currentDate).Iter().Scanner()
 
@@ -577,7 +559,8 @@ func (rr *ReservationRepo) GetReservationsByAccommodationWithEndDate(ctx context
 
 		err := scanner.Scan(&reservation.Id, &reservation.AccommodationID, &reservation.UserID, &reservation.StartDate,
 			&reservation.EndDate, &reservation.Username, &reservation.AccommodationName, &reservation.Location, &reservation.Price,
-			&reservation.NumberOfDays, &reservation.DateRange, &reservation.IsActive, &reservation.Country, &reservation.HostID)
+			&reservation.NumberOfDays, &reservation.DateRange, &reservation.IsActive, &reservation.Country, &reservation.HostID,
+			&reservation.Guests.Adults, &reservation.Guests.Children, &reservation.Guests.Infants, &reservation.Guests.Pets)
 		if err != nil {
 			rr.logger.LogError("reservationsRepo", err.Error())
 			return nil, err
@@ -600,7 +583,7 @@ func (rr *ReservationRepo) GetReservationsByHostWithEndDate(ctx context.Context,
 	defer span.End()
 	currentDate := time.Now().Format("2006-01-02")
 	scanner := rr.session.Query(`SELECT id,accommodation_id, user_id, start_date, end_date,username,accommodation_name,location,price,
-	num_of_days,date_range,is_active,country,host_id FROM reservation_by_host
+	num_of_days,date_range,is_active,country,host_id,adults,children,infants,pets FROM reservation_by_host
 	 WHERE  host_id = ? AND user_id = ? AND end_date <= ?`,
 		hostID, userID, currentDate).Iter().Scanner()
 
@@ -610,7 +593,8 @@ func (rr *ReservationRepo) GetReservationsByHostWithEndDate(ctx context.Context,
 
 		err := scanner.Scan(&reservation.Id, &reservation.AccommodationID, &reservation.UserID, &reservation.StartDate,
 			&reservation.EndDate, &reservation.Username, &reservation.AccommodationName, &reservation.Location, &reservation.Price,
-			&reservation.NumberOfDays, &reservation.DateRange, &reservation.IsActive, &reservation.Country, &reservation.HostID)
+			&reservation.NumberOfDays, &reservation.DateRange, &reservation.IsActive, &reservation.Country, &reservation.HostID,
+			&reservation.Guests.Adults, &reservation.Guests.Children, &reservation.Guests.Infants, &reservation.Guests.Pets)
 		if err != nil {
 			rr.logger.LogError("reservationsRepo", err.Error())
 			return nil, err
@@ -632,10 +616,18 @@ func (rr *ReservationRepo) DeleteAvl(ctx context.Context, accommodationID, id, c
 	ctx, span := rr.tracer.Start(ctx, "ReservationRepo.DeleteAvl")
 	defer span.End()
 
-	batch := rr.session.NewBatch(gocql.LoggedBatch)
+	var dateRange []string
+	err := rr.session.Query(`SELECT date_range FROM free_accommodation WHERE accommodation_id = ? AND country = ? AND id = ?`,
+		accommodationID, country, id).Scan(&dateRange)
+	if err != nil && err != gocql.ErrNotFound {
+		rr.logger.LogError("reservationsRepo", err.Error())
+		return nil, errors.NewReservationError(500, "Unable to delete availability")
+	}
+	batch := rr.newBatch(gocql.LoggedBatch)
 
 	batch.Query(`DELETE FROM free_accommodation WHERE accommodation_id = ? AND country = ? AND id = ?`, accommodationID, country, id)
 	batch.Query(`DELETE FROM avl_by_price WHERE is_active = ? AND price = ? AND id = ?`, true, price, id)
+	removeFreeNights(batch, accommodationID, dateRange)
 
 	if err := rr.session.ExecuteBatch(batch); err != nil {
 		rr.logger.LogError("reservationsRepo", err.Error())
@@ -676,35 +668,381 @@ func (rr *ReservationRepo) GetAccommodationIDsByMaxPrice(ctx context.Context, ma
 func (rr *ReservationRepo) AvailabilityNotInDateRange(ctx context.Context, accommodationIDs []string, dateRange []string) ([]string, *errors.ReservationError) {
 	ctx, span := rr.tracer.Start(ctx, "ReservationRepo.AvailabilityNotInDateRange")
 	defer span.End()
-	uniqueAccommodationIDs := make(map[string]struct{})
-
+	result := make([]string, 0)
 	for _, accommodationID := range accommodationIDs {
-		query := `SELECT accommodation_id FROM free_accommodation WHERE accommodation_id = ? AND date_range CONTAINS ?`
-
+		nights, err := rr.nightsInRange(ctx, accommodationID, dateRange)
+		if err != nil {
+			rr.logger.LogError("reservationsRepo", err.Error())
+			return nil, errors.NewReservationError(500, "Unable to retrieve availability, database error")
+		}
 		isInDateRange := false
-
 		for _, date := range dateRange {
-			iter := rr.session.Query(query, accommodationID, date).Iter()
-
-			var result string
-			if iter.Scan(&result) {
+			if n, ok := nights[date]; ok && n.isFree() {
 				isInDateRange = true
+				break
+			}
+		}
+		if !isInDateRange {
+			result = append(result, accommodationID)
+		}
+	}
+	rr.logger.LogInfo("reservationRepo", fmt.Sprintf("Found availabilities that are not in date range by accommodationIDs and dateRange: %v", result))
+	return result, nil
+}
+
+func (rr *ReservationRepo) GetReservationByUserAndId(ctx context.Context, userID, id string) (*domain.Reservation, *errors.ReservationError) {
+	ctx, span := rr.tracer.Start(ctx, "ReservationRepo.GetReservationByUserAndId")
+	defer span.End()
+	var reservation domain.Reservation
+	err := rr.session.Query(`SELECT id,accommodation_id, user_id, start_date, end_date,username,accommodation_name,location,price,
+	num_of_days,continent,date_range,is_active,country,host_id,adults,children,infants,pets FROM reservation_by_user
+	 WHERE user_id = ? AND id = ?`,
+		userID, id).Scan(&reservation.Id, &reservation.AccommodationID, &reservation.UserID, &reservation.StartDate,
+		&reservation.EndDate, &reservation.Username, &reservation.AccommodationName, &reservation.Location, &reservation.Price,
+		&reservation.NumberOfDays, &reservation.Continent, &reservation.DateRange, &reservation.IsActive, &reservation.Country, &reservation.HostID,
+		&reservation.Guests.Adults, &reservation.Guests.Children, &reservation.Guests.Infants, &reservation.Guests.Pets)
+	if err == gocql.ErrNotFound {
+		return nil, errors.NewReservationError(404, "Reservation not found")
+	}
+	if err != nil {
+		rr.logger.LogError("reservationsRepo", err.Error())
+		return nil, errors.NewReservationError(500, "Unable to retrieve reservation, database error")
+	}
+	rr.logger.LogInfo("reservationRepo", fmt.Sprintf("Found reservation by userID and ID: %v", reservation))
+	return &reservation, nil
+}
+
+// NightlyPrices returns the price of every date from dateRange that is covered by
+// a free_accommodation row. Dates that are missing from the result are not available.
+func (rr *ReservationRepo) NightlyPrices(ctx context.Context, accommodationID string, dateRange []string) (map[string]int, *errors.ReservationError) {
+	ctx, span := rr.tracer.Start(ctx, "ReservationRepo.NightlyPrices")
+	defer span.End()
+	nights, err := rr.nightsInRange(ctx, accommodationID, dateRange)
+	if err != nil {
+		return nil, rr.availabilityDatabaseError(err)
+	}
+	prices := make(map[string]int)
+	for _, date := range dateRange {
+		if n, ok := nights[date]; ok && n.isFree() {
+			prices[date] = n.price
+		}
+	}
+	rr.logger.LogInfo("reservationRepo", fmt.Sprintf("Found nightly prices by accommodationID and dateRange: %v", prices))
+	return prices, nil
+}
+
+// UpdateReservation rewrites a reservation in all four reservation tables in one logged batch.
+// reservation_by_host and reservation_by_accommodation cluster by end_date, so when it changes
+// their rows are deleted and reinserted instead of updated in place. The nights the reservation
+// doesn't have yet are claimed first, when another reservation got any of them first the
+// reservation is left as it is and UpdateReservation fails with 409. A reservation booked as part
+// of a trip gets its leg of the trip rewritten too.
+func (rr *ReservationRepo) UpdateReservation(ctx context.Context, old *domain.Reservation, updated *domain.Reservation) (*domain.Reservation, *errors.ReservationError) {
+	ctx, span := rr.tracer.Start(ctx, "ReservationRepo.UpdateReservation")
+	defer span.End()
+	startDate := updated.DateRange[0]
+	endDate := updated.DateRange[len(updated.DateRange)-1]
+	tripID, tripErr := rr.GetTripIDByReservation(ctx, old.Id)
+	if tripErr != nil {
+		return nil, tripErr
+	}
+	newNights := subtractDates(updated.DateRange, old.DateRange)
+	claimed, claimErr := rr.claimNights(ctx, old.AccommodationID, old.Id, newNights)
+	if claimErr != nil {
+		return nil, claimErr
+	}
+	if !claimed {
+		return nil, errors.NewReservationError(409, "Accommodation is not available for the specified date range")
+	}
+
+	batch := rr.newBatch(gocql.LoggedBatch)
+
+	batch.Query(`UPDATE reservations SET start_date = ?, end_date = ?, price = ?, num_of_days = ?, date_range = ?,
+		adults = ?, children = ?, infants = ?, pets = ?
+		WHERE continent = ? AND country = ? AND id = ?`, startDate, endDate, updated.Price, updated.NumberOfDays,
+		updated.DateRange, updated.Guests.Adults, updated.Guests.Children, updated.Guests.Infants, updated.Guests.Pets,
+		old.Continent, old.Country, old.Id)
+	batch.Query(`UPDATE reservation_by_user SET start_date = ?, end_date = ?, price = ?, num_of_days = ?, date_range = ?,
+		adults = ?, children = ?, infants = ?, pets = ?
+		WHERE user_id = ? AND id = ?`, startDate, endDate, updated.Price, updated.NumberOfDays,
+		updated.DateRange, updated.Guests.Adults, updated.Guests.Children, updated.Guests.Infants, updated.Guests.Pets,
+		old.UserID, old.Id)
+	// end_date is part of the key of the host and accommodation tables. The old rows are only deleted
+	// when it changes, a delete and an insert of the same row in one batch share a timestamp and the
+	// delete would win.
+	endDateChanged := endDate != old.EndDate
+	if endDateChanged {
+		batch.Query(`DELETE FROM reservation_by_host WHERE host_id = ? AND user_id = ? AND end_date = ? AND id = ?`,
+			old.HostID, old.UserID, old.EndDate, old.Id)
+	}
+	batch.Query(`INSERT INTO reservation_by_host (id,user_id,accommodation_id,start_date,end_date,username,accommodation_name,location,price,num_of_days,
+	    continent,date_range,is_active,country,host_id,adults,children,infants,pets)
+	    VALUES(?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)`, old.Id, old.UserID, old.AccommodationID, startDate,
+		endDate, old.Username, old.AccommodationName, old.Location,
+		updated.Price, updated.NumberOfDays, old.Continent, updated.DateRange, old.IsActive, old.Country, old.HostID,
+		updated.Guests.Adults, updated.Guests.Children, updated.Guests.Infants, updated.Guests.Pets)
+	if endDateChanged {
+		batch.Query(`DELETE FROM reservation_by_accommodation WHERE accommodation_id = ? AND user_id = ? AND end_date = ? AND id = ?`,
+			old.AccommodationID, old.UserID, old.EndDate, old.Id)
+	}
+	batch.Query(`INSERT INTO reservation_by_accommodation (id,user_id,accommodation_id,start_date,end_date,username,accommodation_name,location,price,num_of_days,
+			continent,date_range,is_active,country,host_id,adults,children,infants,pets)
+			VALUES(?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)`, old.Id, old.UserID, old.AccommodationID, startDate,
+		endDate, old.Username, old.AccommodationName, old.Location,
+		updated.Price, updated.NumberOfDays, old.Continent, updated.DateRange, old.IsActive, old.Country, old.HostID,
+		updated.Guests.Adults, updated.Guests.Children, updated.Guests.Infants, updated.Guests.Pets)
+	if tripID != nil {
+		batch.Query(`UPDATE trip_legs SET date_range = ?, price = ?, adults = ?, children = ?, infants = ?, pets = ?
+			WHERE trip_id = ? AND reservation_id = ?`, updated.DateRange, updated.Price, updated.Guests.Adults,
+			updated.Guests.Children, updated.Guests.Infants, updated.Guests.Pets, *tripID, old.Id)
+	}
+	releaseNights(batch, old.AccommodationID, subtractDates(old.DateRange, updated.DateRange))
+
+	if err := rr.session.ExecuteBatch(batch); err != nil {
+		rr.logger.LogError("reservationsRepo", err.Error())
+		rr.unclaimNights(ctx, old.AccommodationID, old.Id, newNights)
+		return nil, errors.NewReservationError(500, "Unable to modify the reservation")
+	}
+
+	result := *old
+	result.StartDate = startDate
+	result.EndDate = endDate
+	result.Price = updated.Price
+	result.NumberOfDays = updated.NumberOfDays
+	result.DateRange = updated.DateRange
+	result.Guests = updated.Guests
+	rr.logger.LogInfo("reservationRepo", fmt.Sprintf("Modified reservation: %v", result))
+	return &result, nil
+}
+
+func (rr *ReservationRepo) GetReservedDates(ctx context.Context, accommodationID string) ([]string, *errors.ReservationError) {
+	ctx, span := rr.tracer.Start(ctx, "ReservationRepo.GetReservedDates")
+	defer span.End()
+	iter := rr.session.Query(`SELECT date_range, is_active FROM reservation_by_accommodation WHERE accommodation_id = ?`,
+		accommodationID).Iter()
+
+	var reservedDates []string
+	var dateRange []string
+	var isActive bool
+	for iter.Scan(&dateRange, &isActive) {
+		if isActive {
+			reservedDates = append(reservedDates, dateRange...)
+		}
+	}
+	if err := iter.Close(); err != nil {
+		rr.logger.LogError("reservationsRepo", err.Error())
+		return nil, errors.NewReservationError(500, "Unable to retrieve reservations, database error")
+	}
+	rr.logger.LogInfo("reservationRepo", fmt.Sprintf("Found reserved dates by accommodationID: %v", reservedDates))
+	return reservedDates, nil
+}
+
+func (rr *ReservationRepo) GetBlockedDates(ctx context.Context, accommodationID, from, to string) ([]domain.BlockedDate, *errors.ReservationError) {
+	ctx, span := rr.tracer.Start(ctx, "ReservationRepo.GetBlockedDates")
+	defer span.End()
+	iter := rr.session.Query(`SELECT accommodation_id, date, reason FROM blocked_dates
+		WHERE accommodation_id = ? AND date >= ? AND date <= ?`, accommodationID, from, to).Consistency(conflictConsistency).Iter()
+
+	var blocked []domain.BlockedDate
+	var block domain.BlockedDate
+	for iter.Scan(&block.AccommodationID, &block.Date, &block.Reason) {
+		blocked = append(blocked, block)
+	}
+	if err := iter.Close(); err != nil {
+		rr.logger.LogError("reservationsRepo", err.Error())
+		return nil, errors.NewReservationError(500, "Unable to retrieve blocked dates, database error")
+	}
+	rr.logger.LogInfo("reservationRepo", fmt.Sprintf("Found blocked dates by accommodationID: %v", blocked))
+	return blocked, nil
+}
+
+func (rr *ReservationRepo) GetAvailabilityRanges(ctx context.Context, accommodationID string) ([]domain.AvailabilityRange, *errors.ReservationError) {
+	ctx, span := rr.tracer.Start(ctx, "ReservationRepo.GetAvailabilityRanges")
+	defer span.End()
+	iter := rr.session.Query(`SELECT id, accommodation_id, location, price, continent, country, date_range
+		FROM free_accommodation WHERE accommodation_id = ?`, accommodationID).Iter()
+
+	var ranges []domain.AvailabilityRange
+	var avl domain.AvailabilityRange
+	for iter.Scan(&avl.Id, &avl.AccommodationID, &avl.Location, &avl.Price, &avl.Continent, &avl.Country, &avl.DateRange) {
+		ranges = append(ranges, avl)
+		avl = domain.AvailabilityRange{}
+	}
+	if err := iter.Close(); err != nil {
+		rr.logger.LogError("reservationsRepo", err.Error())
+		return nil, errors.NewReservationError(500, "Unable to retrieve availability, database error")
+	}
+	rr.logger.LogInfo("reservationRepo", fmt.Sprintf("Found availability ranges by accommodationID: %v", ranges))
+	return ranges, nil
+}
+
+// ApplyAvailabilityChanges moves the availability of an accommodation from previous to next in one
+// logged batch. Ranges keep their row when their id is reused, so nothing is deleted and reinserted
+// under the same primary key.
+func (rr *ReservationRepo) ApplyAvailabilityChanges(ctx context.Context, previous, next []domain.AvailabilityRange) *errors.ReservationError {
+	ctx, span := rr.tracer.Start(ctx, "ReservationRepo.ApplyAvailabilityChanges")
+	defer span.End()
+	nextByID := make(map[gocql.UUID]domain.AvailabilityRange, len(next))
+	for _, avl := range next {
+		nextByID[avl.Id] = avl
+	}
+	previousByID := make(map[gocql.UUID]domain.AvailabilityRange, len(previous))
+	for _, avl := range previous {
+		previousByID[avl.Id] = avl
+	}
+
+	nextDates := make(map[string]struct{})
+	for _, avl := range next {
+		for _, date := range avl.DateRange {
+			nextDates[date] = struct{}{}
+		}
+	}
+
+	batch := rr.newBatch(gocql.LoggedBatch)
+	for _, old := range previous {
+		var removedDates []string
+		for _, date := range old.DateRange {
+			if _, ok := nextDates[date]; !ok {
+				removedDates = append(removedDates, date)
 			}
+		}
+		removeFreeNights(batch, old.AccommodationID, removedDates)
+		updated, kept := nextByID[old.Id]
+		if !kept {
+			batch.Query(`DELETE FROM free_accommodation WHERE accommodation_id = ? AND country = ? AND id = ?`, old.AccommodationID, old.Country, old.Id)
+		}
+		if !kept || updated.Price != old.Price {
+			batch.Query(`DELETE FROM avl_by_price WHERE is_active = ? AND price = ? AND id = ?`, true, old.Price, old.Id)
+		}
+	}
+	for _, avl := range next {
+		if old, exists := previousByID[avl.Id]; exists && old.Price == avl.Price && equalDates(old.DateRange, avl.DateRange) {
+			continue
+		}
+		batch.Query(`
+				INSERT INTO free_accommodation (id, accommodation_id, location, price, continent, country, date_range)
+				VALUES(?, ?, ?, ?, ?, ?, ?)
+			`, avl.Id, avl.AccommodationID, avl.Location, avl.Price, avl.Continent, avl.Country, avl.DateRange)
+		batch.Query(`
+				INSERT INTO avl_by_price (id, accommodation_id, location, price, continent, country, date_range,is_active)
+				VALUES(?, ?, ?, ?, ?, ?, ?,?)
+			`, avl.Id, avl.AccommodationID, avl.Location, avl.Price, avl.Continent, avl.Country, avl.DateRange, true)
+		addFreeNights(batch, avl.AccommodationID, avl.Id, avl.Price, avl.DateRange)
+	}
+	if batch.Size() == 0 {
+		return nil
+	}
+
+	if err := rr.session.ExecuteBatch(batch); err != nil {
+		rr.logger.LogError("reservationsRepo", err.Error())
+		return errors.NewReservationError(500, "Unable to update availability")
+	}
+	rr.logger.LogInfo("reservationRepo", fmt.Sprintf("Applied availability changes: %v", next))
+	return nil
+}
 
-			if err := iter.Close(); err != nil {
-				rr.logger.LogError("reservationsRepo", err.Error())
-				return nil, errors.NewReservationError(500, "Unable to retrieve availability, database error")
+// ReservationsOnDates returns the ids of active reservations of an accommodation that hold any of the dates.
+func (rr *ReservationRepo) ReservationsOnDates(ctx context.Context, accommodationID string, dates []string) ([]string, *errors.ReservationError) {
+	ctx, span := rr.tracer.Start(ctx, "ReservationRepo.ReservationsOnDates")
+	defer span.End()
+	wanted := make(map[string]struct{}, len(dates))
+	for _, date := range dates {
+		wanted[date] = struct{}{}
+	}
+	iter := rr.session.Query(`SELECT id, date_range, is_active FROM reservation_by_accommodation WHERE accommodation_id = ?`,
+		accommodationID).Iter()
+
+	var reservationIDs []string
+	var id gocql.UUID
+	var dateRange []string
+	var isActive bool
+	for iter.Scan(&id, &dateRange, &isActive) {
+		if !isActive {
+			continue
+		}
+		for _, date := range dateRange {
+			if _, ok := wanted[date]; ok {
+				reservationIDs = append(reservationIDs, id.String())
+				break
 			}
 		}
-		if !isInDateRange {
-			uniqueAccommodationIDs[accommodationID] = struct{}{}
+	}
+	if err := iter.Close(); err != nil {
+		rr.logger.LogError("reservationsRepo", err.Error())
+		return nil, errors.NewReservationError(500, "Unable to retrieve reservations, database error")
+	}
+	rr.logger.LogInfo("reservationRepo", fmt.Sprintf("Found reservations on dates by accommodationID: %v", reservationIDs))
+	return reservationIDs, nil
+}
+
+func (rr *ReservationRepo) InsertBlockedDates(ctx context.Context, accommodationID string, dates []string, reason string) *errors.ReservationError {
+	ctx, span := rr.tracer.Start(ctx, "ReservationRepo.InsertBlockedDates")
+	defer span.End()
+	batch := rr.newBatch(gocql.UnloggedBatch)
+	for _, date := range dates {
+		batch.Query(`INSERT INTO blocked_dates (accommodation_id, date, reason) VALUES(?, ?, ?)`, accommodationID, date, reason)
+	}
+	if err := rr.session.ExecuteBatch(batch); err != nil {
+		rr.logger.LogError("reservationsRepo", err.Error())
+		return errors.NewReservationError(500, "Unable to block dates")
+	}
+	rr.logger.LogInfo("reservationRepo", fmt.Sprintf("Blocked dates %v for accommodationID: %s", dates, accommodationID))
+	return nil
+}
+
+func (rr *ReservationRepo) DeleteBlockedDates(ctx context.Context, accommodationID string, dates []string) *errors.ReservationError {
+	ctx, span := rr.tracer.Start(ctx, "ReservationRepo.DeleteBlockedDates")
+	defer span.End()
+	batch := rr.newBatch(gocql.UnloggedBatch)
+	for _, date := range dates {
+		batch.Query(`DELETE FROM blocked_dates WHERE accommodation_id = ? AND date = ?`, accommodationID, date)
+	}
+	if err := rr.session.ExecuteBatch(batch); err != nil {
+		rr.logger.LogError("reservationsRepo", err.Error())
+		return errors.NewReservationError(500, "Unable to unblock dates")
+	}
+	rr.logger.LogInfo("reservationRepo", fmt.Sprintf("Unblocked dates %v for accommodationID: %s", dates, accommodationID))
+	return nil
+}
+
+func equalDates(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
 		}
 	}
+	return true
+}
 
-	result := make([]string, 0, len(uniqueAccommodationIDs))
-	for key := range uniqueAccommodationIDs {
-		result = append(result, key)
+func (rr *ReservationRepo) SaveCalendarFeed(ctx context.Context, feed domain.CalendarFeed) *errors.ReservationError {
+	ctx, span := rr.tracer.Start(ctx, "ReservationRepo.SaveCalendarFeed")
+	defer span.End()
+	err := rr.session.Query(`INSERT INTO calendar_feeds (accommodation_id, url, last_synced) VALUES(?, ?, ?)`,
+		feed.AccommodationID, feed.URL, feed.LastSynced).Consistency(rr.writeConsistency).Exec()
+	if err != nil {
+		rr.logger.LogError("reservationsRepo", err.Error())
+		return errors.NewReservationError(500, "Unable to save calendar feed")
 	}
-	rr.logger.LogInfo("reservationRepo", fmt.Sprintf("Found availabilities that are not in date range by accommodationIDs and dateRange: %v", result))
-	return result, nil
+	rr.logger.LogInfo("reservationRepo", fmt.Sprintf("Saved calendar feed: %v", feed))
+	return nil
+}
+
+func (rr *ReservationRepo) GetCalendarFeeds(ctx context.Context) ([]domain.CalendarFeed, *errors.ReservationError) {
+	ctx, span := rr.tracer.Start(ctx, "ReservationRepo.GetCalendarFeeds")
+	defer span.End()
+	iter := rr.session.Query(`SELECT accommodation_id, url, last_synced FROM calendar_feeds`).Iter()
+
+	var feeds []domain.CalendarFeed
+	var feed domain.CalendarFeed
+	for iter.Scan(&feed.AccommodationID, &feed.URL, &feed.LastSynced) {
+		feeds = append(feeds, feed)
+	}
+	if err := iter.Close(); err != nil {
+		rr.logger.LogError("reservationsRepo", err.Error())
+		return nil, errors.NewReservationError(500, "Unable to retrieve calendar feeds, database error")
+	}
+	return feeds, nil
 }
@@ -0,0 +1,154 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"reservation-service/domain"
+	"reservation-service/errors"
+
+	"github.com/gocql/gocql"
+)
+
+// InsertTrip stores the reservations of a trip together with the trip in one logged batch, so
+// either every leg is reserved or none is. The nights of every leg are claimed first, when
+// another reservation got any of them first the nights of the trip are given back and InsertTrip
+// fails with 409. The batch grows with every leg, trips are kept within utils.MaxTripLegs and
+// utils.MaxTripNights so it and the claims stay below the batch limit.
+func (rr *ReservationRepo) InsertTrip(ctx context.Context, trip *domain.Trip, reservations []*domain.Reservation) *errors.ReservationError {
+	ctx, span := rr.tracer.Start(ctx, "ReservationRepo.InsertTrip")
+	defer span.End()
+	batch := rr.newBatch(gocql.LoggedBatch)
+	for i, reservation := range reservations {
+		if err := rr.addReservation(batch, reservation); err != nil {
+			return errors.NewReservationError(400, err.Error())
+		}
+		leg := &trip.Legs[i]
+		leg.ReservationID = reservation.Id
+		leg.Country = reservation.Country
+		batch.Query(`INSERT INTO trip_legs (trip_id, reservation_id, user_id, created_at, accommodation_id, accommodation_name,
+			host_id, country, date_range, adults, children, infants, pets, price, status)
+			VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			trip.Id, leg.ReservationID, trip.UserID, trip.CreatedAt, leg.AccommodationID, leg.AccommodationName, leg.HostID,
+			leg.Country, leg.DateRange, leg.Guests.Adults, leg.Guests.Children, leg.Guests.Infants, leg.Guests.Pets,
+			leg.Price, leg.Status)
+		batch.Query(`INSERT INTO trip_by_reservation (reservation_id, trip_id) VALUES(?, ?)`, leg.ReservationID, trip.Id)
+	}
+	batch.Query(`INSERT INTO trips_by_user (user_id, trip_id, created_at) VALUES(?, ?, ?)`, trip.UserID, trip.Id, trip.CreatedAt)
+	unclaim := func(legs []*domain.Reservation) {
+		for _, reservation := range legs {
+			rr.unclaimNights(ctx, reservation.AccommodationID, reservation.Id, reservation.DateRange)
+		}
+	}
+	for i, reservation := range reservations {
+		claimed, err := rr.claimNights(ctx, reservation.AccommodationID, reservation.Id, reservation.DateRange)
+		if err != nil {
+			unclaim(reservations[:i])
+			return err
+		}
+		if !claimed {
+			unclaim(reservations[:i])
+			return errors.NewReservationError(409, fmt.Sprintf("Leg %d: Accommodation is not available for the specified date range", i+1))
+		}
+	}
+	if err := rr.session.ExecuteBatch(batch); err != nil {
+		rr.logger.LogError("reservationsRepo", err.Error())
+		unclaim(reservations)
+		return errors.NewReservationError(500, "Unable to create trip, database error")
+	}
+	rr.logger.LogInfo("reservationRepo", fmt.Sprintf("Inserted trip %s with %d legs", trip.Id, len(trip.Legs)))
+	return nil
+}
+
+func (rr *ReservationRepo) GetTrip(ctx context.Context, tripID gocql.UUID) (*domain.Trip, *errors.ReservationError) {
+	ctx, span := rr.tracer.Start(ctx, "ReservationRepo.GetTrip")
+	defer span.End()
+	iter := rr.session.Query(`SELECT reservation_id, user_id, created_at, accommodation_id, accommodation_name, host_id, country,
+		date_range, adults, children, infants, pets, price, status FROM trip_legs WHERE trip_id = ?`, tripID).Iter()
+	trip := domain.Trip{Id: tripID, Legs: []domain.TripLeg{}}
+	for {
+		var leg domain.TripLeg
+		if !iter.Scan(&leg.ReservationID, &trip.UserID, &trip.CreatedAt, &leg.AccommodationID, &leg.AccommodationName,
+			&leg.HostID, &leg.Country, &leg.DateRange, &leg.Guests.Adults, &leg.Guests.Children, &leg.Guests.Infants,
+			&leg.Guests.Pets, &leg.Price, &leg.Status) {
+			break
+		}
+		trip.Legs = append(trip.Legs, leg)
+	}
+	if err := iter.Close(); err != nil {
+		rr.logger.LogError("reservationsRepo", err.Error())
+		return nil, errors.NewReservationError(500, "Unable to retrieve trip, database error")
+	}
+	if len(trip.Legs) == 0 {
+		return nil, errors.NewReservationError(404, "Trip not found")
+	}
+	trip.Price = trip.ActivePrice()
+	return &trip, nil
+}
+
+// GetTripIDByReservation returns the trip a reservation was booked with, or nil for a
+// reservation booked on its own.
+func (rr *ReservationRepo) GetTripIDByReservation(ctx context.Context, reservationID gocql.UUID) (*gocql.UUID, *errors.ReservationError) {
+	ctx, span := rr.tracer.Start(ctx, "ReservationRepo.GetTripIDByReservation")
+	defer span.End()
+	var tripID gocql.UUID
+	err := rr.session.Query(`SELECT trip_id FROM trip_by_reservation WHERE reservation_id = ?`, reservationID).Scan(&tripID)
+	if err == gocql.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		rr.logger.LogError("reservationsRepo", err.Error())
+		return nil, errors.NewReservationError(500, "Unable to retrieve trip, database error")
+	}
+	return &tripID, nil
+}
+
+// BackfillTripByReservation fills trip_by_reservation from trip_legs. Every write is an upsert,
+// so running it again is harmless.
+func (rr *ReservationRepo) BackfillTripByReservation(ctx context.Context) error {
+	ctx, span := rr.tracer.Start(ctx, "ReservationRepo.BackfillTripByReservation")
+	defer span.End()
+	iter := rr.session.Query(`SELECT trip_id, reservation_id FROM trip_legs`).Iter()
+	var tripID, reservationID gocql.UUID
+	for iter.Scan(&tripID, &reservationID) {
+		err := rr.session.Query(`INSERT INTO trip_by_reservation (reservation_id, trip_id) VALUES(?, ?)`, reservationID, tripID).
+			Consistency(rr.writeConsistency).Exec()
+		if err != nil {
+			iter.Close()
+			return err
+		}
+	}
+	return iter.Close()
+}
+
+func (rr *ReservationRepo) GetTripsByUser(ctx context.Context, userID string) ([]domain.Trip, *errors.ReservationError) {
+	ctx, span := rr.tracer.Start(ctx, "ReservationRepo.GetTripsByUser")
+	defer span.End()
+	iter := rr.session.Query(`SELECT trip_id FROM trips_by_user WHERE user_id = ?`, userID).Iter()
+	trips := []domain.Trip{}
+	var tripID gocql.UUID
+	for iter.Scan(&tripID) {
+		trip, err := rr.GetTrip(ctx, tripID)
+		if err != nil {
+			iter.Close()
+			return nil, err
+		}
+		trips = append(trips, *trip)
+	}
+	if err := iter.Close(); err != nil {
+		rr.logger.LogError("reservationsRepo", err.Error())
+		return nil, errors.NewReservationError(500, "Unable to retrieve trips, database error")
+	}
+	return trips, nil
+}
+
+func (rr *ReservationRepo) UpdateTripLegStatus(ctx context.Context, tripID, reservationID gocql.UUID, status string) *errors.ReservationError {
+	ctx, span := rr.tracer.Start(ctx, "ReservationRepo.UpdateTripLegStatus")
+	defer span.End()
+	err := rr.session.Query(`UPDATE trip_legs SET status = ? WHERE trip_id = ? AND reservation_id = ?`,
+		status, tripID, reservationID).Consistency(rr.writeConsistency).Exec()
+	if err != nil {
+		rr.logger.LogError("reservationsRepo", err.Error())
+		return errors.NewReservationError(500, "Unable to update trip, database error")
+	}
+	return nil
+}
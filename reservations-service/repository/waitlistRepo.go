@@ -0,0 +1,232 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"reservation-service/domain"
+	"reservation-service/errors"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+const waitlistColumns = `accommodation_id, id, accommodation_name, user_id, date_range, adults, children, infants, pets,
+	status, hold_expires_at`
+
+func (rr *ReservationRepo) InsertWaitlistEntry(ctx context.Context, entry *domain.WaitlistEntry) *errors.ReservationError {
+	ctx, span := rr.tracer.Start(ctx, "ReservationRepo.InsertWaitlistEntry")
+	defer span.End()
+	batch := rr.newBatch(gocql.LoggedBatch)
+	batch.Query(`INSERT INTO waitlist_by_accommodation (`+waitlistColumns+`) VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		entry.AccommodationID, entry.Id, entry.AccommodationName, entry.UserID, entry.DateRange, entry.Guests.Adults,
+		entry.Guests.Children, entry.Guests.Infants, entry.Guests.Pets, entry.Status, entry.HoldExpiresAt)
+	batch.Query(`INSERT INTO waitlist_by_user (user_id, id, accommodation_id) VALUES(?, ?, ?)`,
+		entry.UserID, entry.Id, entry.AccommodationID)
+	if err := rr.session.ExecuteBatch(batch); err != nil {
+		rr.logger.LogError("reservationsRepo", err.Error())
+		return errors.NewReservationError(500, "Unable to join the waitlist, database error")
+	}
+	rr.logger.LogInfo("reservationRepo", fmt.Sprintf("User %s joined the waitlist of accommodation %s", entry.UserID, entry.AccommodationID))
+	return nil
+}
+
+// UpdateWaitlistEntry stores the status of an entry. Offered entries are also registered in
+// waitlist_offers under the day their hold expires.
+func (rr *ReservationRepo) UpdateWaitlistEntry(ctx context.Context, entry *domain.WaitlistEntry) *errors.ReservationError {
+	ctx, span := rr.tracer.Start(ctx, "ReservationRepo.UpdateWaitlistEntry")
+	defer span.End()
+	batch := rr.newBatch(gocql.LoggedBatch)
+	batch.Query(`UPDATE waitlist_by_accommodation SET status = ?, hold_expires_at = ? WHERE accommodation_id = ? AND id = ?`,
+		entry.Status, entry.HoldExpiresAt, entry.AccommodationID, entry.Id)
+	if entry.Status == domain.WaitlistOffered && entry.HoldExpiresAt != nil {
+		batch.Query(`INSERT INTO waitlist_offers (day, expires_at, accommodation_id, entry_id) VALUES(?, ?, ?, ?)`,
+			entry.HoldExpiresAt.UTC().Format("2006-01-02"), *entry.HoldExpiresAt, entry.AccommodationID, entry.Id)
+	}
+	if err := rr.session.ExecuteBatch(batch); err != nil {
+		rr.logger.LogError("reservationsRepo", err.Error())
+		return errors.NewReservationError(500, "Unable to update the waitlist, database error")
+	}
+	return nil
+}
+
+func (rr *ReservationRepo) DeleteWaitlistEntry(ctx context.Context, entry *domain.WaitlistEntry) *errors.ReservationError {
+	ctx, span := rr.tracer.Start(ctx, "ReservationRepo.DeleteWaitlistEntry")
+	defer span.End()
+	batch := rr.newBatch(gocql.LoggedBatch)
+	batch.Query(`DELETE FROM waitlist_by_accommodation WHERE accommodation_id = ? AND id = ?`, entry.AccommodationID, entry.Id)
+	batch.Query(`DELETE FROM waitlist_by_user WHERE user_id = ? AND id = ?`, entry.UserID, entry.Id)
+	if err := rr.session.ExecuteBatch(batch); err != nil {
+		rr.logger.LogError("reservationsRepo", err.Error())
+		return errors.NewReservationError(500, "Unable to leave the waitlist, database error")
+	}
+	rr.logger.LogInfo("reservationRepo", fmt.Sprintf("User %s left the waitlist of accommodation %s", entry.UserID, entry.AccommodationID))
+	return nil
+}
+
+// GetWaitlist returns the waitlist of an accommodation in the order the guests joined.
+func (rr *ReservationRepo) GetWaitlist(ctx context.Context, accommodationID string) ([]domain.WaitlistEntry, *errors.ReservationError) {
+	ctx, span := rr.tracer.Start(ctx, "ReservationRepo.GetWaitlist")
+	defer span.End()
+	iter := rr.session.Query(`SELECT `+waitlistColumns+` FROM waitlist_by_accommodation WHERE accommodation_id = ?`,
+		accommodationID).Iter()
+	entries := []domain.WaitlistEntry{}
+	for {
+		var entry domain.WaitlistEntry
+		if !scanWaitlistEntry(iter, &entry) {
+			break
+		}
+		entries = append(entries, entry)
+	}
+	if err := iter.Close(); err != nil {
+		rr.logger.LogError("reservationsRepo", err.Error())
+		return nil, errors.NewReservationError(500, "Unable to retrieve the waitlist, database error")
+	}
+	return entries, nil
+}
+
+func (rr *ReservationRepo) GetWaitlistEntry(ctx context.Context, accommodationID string, id gocql.UUID) (*domain.WaitlistEntry, *errors.ReservationError) {
+	ctx, span := rr.tracer.Start(ctx, "ReservationRepo.GetWaitlistEntry")
+	defer span.End()
+	iter := rr.session.Query(`SELECT `+waitlistColumns+` FROM waitlist_by_accommodation WHERE accommodation_id = ? AND id = ?`,
+		accommodationID, id).Iter()
+	var entry domain.WaitlistEntry
+	found := scanWaitlistEntry(iter, &entry)
+	if err := iter.Close(); err != nil {
+		rr.logger.LogError("reservationsRepo", err.Error())
+		return nil, errors.NewReservationError(500, "Unable to retrieve the waitlist, database error")
+	}
+	if !found {
+		return nil, errors.NewReservationError(404, "Waitlist entry not found")
+	}
+	return &entry, nil
+}
+
+func (rr *ReservationRepo) GetWaitlistByUser(ctx context.Context, userID string) ([]domain.WaitlistEntry, *errors.ReservationError) {
+	ctx, span := rr.tracer.Start(ctx, "ReservationRepo.GetWaitlistByUser")
+	defer span.End()
+	iter := rr.session.Query(`SELECT id, accommodation_id FROM waitlist_by_user WHERE user_id = ?`, userID).Iter()
+	entries := []domain.WaitlistEntry{}
+	var id gocql.UUID
+	var accommodationID string
+	for iter.Scan(&id, &accommodationID) {
+		entry, err := rr.GetWaitlistEntry(ctx, accommodationID, id)
+		if err != nil && err.Status != 404 {
+			iter.Close()
+			return nil, err
+		}
+		if entry != nil {
+			entries = append(entries, *entry)
+		}
+	}
+	if err := iter.Close(); err != nil {
+		rr.logger.LogError("reservationsRepo", err.Error())
+		return nil, errors.NewReservationError(500, "Unable to retrieve the waitlist, database error")
+	}
+	return entries, nil
+}
+
+func scanWaitlistEntry(iter *gocql.Iter, entry *domain.WaitlistEntry) bool {
+	var holdExpiresAt time.Time
+	if !iter.Scan(&entry.AccommodationID, &entry.Id, &entry.AccommodationName, &entry.UserID, &entry.DateRange,
+		&entry.Guests.Adults, &entry.Guests.Children, &entry.Guests.Infants, &entry.Guests.Pets, &entry.Status, &holdExpiresAt) {
+		return false
+	}
+	if !holdExpiresAt.IsZero() {
+		entry.HoldExpiresAt = &holdExpiresAt
+	}
+	return true
+}
+
+// HoldNights holds nights of an accommodation for a waitlist entry. The rows expire together
+// with the hold. Every night is inserted only if it isn't held yet, and as the holds of an
+// accommodation share a partition the inserts go in one conditional batch: when another offer
+// holds any of the nights first, none of them is held and HoldNights returns false.
+func (rr *ReservationRepo) HoldNights(ctx context.Context, holds []domain.Hold) (bool, *errors.ReservationError) {
+	ctx, span := rr.tracer.Start(ctx, "ReservationRepo.HoldNights")
+	defer span.End()
+	batch := rr.newBatch(gocql.LoggedBatch)
+	for _, hold := range holds {
+		ttl := int(time.Until(hold.ExpiresAt).Seconds())
+		if ttl < 1 {
+			continue
+		}
+		batch.Query(`INSERT INTO reservation_holds (accommodation_id, date, user_id, entry_id, expires_at) VALUES(?, ?, ?, ?, ?) IF NOT EXISTS USING TTL ?`,
+			hold.AccommodationID, hold.Date, hold.UserID, hold.EntryID, hold.ExpiresAt, ttl)
+	}
+	if batch.Size() == 0 {
+		return false, nil
+	}
+	applied, iter, err := rr.session.MapExecuteBatchCAS(batch, map[string]interface{}{})
+	if iter != nil {
+		_ = iter.Close()
+	}
+	if err != nil {
+		rr.logger.LogError("reservationsRepo", err.Error())
+		return false, errors.NewReservationError(500, "Unable to hold nights, database error")
+	}
+	return applied, nil
+}
+
+// GetHolds returns the holds on the nights of an accommodation between from and to, keyed by date.
+func (rr *ReservationRepo) GetHolds(ctx context.Context, accommodationID, from, to string) (map[string]domain.Hold, *errors.ReservationError) {
+	ctx, span := rr.tracer.Start(ctx, "ReservationRepo.GetHolds")
+	defer span.End()
+	iter := rr.session.Query(`SELECT date, user_id, entry_id, expires_at FROM reservation_holds
+		WHERE accommodation_id = ? AND date >= ? AND date <= ?`, accommodationID, from, to).Consistency(conflictConsistency).Iter()
+	holds := make(map[string]domain.Hold)
+	hold := domain.Hold{AccommodationID: accommodationID}
+	for iter.Scan(&hold.Date, &hold.UserID, &hold.EntryID, &hold.ExpiresAt) {
+		holds[hold.Date] = hold
+	}
+	if err := iter.Close(); err != nil {
+		rr.logger.LogError("reservationsRepo", err.Error())
+		return nil, errors.NewReservationError(500, "Unable to retrieve holds, database error")
+	}
+	return holds, nil
+}
+
+func (rr *ReservationRepo) ReleaseHolds(ctx context.Context, accommodationID string, dates []string) *errors.ReservationError {
+	ctx, span := rr.tracer.Start(ctx, "ReservationRepo.ReleaseHolds")
+	defer span.End()
+	batch := rr.newBatch(gocql.LoggedBatch)
+	for _, date := range dates {
+		batch.Query(`DELETE FROM reservation_holds WHERE accommodation_id = ? AND date = ?`, accommodationID, date)
+	}
+	if err := rr.session.ExecuteBatch(batch); err != nil {
+		rr.logger.LogError("reservationsRepo", err.Error())
+		return errors.NewReservationError(500, "Unable to release holds, database error")
+	}
+	return nil
+}
+
+// GetExpiredOffers returns the offers of the given days whose hold ran out before now.
+func (rr *ReservationRepo) GetExpiredOffers(ctx context.Context, days []string, now time.Time) ([]domain.WaitlistOffer, *errors.ReservationError) {
+	ctx, span := rr.tracer.Start(ctx, "ReservationRepo.GetExpiredOffers")
+	defer span.End()
+	offers := []domain.WaitlistOffer{}
+	for _, day := range days {
+		iter := rr.session.Query(`SELECT expires_at, accommodation_id, entry_id FROM waitlist_offers WHERE day = ? AND expires_at <= ?`,
+			day, now).Iter()
+		offer := domain.WaitlistOffer{Day: day}
+		for iter.Scan(&offer.ExpiresAt, &offer.AccommodationID, &offer.EntryID) {
+			offers = append(offers, offer)
+		}
+		if err := iter.Close(); err != nil {
+			rr.logger.LogError("reservationsRepo", err.Error())
+			return nil, errors.NewReservationError(500, "Unable to retrieve waitlist offers, database error")
+		}
+	}
+	return offers, nil
+}
+
+func (rr *ReservationRepo) DeleteWaitlistOffer(ctx context.Context, offer domain.WaitlistOffer) *errors.ReservationError {
+	ctx, span := rr.tracer.Start(ctx, "ReservationRepo.DeleteWaitlistOffer")
+	defer span.End()
+	err := rr.session.Query(`DELETE FROM waitlist_offers WHERE day = ? AND expires_at = ? AND accommodation_id = ? AND entry_id = ?`,
+		offer.Day, offer.ExpiresAt, offer.AccommodationID, offer.EntryID).Consistency(rr.writeConsistency).Exec()
+	if err != nil {
+		rr.logger.LogError("reservationsRepo", err.Error())
+		return errors.NewReservationError(500, "Unable to delete waitlist offer, database error")
+	}
+	return nil
+}
@@ -0,0 +1,372 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"reservation-service/domain"
+	"reservation-service/errors"
+	"sort"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+const dateLayout = "2006-01-02"
+
+// AuthorizeHost makes sure the accommodation belongs to the host, hosts only manage the
+// availability and prices of their own accommodations.
+func (s *ReservationService) AuthorizeHost(ctx context.Context, accommodationID, hostID string) *errors.ReservationError {
+	ctx, span := s.tracer.Start(ctx, "ReservationService.AuthorizeHost")
+	defer span.End()
+	accommodation, err := s.accommodations.GetAccommodation(ctx, accommodationID)
+	if err != nil {
+		s.logger.LogError("reservationsService", err.Message)
+		return err
+	}
+	if accommodation.UserId != hostID {
+		s.logger.LogWarn("reservationsService", fmt.Sprintf("Host %s tried to manage accommodation %s of host %s", hostID, accommodationID, accommodation.UserId))
+		return errors.NewReservationError(403, "Accommodation belongs to another host")
+	}
+	return nil
+}
+
+// UpdateAvailability changes the dates and the price of one availability. The request carries
+// exactly one date range with its price.
+func (s *ReservationService) UpdateAvailability(ctx context.Context, accommodationID, id string, reservation *domain.FreeReservation) (*domain.FreeReservation, *errors.ReservationError) {
+	ctx, span := s.tracer.Start(ctx, "ReservationService.UpdateAvailability")
+	defer span.End()
+	if len(reservation.DateRange) == 0 || len(reservation.DateRange[0].DateRange) == 0 {
+		return nil, errors.NewReservationError(400, "Date range can't be empty")
+	}
+	if len(reservation.DateRange) > 1 {
+		return nil, errors.NewReservationError(400, "An availability is updated with a single date range")
+	}
+	newDates, err := sortedDates(reservation.DateRange[0].DateRange)
+	if err != nil {
+		return nil, err
+	}
+	ranges, err := s.repo.GetAvailabilityRanges(ctx, accommodationID)
+	if err != nil {
+		s.logger.LogError("reservationsService", err.Error())
+		return nil, err
+	}
+	target, others, err := takeRange(ranges, id)
+	if err != nil {
+		return nil, err
+	}
+	if overlapping := intersect(newDates, datesOf(others)); len(overlapping) > 0 {
+		return nil, errors.NewReservationError(400, fmt.Sprintf("Dates %v are already part of another availability", overlapping))
+	}
+	if err := s.checkReservationConflicts(ctx, accommodationID, subtract(target.DateRange, newDates)); err != nil {
+		return nil, err
+	}
+
+	updated := target
+	updated.DateRange = newDates
+	updated.Price = reservation.DateRange[0].Price
+	if err := s.repo.ApplyAvailabilityChanges(ctx, []domain.AvailabilityRange{target}, []domain.AvailabilityRange{updated}); err != nil {
+		s.logger.LogError("reservationsService", err.Error())
+		return nil, err
+	}
+	s.logger.LogInfo("reservationsService", fmt.Sprintf("Updated availability by ID: %v", updated))
+	return &domain.FreeReservation{
+		Id:              updated.Id,
+		AccommodationID: updated.AccommodationID,
+		Location:        updated.Location,
+		Price:           updated.Price,
+		Continent:       updated.Continent,
+		Country:         updated.Country,
+		DateRange:       []domain.DateRangeWithPrice{{DateRange: updated.DateRange, Price: updated.Price}},
+	}, nil
+}
+
+func (s *ReservationService) BlockDates(ctx context.Context, accommodationID string, request domain.BlockDatesRequest) *errors.ReservationError {
+	ctx, span := s.tracer.Start(ctx, "ReservationService.BlockDates")
+	defer span.End()
+	dates, err := sortedDates(request.Dates)
+	if err != nil {
+		return err
+	}
+	if err := s.checkReservationConflicts(ctx, accommodationID, dates); err != nil {
+		return err
+	}
+	if err := s.repo.InsertBlockedDates(ctx, accommodationID, dates, request.Reason); err != nil {
+		s.logger.LogError("reservationsService", err.Error())
+		return err
+	}
+	s.logger.LogInfo("reservationsService", fmt.Sprintf("Blocked dates %v for accommodation %s", dates, accommodationID))
+	return nil
+}
+
+func (s *ReservationService) UnblockDates(ctx context.Context, accommodationID string, request domain.BlockDatesRequest) *errors.ReservationError {
+	ctx, span := s.tracer.Start(ctx, "ReservationService.UnblockDates")
+	defer span.End()
+	dates, err := sortedDates(request.Dates)
+	if err != nil {
+		return err
+	}
+	if err := s.repo.DeleteBlockedDates(ctx, accommodationID, dates); err != nil {
+		s.logger.LogError("reservationsService", err.Error())
+		return err
+	}
+	s.logger.LogInfo("reservationsService", fmt.Sprintf("Unblocked dates %v for accommodation %s", dates, accommodationID))
+	return nil
+}
+
+// SplitAvailability cuts an availability range in two, the second part starting at request.Date.
+func (s *ReservationService) SplitAvailability(ctx context.Context, accommodationID, id string, request domain.SplitAvailabilityRequest) ([]domain.AvailabilityRange, *errors.ReservationError) {
+	ctx, span := s.tracer.Start(ctx, "ReservationService.SplitAvailability")
+	defer span.End()
+	ranges, err := s.repo.GetAvailabilityRanges(ctx, accommodationID)
+	if err != nil {
+		s.logger.LogError("reservationsService", err.Error())
+		return nil, err
+	}
+	target, _, err := takeRange(ranges, id)
+	if err != nil {
+		return nil, err
+	}
+	dates, err := sortedDates(target.DateRange)
+	if err != nil {
+		return nil, err
+	}
+	at := sort.SearchStrings(dates, request.Date)
+	if at == 0 || at == len(dates) || dates[at] != request.Date {
+		return nil, errors.NewReservationError(400, "Split date must be inside the range and after its first date")
+	}
+
+	first := target
+	first.DateRange = dates[:at]
+	second := target
+	second.Id, _ = gocql.RandomUUID()
+	second.DateRange = dates[at:]
+	next := []domain.AvailabilityRange{first, second}
+	if err := s.repo.ApplyAvailabilityChanges(ctx, []domain.AvailabilityRange{target}, next); err != nil {
+		s.logger.LogError("reservationsService", err.Error())
+		return nil, err
+	}
+	s.logger.LogInfo("reservationsService", fmt.Sprintf("Split availability %s into %v", id, next))
+	return next, nil
+}
+
+// MergeAvailability joins adjacent availability ranges into the first of them. The merged range
+// takes request.Price, or the price of the first range when no price is given.
+func (s *ReservationService) MergeAvailability(ctx context.Context, accommodationID string, request domain.MergeAvailabilityRequest) (*domain.AvailabilityRange, *errors.ReservationError) {
+	ctx, span := s.tracer.Start(ctx, "ReservationService.MergeAvailability")
+	defer span.End()
+	if len(request.Ids) < 2 {
+		return nil, errors.NewReservationError(400, "At least two availability ranges are needed for a merge")
+	}
+	ranges, err := s.repo.GetAvailabilityRanges(ctx, accommodationID)
+	if err != nil {
+		s.logger.LogError("reservationsService", err.Error())
+		return nil, err
+	}
+	var merging []domain.AvailabilityRange
+	for _, id := range request.Ids {
+		target, _, err := takeRange(ranges, id)
+		if err != nil {
+			return nil, err
+		}
+		merging = append(merging, target)
+	}
+	dates, err := sortedDates(datesOf(merging))
+	if err != nil {
+		return nil, err
+	}
+	if len(contiguousRuns(dates, func(string) bool { return true })) != 1 {
+		return nil, errors.NewReservationError(400, "Only adjacent availability ranges can be merged")
+	}
+
+	merged := merging[0]
+	merged.DateRange = dates
+	if request.Price > 0 {
+		merged.Price = request.Price
+	}
+	if err := s.repo.ApplyAvailabilityChanges(ctx, merging, []domain.AvailabilityRange{merged}); err != nil {
+		s.logger.LogError("reservationsService", err.Error())
+		return nil, err
+	}
+	s.logger.LogInfo("reservationsService", fmt.Sprintf("Merged availability ranges %v into %v", request.Ids, merged))
+	return &merged, nil
+}
+
+// BulkEditPrices sets the nightly price of the given dates, splitting every range that is only
+// partly covered so the rest of it keeps its old price.
+func (s *ReservationService) BulkEditPrices(ctx context.Context, accommodationID string, request domain.BulkPriceRequest) ([]domain.AvailabilityRange, *errors.ReservationError) {
+	ctx, span := s.tracer.Start(ctx, "ReservationService.BulkEditPrices")
+	defer span.End()
+	if request.Price <= 0 {
+		return nil, errors.NewReservationError(400, "Price must be positive")
+	}
+	dates, err := sortedDates(request.Dates)
+	if err != nil {
+		return nil, err
+	}
+	ranges, err := s.repo.GetAvailabilityRanges(ctx, accommodationID)
+	if err != nil {
+		s.logger.LogError("reservationsService", err.Error())
+		return nil, err
+	}
+	if missing := subtract(dates, datesOf(ranges)); len(missing) > 0 {
+		return nil, errors.NewReservationError(400, fmt.Sprintf("Dates %v are not part of any availability", missing))
+	}
+
+	selected := toSet(dates)
+	var previous, next []domain.AvailabilityRange
+	for _, avl := range ranges {
+		if len(intersect(avl.DateRange, dates)) == 0 {
+			continue
+		}
+		previous = append(previous, avl)
+		rangeDates, err := sortedDates(avl.DateRange)
+		if err != nil {
+			return nil, err
+		}
+		for i, run := range contiguousRuns(rangeDates, func(date string) bool { _, ok := selected[date]; return ok }) {
+			part := avl
+			if i > 0 {
+				part.Id, _ = gocql.RandomUUID()
+			}
+			part.DateRange = run
+			if _, ok := selected[run[0]]; ok {
+				part.Price = request.Price
+			}
+			next = append(next, part)
+		}
+	}
+	if err := s.repo.ApplyAvailabilityChanges(ctx, previous, next); err != nil {
+		s.logger.LogError("reservationsService", err.Error())
+		return nil, err
+	}
+	s.logger.LogInfo("reservationsService", fmt.Sprintf("Set price %d for dates %v of accommodation %s", request.Price, dates, accommodationID))
+	return next, nil
+}
+
+// RollbackAvailability removes the availability of an accommodation whose creation is being
+// compensated, including ranges that were only partly written. It refuses to when the
+// accommodation was already booked.
+func (s *ReservationService) RollbackAvailability(ctx context.Context, accommodationID string) *errors.ReservationError {
+	ctx, span := s.tracer.Start(ctx, "ReservationService.RollbackAvailability")
+	defer span.End()
+	ranges, err := s.repo.GetAvailabilityRanges(ctx, accommodationID)
+	if err != nil {
+		s.logger.LogError("reservationsService", err.Error())
+		return err
+	}
+	if len(ranges) == 0 {
+		return nil
+	}
+	if err := s.checkReservationConflicts(ctx, accommodationID, datesOf(ranges)); err != nil {
+		return err
+	}
+	if err := s.repo.ApplyAvailabilityChanges(ctx, ranges, nil); err != nil {
+		s.logger.LogError("reservationsService", err.Error())
+		return err
+	}
+	s.logger.LogInfo("reservationsService", fmt.Sprintf("Rolled back %d availability ranges of accommodation %s", len(ranges), accommodationID))
+	return nil
+}
+
+func (s *ReservationService) checkReservationConflicts(ctx context.Context, accommodationID string, dates []string) *errors.ReservationError {
+	if len(dates) == 0 {
+		return nil
+	}
+	reservationIDs, err := s.repo.ReservationsOnDates(ctx, accommodationID, dates)
+	if err != nil {
+		s.logger.LogError("reservationsService", err.Error())
+		return err
+	}
+	if len(reservationIDs) > 0 {
+		return errors.NewReservationErrorWithDetails(409, "Dates are already reserved", domain.AvailabilityConflict{
+			Dates:          dates,
+			ReservationIDs: reservationIDs,
+		})
+	}
+	return nil
+}
+
+func takeRange(ranges []domain.AvailabilityRange, id string) (domain.AvailabilityRange, []domain.AvailabilityRange, *errors.ReservationError) {
+	var others []domain.AvailabilityRange
+	var target *domain.AvailabilityRange
+	for i := range ranges {
+		if ranges[i].Id.String() == id {
+			target = &ranges[i]
+			continue
+		}
+		others = append(others, ranges[i])
+	}
+	if target == nil {
+		return domain.AvailabilityRange{}, nil, errors.NewReservationError(404, "Availability not found")
+	}
+	return *target, others, nil
+}
+
+func sortedDates(dates []string) ([]string, *errors.ReservationError) {
+	if len(dates) == 0 {
+		return nil, errors.NewReservationError(400, "Dates can't be empty")
+	}
+	unique := toSet(dates)
+	result := make([]string, 0, len(unique))
+	for date := range unique {
+		if _, err := time.Parse(dateLayout, date); err != nil {
+			return nil, errors.NewReservationError(400, fmt.Sprintf("Invalid date %s, expected YYYY-MM-DD", date))
+		}
+		result = append(result, date)
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+// contiguousRuns cuts sorted dates into runs of consecutive days for which member returns the same value.
+func contiguousRuns(dates []string, member func(date string) bool) [][]string {
+	var runs [][]string
+	var previous time.Time
+	for i, date := range dates {
+		current, _ := time.Parse(dateLayout, date)
+		if i == 0 || !current.Equal(previous.AddDate(0, 0, 1)) || member(date) != member(dates[i-1]) {
+			runs = append(runs, []string{})
+		}
+		runs[len(runs)-1] = append(runs[len(runs)-1], date)
+		previous = current
+	}
+	return runs
+}
+
+func datesOf(ranges []domain.AvailabilityRange) []string {
+	var dates []string
+	for _, avl := range ranges {
+		dates = append(dates, avl.DateRange...)
+	}
+	return dates
+}
+
+func toSet(dates []string) map[string]struct{} {
+	set := make(map[string]struct{}, len(dates))
+	for _, date := range dates {
+		set[date] = struct{}{}
+	}
+	return set
+}
+
+func intersect(a, b []string) []string {
+	set := toSet(b)
+	var result []string
+	for _, date := range a {
+		if _, ok := set[date]; ok {
+			result = append(result, date)
+		}
+	}
+	return result
+}
+
+func subtract(a, b []string) []string {
+	set := toSet(b)
+	var result []string
+	for _, date := range a {
+		if _, ok := set[date]; !ok {
+			result = append(result, date)
+		}
+	}
+	return result
+}
@@ -0,0 +1,185 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"reservation-service/client"
+	"reservation-service/config"
+	"reservation-service/domain"
+	"reservation-service/errors"
+	"reservation-service/repository"
+	"reservation-service/utils"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	importedBlockReason = "Imported from external calendar"
+	// calendarSyncDays is how far ahead external calendars are imported, earlier and later
+	// nights of their events are ignored.
+	calendarSyncDays = 730
+)
+
+// calendarStore keeps the reserved and blocked nights and the calendar feeds of accommodations.
+// ReservationRepo is the store of the service, tests keep them in memory.
+type calendarStore interface {
+	GetReservedDates(ctx context.Context, accommodationID string) ([]string, *errors.ReservationError)
+	GetBlockedDates(ctx context.Context, accommodationID, from, to string) ([]domain.BlockedDate, *errors.ReservationError)
+	InsertBlockedDates(ctx context.Context, accommodationID string, dates []string, reason string) *errors.ReservationError
+	DeleteBlockedDates(ctx context.Context, accommodationID string, dates []string) *errors.ReservationError
+	SaveCalendarFeed(ctx context.Context, feed domain.CalendarFeed) *errors.ReservationError
+	GetCalendarFeeds(ctx context.Context) ([]domain.CalendarFeed, *errors.ReservationError)
+}
+
+type CalendarSyncService struct {
+	repo           calendarStore
+	calendarClient *client.CalendarClient
+	logger         *config.Logger
+	tracer         trace.Tracer
+}
+
+func NewCalendarSyncService(repo *repository.ReservationRepo, calendarClient *client.CalendarClient, logger *config.Logger, tracer trace.Tracer) *CalendarSyncService {
+	return &CalendarSyncService{repo: repo, calendarClient: calendarClient, logger: logger, tracer: tracer}
+}
+
+// ExportCalendar writes the reserved and blocked nights of an accommodation as an iCalendar feed.
+func (cs *CalendarSyncService) ExportCalendar(ctx context.Context, accommodationID string, w io.Writer) *errors.ReservationError {
+	ctx, span := cs.tracer.Start(ctx, "CalendarSyncService.ExportCalendar")
+	defer span.End()
+	reservedDates, err := cs.repo.GetReservedDates(ctx, accommodationID)
+	if err != nil {
+		cs.logger.LogError("calendarSyncService", err.Error())
+		return err
+	}
+	blockedDates, err := cs.repo.GetBlockedDates(ctx, accommodationID, "0000-01-01", "9999-12-31")
+	if err != nil {
+		cs.logger.LogError("calendarSyncService", err.Error())
+		return err
+	}
+	var blocked []string
+	for _, block := range blockedDates {
+		blocked = append(blocked, block.Date)
+	}
+
+	events := []utils.CalendarEvent{
+		{UID: accommodationID + "-reserved", Summary: "Reserved", Dates: reservedDates},
+		{UID: accommodationID + "-blocked", Summary: "Not available", Dates: blocked},
+	}
+	if err := utils.WriteICS(w, "Accommodation "+accommodationID, events); err != nil {
+		cs.logger.LogError("calendarSyncService", err.Error())
+		return errors.NewReservationError(500, "Unable to write calendar")
+	}
+	return nil
+}
+
+// ImportCalendar turns the events of an external calendar into blocked dates. Dates blocked by an
+// earlier import that are gone from the calendar are unblocked again, and dates that are already
+// reserved here are reported as conflicts instead of being blocked. Only the nights from today
+// until calendarSyncDays later are imported and unblocked.
+func (cs *CalendarSyncService) ImportCalendar(ctx context.Context, accommodationID string, body io.Reader) (*domain.CalendarImportResult, *errors.ReservationError) {
+	ctx, span := cs.tracer.Start(ctx, "CalendarSyncService.ImportCalendar")
+	defer span.End()
+	from := time.Now().UTC().Truncate(24 * time.Hour)
+	to := from.AddDate(0, 0, calendarSyncDays)
+	events, parseErr := utils.ParseICS(body, from, to)
+	if parseErr != nil {
+		return nil, errors.NewReservationError(400, "Invalid calendar: "+parseErr.Error())
+	}
+	imported := make(map[string]struct{})
+	for _, event := range events {
+		for _, date := range event.Dates {
+			imported[date] = struct{}{}
+		}
+	}
+
+	reservedDates, err := cs.repo.GetReservedDates(ctx, accommodationID)
+	if err != nil {
+		cs.logger.LogError("calendarSyncService", err.Error())
+		return nil, err
+	}
+	reserved := toSet(reservedDates)
+	existingBlocks, err := cs.repo.GetBlockedDates(ctx, accommodationID, from.Format(dateLayout), to.AddDate(0, 0, -1).Format(dateLayout))
+	if err != nil {
+		cs.logger.LogError("calendarSyncService", err.Error())
+		return nil, err
+	}
+
+	result := &domain.CalendarImportResult{}
+	blocked := make(map[string]struct{}, len(existingBlocks))
+	for _, block := range existingBlocks {
+		blocked[block.Date] = struct{}{}
+		if _, stillImported := imported[block.Date]; !stillImported && block.Reason == importedBlockReason {
+			result.UnblockedDates = append(result.UnblockedDates, block.Date)
+		}
+	}
+	for date := range imported {
+		if _, ok := reserved[date]; ok {
+			result.ConflictedDates = append(result.ConflictedDates, date)
+			continue
+		}
+		if _, ok := blocked[date]; !ok {
+			result.BlockedDates = append(result.BlockedDates, date)
+		}
+	}
+
+	if len(result.UnblockedDates) > 0 {
+		if err := cs.repo.DeleteBlockedDates(ctx, accommodationID, result.UnblockedDates); err != nil {
+			cs.logger.LogError("calendarSyncService", err.Error())
+			return nil, err
+		}
+	}
+	if len(result.BlockedDates) > 0 {
+		if err := cs.repo.InsertBlockedDates(ctx, accommodationID, result.BlockedDates, importedBlockReason); err != nil {
+			cs.logger.LogError("calendarSyncService", err.Error())
+			return nil, err
+		}
+	}
+	if len(result.ConflictedDates) > 0 {
+		cs.logger.LogWarn("calendarSyncService", fmt.Sprintf("External calendar of accommodation %s overlaps reservations on %v", accommodationID, result.ConflictedDates))
+	}
+	cs.logger.LogInfo("calendarSyncService", fmt.Sprintf("Imported calendar for accommodation %s: %v", accommodationID, result))
+	return result, nil
+}
+
+func (cs *CalendarSyncService) RegisterFeed(ctx context.Context, accommodationID string, feed domain.CalendarFeed) (*domain.CalendarFeed, *errors.ReservationError) {
+	ctx, span := cs.tracer.Start(ctx, "CalendarSyncService.RegisterFeed")
+	defer span.End()
+	if err := cs.calendarClient.CheckURL(ctx, feed.URL); err != nil {
+		cs.logger.LogWarn("calendarSyncService", fmt.Sprintf("Refused calendar feed of accommodation %s: %v", accommodationID, err))
+		return nil, errors.NewReservationError(400, "Calendar feed URL must be an https URL of a public host")
+	}
+	feed.AccommodationID = accommodationID
+	feed.LastSynced = ""
+	if err := cs.repo.SaveCalendarFeed(ctx, feed); err != nil {
+		return nil, err
+	}
+	return &feed, nil
+}
+
+// SyncFeeds imports every registered external calendar once. A feed that can't be fetched or
+// imported keeps its last sync time and doesn't hold up the others.
+func (cs *CalendarSyncService) SyncFeeds(ctx context.Context) {
+	ctx, span := cs.tracer.Start(ctx, "CalendarSyncService.SyncFeeds")
+	defer span.End()
+	feeds, err := cs.repo.GetCalendarFeeds(ctx)
+	if err != nil {
+		cs.logger.LogError("calendarSyncService", err.Error())
+		return
+	}
+	for _, feed := range feeds {
+		body, fetchErr := cs.calendarClient.FetchCalendar(ctx, feed.URL)
+		if fetchErr != nil {
+			cs.logger.LogError("calendarSyncService", fmt.Sprintf("Unable to fetch calendar of accommodation %s: %v", feed.AccommodationID, fetchErr))
+			continue
+		}
+		if _, err := cs.ImportCalendar(ctx, feed.AccommodationID, bytes.NewReader(body)); err != nil {
+			cs.logger.LogError("calendarSyncService", fmt.Sprintf("Unable to import calendar of accommodation %s: %v", feed.AccommodationID, err.Message))
+			continue
+		}
+		feed.LastSynced = time.Now().UTC().Format(time.RFC3339)
+		_ = cs.repo.SaveCalendarFeed(ctx, feed)
+	}
+}
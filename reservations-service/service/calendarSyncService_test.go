@@ -0,0 +1,84 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reservation-service/client"
+	"reservation-service/domain"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestCalendarSyncService(t *testing.T, allowLocalFeeds bool) (*CalendarSyncService, *memoryStore) {
+	t.Helper()
+	store := newMemoryStore()
+	calendarClient := client.NewCalendarClient(5*time.Second, allowLocalFeeds)
+	return &CalendarSyncService{repo: store, calendarClient: calendarClient, logger: newTestLogger(t), tracer: newTestTracer()}, store
+}
+
+// icsDate is the iCalendar date days from today.
+func icsDate(days int) string {
+	return time.Now().UTC().AddDate(0, 0, days).Format("20060102")
+}
+
+func serveTestCalendar(t *testing.T, body string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/calendar.ics" {
+			rw.WriteHeader(http.StatusNotFound)
+			return
+		}
+		rw.Header().Set("Content-Type", "text/calendar")
+		_, _ = rw.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestSyncFeedsImportsRegisteredFeeds(t *testing.T) {
+	cs, store := newTestCalendarSyncService(t, true)
+	ctx := context.Background()
+	srv := serveTestCalendar(t, "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nUID:stay\r\nDTSTART;VALUE=DATE:"+icsDate(3)+
+		"\r\nDTEND;VALUE=DATE:"+icsDate(6)+"\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n")
+
+	store.reserved["accommodation-1"] = []string{testDate(5)}
+	_ = store.InsertBlockedDates(ctx, "accommodation-1", []string{testDate(20)}, importedBlockReason)
+	_ = store.InsertBlockedDates(ctx, "accommodation-1", []string{testDate(21)}, "Maintenance")
+	for accommodationID, url := range map[string]string{"accommodation-1": srv.URL + "/calendar.ics", "accommodation-2": srv.URL + "/missing.ics"} {
+		if _, err := cs.RegisterFeed(ctx, accommodationID, domain.CalendarFeed{URL: url}); err != nil {
+			t.Fatalf("registering feed of %s: %s", accommodationID, err.Message)
+		}
+	}
+
+	cs.SyncFeeds(ctx)
+
+	// The nights of the event are blocked except the reserved one, the night an earlier import
+	// blocked is unblocked and the host's own block stays.
+	blocks, _ := store.GetBlockedDates(ctx, "accommodation-1", "0000-01-01", "9999-12-31")
+	var blocked []string
+	for _, block := range blocks {
+		blocked = append(blocked, block.Date)
+	}
+	if want := []string{testDate(3), testDate(4), testDate(21)}; strings.Join(blocked, ",") != strings.Join(want, ",") {
+		t.Fatalf("blocked dates are %v, want %v", blocked, want)
+	}
+	if feed := store.feeds["accommodation-1"]; feed.LastSynced == "" {
+		t.Fatalf("feed of accommodation-1 wasn't marked synced")
+	}
+	if feed := store.feeds["accommodation-2"]; feed.LastSynced != "" {
+		t.Fatalf("missing feed of accommodation-2 was marked synced at %s", feed.LastSynced)
+	}
+}
+
+func TestRegisterFeedRefusesLocalFeedUnlessAllowed(t *testing.T) {
+	cs, store := newTestCalendarSyncService(t, false)
+	srv := serveTestCalendar(t, "BEGIN:VCALENDAR\r\nEND:VCALENDAR\r\n")
+	if _, err := cs.RegisterFeed(context.Background(), "accommodation-1", domain.CalendarFeed{URL: srv.URL + "/calendar.ics"}); err == nil || err.Status != 400 {
+		t.Fatalf("registering a local feed got %v, want 400", err)
+	}
+	if len(store.feeds) != 0 {
+		t.Fatalf("refused feed was stored")
+	}
+}
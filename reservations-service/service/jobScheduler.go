@@ -0,0 +1,218 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reservation-service/config"
+	"reservation-service/domain"
+	"reservation-service/errors"
+	"reservation-service/repository"
+	"time"
+
+	"github.com/gocql/gocql"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	jobLease        = "job-scheduler"
+	jobMaxAttempts  = 5
+	jobClaimTimeout = 10 * time.Minute
+)
+
+// JobHandler runs a job. A job whose handler fails is retried on the next run, until it failed
+// jobMaxAttempts times.
+type JobHandler func(ctx context.Context, job domain.Job) error
+
+// JobScheduler runs jobs stored in Cassandra, so they survive restarts. Only the replica that
+// holds the scheduler lease runs jobs, and every job is claimed with a lightweight transaction
+// before it runs, so a job doesn't fire twice even while the lease changes hands.
+type JobScheduler struct {
+	repo     *repository.ReservationRepo
+	owner    string
+	handlers map[string]JobHandler
+	tasks    []*recurringTask
+	lookback time.Duration
+	logger   *config.Logger
+	tracer   trace.Tracer
+}
+
+// recurringTask is work the lease holder does every interval, such as sweeping a table for
+// rows that are due.
+type recurringTask struct {
+	name     string
+	interval time.Duration
+	run      func(ctx context.Context)
+	lastRun  time.Time
+}
+
+// NewJobScheduler creates a scheduler that picks up jobs due within lookback, jobs missed for
+// longer than that while no replica was running are not run anymore.
+func NewJobScheduler(repo *repository.ReservationRepo, lookback time.Duration, logger *config.Logger, tracer trace.Tracer) *JobScheduler {
+	hostname, _ := os.Hostname()
+	instance, _ := gocql.RandomUUID()
+	return &JobScheduler{
+		repo:     repo,
+		owner:    fmt.Sprintf("%s-%s", hostname, instance),
+		handlers: make(map[string]JobHandler),
+		lookback: lookback,
+		logger:   logger,
+		tracer:   tracer,
+	}
+}
+
+// Register sets the handler of a kind of job. Handlers are registered before the scheduler
+// is started.
+func (js *JobScheduler) Register(kind string, handler JobHandler) {
+	js.handlers[kind] = handler
+}
+
+// Every runs task every interval on the replica that holds the scheduler lease. A replica that
+// takes over the lease runs its tasks right away. Tasks are registered before the scheduler is
+// started, and run no more often than the scheduler ticks.
+func (js *JobScheduler) Every(name string, interval time.Duration, task func(ctx context.Context)) {
+	js.tasks = append(js.tasks, &recurringTask{name: name, interval: interval, run: task})
+}
+
+// Schedule stores a job that runs at runAt with the payload encoded as JSON.
+func (js *JobScheduler) Schedule(ctx context.Context, kind string, runAt time.Time, payload interface{}) *errors.ReservationError {
+	ctx, span := js.tracer.Start(ctx, "JobScheduler.Schedule")
+	defer span.End()
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		return errors.NewReservationError(500, "Unable to encode job payload")
+	}
+	runAt = runAt.UTC().Truncate(time.Millisecond)
+	job := &domain.Job{
+		Bucket:  repository.JobBucket(runAt),
+		RunAt:   runAt,
+		Id:      gocql.TimeUUID(),
+		Kind:    kind,
+		Payload: string(encoded),
+		Status:  domain.JobPending,
+	}
+	if err := js.repo.InsertJob(ctx, job); err != nil {
+		return err
+	}
+	js.logger.LogInfo("jobScheduler", fmt.Sprintf("Scheduled %s job %s for %s", kind, job.Id, runAt.Format(time.RFC3339)))
+	return nil
+}
+
+// RunDue runs the jobs that are due. Jobs claimed by a replica that didn't finish them within
+// jobClaimTimeout are taken over.
+func (js *JobScheduler) RunDue(ctx context.Context) {
+	ctx, span := js.tracer.Start(ctx, "JobScheduler.RunDue")
+	defer span.End()
+	now := time.Now().UTC()
+	for hour := now.Add(-js.lookback).Truncate(time.Hour); !hour.After(now); hour = hour.Add(time.Hour) {
+		jobs, err := js.repo.GetJobs(ctx, repository.JobBucket(hour), now)
+		if err != nil {
+			js.logger.LogError("jobScheduler", err.Message)
+			return
+		}
+		for i := range jobs {
+			job := &jobs[i]
+			if job.Status == domain.JobRunning && now.Sub(job.ClaimedAt) > jobClaimTimeout {
+				released, err := js.repo.ReleaseJob(ctx, job)
+				if err != nil {
+					js.logger.LogError("jobScheduler", err.Message)
+					continue
+				}
+				if released {
+					js.logger.LogWarn("jobScheduler", fmt.Sprintf("Took over %s job %s abandoned by %s", job.Kind, job.Id, job.Owner))
+					job.Status = domain.JobPending
+				}
+			}
+			if job.Status == domain.JobPending {
+				js.run(ctx, job)
+			}
+		}
+	}
+}
+
+func (js *JobScheduler) run(ctx context.Context, job *domain.Job) {
+	claimed, err := js.repo.ClaimJob(ctx, job, js.owner, time.Now().UTC().Truncate(time.Millisecond))
+	if err != nil {
+		js.logger.LogError("jobScheduler", err.Message)
+		return
+	}
+	if !claimed {
+		return
+	}
+	job.Attempts++
+	job.LastError = ""
+	handler, ok := js.handlers[job.Kind]
+	var runErr error
+	if !ok {
+		runErr = fmt.Errorf("no handler for jobs of kind %s", job.Kind)
+		job.Attempts = jobMaxAttempts
+	} else {
+		runErr = handler(ctx, *job)
+	}
+	switch {
+	case runErr == nil:
+		job.Status = domain.JobDone
+	case job.Attempts >= jobMaxAttempts:
+		job.Status = domain.JobFailed
+		job.LastError = runErr.Error()
+		js.logger.LogError("jobScheduler", fmt.Sprintf("%s job %s failed for good: %v", job.Kind, job.Id, runErr))
+	default:
+		job.Status = domain.JobPending
+		job.LastError = runErr.Error()
+		js.logger.LogWarn("jobScheduler", fmt.Sprintf("%s job %s failed, attempt %d: %v", job.Kind, job.Id, job.Attempts, runErr))
+	}
+	finished, err := js.repo.FinishJob(ctx, job)
+	if err != nil {
+		js.logger.LogError("jobScheduler", err.Message)
+		return
+	}
+	if !finished {
+		// The claim was taken over while the handler ran, the outcome is left to the new owner.
+		js.logger.LogWarn("jobScheduler", fmt.Sprintf("Lost the claim on %s job %s, its outcome was not stored", job.Kind, job.Id))
+	}
+}
+
+// runTasks runs the recurring tasks whose interval has passed since they last ran.
+func (js *JobScheduler) runTasks(ctx context.Context) {
+	for _, task := range js.tasks {
+		now := time.Now()
+		if now.Sub(task.lastRun) < task.interval {
+			continue
+		}
+		task.lastRun = now
+		js.logger.LogInfo("jobScheduler", fmt.Sprintf("Running %s", task.name))
+		task.run(ctx)
+	}
+}
+
+// Start runs due jobs and recurring tasks every interval until ctx is done, on the replica that
+// holds the lease. The lease outlives a few intervals, so it only changes hands when its holder
+// stops.
+func (js *JobScheduler) Start(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				leader, err := js.repo.AcquireLease(ctx, jobLease, js.owner, 3*interval)
+				if err != nil {
+					js.logger.LogError("jobScheduler", err.Message)
+					continue
+				}
+				if !leader {
+					// Tasks run right away once this replica takes the lease again.
+					for _, task := range js.tasks {
+						task.lastRun = time.Time{}
+					}
+					continue
+				}
+				js.RunDue(ctx)
+				js.runTasks(ctx)
+			}
+		}
+	}()
+}
@@ -0,0 +1,296 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"reservation-service/config"
+	"reservation-service/domain"
+	"reservation-service/errors"
+	"reservation-service/repository"
+	"strconv"
+	"time"
+
+	"github.com/gocql/gocql"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// payoutAttempts is how many times a payout is tried while other payouts of the host keep
+// getting in first.
+const payoutAttempts = 3
+
+type posting struct {
+	account string
+	amount  int
+}
+
+// transaction is a set of postings booked together, which sum up to zero.
+type transaction struct {
+	kind        string
+	description string
+	postings    []posting
+}
+
+// ledgerStore keeps the ledger entries, ReservationRepo is the store of the service.
+type ledgerStore interface {
+	InsertLedgerTransactions(ctx context.Context, entries []domain.LedgerEntry) *errors.ReservationError
+	InsertLedgerPayout(ctx context.Context, entries []domain.LedgerEntry, version int) (bool, int, *errors.ReservationError)
+	GetLedgerVersion(ctx context.Context, hostID string) (int, *errors.ReservationError)
+	GetLedgerEntries(ctx context.Context, hostID string, from, to time.Time) ([]domain.LedgerEntry, *errors.ReservationError)
+}
+
+// LedgerService keeps the double-entry ledger of guest charges, platform fees, refunds, payouts
+// and adjustments. Host balances and statements are always computed from the entries.
+type LedgerService struct {
+	repo       ledgerStore
+	feePercent int
+	logger     *config.Logger
+	tracer     trace.Tracer
+}
+
+func NewLedgerService(repo *repository.ReservationRepo, feePercent int, logger *config.Logger, tracer trace.Tracer) *LedgerService {
+	return &LedgerService{repo: repo, feePercent: feePercent, logger: logger, tracer: tracer}
+}
+
+func (ls *LedgerService) fee(amount int) int {
+	return amount * ls.feePercent / 100
+}
+
+// entries turns transactions of a host into ledger entries. Entries of a booking of a payment at
+// a given time get ids derived from the payment, the booking and that time, so booking them again
+// stores the same rows instead of new ones. Without a time every entry gets a new id.
+func (ls *LedgerService) entries(p *domain.Payment, hostID, currency string, at time.Time, booking string, transactions ...transaction) []domain.LedgerEntry {
+	var reservationID gocql.UUID
+	if p != nil {
+		reservationID = p.ReservationID
+	}
+	newID := func(key string) gocql.UUID {
+		if at.IsZero() {
+			return gocql.TimeUUID()
+		}
+		return ledgerID(at, fmt.Sprintf("%s/%s/%s", reservationID, booking, key))
+	}
+	var entries []domain.LedgerEntry
+	for i, t := range transactions {
+		transactionID := newID(strconv.Itoa(i))
+		for j, post := range t.postings {
+			entries = append(entries, domain.LedgerEntry{
+				EntryID:       newID(fmt.Sprintf("%d/%d", i, j)),
+				TransactionID: transactionID,
+				HostID:        hostID,
+				ReservationID: reservationID,
+				Account:       post.account,
+				Amount:        post.amount,
+				Currency:      currency,
+				Type:          t.kind,
+				Description:   t.description,
+			})
+		}
+	}
+	return entries
+}
+
+// ledgerID makes a time UUID of the given time whose clock sequence and node come from key,
+// instead of being random.
+func ledgerID(at time.Time, key string) gocql.UUID {
+	id := gocql.UUIDFromTime(at)
+	sum := sha256.Sum256([]byte(key))
+	copy(id[8:], sum[:8])
+	id[8] = id[8]&0x3f | 0x80
+	return id
+}
+
+// RecordCharge books a captured guest payment to the host and takes the platform fee from it,
+// in one batch. The entries are keyed by the payment and the time it was captured at, so a
+// charge booked again after its outcome was lost is not booked twice.
+func (ls *LedgerService) RecordCharge(ctx context.Context, p *domain.Payment) *errors.ReservationError {
+	ctx, span := ls.tracer.Start(ctx, "LedgerService.RecordCharge")
+	defer span.End()
+	transactions := []transaction{{domain.LedgerCharge, "Guest payment captured", []posting{
+		{domain.AccountPlatformCash, p.CapturedAmount},
+		{domain.AccountHostPayable, -p.CapturedAmount},
+	}}}
+	if fee := ls.fee(p.CapturedAmount); fee > 0 {
+		transactions = append(transactions, transaction{domain.LedgerFee, fmt.Sprintf("Platform fee %d%%", ls.feePercent), []posting{
+			{domain.AccountHostPayable, fee},
+			{domain.AccountPlatformRevenue, -fee},
+		}})
+	}
+	return ls.repo.InsertLedgerTransactions(ctx, ls.entries(p, p.HostID, p.Currency, p.UpdatedAt, "charge", transactions...))
+}
+
+// RecordRefund takes a refunded amount back from the host and returns the fee charged on it.
+// Like a charge, the entries are keyed by the payment and the time it was refunded at.
+func (ls *LedgerService) RecordRefund(ctx context.Context, p *domain.Payment, amount int) *errors.ReservationError {
+	ctx, span := ls.tracer.Start(ctx, "LedgerService.RecordRefund")
+	defer span.End()
+	transactions := []transaction{{domain.LedgerRefund, "Guest payment refunded", []posting{
+		{domain.AccountHostPayable, amount},
+		{domain.AccountPlatformCash, -amount},
+	}}}
+	if fee := ls.fee(amount); fee > 0 {
+		transactions = append(transactions, transaction{domain.LedgerFee, "Platform fee returned", []posting{
+			{domain.AccountPlatformRevenue, fee},
+			{domain.AccountHostPayable, -fee},
+		}})
+	}
+	return ls.repo.InsertLedgerTransactions(ctx, ls.entries(p, p.HostID, p.Currency, p.UpdatedAt, "refund", transactions...))
+}
+
+// RecordAdjustment corrects the host's earnings from a payment by amount, e.g. when the provider
+// reports a different captured total. A positive amount is owed to the host. Like a charge, the
+// entries are keyed by the payment and the time the difference was found at.
+func (ls *LedgerService) RecordAdjustment(ctx context.Context, p *domain.Payment, amount int, description string) *errors.ReservationError {
+	ctx, span := ls.tracer.Start(ctx, "LedgerService.RecordAdjustment")
+	defer span.End()
+	if amount == 0 {
+		return nil
+	}
+	return ls.repo.InsertLedgerTransactions(ctx, ls.entries(p, p.HostID, p.Currency, p.UpdatedAt, "adjustment", transaction{domain.LedgerAdjustment, description, []posting{
+		{domain.AccountPlatformCash, amount},
+		{domain.AccountHostPayable, -amount},
+	}}))
+}
+
+// RecordPayout pays out the whole balance of a host. The payout is only stored if no other
+// payout of the host got in since the balance was read, otherwise the balance is read again.
+func (ls *LedgerService) RecordPayout(ctx context.Context, hostID string) (*domain.HostBalance, *errors.ReservationError) {
+	ctx, span := ls.tracer.Start(ctx, "LedgerService.RecordPayout")
+	defer span.End()
+	version, err := ls.repo.GetLedgerVersion(ctx, hostID)
+	if err != nil {
+		return nil, err
+	}
+	for attempt := 1; attempt <= payoutAttempts; attempt++ {
+		balance, err := ls.GetBalance(ctx, hostID)
+		if err != nil {
+			return nil, err
+		}
+		if balance.Balance <= 0 {
+			return nil, errors.NewReservationError(400, "There is nothing to pay out")
+		}
+		entries := ls.entries(nil, hostID, balance.Currency, time.Time{}, "payout", transaction{domain.LedgerPayout, "Payout to host", []posting{
+			{domain.AccountHostPayable, balance.Balance},
+			{domain.AccountPlatformCash, -balance.Balance},
+		}})
+		applied, current, err := ls.repo.InsertLedgerPayout(ctx, entries, version)
+		if err != nil {
+			return nil, err
+		}
+		if applied {
+			ls.logger.LogInfo("ledgerService", fmt.Sprintf("Paid out %d %s to host %s", balance.Balance, balance.Currency, hostID))
+			return ls.GetBalance(ctx, hostID)
+		}
+		ls.logger.LogWarn("ledgerService", fmt.Sprintf("Another payout to host %s got in first, attempt %d", hostID, attempt))
+		version = current
+	}
+	return nil, errors.NewReservationError(409, "The balance changed during the payout, try again")
+}
+
+// GetBalance sums up the host payable entries of a host.
+func (ls *LedgerService) GetBalance(ctx context.Context, hostID string) (*domain.HostBalance, *errors.ReservationError) {
+	ctx, span := ls.tracer.Start(ctx, "LedgerService.GetBalance")
+	defer span.End()
+	entries, err := ls.repo.GetLedgerEntries(ctx, hostID, time.Time{}, time.Time{})
+	if err != nil {
+		return nil, err
+	}
+	balance := &domain.HostBalance{HostID: hostID}
+	for _, entry := range entries {
+		if entry.Account != domain.AccountHostPayable {
+			continue
+		}
+		// The host payable account is a liability, credits increase what the host is owed.
+		amount := -entry.Amount
+		balance.Currency = entry.Currency
+		balance.Balance += amount
+		switch entry.Type {
+		case domain.LedgerCharge:
+			balance.Charges += amount
+		case domain.LedgerFee:
+			balance.Fees += amount
+		case domain.LedgerRefund:
+			balance.Refunds += amount
+		case domain.LedgerPayout:
+			balance.Payouts += amount
+		case domain.LedgerAdjustment:
+			balance.Adjusted += amount
+		}
+	}
+	return balance, nil
+}
+
+// GetStatement lists the changes of a host's balance between from and to, both inclusive and in
+// YYYY-MM-DD format.
+func (ls *LedgerService) GetStatement(ctx context.Context, hostID, from, to string) (*domain.HostStatement, *errors.ReservationError) {
+	ctx, span := ls.tracer.Start(ctx, "LedgerService.GetStatement")
+	defer span.End()
+	fromTime, parseErr := time.Parse(dateLayout, from)
+	if parseErr != nil {
+		return nil, errors.NewReservationError(400, "from must be a date in YYYY-MM-DD format")
+	}
+	toTime, parseErr := time.Parse(dateLayout, to)
+	if parseErr != nil {
+		return nil, errors.NewReservationError(400, "to must be a date in YYYY-MM-DD format")
+	}
+	if toTime.Before(fromTime) {
+		return nil, errors.NewReservationError(400, "to can't be before from")
+	}
+	entries, err := ls.repo.GetLedgerEntries(ctx, hostID, time.Time{}, toTime.AddDate(0, 0, 1).Add(-time.Nanosecond))
+	if err != nil {
+		return nil, err
+	}
+	statement := &domain.HostStatement{HostID: hostID, From: from, To: to, Lines: []domain.StatementLine{}}
+	for _, entry := range entries {
+		if entry.Account != domain.AccountHostPayable {
+			continue
+		}
+		amount := -entry.Amount
+		statement.Currency = entry.Currency
+		if entry.CreatedAt.Before(fromTime) {
+			statement.OpeningBalance += amount
+			statement.ClosingBalance += amount
+			continue
+		}
+		statement.ClosingBalance += amount
+		statement.Lines = append(statement.Lines, domain.StatementLine{
+			CreatedAt:     entry.CreatedAt,
+			TransactionID: entry.TransactionID,
+			ReservationID: entry.ReservationID,
+			Type:          entry.Type,
+			Description:   entry.Description,
+			Amount:        amount,
+			Balance:       statement.ClosingBalance,
+		})
+	}
+	return statement, nil
+}
+
+// WriteStatementCSV writes the statement of a host as CSV, one row per balance change.
+func (ls *LedgerService) WriteStatementCSV(ctx context.Context, hostID, from, to string, w io.Writer) *errors.ReservationError {
+	ctx, span := ls.tracer.Start(ctx, "LedgerService.WriteStatementCSV")
+	defer span.End()
+	statement, err := ls.GetStatement(ctx, hostID, from, to)
+	if err != nil {
+		return err
+	}
+	writer := csv.NewWriter(w)
+	rows := [][]string{{"date", "transaction_id", "reservation_id", "type", "description", "amount", "balance", "currency"}}
+	rows = append(rows, []string{from, "", "", "opening_balance", "Opening balance", "", strconv.Itoa(statement.OpeningBalance), statement.Currency})
+	for _, line := range statement.Lines {
+		reservationID := ""
+		if line.ReservationID != (gocql.UUID{}) {
+			reservationID = line.ReservationID.String()
+		}
+		rows = append(rows, []string{line.CreatedAt.UTC().Format(time.RFC3339), line.TransactionID.String(), reservationID,
+			line.Type, line.Description, strconv.Itoa(line.Amount), strconv.Itoa(line.Balance), statement.Currency})
+	}
+	rows = append(rows, []string{to, "", "", "closing_balance", "Closing balance", "", strconv.Itoa(statement.ClosingBalance), statement.Currency})
+	if writeErr := writer.WriteAll(rows); writeErr != nil {
+		ls.logger.LogError("ledgerService", writeErr.Error())
+		return errors.NewReservationError(500, "Unable to write statement")
+	}
+	return nil
+}
@@ -0,0 +1,515 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	errs "errors"
+	"fmt"
+	"reservation-service/config"
+	"reservation-service/domain"
+	"reservation-service/errors"
+	"reservation-service/payment"
+	"reservation-service/repository"
+	"time"
+
+	"github.com/gocql/gocql"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// refundRetryDelay is how long a refund that failed when its reservation was canceled waits
+// before it is tried again.
+const refundRetryDelay = 5 * time.Minute
+
+// paymentStore keeps payments and the webhook events applied to them. ReservationRepo is the
+// store of the service, tests keep payments in memory.
+type paymentStore interface {
+	SavePayment(ctx context.Context, payment *domain.Payment) *errors.ReservationError
+	UpdatePayment(ctx context.Context, payment *domain.Payment, from string) (bool, *errors.ReservationError)
+	GetPayment(ctx context.Context, reservationID gocql.UUID) (*domain.Payment, *errors.ReservationError)
+	GetPaymentByAuthorization(ctx context.Context, authorizationID string) (*domain.Payment, *errors.ReservationError)
+	ChangePayment(ctx context.Context, payment *domain.Payment, previous *domain.Payment) (bool, *errors.ReservationError)
+	GetDueCaptures(ctx context.Context, months []string, today string) ([]gocql.UUID, *errors.ReservationError)
+	ClaimWebhookEvent(ctx context.Context, eventID string) (bool, *errors.ReservationError)
+	ReleaseWebhookEvent(ctx context.Context, eventID string) *errors.ReservationError
+}
+
+// jobQueue schedules jobs, JobScheduler is the queue of the service.
+type jobQueue interface {
+	Schedule(ctx context.Context, kind string, runAt time.Time, payload interface{}) *errors.ReservationError
+}
+
+type PaymentService struct {
+	repo     paymentStore
+	provider payment.Provider
+	currency string
+	ledger   *LedgerService
+	jobs     jobQueue
+	// confirmationGrace is how long a reservation is kept after its payment failed, before it
+	// expires as unconfirmed.
+	confirmationGrace time.Duration
+	logger            *config.Logger
+	tracer            trace.Tracer
+}
+
+func NewPaymentService(repo *repository.ReservationRepo, provider payment.Provider, currency string, ledger *LedgerService, jobs *JobScheduler, confirmationGrace time.Duration, logger *config.Logger, tracer trace.Tracer) *PaymentService {
+	return &PaymentService{repo: repo, provider: provider, currency: currency, ledger: ledger, jobs: jobs, confirmationGrace: confirmationGrace, logger: logger, tracer: tracer}
+}
+
+// Authorize holds the price of a reservation on the guest's payment method and records the
+// payment. The reservation must already have its id and price.
+func (ps *PaymentService) Authorize(ctx context.Context, reservation *domain.Reservation) (*domain.Payment, *errors.ReservationError) {
+	ctx, span := ps.tracer.Start(ctx, "PaymentService.Authorize")
+	defer span.End()
+	authorization, err := ps.authorize(ctx, reservation.Id, reservation.Id.String(), reservation.Price, reservation.PaymentToken)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	result := &domain.Payment{
+		ReservationID:   reservation.Id,
+		UserID:          reservation.UserID,
+		HostID:          reservation.HostID,
+		AccommodationID: reservation.AccommodationID,
+		CheckIn:         reservation.DateRange[0],
+		Provider:        ps.provider.Name(),
+		AuthorizationID: authorization.ID,
+		Amount:          authorization.Amount,
+		Currency:        ps.currency,
+		Status:          domain.PaymentAuthorized,
+		CreatedAt:       now,
+		UpdatedAt:       now,
+	}
+	if err := ps.repo.SavePayment(ctx, result); err != nil {
+		ps.release(ctx, result)
+		return nil, err
+	}
+	return result, nil
+}
+
+func (ps *PaymentService) authorize(ctx context.Context, reservationID gocql.UUID, reference string, amount int, paymentToken string) (*payment.Authorization, *errors.ReservationError) {
+	authorization, err := ps.provider.Authorize(ctx, payment.AuthorizeRequest{
+		Reference:    reference,
+		Amount:       amount,
+		Currency:     ps.currency,
+		PaymentToken: paymentToken,
+	})
+	if err != nil {
+		var declined *payment.DeclinedError
+		if errs.As(err, &declined) {
+			ps.logger.LogInfo("paymentService", fmt.Sprintf("Payment for reservation %s declined: %s", reservationID, declined.Reason))
+			return nil, errors.NewReservationError(402, "Payment declined: "+declined.Reason)
+		}
+		ps.logger.LogError("paymentService", err.Error())
+		return nil, errors.NewReservationError(502, "Unable to authorize payment")
+	}
+	return authorization, nil
+}
+
+// PaymentChange is the payment of a modified reservation with its new amount and check-in. It is
+// prepared before the modification is stored and applied after it was.
+type PaymentChange struct {
+	payment  domain.Payment
+	previous domain.Payment
+}
+
+// PrepareChange works out the payment of a reservation with a new price and check-in. A lower
+// price is captured from the authorization the payment has, a higher one is authorized anew with
+// paymentToken. Only authorized payments can change, one that was captured already can't. It
+// returns nil when the reservation has no payment or the payment stays as it is.
+func (ps *PaymentService) PrepareChange(ctx context.Context, reservation *domain.Reservation, paymentToken string) (*PaymentChange, *errors.ReservationError) {
+	ctx, span := ps.tracer.Start(ctx, "PaymentService.PrepareChange")
+	defer span.End()
+	p, err := ps.repo.GetPayment(ctx, reservation.Id)
+	if err != nil {
+		if err.Status == 404 {
+			return nil, nil
+		}
+		return nil, err
+	}
+	checkIn := reservation.DateRange[0]
+	if p.Amount == reservation.Price && p.CheckIn == checkIn {
+		return nil, nil
+	}
+	if p.Status != domain.PaymentAuthorized {
+		return nil, errors.NewReservationError(409, fmt.Sprintf("Payment of the reservation is %s, its price and dates can't change anymore", p.Status))
+	}
+	change := &PaymentChange{payment: *p, previous: *p}
+	change.payment.CheckIn = checkIn
+	change.payment.Amount = reservation.Price
+	if reservation.Price > p.Amount {
+		if paymentToken == "" {
+			return nil, errors.NewReservationError(402, "A payment method is needed to pay the higher price")
+		}
+		// Every new authorization gets its own reference, the provider answers a reference it
+		// saw before with the authorization it made then.
+		reference := fmt.Sprintf("%s-%d", reservation.Id, time.Now().UnixNano())
+		authorization, err := ps.authorize(ctx, reservation.Id, reference, reservation.Price, paymentToken)
+		if err != nil {
+			return nil, err
+		}
+		change.payment.AuthorizationID = authorization.ID
+		change.payment.Amount = authorization.Amount
+	}
+	return change, nil
+}
+
+// ApplyChange stores a changed payment, which moves it to its new check-in in the capture queue,
+// and releases the authorization it replaces. A payment that moved on since the change was
+// prepared is left as it is and the change is discarded.
+func (ps *PaymentService) ApplyChange(ctx context.Context, change *PaymentChange) (*domain.Payment, *errors.ReservationError) {
+	ctx, span := ps.tracer.Start(ctx, "PaymentService.ApplyChange")
+	defer span.End()
+	change.payment.UpdatedAt = time.Now().UTC()
+	applied, err := ps.repo.ChangePayment(ctx, &change.payment, &change.previous)
+	if err != nil {
+		ps.DiscardChange(ctx, change)
+		return nil, err
+	}
+	if !applied {
+		ps.DiscardChange(ctx, change)
+		return nil, errors.NewReservationError(409, "Payment changed while the reservation was modified")
+	}
+	if change.payment.AuthorizationID != change.previous.AuthorizationID {
+		if _, err := ps.provider.Refund(ctx, change.previous.AuthorizationID, change.previous.Amount, "release-"+change.previous.AuthorizationID); err != nil {
+			// The hold runs out on its own, the guest is never charged from it.
+			ps.logger.LogError("paymentService", fmt.Sprintf("Unable to release replaced authorization %s: %v", change.previous.AuthorizationID, err))
+		}
+	}
+	ps.logger.LogInfo("paymentService", fmt.Sprintf("Payment of reservation %s is now %d with check-in %s",
+		change.payment.ReservationID, change.payment.Amount, change.payment.CheckIn))
+	return &change.payment, nil
+}
+
+// DiscardChange releases the new authorization of a change that isn't applied.
+func (ps *PaymentService) DiscardChange(ctx context.Context, change *PaymentChange) {
+	if change.payment.AuthorizationID == change.previous.AuthorizationID {
+		return
+	}
+	if _, err := ps.provider.Refund(ctx, change.payment.AuthorizationID, change.payment.Amount, "release-"+change.payment.AuthorizationID); err != nil {
+		ps.logger.LogError("paymentService", fmt.Sprintf("Unable to release authorization %s: %v", change.payment.AuthorizationID, err))
+	}
+}
+
+// Void releases the authorization of a reservation that couldn't be stored.
+func (ps *PaymentService) Void(ctx context.Context, p *domain.Payment) {
+	ctx, span := ps.tracer.Start(ctx, "PaymentService.Void")
+	defer span.End()
+	if !ps.release(ctx, p) {
+		return
+	}
+	p.Status = domain.PaymentVoided
+	p.UpdatedAt = time.Now().UTC()
+	_, _ = ps.repo.UpdatePayment(ctx, p, domain.PaymentAuthorized)
+}
+
+func (ps *PaymentService) release(ctx context.Context, p *domain.Payment) bool {
+	if _, err := ps.provider.Refund(ctx, p.AuthorizationID, p.Amount, "release-"+p.ReservationID.String()); err != nil {
+		ps.logger.LogError("paymentService", fmt.Sprintf("Unable to release authorization %s: %v", p.AuthorizationID, err))
+		return false
+	}
+	return true
+}
+
+// WebhookSignatureHeader is the header the provider signs its webhooks in.
+func (ps *PaymentService) WebhookSignatureHeader() string {
+	return ps.provider.WebhookSignatureHeader()
+}
+
+// Currency is the currency reservations are paid in.
+func (ps *PaymentService) Currency() string {
+	return ps.currency
+}
+
+func (ps *PaymentService) GetPayment(ctx context.Context, reservationID string) (*domain.Payment, *errors.ReservationError) {
+	ctx, span := ps.tracer.Start(ctx, "PaymentService.GetPayment")
+	defer span.End()
+	id, err := gocql.ParseUUID(reservationID)
+	if err != nil {
+		return nil, errors.NewReservationError(400, "Invalid reservation id")
+	}
+	return ps.repo.GetPayment(ctx, id)
+}
+
+// Capture charges the authorized amount of a reservation. The capture is sent with a key of the
+// reservation, so capturing again after an outcome was lost doesn't charge the guest twice. The
+// payment is captured_unrecorded until its charge is in the ledger, a payment left there or in
+// another unrecorded state is booked by the next capture.
+func (ps *PaymentService) Capture(ctx context.Context, reservationID gocql.UUID) *errors.ReservationError {
+	ctx, span := ps.tracer.Start(ctx, "PaymentService.Capture")
+	defer span.End()
+	p, err := ps.repo.GetPayment(ctx, reservationID)
+	if err != nil {
+		return err
+	}
+	switch p.Status {
+	case domain.PaymentCapturedUnrecorded, domain.PaymentAdjustmentUnrecorded, domain.PaymentRefundUnrecorded:
+		return ps.recordPending(ctx, p)
+	case domain.PaymentAuthorized:
+	default:
+		return nil
+	}
+	if p.CheckIn > time.Now().UTC().Format(dateLayout) {
+		// The reservation was moved to a later check-in, the payment is captured then.
+		return nil
+	}
+	if _, captureErr := ps.provider.Capture(ctx, p.AuthorizationID, p.Amount, "capture-"+reservationID.String()); captureErr != nil {
+		ps.logger.LogError("paymentService", fmt.Sprintf("Unable to capture payment of reservation %s: %v", reservationID, captureErr))
+		return errors.NewReservationError(502, "Unable to capture payment")
+	}
+	p.CapturedAmount = p.Amount
+	p.Status = domain.PaymentCapturedUnrecorded
+	p.UpdatedAt = time.Now().UTC().Truncate(time.Millisecond)
+	applied, err := ps.repo.UpdatePayment(ctx, p, domain.PaymentAuthorized)
+	if err != nil || !applied {
+		return err
+	}
+	return ps.recordCapture(ctx, p)
+}
+
+// recordCapture books the charge of a captured_unrecorded payment and moves it on to captured.
+// The charge is keyed by the time the payment was captured at, so booking it again after a
+// failure doesn't book it twice.
+func (ps *PaymentService) recordCapture(ctx context.Context, p *domain.Payment) *errors.ReservationError {
+	if err := ps.ledger.RecordCharge(ctx, p); err != nil {
+		return err
+	}
+	p.Status = domain.PaymentCaptured
+	p.UpdatedAt = time.Now().UTC()
+	_, err := ps.repo.UpdatePayment(ctx, p, domain.PaymentCapturedUnrecorded)
+	return err
+}
+
+// recordPending books what a payment in one of the unrecorded states still owes the ledger and
+// moves it on, other payments are left as they are. Refunds and adjustments are keyed by the time
+// the payment went unrecorded at, so booking them again after a failure doesn't book them twice.
+func (ps *PaymentService) recordPending(ctx context.Context, p *domain.Payment) *errors.ReservationError {
+	from := p.Status
+	switch from {
+	case domain.PaymentCapturedUnrecorded:
+		return ps.recordCapture(ctx, p)
+	case domain.PaymentAdjustmentUnrecorded:
+		if err := ps.ledger.RecordAdjustment(ctx, p, p.UnrecordedAmount, "Captured amount reconciled with the payment provider"); err != nil {
+			return err
+		}
+		p.Status = domain.PaymentCaptured
+	case domain.PaymentRefundUnrecorded:
+		if err := ps.ledger.RecordRefund(ctx, p, p.UnrecordedAmount); err != nil {
+			return err
+		}
+		p.Status = domain.PaymentRefunded
+	default:
+		return nil
+	}
+	p.UnrecordedAmount = 0
+	p.UpdatedAt = time.Now().UTC()
+	_, err := ps.repo.UpdatePayment(ctx, p, from)
+	return err
+}
+
+// Refund returns everything that was paid for a reservation, or releases the authorization when
+// nothing was captured yet. Reservations made before payments were introduced have no payment
+// and need no refund. The payment is refund_unrecorded until its refund is in the ledger, a
+// refund that failed to be booked is booked when the refund is tried again.
+func (ps *PaymentService) Refund(ctx context.Context, reservationID gocql.UUID) *errors.ReservationError {
+	ctx, span := ps.tracer.Start(ctx, "PaymentService.Refund")
+	defer span.End()
+	p, err := ps.repo.GetPayment(ctx, reservationID)
+	if err != nil {
+		if err.Status == 404 {
+			return nil
+		}
+		return err
+	}
+	if err := ps.recordPending(ctx, p); err != nil {
+		return err
+	}
+	from := p.Status
+	switch p.Status {
+	case domain.PaymentAuthorized:
+		if !ps.release(ctx, p) {
+			return errors.NewReservationError(502, "Unable to release the payment")
+		}
+		p.Status = domain.PaymentVoided
+	case domain.PaymentCaptured:
+		amount := p.CapturedAmount - p.RefundedAmount
+		if _, refundErr := ps.provider.Refund(ctx, p.AuthorizationID, amount, "refund-"+reservationID.String()); refundErr != nil {
+			ps.logger.LogError("paymentService", fmt.Sprintf("Unable to refund payment of reservation %s: %v", reservationID, refundErr))
+			return errors.NewReservationError(502, "Unable to refund the payment")
+		}
+		p.RefundedAmount += amount
+		p.UnrecordedAmount = amount
+		p.Status = domain.PaymentRefundUnrecorded
+		p.UpdatedAt = time.Now().UTC().Truncate(time.Millisecond)
+		applied, err := ps.repo.UpdatePayment(ctx, p, from)
+		if err != nil || !applied {
+			return err
+		}
+		return ps.recordPending(ctx, p)
+	default:
+		return nil
+	}
+	p.UpdatedAt = time.Now().UTC()
+	_, err = ps.repo.UpdatePayment(ctx, p, from)
+	return err
+}
+
+// RegisterJobs registers the jobs that retry payment operations.
+func (ps *PaymentService) RegisterJobs(jobs *JobScheduler) {
+	jobs.Register(domain.JobRefund, ps.refund)
+}
+
+// RetryRefund schedules the refund of a canceled reservation whose refund failed. The refund
+// is keyed by the reservation, so it is never paid out twice.
+func (ps *PaymentService) RetryRefund(ctx context.Context, reservationID gocql.UUID) {
+	payload := domain.ReservationJob{ReservationID: reservationID.String()}
+	if err := ps.jobs.Schedule(ctx, domain.JobRefund, time.Now().Add(refundRetryDelay), payload); err != nil {
+		ps.logger.LogError("paymentService", fmt.Sprintf("Unable to schedule the refund of reservation %s: %s", reservationID, err.Message))
+	}
+}
+
+func (ps *PaymentService) refund(ctx context.Context, job domain.Job) error {
+	var payload domain.ReservationJob
+	if err := json.Unmarshal([]byte(job.Payload), &payload); err != nil {
+		return err
+	}
+	reservationID, err := gocql.ParseUUID(payload.ReservationID)
+	if err != nil {
+		return err
+	}
+	if err := ps.Refund(ctx, reservationID); err != nil {
+		return err
+	}
+	return nil
+}
+
+// CaptureDuePayments captures the payments of every reservation whose check-in has come, and
+// books the charges of captures that didn't make it into the ledger. Check-ins of the current
+// and the previous month are looked at.
+func (ps *PaymentService) CaptureDuePayments(ctx context.Context) {
+	ctx, span := ps.tracer.Start(ctx, "PaymentService.CaptureDuePayments")
+	defer span.End()
+	now := time.Now().UTC()
+	months := []string{now.AddDate(0, -1, 0).Format("2006-01"), now.Format("2006-01")}
+	due, err := ps.repo.GetDueCaptures(ctx, months, now.Format(dateLayout))
+	if err != nil {
+		ps.logger.LogError("paymentService", err.Message)
+		return
+	}
+	for _, reservationID := range due {
+		if err := ps.Capture(ctx, reservationID); err != nil {
+			ps.logger.LogError("paymentService", err.Message)
+		}
+	}
+}
+
+// HandleWebhook applies an event the provider reports asynchronously to the stored payment. An
+// event is applied once, one the provider sends again is acknowledged and ignored. An event that
+// couldn't be handled is forgotten, so it is handled when the provider retries it.
+func (ps *PaymentService) HandleWebhook(ctx context.Context, payload []byte, signature string) *errors.ReservationError {
+	ctx, span := ps.tracer.Start(ctx, "PaymentService.HandleWebhook")
+	defer span.End()
+	event, err := ps.provider.VerifyWebhook(payload, signature)
+	if err != nil {
+		ps.logger.LogWarn("paymentService", "Rejected payment webhook: "+err.Error())
+		return errors.NewReservationError(400, "Invalid webhook")
+	}
+	if event.ID == "" {
+		return errors.NewReservationError(400, "Webhook event has no id")
+	}
+	claimed, claimErr := ps.repo.ClaimWebhookEvent(ctx, event.ID)
+	if claimErr != nil {
+		return claimErr
+	}
+	if !claimed {
+		ps.logger.LogInfo("paymentService", fmt.Sprintf("Ignored payment webhook %s, it was handled before", event.ID))
+		return nil
+	}
+	if applyErr := ps.applyWebhook(ctx, event); applyErr != nil {
+		if applyErr.Status >= 500 {
+			if releaseErr := ps.repo.ReleaseWebhookEvent(ctx, event.ID); releaseErr != nil {
+				ps.logger.LogError("paymentService", fmt.Sprintf("Payment webhook %s failed and stays recorded: %s", event.ID, releaseErr.Message))
+			}
+		}
+		return applyErr
+	}
+	return nil
+}
+
+// applyWebhook moves a payment on as the event reports. A payment only goes from authorized to
+// captured and from captured to refunded, or fails or expires while authorized; an event that
+// would move it any other way is rejected.
+func (ps *PaymentService) applyWebhook(ctx context.Context, event *payment.WebhookEvent) *errors.ReservationError {
+	switch event.Type {
+	case payment.EventCaptured, payment.EventRefunded, payment.EventFailed, payment.EventAuthorizationExpired:
+	default:
+		ps.logger.LogInfo("paymentService", fmt.Sprintf("Ignored payment webhook %s of type %s", event.ID, event.Type))
+		return nil
+	}
+	p, getErr := ps.repo.GetPaymentByAuthorization(ctx, event.AuthorizationID)
+	if getErr != nil {
+		return getErr
+	}
+	if err := ps.recordPending(ctx, p); err != nil {
+		return err
+	}
+	from := p.Status
+	// The ledger follows the totals the provider reports: a capture the service didn't make itself
+	// is charged, a differing captured total is adjusted and new refunds are booked. Like the
+	// service's own captures and refunds, the payment is unrecorded until they are booked.
+	switch event.Type {
+	case payment.EventCaptured:
+		if from != domain.PaymentAuthorized && from != domain.PaymentCaptured {
+			return ps.rejectWebhook(p, event)
+		}
+		p.Status = domain.PaymentCaptured
+		if from == domain.PaymentAuthorized {
+			p.Status = domain.PaymentCapturedUnrecorded
+		} else if difference := event.Amount - p.CapturedAmount; difference != 0 {
+			p.UnrecordedAmount = difference
+			p.Status = domain.PaymentAdjustmentUnrecorded
+		}
+		p.CapturedAmount = event.Amount
+	case payment.EventRefunded:
+		if from != domain.PaymentCaptured && from != domain.PaymentRefunded {
+			return ps.rejectWebhook(p, event)
+		}
+		p.Status = domain.PaymentRefunded
+		if difference := event.Amount - p.RefundedAmount; difference > 0 {
+			p.UnrecordedAmount = difference
+			p.Status = domain.PaymentRefundUnrecorded
+		}
+		p.RefundedAmount = event.Amount
+	case payment.EventFailed:
+		if from != domain.PaymentAuthorized {
+			return ps.rejectWebhook(p, event)
+		}
+		p.Status = domain.PaymentFailed
+	case payment.EventAuthorizationExpired:
+		if from != domain.PaymentAuthorized {
+			return ps.rejectWebhook(p, event)
+		}
+		p.Status = domain.PaymentVoided
+	}
+	p.UpdatedAt = time.Now().UTC().Truncate(time.Millisecond)
+	applied, err := ps.repo.UpdatePayment(ctx, p, from)
+	if err != nil {
+		return err
+	}
+	if !applied {
+		return errors.NewReservationError(503, "Payment changed while the webhook was handled, send it again")
+	}
+	ps.logger.LogInfo("paymentService", fmt.Sprintf("Payment of reservation %s is %s after webhook %s", p.ReservationID, p.Status, event.ID))
+	if event.Type == payment.EventFailed || event.Type == payment.EventAuthorizationExpired {
+		expiry := domain.ReservationJob{ReservationID: p.ReservationID.String(), UserID: p.UserID}
+		if err := ps.jobs.Schedule(ctx, domain.JobExpireUnconfirmed, time.Now().Add(ps.confirmationGrace), expiry); err != nil {
+			return err
+		}
+	}
+	return ps.recordPending(ctx, p)
+}
+
+func (ps *PaymentService) rejectWebhook(p *domain.Payment, event *payment.WebhookEvent) *errors.ReservationError {
+	ps.logger.LogWarn("paymentService", fmt.Sprintf("Rejected payment webhook %s, payment of reservation %s is %s and can't take a %s event",
+		event.ID, p.ReservationID, p.Status, event.Type))
+	return errors.NewReservationError(409, fmt.Sprintf("Payment is %s and can't take a %s event", p.Status, event.Type))
+}
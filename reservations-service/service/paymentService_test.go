@@ -0,0 +1,349 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"reservation-service/domain"
+	"reservation-service/payment"
+	"reservation-service/payment/paymenttest"
+	"testing"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+const (
+	testWebhookSecret = "whsec_test"
+	testHostID        = "host-1"
+	testGuestID       = "guest-1"
+)
+
+func newTestPaymentService(t *testing.T) (*PaymentService, *memoryStore, *paymenttest.FakeProvider) {
+	t.Helper()
+	store := newMemoryStore()
+	provider := paymenttest.NewFakeProvider(testWebhookSecret)
+	logger := newTestLogger(t)
+	tracer := newTestTracer()
+	ledger := &LedgerService{repo: store, feePercent: 10, logger: logger, tracer: tracer}
+	ps := &PaymentService{repo: store, provider: provider, currency: "EUR", ledger: ledger, jobs: store,
+		confirmationGrace: time.Hour, logger: logger, tracer: tracer}
+	return ps, store, provider
+}
+
+func testReservation(price int, token string) *domain.Reservation {
+	id, _ := gocql.RandomUUID()
+	return &domain.Reservation{
+		Id:              id,
+		UserID:          testGuestID,
+		HostID:          testHostID,
+		AccommodationID: "accommodation-1",
+		DateRange:       []string{testDate(0), testDate(1)},
+		Price:           price,
+		PaymentToken:    token,
+	}
+}
+
+// testDate is the date days from today.
+func testDate(days int) string {
+	return time.Now().UTC().AddDate(0, 0, days).Format(dateLayout)
+}
+
+func assertBalance(t *testing.T, ps *PaymentService, want int) {
+	t.Helper()
+	balance, err := ps.ledger.GetBalance(context.Background(), testHostID)
+	if err != nil {
+		t.Fatalf("getting balance: %s", err.Message)
+	}
+	if balance.Balance != want {
+		t.Fatalf("host balance is %d, want %d", balance.Balance, want)
+	}
+}
+
+func sendWebhook(t *testing.T, ps *PaymentService, provider *paymenttest.FakeProvider, event payment.WebhookEvent) int {
+	t.Helper()
+	payload, _ := json.Marshal(event)
+	if err := ps.HandleWebhook(context.Background(), payload, provider.SignWebhook(payload)); err != nil {
+		return err.Status
+	}
+	return 204
+}
+
+func TestPaymentIsCapturedOnceAndRefunded(t *testing.T) {
+	ps, store, _ := newTestPaymentService(t)
+	ctx := context.Background()
+	reservation := testReservation(200, "tok_visa")
+	if _, err := ps.Authorize(ctx, reservation); err != nil {
+		t.Fatalf("authorizing: %s", err.Message)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := ps.Capture(ctx, reservation.Id); err != nil {
+			t.Fatalf("capturing: %s", err.Message)
+		}
+	}
+	if p := store.payment(t, reservation.Id); p.Status != domain.PaymentCaptured || p.CapturedAmount != 200 {
+		t.Fatalf("payment is %s with %d captured, want captured with 200", p.Status, p.CapturedAmount)
+	}
+	// The host earns the price less the 10% fee, once.
+	assertBalance(t, ps, 180)
+
+	if err := ps.Refund(ctx, reservation.Id); err != nil {
+		t.Fatalf("refunding: %s", err.Message)
+	}
+	if p := store.payment(t, reservation.Id); p.Status != domain.PaymentRefunded || p.RefundedAmount != 200 {
+		t.Fatalf("payment is %s with %d refunded, want refunded with 200", p.Status, p.RefundedAmount)
+	}
+	assertBalance(t, ps, 0)
+}
+
+func TestPaymentRefundReleasesUncapturedAuthorization(t *testing.T) {
+	ps, store, _ := newTestPaymentService(t)
+	ctx := context.Background()
+	reservation := testReservation(200, "tok_visa")
+	if _, err := ps.Authorize(ctx, reservation); err != nil {
+		t.Fatalf("authorizing: %s", err.Message)
+	}
+	if err := ps.Refund(ctx, reservation.Id); err != nil {
+		t.Fatalf("refunding: %s", err.Message)
+	}
+	if p := store.payment(t, reservation.Id); p.Status != domain.PaymentVoided {
+		t.Fatalf("payment is %s, want %s", p.Status, domain.PaymentVoided)
+	}
+	// The released authorization can't be captured anymore.
+	if err := ps.Capture(ctx, reservation.Id); err != nil {
+		t.Fatalf("capturing: %s", err.Message)
+	}
+	assertBalance(t, ps, 0)
+}
+
+func TestPaymentDeclinedIsNotStored(t *testing.T) {
+	ps, store, _ := newTestPaymentService(t)
+	reservation := testReservation(200, paymenttest.TokenDeclined)
+	if _, err := ps.Authorize(context.Background(), reservation); err == nil || err.Status != 402 {
+		t.Fatalf("authorizing a declined card got %v, want 402", err)
+	}
+	if len(store.payments) != 0 {
+		t.Fatalf("declined payment was stored")
+	}
+}
+
+func TestPaymentWebhookIsAppliedOnceAndOnlyWhenSigned(t *testing.T) {
+	ps, store, provider := newTestPaymentService(t)
+	ctx := context.Background()
+	reservation := testReservation(200, "tok_visa")
+	authorized, err := ps.Authorize(ctx, reservation)
+	if err != nil {
+		t.Fatalf("authorizing: %s", err.Message)
+	}
+
+	payload, _ := json.Marshal(payment.WebhookEvent{ID: "evt_forged", Type: payment.EventCaptured, AuthorizationID: authorized.AuthorizationID, Amount: 200})
+	if err := ps.HandleWebhook(ctx, payload, "forged"); err == nil || err.Status != 400 {
+		t.Fatalf("forged webhook got %v, want 400", err)
+	}
+
+	captured := payment.WebhookEvent{ID: "evt_1", Type: payment.EventCaptured, AuthorizationID: authorized.AuthorizationID, Amount: 200}
+	for i := 0; i < 2; i++ {
+		if status := sendWebhook(t, ps, provider, captured); status != 204 {
+			t.Fatalf("capture webhook got %d, want 204", status)
+		}
+	}
+	if p := store.payment(t, reservation.Id); p.Status != domain.PaymentCaptured {
+		t.Fatalf("payment is %s, want %s", p.Status, domain.PaymentCaptured)
+	}
+	assertBalance(t, ps, 180)
+
+	// A captured payment can't fail anymore.
+	failed := payment.WebhookEvent{ID: "evt_2", Type: payment.EventFailed, AuthorizationID: authorized.AuthorizationID}
+	if status := sendWebhook(t, ps, provider, failed); status != 409 {
+		t.Fatalf("failure webhook of a captured payment got %d, want 409", status)
+	}
+}
+
+func TestPaymentRefundIsBookedOnceAfterLedgerFailure(t *testing.T) {
+	ps, store, _ := newTestPaymentService(t)
+	ctx := context.Background()
+	reservation := testReservation(200, "tok_visa")
+	if _, err := ps.Authorize(ctx, reservation); err != nil {
+		t.Fatalf("authorizing: %s", err.Message)
+	}
+	if err := ps.Capture(ctx, reservation.Id); err != nil {
+		t.Fatalf("capturing: %s", err.Message)
+	}
+
+	store.failLedger = 1
+	if err := ps.Refund(ctx, reservation.Id); err == nil {
+		t.Fatalf("refunding with a failing ledger succeeded")
+	}
+	if p := store.payment(t, reservation.Id); p.Status != domain.PaymentRefundUnrecorded || p.UnrecordedAmount != 200 {
+		t.Fatalf("payment is %s with %d unrecorded, want %s with 200", p.Status, p.UnrecordedAmount, domain.PaymentRefundUnrecorded)
+	}
+	assertBalance(t, ps, 180)
+
+	for i := 0; i < 2; i++ {
+		if err := ps.Refund(ctx, reservation.Id); err != nil {
+			t.Fatalf("refunding again: %s", err.Message)
+		}
+	}
+	if p := store.payment(t, reservation.Id); p.Status != domain.PaymentRefunded || p.RefundedAmount != 200 {
+		t.Fatalf("payment is %s with %d refunded, want refunded with 200", p.Status, p.RefundedAmount)
+	}
+	assertBalance(t, ps, 0)
+}
+
+func TestPaymentWebhookBooksRefundsAndAdjustmentsOnce(t *testing.T) {
+	ps, store, provider := newTestPaymentService(t)
+	ctx := context.Background()
+	reservation := testReservation(200, "tok_visa")
+	authorized, err := ps.Authorize(ctx, reservation)
+	if err != nil {
+		t.Fatalf("authorizing: %s", err.Message)
+	}
+	if err := ps.Capture(ctx, reservation.Id); err != nil {
+		t.Fatalf("capturing: %s", err.Message)
+	}
+
+	// The provider reports 250 captured; the ledger fails the first time, so the provider sends
+	// the event again.
+	adjusted := payment.WebhookEvent{ID: "evt_1", Type: payment.EventCaptured, AuthorizationID: authorized.AuthorizationID, Amount: 250}
+	store.failLedger = 1
+	if status := sendWebhook(t, ps, provider, adjusted); status != 500 {
+		t.Fatalf("capture webhook with a failing ledger got %d, want 500", status)
+	}
+	for i := 0; i < 2; i++ {
+		if status := sendWebhook(t, ps, provider, adjusted); status != 204 {
+			t.Fatalf("capture webhook got %d, want 204", status)
+		}
+	}
+	assertBalance(t, ps, 230)
+
+	refunded := payment.WebhookEvent{ID: "evt_2", Type: payment.EventRefunded, AuthorizationID: authorized.AuthorizationID, Amount: 100}
+	store.failLedger = 1
+	if status := sendWebhook(t, ps, provider, refunded); status != 500 {
+		t.Fatalf("refund webhook with a failing ledger got %d, want 500", status)
+	}
+	for i := 0; i < 2; i++ {
+		if status := sendWebhook(t, ps, provider, refunded); status != 204 {
+			t.Fatalf("refund webhook got %d, want 204", status)
+		}
+	}
+	if p := store.payment(t, reservation.Id); p.Status != domain.PaymentRefunded || p.RefundedAmount != 100 {
+		t.Fatalf("payment is %s with %d refunded, want refunded with 100", p.Status, p.RefundedAmount)
+	}
+	// 100 goes back to the guest and the host gets the fee of 10 back.
+	assertBalance(t, ps, 140)
+}
+
+func TestPaymentChangeTakesLowerPriceFromAuthorization(t *testing.T) {
+	ps, store, _ := newTestPaymentService(t)
+	ctx := context.Background()
+	reservation := testReservation(200, "tok_visa")
+	authorized, err := ps.Authorize(ctx, reservation)
+	if err != nil {
+		t.Fatalf("authorizing: %s", err.Message)
+	}
+
+	modified := *reservation
+	modified.Price = 150
+	change, err := ps.PrepareChange(ctx, &modified, "")
+	if err != nil {
+		t.Fatalf("preparing change: %s", err.Message)
+	}
+	if _, err := ps.ApplyChange(ctx, change); err != nil {
+		t.Fatalf("applying change: %s", err.Message)
+	}
+	if p := store.payment(t, reservation.Id); p.Amount != 150 || p.AuthorizationID != authorized.AuthorizationID {
+		t.Fatalf("payment is %d on %s, want 150 on %s", p.Amount, p.AuthorizationID, authorized.AuthorizationID)
+	}
+
+	if err := ps.Capture(ctx, reservation.Id); err != nil {
+		t.Fatalf("capturing: %s", err.Message)
+	}
+	if p := store.payment(t, reservation.Id); p.CapturedAmount != 150 {
+		t.Fatalf("captured %d, want 150", p.CapturedAmount)
+	}
+	assertBalance(t, ps, 135)
+}
+
+func TestPaymentChangeAuthorizesHigherPriceAndReleasesOldAuthorization(t *testing.T) {
+	ps, store, provider := newTestPaymentService(t)
+	ctx := context.Background()
+	reservation := testReservation(200, "tok_visa")
+	authorized, err := ps.Authorize(ctx, reservation)
+	if err != nil {
+		t.Fatalf("authorizing: %s", err.Message)
+	}
+
+	modified := *reservation
+	modified.Price = 300
+	if _, err := ps.PrepareChange(ctx, &modified, ""); err == nil || err.Status != 402 {
+		t.Fatalf("raising the price without a payment method got %v, want 402", err)
+	}
+	change, err := ps.PrepareChange(ctx, &modified, "tok_visa")
+	if err != nil {
+		t.Fatalf("preparing change: %s", err.Message)
+	}
+	changed, err := ps.ApplyChange(ctx, change)
+	if err != nil {
+		t.Fatalf("applying change: %s", err.Message)
+	}
+	if changed.AuthorizationID == authorized.AuthorizationID || changed.Amount != 300 {
+		t.Fatalf("payment is %d on %s, want 300 on a new authorization", changed.Amount, changed.AuthorizationID)
+	}
+	if _, err := provider.Refund(ctx, authorized.AuthorizationID, 200, "release-again"); err == nil {
+		t.Fatalf("replaced authorization %s wasn't released", authorized.AuthorizationID)
+	}
+
+	if err := ps.Capture(ctx, reservation.Id); err != nil {
+		t.Fatalf("capturing: %s", err.Message)
+	}
+	if p := store.payment(t, reservation.Id); p.Status != domain.PaymentCaptured || p.CapturedAmount != 300 {
+		t.Fatalf("payment is %s with %d captured, want captured with 300", p.Status, p.CapturedAmount)
+	}
+	assertBalance(t, ps, 270)
+}
+
+func TestPaymentChangeMovesCaptureToNewCheckIn(t *testing.T) {
+	ps, store, _ := newTestPaymentService(t)
+	ctx := context.Background()
+	reservation := testReservation(200, "tok_visa")
+	if _, err := ps.Authorize(ctx, reservation); err != nil {
+		t.Fatalf("authorizing: %s", err.Message)
+	}
+
+	modified := *reservation
+	modified.DateRange = []string{testDate(7), testDate(8)}
+	change, err := ps.PrepareChange(ctx, &modified, "")
+	if err != nil {
+		t.Fatalf("preparing change: %s", err.Message)
+	}
+	if _, err := ps.ApplyChange(ctx, change); err != nil {
+		t.Fatalf("applying change: %s", err.Message)
+	}
+	if err := ps.Capture(ctx, reservation.Id); err != nil {
+		t.Fatalf("capturing: %s", err.Message)
+	}
+	if p := store.payment(t, reservation.Id); p.Status != domain.PaymentAuthorized || p.CheckIn != testDate(7) {
+		t.Fatalf("payment is %s with check-in %s, want authorized with check-in %s", p.Status, p.CheckIn, testDate(7))
+	}
+}
+
+func TestPaymentChangeOfCapturedPaymentIsRefused(t *testing.T) {
+	ps, store, _ := newTestPaymentService(t)
+	ctx := context.Background()
+	reservation := testReservation(200, "tok_visa")
+	if _, err := ps.Authorize(ctx, reservation); err != nil {
+		t.Fatalf("authorizing: %s", err.Message)
+	}
+	if err := ps.Capture(ctx, reservation.Id); err != nil {
+		t.Fatalf("capturing: %s", err.Message)
+	}
+
+	modified := *reservation
+	modified.Price = 250
+	if _, err := ps.PrepareChange(ctx, &modified, "tok_visa"); err == nil || err.Status != 409 {
+		t.Fatalf("changing a captured payment got %v, want 409", err)
+	}
+	if p := store.payment(t, reservation.Id); p.Amount != 200 || p.CapturedAmount != 200 {
+		t.Fatalf("payment is %d with %d captured, want 200 with 200", p.Amount, p.CapturedAmount)
+	}
+}
@@ -0,0 +1,130 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reservation-service/domain"
+	"time"
+)
+
+const checkInReminderLead = 48 * time.Hour
+
+// RegisterJobs registers the jobs that follow a reservation through its stay.
+func (s *ReservationService) RegisterJobs(jobs *JobScheduler) {
+	jobs.Register(domain.JobCheckInReminder, s.sendCheckInReminder)
+	jobs.Register(domain.JobReviewPrompt, s.sendReviewPrompt)
+	jobs.Register(domain.JobMarkInactive, s.markInactive)
+	jobs.Register(domain.JobExpireUnconfirmed, s.expireUnconfirmed)
+}
+
+// scheduleStayJobs schedules the check-in reminder 48 hours before the stay starts, and the
+// review prompt and the end of the reservation at check-out. A reminder that is already due
+// is sent right away.
+func (s *ReservationService) scheduleStayJobs(ctx context.Context, reservation *domain.Reservation) {
+	start, err := time.Parse(dateLayout, reservation.StartDate)
+	if err != nil {
+		s.logger.LogError("reservationsService", fmt.Sprintf("Unable to schedule jobs of reservation %s: %v", reservation.Id, err))
+		return
+	}
+	end, err := time.Parse(dateLayout, reservation.EndDate)
+	if err != nil {
+		s.logger.LogError("reservationsService", fmt.Sprintf("Unable to schedule jobs of reservation %s: %v", reservation.Id, err))
+		return
+	}
+	checkOut := end.AddDate(0, 0, 1)
+	now := time.Now()
+	schedule := func(kind string, runAt time.Time, date string) {
+		payload := domain.ReservationJob{ReservationID: reservation.Id.String(), UserID: reservation.UserID, Date: date}
+		if err := s.jobs.Schedule(ctx, kind, runAt, payload); err != nil {
+			s.logger.LogError("reservationsService", err.Message)
+		}
+	}
+	if start.After(now) {
+		reminder := start.Add(-checkInReminderLead)
+		if reminder.Before(now) {
+			reminder = now
+		}
+		schedule(domain.JobCheckInReminder, reminder, reservation.StartDate)
+	}
+	schedule(domain.JobReviewPrompt, checkOut, reservation.EndDate)
+	schedule(domain.JobMarkInactive, checkOut, reservation.EndDate)
+}
+
+// reservationForJob loads the reservation a job is about. It returns nil if the reservation
+// was canceled, or if its stay moved away from the date the job was scheduled for.
+func (s *ReservationService) reservationForJob(ctx context.Context, job domain.Job, date func(*domain.Reservation) string) (*domain.Reservation, error) {
+	var payload domain.ReservationJob
+	if err := json.Unmarshal([]byte(job.Payload), &payload); err != nil {
+		return nil, err
+	}
+	reservation, err := s.repo.GetReservationByUserAndId(ctx, payload.UserID, payload.ReservationID)
+	if err != nil {
+		if err.Status == 404 {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if date != nil && date(reservation) != payload.Date {
+		return nil, nil
+	}
+	return reservation, nil
+}
+
+func (s *ReservationService) sendCheckInReminder(ctx context.Context, job domain.Job) error {
+	reservation, err := s.reservationForJob(ctx, job, func(r *domain.Reservation) string { return r.StartDate })
+	if err != nil || reservation == nil {
+		return err
+	}
+	s.notification.SendReminderNotification(ctx, reservation.UserID,
+		fmt.Sprintf("Your stay at %s starts on %s, check-in is in less than two days", reservation.AccommodationName, reservation.StartDate))
+	return nil
+}
+
+func (s *ReservationService) sendReviewPrompt(ctx context.Context, job domain.Job) error {
+	reservation, err := s.reservationForJob(ctx, job, func(r *domain.Reservation) string { return r.EndDate })
+	if err != nil || reservation == nil {
+		return err
+	}
+	s.notification.SendReminderNotification(ctx, reservation.UserID,
+		fmt.Sprintf("How was your stay at %s? Rate the accommodation and your host", reservation.AccommodationName))
+	return nil
+}
+
+func (s *ReservationService) markInactive(ctx context.Context, job domain.Job) error {
+	reservation, err := s.reservationForJob(ctx, job, func(r *domain.Reservation) string { return r.EndDate })
+	if err != nil || reservation == nil || !reservation.IsActive {
+		return err
+	}
+	if err := s.repo.DeactivateReservation(ctx, reservation); err != nil {
+		return err
+	}
+	s.logger.LogInfo("reservationsService", fmt.Sprintf("Reservation %s is past its stay and no longer active", reservation.Id))
+	return nil
+}
+
+// expireUnconfirmed cancels a reservation whose payment failed and wasn't confirmed since.
+func (s *ReservationService) expireUnconfirmed(ctx context.Context, job domain.Job) error {
+	reservation, err := s.reservationForJob(ctx, job, nil)
+	if err != nil || reservation == nil {
+		return err
+	}
+	payment, paymentErr := s.payments.GetPayment(ctx, reservation.Id.String())
+	if paymentErr != nil {
+		if paymentErr.Status == 404 {
+			return nil
+		}
+		return paymentErr
+	}
+	if payment.Status == domain.PaymentAuthorized || payment.Status == domain.PaymentCapturedUnrecorded || payment.Status == domain.PaymentCaptured ||
+		payment.Status == domain.PaymentAdjustmentUnrecorded {
+		return nil
+	}
+	if _, err := s.DeleteReservationById(ctx, reservation.UserID, reservation.Id.String()); err != nil {
+		return err
+	}
+	s.notification.SendReminderNotification(ctx, reservation.UserID,
+		fmt.Sprintf("Your reservation at %s from %s to %s was canceled because its payment couldn't be confirmed",
+			reservation.AccommodationName, reservation.StartDate, reservation.EndDate))
+	return nil
+}
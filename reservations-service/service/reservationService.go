@@ -6,25 +6,33 @@ import (
 	"log"
 	"reservation-service/client"
 	"reservation-service/config"
+	"reservation-service/document"
 	"reservation-service/domain"
 	"reservation-service/errors"
 	"reservation-service/repository"
 	"reservation-service/utils"
+	"sort"
+	"time"
 
+	"github.com/gocql/gocql"
 	"go.opentelemetry.io/otel/trace"
 )
 
 type ReservationService struct {
-	repo         *repository.ReservationRepo
-	validator    *utils.Validator
-	notification *client.NotificationClient
-	logger       *config.Logger
-	tracer       trace.Tracer
-	metricClient *client.MetricsClient
+	repo           *repository.ReservationRepo
+	validator      *utils.Validator
+	notification   *client.NotificationClient
+	logger         *config.Logger
+	tracer         trace.Tracer
+	metricClient   *client.MetricsClient
+	accommodations *client.AccommodationsClient
+	payments       *PaymentService
+	waitlist       *WaitlistService
+	jobs           *JobScheduler
 }
 
-func NewReservationService(repo *repository.ReservationRepo, validator *utils.Validator, notification *client.NotificationClient, logger *config.Logger, tracer trace.Tracer, metricsClient *client.MetricsClient) *ReservationService {
-	return &ReservationService{repo: repo, validator: validator, notification: notification, logger: logger, tracer: tracer, metricClient: metricsClient}
+func NewReservationService(repo *repository.ReservationRepo, validator *utils.Validator, notification *client.NotificationClient, logger *config.Logger, tracer trace.Tracer, metricsClient *client.MetricsClient, accommodations *client.AccommodationsClient, payments *PaymentService, waitlist *WaitlistService, jobs *JobScheduler) *ReservationService {
+	return &ReservationService{repo: repo, validator: validator, notification: notification, logger: logger, tracer: tracer, metricClient: metricsClient, accommodations: accommodations, payments: payments, waitlist: waitlist, jobs: jobs}
 }
 
 // service/reservationService.go
@@ -32,20 +40,58 @@ func NewReservationService(repo *repository.ReservationRepo, validator *utils.Va
 func (r ReservationService) CreateReservation(ctx context.Context, reservation domain.Reservation) (*domain.Reservation, *errors.ReservationError) {
 	ctx, span := r.tracer.Start(ctx, "ReservationService.CreateReservation")
 	defer span.End()
-	/*	r.validator.ValidateReservation(&reservation)
-		validationErrors := r.validator.GetErrors()
+	holdEntry, err := r.prepareReservation(ctx, &reservation)
+	if err != nil {
+		return nil, err
+	}
+	reservation.Id, _ = gocql.RandomUUID()
+	// The reservation is only stored once the payment is authorized.
+	authorizedPayment, erro := r.payments.Authorize(ctx, &reservation)
+	if erro != nil {
+		return nil, erro
+	}
+	reservation.PaymentToken = ""
+	createdReservation, insertErr := r.repo.InsertReservation(ctx, &reservation)
+	if insertErr != nil {
+		r.logger.LogError("reservationsService", insertErr.Error())
+		r.payments.Void(ctx, authorizedPayment)
+		return nil, errors.NewReservationError(insertErr.Status, "Unable to create reservation: "+insertErr.Message)
+	}
+	createdReservation.Payment = authorizedPayment
+	r.reservationCreated(ctx, createdReservation, holdEntry)
+	return createdReservation, nil
+}
 
-		if len(validationErrors) > 0 {
-			return nil, errors.NewReservationError(400, "Validation failed")
-		}
-	*/
+// prepareReservation runs every check a new reservation has to pass: the reservation and its
+// party are validated and all nights must be offered, free, not blocked and not held for
+// another guest. The host, the accommodation name and the price of the stay are set on the
+// reservation. If the nights are held for the
+// guest, the waitlist entry holding them is returned.
+func (r ReservationService) prepareReservation(ctx context.Context, reservation *domain.Reservation) (*gocql.UUID, *errors.ReservationError) {
+	if validationErrors := r.validator.ValidateReservation(reservation); len(validationErrors) > 0 {
+		r.logger.LogInfo("reservationsService", fmt.Sprintf("Reservation rejected by validation: %v", validationErrors))
+		return nil, errors.NewReservationErrorWithDetails(400, "Validation failed", validationErrors)
+	}
+	accommodation, err := r.accommodations.GetAccommodation(ctx, reservation.AccommodationID)
+	if err != nil {
+		r.logger.LogError("reservationsService", err.Message)
+		return nil, err
+	}
+	// The host is paid and notified, so who it is comes from the accommodation and not from the
+	// request.
+	reservation.HostID = accommodation.UserId
+	reservation.AccommodationName = accommodation.Name
+	if validationErrors := r.validator.ValidateGuests(reservation.Guests, accommodation); len(validationErrors) > 0 {
+		r.logger.LogInfo("reservationsService", fmt.Sprintf("Reservation rejected by validation: %v", validationErrors))
+		return nil, errors.NewReservationErrorWithDetails(400, "Validation failed", validationErrors)
+	}
 	available, err := r.IsAvailable(ctx, reservation.AccommodationID, reservation.DateRange)
 	if err != nil {
 		r.logger.LogError("reservationsService", err.Message)
 		return nil, err
 	}
 	if !available {
-		r.logger.LogError("reservationsService", err.Message)
+		r.logger.LogInfo("reservationsService", fmt.Sprintf("Accommodation %s not available on %v", reservation.AccommodationID, reservation.DateRange))
 		return nil, errors.NewReservationError(400, "Accommodation not available for the specified date range")
 	}
 
@@ -55,19 +101,65 @@ func (r ReservationService) CreateReservation(ctx context.Context, reservation d
 		return nil, erro
 	}
 	if reserved {
-		r.logger.LogError("reservationsService", erro.Message)
+		r.logger.LogInfo("reservationsService", fmt.Sprintf("Accommodation %s already reserved on %v", reservation.AccommodationID, reservation.DateRange))
 		return nil, errors.NewReservationError(400, "Accommodation not available for the specified date range1")
 	}
-	createdReservation, insertErr := r.repo.InsertReservation(ctx, &reservation)
-	if insertErr != nil {
+	blocked, erro := r.IsBlocked(ctx, reservation.AccommodationID, reservation.DateRange)
+	if erro != nil {
+		r.logger.LogError("reservationsService", erro.Message)
+		return nil, erro
+	}
+	if blocked {
+		return nil, errors.NewReservationError(400, "Accommodation not available for the specified date range")
+	}
+	held, holdEntry, erro := r.waitlist.HeldFor(ctx, reservation.AccommodationID, reservation.DateRange, reservation.UserID)
+	if erro != nil {
+		r.logger.LogError("reservationsService", erro.Message)
+		return nil, erro
+	}
+	if held {
+		return nil, errors.NewReservationError(400, "Accommodation is held for a guest from the waitlist")
+	}
+	prices, erro := r.repo.NightlyPrices(ctx, reservation.AccommodationID, reservation.DateRange)
+	if erro != nil {
 		r.logger.LogError("reservationsService", erro.Message)
-		return nil, errors.NewReservationError(500, "Unable to create reservation: "+insertErr.Error())
+		return nil, erro
+	}
+	reservation.Price = stayPrice(prices, reservation.DateRange, reservation.Guests, accommodation)
+	return holdEntry, nil
+}
+
+// reservationCreated completes a stored reservation: the waitlist hold it used is fulfilled,
+// the jobs of the stay are scheduled, the host and the guest are notified and the reservation
+// is counted in the metrics.
+func (r ReservationService) reservationCreated(ctx context.Context, createdReservation *domain.Reservation, holdEntry *gocql.UUID) {
+	if holdEntry != nil {
+		r.waitlist.Fulfill(ctx, createdReservation.AccommodationID, *holdEntry)
+	}
+	r.scheduleStayJobs(ctx, createdReservation)
+	r.notification.SendReservationCreatedNotification(ctx, createdReservation.HostID,
+		fmt.Sprintf("Reservation successfully created for %s", createdReservation.Guests))
+	if confirmation, err := r.renderDocument(ctx, createdReservation, domain.DocumentConfirmation, domain.DocumentFormatPDF); err == nil {
+		r.notification.SendReservationConfirmation(ctx, createdReservation.UserID,
+			fmt.Sprintf("Your reservation at %s from %s to %s is confirmed", createdReservation.AccommodationName, createdReservation.StartDate, createdReservation.EndDate),
+			confirmation)
 	}
-	r.notification.SendReservationCreatedNotification(ctx, reservation.HostID, "Reservation successfully created")
 
 	r.logger.LogInfo("reservationsService", fmt.Sprintf("Reservation created: %v", createdReservation))
-	r.metricClient.SendReserved(ctx, createdReservation.UserID, createdReservation.AccommodationID)
-	return createdReservation, nil
+	r.metricClient.SendReserved(ctx, createdReservation.UserID, createdReservation.AccommodationID, createdReservation.Guests)
+}
+
+// stayPrice sums the nightly prices of a stay. Accommodations paid per guest charge every night
+// once for each adult and child, reservations made before guests were recorded count as one guest.
+func stayPrice(prices map[string]int, dateRange []string, guests domain.Guests, accommodation *domain.Accommodation) int {
+	total := 0
+	for _, date := range dateRange {
+		total += prices[date]
+	}
+	if accommodation.Paying == domain.PayingPerGuest && guests.Visitors() > 1 {
+		total *= guests.Visitors()
+	}
+	return total
 }
 
 func (r ReservationService) CreateAvailability(ctx context.Context, reservation domain.FreeReservation) (*domain.FreeReservation, *errors.ReservationError) {
@@ -87,30 +179,116 @@ func (r ReservationService) CreateAvailability(ctx context.Context, reservation
 	return createdAvailability, nil
 }
 
-func (s *ReservationService) GetReservationsByUser(ctx context.Context, userID string) ([]domain.Reservation, *errors.ReservationError) {
+func (s *ReservationService) GetReservationsByUser(ctx context.Context, userID string, filter domain.ReservationFilter) (*domain.ReservationPage, *errors.ReservationError) {
 	ctx, span := s.tracer.Start(ctx, "ReservationService.GetReservationsByUser")
 	defer span.End()
 
-	reservations, err := s.repo.GetReservationsByUser(ctx, userID)
+	today := time.Now().Format(dateLayout)
+	reservations, nextPageState, err := s.repo.GetReservationsByUser(ctx, userID, filter, today)
 	if err != nil {
 		s.logger.LogError("reservationsService", err.Error())
 
 		return nil, errors.NewReservationError(500, err.Error())
 	}
-	s.logger.LogInfo("reservationsService", fmt.Sprintf("Found reservations by user: %v", reservations))
-	return reservations, nil
+	page := reservationPage(reservations, filter, nextPageState, today)
+	s.logger.LogInfo("reservationsService", fmt.Sprintf("Found %d reservations by user %s", len(page.Reservations), userID))
+	return page, nil
 }
-func (s *ReservationService) GetReservationsByHost(ctx context.Context, hostID string) ([]domain.Reservation, *errors.ReservationError) {
+func (s *ReservationService) GetReservationsByHost(ctx context.Context, hostID string, filter domain.ReservationFilter) (*domain.ReservationPage, *errors.ReservationError) {
 	ctx, span := s.tracer.Start(ctx, "ReservationService.GetReservationsByHost")
 	defer span.End()
 
-	reservations, err := s.repo.GetReservationsByHost(ctx, hostID)
+	today := time.Now().Format(dateLayout)
+	reservations, nextPageState, err := s.repo.GetReservationsByHost(ctx, hostID, filter, today)
 	if err != nil {
 		s.logger.LogError("reservationsService", err.Error())
 		return nil, errors.NewReservationError(500, err.Error())
 	}
-	s.logger.LogInfo("reservationsService", fmt.Sprintf("Found reservations by host: %v", reservations))
-	return reservations, nil
+	page := reservationPage(reservations, filter, nextPageState, today)
+	s.logger.LogInfo("reservationsService", fmt.Sprintf("Found %d reservations by host %s", len(page.Reservations), hostID))
+	return page, nil
+}
+
+// HasOpenReservations tells whether the user still has a stay that is not over, as a guest or
+// as the host of the accommodation, depending on the role.
+func (s *ReservationService) HasOpenReservations(ctx context.Context, userID, role string) (bool, *errors.ReservationError) {
+	ctx, span := s.tracer.Start(ctx, "ReservationService.HasOpenReservations")
+	defer span.End()
+	filter := domain.ReservationFilter{From: time.Now().Format(dateLayout), Size: 1}
+	var page *domain.ReservationPage
+	var err *errors.ReservationError
+	if role == "Guest" {
+		page, err = s.GetReservationsByUser(ctx, userID, filter)
+	} else {
+		page, err = s.GetReservationsByHost(ctx, userID, filter)
+	}
+	if err != nil {
+		return false, err
+	}
+	// A filtered page can come back empty before the last page, only the last one settles it.
+	for len(page.Reservations) == 0 && len(page.NextPageState) > 0 {
+		filter.PageState = page.NextPageState
+		if role == "Guest" {
+			page, err = s.GetReservationsByUser(ctx, userID, filter)
+		} else {
+			page, err = s.GetReservationsByHost(ctx, userID, filter)
+		}
+		if err != nil {
+			return false, err
+		}
+	}
+	return len(page.Reservations) > 0, nil
+}
+
+// reservationPage sets the stay status of the reservations the filter found. A full list is
+// sorted by check-in, the latest first, a page keeps the order it was read in so the next page
+// follows on.
+func reservationPage(reservations []domain.Reservation, filter domain.ReservationFilter, nextPageState []byte, today string) *domain.ReservationPage {
+	for i := range reservations {
+		reservations[i].Status = reservations[i].StayStatus(today)
+	}
+	if filter.Size == 0 {
+		sort.SliceStable(reservations, func(i, j int) bool {
+			return reservations[i].StartDate > reservations[j].StartDate
+		})
+	}
+	return &domain.ReservationPage{Reservations: reservations, Size: filter.Size, NextPageState: nextPageState}
+}
+
+// GetReservationDocument renders the confirmation or the invoice of one of the guest's
+// reservations.
+func (s *ReservationService) GetReservationDocument(ctx context.Context, userID, id, kind, format string) (*domain.Document, *errors.ReservationError) {
+	ctx, span := s.tracer.Start(ctx, "ReservationService.GetReservationDocument")
+	defer span.End()
+	reservation, err := s.repo.GetReservationByUserAndId(ctx, userID, id)
+	if err != nil {
+		s.logger.LogError("reservationsService", err.Message)
+		return nil, err
+	}
+	return s.renderDocument(ctx, reservation, kind, format)
+}
+
+func (s *ReservationService) renderDocument(ctx context.Context, reservation *domain.Reservation, kind, format string) (*domain.Document, *errors.ReservationError) {
+	payment := reservation.Payment
+	if payment == nil {
+		var err *errors.ReservationError
+		payment, err = s.payments.GetPayment(ctx, reservation.Id.String())
+		if err != nil && err.Status != 404 {
+			s.logger.LogError("reservationsService", err.Message)
+			return nil, err
+		}
+	}
+	rendered, renderErr := document.Render(kind, format, document.Booking{
+		Reservation: reservation,
+		Payment:     payment,
+		Currency:    s.payments.Currency(),
+		IssuedAt:    time.Now(),
+	})
+	if renderErr != nil {
+		s.logger.LogError("reservationsService", renderErr.Error())
+		return nil, errors.NewReservationError(500, "Unable to render document")
+	}
+	return rendered, nil
 }
 
 func (s *ReservationService) ProcessDateRange(ctx context.Context, accommodationIDs []string, dateRange []string) ([]string, *errors.ReservationError) {
@@ -180,15 +358,32 @@ func (s *ReservationService) GetAvailabilityForAccommodation(ctx context.Context
 	return avl, nil
 }
 
-func (s *ReservationService) DeleteReservationById(ctx context.Context, country string, id, userID, hostID, accommodationID, endDate string) (*domain.Reservation, *errors.ReservationError) {
+// DeleteReservationById cancels a reservation of the user. Reservations of other users are not
+// found, so they are neither canceled nor refunded.
+func (s *ReservationService) DeleteReservationById(ctx context.Context, userID, id string) (*domain.Reservation, *errors.ReservationError) {
 	ctx, span := s.tracer.Start(ctx, "ReservationService.DeleteReservationById")
 	defer span.End()
-	deletedReservation, err := s.repo.DeleteById(ctx, country, id, userID, hostID, accommodationID, endDate)
+	reservationID, parseErr := gocql.ParseUUID(id)
+	if parseErr != nil {
+		return nil, errors.NewReservationError(400, "Invalid reservation id")
+	}
+	reservation, err := s.repo.GetReservationByUserAndId(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+	deletedReservation, err := s.repo.DeleteById(ctx, reservation.Country, id, userID, reservation.HostID, reservation.AccommodationID, reservation.EndDate)
 	if err != nil {
 		s.logger.LogError("reservationsService", err.Error())
 		return nil, errors.NewReservationError(500, err.Error())
 	}
-	s.notification.SendReservationCanceledNotification(ctx, hostID, "Reservation canceled!")
+	// The reservation is gone before the money goes back, so a failed cancellation never leaves
+	// a refunded reservation behind. A refund that fails now is retried by a job.
+	if refundErr := s.payments.Refund(ctx, reservationID); refundErr != nil {
+		s.logger.LogError("reservationsService", fmt.Sprintf("Unable to refund canceled reservation %s, retrying later: %s", id, refundErr.Message))
+		s.payments.RetryRefund(ctx, reservationID)
+	}
+	s.notification.SendReservationCanceledNotification(ctx, reservation.HostID, "Reservation canceled!")
+	s.waitlist.Offer(ctx, reservation.AccommodationID, deletedReservation.DateRange)
 	s.logger.LogInfo("reservationsService", fmt.Sprintf("Deleted reservations by id: %v", deletedReservation))
 	return deletedReservation, nil
 }
@@ -220,6 +415,27 @@ func (s *ReservationService) IsReserved(ctx context.Context, accommodationID str
 	return available, nil
 }
 
+func (s *ReservationService) IsBlocked(ctx context.Context, accommodationID string, dateRange []string) (bool, *errors.ReservationError) {
+	ctx, span := s.tracer.Start(ctx, "ReservationService.IsBlocked")
+	defer span.End()
+	dates, err := sortedDates(dateRange)
+	if err != nil {
+		return false, err
+	}
+	blockedDates, err := s.repo.GetBlockedDates(ctx, accommodationID, dates[0], dates[len(dates)-1])
+	if err != nil {
+		s.logger.LogError("reservationsService", err.Error())
+		return false, errors.NewReservationError(500, "Accommodation not available")
+	}
+	wanted := toSet(dates)
+	for _, block := range blockedDates {
+		if _, ok := wanted[block.Date]; ok {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
 func (s *ReservationService) getNumberOfCanceledReservations(ctx context.Context, hostID string) (int, *errors.ReservationError) {
 	ctx, span := s.tracer.Start(ctx, "ReservationService.getNumberOfCanceledReservations")
 	defer span.End()
@@ -295,33 +511,223 @@ func (s *ReservationService) DeleteAvl(ctx context.Context, accommodationID, id,
 	return deletedAvl, nil
 }
 
-func (s *ReservationService) UpdateAvailability(ctx context.Context, accommodationID, id, country string, price int, reservation *domain.FreeReservation) (*domain.FreeReservation, *errors.ReservationError) {
-	ctx, span := s.tracer.Start(ctx, "ReservationService.UpdateAvailability")
+func (s *ReservationService) GetAccommodationIDsByMaxPrice(ctx context.Context, maxPrice int) ([]string, *errors.ReservationError) {
+	ctx, span := s.tracer.Start(ctx, "ReservationService.GetAccommodationIDsByMaxPrice")
 	defer span.End()
-	s.logger.LogInfo("reservationService", fmt.Sprintf("Vrednost: %v", reservation))
-	_, err := s.repo.DeleteAvl(ctx, accommodationID, id, country, price)
+	accommodations, err := s.repo.GetAccommodationIDsByMaxPrice(ctx, maxPrice)
 	if err != nil {
 		s.logger.LogError("reservationsService", err.Error())
 		return nil, errors.NewReservationError(500, err.Error())
 	}
+	s.logger.LogInfo("reservationsService", fmt.Sprintf("Found accommodations by price: %v", accommodations))
+	return accommodations, nil
+}
+
+func (s *ReservationService) ModifyReservation(ctx context.Context, request domain.ModifyReservationRequest) (*domain.ReservationModification, *errors.ReservationError) {
+	ctx, span := s.tracer.Start(ctx, "ReservationService.ModifyReservation")
+	defer span.End()
+	if len(request.DateRange) == 0 && request.Guests == nil {
+		return nil, errors.NewReservationError(400, "Date range or guests must be provided")
+	}
+	if len(request.DateRange) > 0 {
+		if validationErrors := s.validator.ValidateDateRange(request.DateRange); len(validationErrors) > 0 {
+			return nil, errors.NewReservationErrorWithDetails(400, "Validation failed", validationErrors)
+		}
+	}
+	existing, err := s.repo.GetReservationByUserAndId(ctx, request.UserID, request.Id)
+	if err != nil {
+		s.logger.LogError("reservationsService", err.Error())
+		return nil, err
+	}
+	if !existing.IsActive {
+		return nil, errors.NewReservationError(400, "Only active reservations can be modified")
+	}
+	dateRange := existing.DateRange
+	if len(request.DateRange) > 0 {
+		dateRange = request.DateRange
+	}
+	guests := existing.Guests
+	accommodation, err := s.accommodations.GetAccommodation(ctx, existing.AccommodationID)
+	if err != nil {
+		s.logger.LogError("reservationsService", err.Message)
+		return nil, err
+	}
+	if request.Guests != nil {
+		if validationErrors := s.validator.ValidateGuests(*request.Guests, accommodation); len(validationErrors) > 0 {
+			return nil, errors.NewReservationErrorWithDetails(400, "Validation failed", validationErrors)
+		}
+		guests = *request.Guests
+	}
+
+	heldNights := make(map[string]struct{}, len(existing.DateRange))
+	for _, date := range existing.DateRange {
+		heldNights[date] = struct{}{}
+	}
+	var newNights []string
+	for _, date := range dateRange {
+		if _, held := heldNights[date]; !held {
+			newNights = append(newNights, date)
+		}
+	}
+
+	prices, err := s.repo.NightlyPrices(ctx, existing.AccommodationID, dateRange)
+	if err != nil {
+		s.logger.LogError("reservationsService", err.Error())
+		return nil, err
+	}
+	for _, date := range dateRange {
+		if _, ok := prices[date]; !ok {
+			return nil, errors.NewReservationError(400, "Accommodation not available for the specified date range")
+		}
+	}
+	newPrice := stayPrice(prices, dateRange, guests, accommodation)
+
+	if len(newNights) > 0 {
+		reserved, err := s.repo.IsReserved(ctx, existing.AccommodationID, newNights)
+		if err != nil {
+			s.logger.LogError("reservationsService", err.Error())
+			return nil, err
+		}
+		if reserved {
+			return nil, errors.NewReservationError(400, "Accommodation not available for the specified date range")
+		}
+		blocked, err := s.IsBlocked(ctx, existing.AccommodationID, newNights)
+		if err != nil {
+			return nil, err
+		}
+		if blocked {
+			return nil, errors.NewReservationError(400, "Accommodation not available for the specified date range")
+		}
+		held, _, err := s.waitlist.HeldFor(ctx, existing.AccommodationID, newNights, existing.UserID)
+		if err != nil {
+			return nil, err
+		}
+		if held {
+			return nil, errors.NewReservationError(400, "Accommodation is held for a guest from the waitlist")
+		}
+	}
 
-	updatedReservation, err := s.repo.InsertAvailability(ctx, reservation)
+	updated := *existing
+	updated.DateRange = dateRange
+	updated.NumberOfDays = len(dateRange)
+	updated.Price = newPrice
+	updated.Guests = guests
+	// The payment follows the new price and check-in. A higher price is authorized before the
+	// reservation changes, and the payment is only changed once the reservation was.
+	change, err := s.payments.PrepareChange(ctx, &updated, request.PaymentToken)
+	if err != nil {
+		return nil, err
+	}
+	modified, err := s.repo.UpdateReservation(ctx, existing, &updated)
 	if err != nil {
 		s.logger.LogError("reservationsService", err.Error())
-		return nil, errors.NewReservationError(500, "Unable to update availability!")
+		if change != nil {
+			s.payments.DiscardChange(ctx, change)
+		}
+		return nil, err
 	}
-	s.logger.LogInfo("reservationsService", fmt.Sprintf("Updated availability by ID: %v", updatedReservation))
-	return updatedReservation, nil
+	if change != nil {
+		changedPayment, err := s.payments.ApplyChange(ctx, change)
+		if err != nil {
+			if _, revertErr := s.repo.UpdateReservation(ctx, modified, existing); revertErr != nil {
+				s.logger.LogError("reservationsService", fmt.Sprintf("Reservation %s was modified but its payment wasn't, and it couldn't be put back: %s",
+					existing.Id, revertErr.Message))
+			}
+			return nil, err
+		}
+		modified.Payment = changedPayment
+	}
+	s.notification.SendReservationModifiedNotification(ctx, existing.HostID,
+		fmt.Sprintf("Reservation modified for %s", guests))
+	if freed := subtract(existing.DateRange, dateRange); len(freed) > 0 {
+		s.waitlist.Offer(ctx, existing.AccommodationID, freed)
+	}
+	if modified.StartDate != existing.StartDate || modified.EndDate != existing.EndDate {
+		s.scheduleStayJobs(ctx, modified)
+	}
+
+	s.logger.LogInfo("reservationsService", fmt.Sprintf("Reservation modified: %v", modified))
+	return &domain.ReservationModification{
+		Reservation:     modified,
+		OldPrice:        existing.Price,
+		NewPrice:        newPrice,
+		PriceDifference: newPrice - existing.Price,
+	}, nil
 }
 
-func (s *ReservationService) GetAccommodationIDsByMaxPrice(ctx context.Context, maxPrice int) ([]string, *errors.ReservationError) {
-	ctx, span := s.tracer.Start(ctx, "ReservationService.GetAccommodationIDsByMaxPrice")
+func (s *ReservationService) GetAvailabilityCalendar(ctx context.Context, accommodationID, month string, months int) (*domain.AvailabilityCalendar, *errors.ReservationError) {
+	ctx, span := s.tracer.Start(ctx, "ReservationService.GetAvailabilityCalendar")
 	defer span.End()
-	accommodations, err := s.repo.GetAccommodationIDsByMaxPrice(ctx, maxPrice)
+	start := time.Now().UTC()
+	if month != "" {
+		parsed, err := time.Parse("2006-01", month)
+		if err != nil {
+			return nil, errors.NewReservationError(400, "Month must be in YYYY-MM format")
+		}
+		start = parsed
+	}
+	if months < 1 || months > 12 {
+		return nil, errors.NewReservationError(400, "Number of months must be between 1 and 12")
+	}
+	start = time.Date(start.Year(), start.Month(), 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, months, -1)
+	from := start.Format("2006-01-02")
+	to := end.Format("2006-01-02")
+
+	freeRanges, err := s.repo.CheckAvailabilityForAccommodation(ctx, accommodationID)
 	if err != nil {
 		s.logger.LogError("reservationsService", err.Error())
-		return nil, errors.NewReservationError(500, err.Error())
+		return nil, err
 	}
-	s.logger.LogInfo("reservationsService", fmt.Sprintf("Found accommodations by price: %v", accommodations))
-	return accommodations, nil
+	prices := make(map[string]int)
+	for _, freeRange := range freeRanges {
+		for _, date := range freeRange.DateRange {
+			prices[date] = freeRange.Price
+		}
+	}
+
+	reservedDates, err := s.repo.GetReservedDates(ctx, accommodationID)
+	if err != nil {
+		s.logger.LogError("reservationsService", err.Error())
+		return nil, err
+	}
+	booked := make(map[string]struct{}, len(reservedDates))
+	for _, date := range reservedDates {
+		booked[date] = struct{}{}
+	}
+
+	blockedDates, err := s.repo.GetBlockedDates(ctx, accommodationID, from, to)
+	if err != nil {
+		s.logger.LogError("reservationsService", err.Error())
+		return nil, err
+	}
+	blocked := make(map[string]struct{}, len(blockedDates))
+	for _, block := range blockedDates {
+		blocked[block.Date] = struct{}{}
+	}
+
+	held, err := s.repo.GetHolds(ctx, accommodationID, from, to)
+	if err != nil {
+		s.logger.LogError("reservationsService", err.Error())
+		return nil, err
+	}
+
+	calendar := &domain.AvailabilityCalendar{AccommodationID: accommodationID, From: from, To: to}
+	for day := start; !day.After(end); day = day.AddDate(0, 0, 1) {
+		date := day.Format("2006-01-02")
+		price, offered := prices[date]
+		calendarDay := domain.CalendarDay{Date: date, Price: price}
+		if _, ok := booked[date]; ok {
+			calendarDay.Status = domain.DayBooked
+		} else if _, ok := blocked[date]; ok || !offered {
+			calendarDay.Status = domain.DayBlocked
+		} else if _, ok := held[date]; ok {
+			calendarDay.Status = domain.DayHeld
+		} else {
+			calendarDay.Status = domain.DayAvailable
+		}
+		calendar.Days = append(calendar.Days, calendarDay)
+	}
+	s.logger.LogInfo("reservationsService", fmt.Sprintf("Built availability calendar for accommodationID %s from %s to %s", accommodationID, from, to))
+	return calendar, nil
 }
@@ -0,0 +1,262 @@
+package service
+
+import (
+	"context"
+	"reservation-service/config"
+	"reservation-service/domain"
+	"reservation-service/errors"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gocql/gocql"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// memoryStore keeps payments, webhook events, ledger entries, jobs, reserved and blocked nights
+// and calendar feeds in memory, with the conditional writes of ReservationRepo.
+type memoryStore struct {
+	mu             sync.Mutex
+	payments       map[gocql.UUID]domain.Payment
+	webhookEvents  map[string]bool
+	ledger         map[gocql.UUID]domain.LedgerEntry
+	ledgerVersions map[string]int
+	jobs           []string
+	reserved       map[string][]string
+	// blocked holds the reason of every blocked night by accommodation and date.
+	blocked map[string]map[string]string
+	feeds   map[string]domain.CalendarFeed
+	// failLedger fails the next ledger writes, as many as it counts.
+	failLedger int
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{
+		payments:       make(map[gocql.UUID]domain.Payment),
+		webhookEvents:  make(map[string]bool),
+		ledger:         make(map[gocql.UUID]domain.LedgerEntry),
+		ledgerVersions: make(map[string]int),
+		reserved:       make(map[string][]string),
+		blocked:        make(map[string]map[string]string),
+		feeds:          make(map[string]domain.CalendarFeed),
+	}
+}
+
+func (ms *memoryStore) SavePayment(ctx context.Context, payment *domain.Payment) *errors.ReservationError {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	ms.payments[payment.ReservationID] = *payment
+	return nil
+}
+
+func (ms *memoryStore) UpdatePayment(ctx context.Context, payment *domain.Payment, from string) (bool, *errors.ReservationError) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	stored, ok := ms.payments[payment.ReservationID]
+	if !ok || stored.Status != from {
+		return false, nil
+	}
+	ms.payments[payment.ReservationID] = *payment
+	return true, nil
+}
+
+func (ms *memoryStore) GetPayment(ctx context.Context, reservationID gocql.UUID) (*domain.Payment, *errors.ReservationError) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	stored, ok := ms.payments[reservationID]
+	if !ok {
+		return nil, errors.NewReservationError(404, "Payment not found")
+	}
+	return &stored, nil
+}
+
+func (ms *memoryStore) GetPaymentByAuthorization(ctx context.Context, authorizationID string) (*domain.Payment, *errors.ReservationError) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	for _, stored := range ms.payments {
+		if stored.AuthorizationID == authorizationID {
+			return &stored, nil
+		}
+	}
+	return nil, errors.NewReservationError(404, "Payment not found")
+}
+
+func (ms *memoryStore) ChangePayment(ctx context.Context, payment *domain.Payment, previous *domain.Payment) (bool, *errors.ReservationError) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	stored, ok := ms.payments[payment.ReservationID]
+	if !ok || stored.Status != domain.PaymentAuthorized || stored.AuthorizationID != previous.AuthorizationID {
+		return false, nil
+	}
+	stored.Amount = payment.Amount
+	stored.AuthorizationID = payment.AuthorizationID
+	stored.CheckIn = payment.CheckIn
+	stored.UpdatedAt = payment.UpdatedAt
+	ms.payments[payment.ReservationID] = stored
+	return true, nil
+}
+
+func (ms *memoryStore) GetDueCaptures(ctx context.Context, months []string, today string) ([]gocql.UUID, *errors.ReservationError) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	var due []gocql.UUID
+	for id, stored := range ms.payments {
+		if (stored.Status == domain.PaymentAuthorized || stored.Status == domain.PaymentCapturedUnrecorded) && stored.CheckIn <= today {
+			due = append(due, id)
+		}
+	}
+	return due, nil
+}
+
+func (ms *memoryStore) ClaimWebhookEvent(ctx context.Context, eventID string) (bool, *errors.ReservationError) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if ms.webhookEvents[eventID] {
+		return false, nil
+	}
+	ms.webhookEvents[eventID] = true
+	return true, nil
+}
+
+func (ms *memoryStore) ReleaseWebhookEvent(ctx context.Context, eventID string) *errors.ReservationError {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	delete(ms.webhookEvents, eventID)
+	return nil
+}
+
+// InsertLedgerTransactions upserts the entries by id, like Cassandra does.
+func (ms *memoryStore) InsertLedgerTransactions(ctx context.Context, entries []domain.LedgerEntry) *errors.ReservationError {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if ms.failLedger > 0 {
+		ms.failLedger--
+		return errors.NewReservationError(500, "Unable to write ledger entries, database error")
+	}
+	for _, entry := range entries {
+		ms.ledger[entry.EntryID] = entry
+	}
+	return nil
+}
+
+func (ms *memoryStore) InsertLedgerPayout(ctx context.Context, entries []domain.LedgerEntry, version int) (bool, int, *errors.ReservationError) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if len(entries) == 0 {
+		return false, 0, errors.NewReservationError(500, "No payout entries")
+	}
+	hostID := entries[0].HostID
+	if current := ms.ledgerVersions[hostID]; current != version {
+		return false, current, nil
+	}
+	for _, entry := range entries {
+		ms.ledger[entry.EntryID] = entry
+	}
+	ms.ledgerVersions[hostID] = version + 1
+	return true, version + 1, nil
+}
+
+func (ms *memoryStore) GetLedgerVersion(ctx context.Context, hostID string) (int, *errors.ReservationError) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	return ms.ledgerVersions[hostID], nil
+}
+
+func (ms *memoryStore) GetLedgerEntries(ctx context.Context, hostID string, from, to time.Time) ([]domain.LedgerEntry, *errors.ReservationError) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	var entries []domain.LedgerEntry
+	for _, entry := range ms.ledger {
+		entry.CreatedAt = entry.EntryID.Time()
+		if entry.HostID != hostID || (!from.IsZero() && entry.CreatedAt.Before(from)) || (!to.IsZero() && entry.CreatedAt.After(to)) {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].CreatedAt.Before(entries[j].CreatedAt) })
+	return entries, nil
+}
+
+func (ms *memoryStore) Schedule(ctx context.Context, kind string, runAt time.Time, payload interface{}) *errors.ReservationError {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	ms.jobs = append(ms.jobs, kind)
+	return nil
+}
+
+func (ms *memoryStore) GetReservedDates(ctx context.Context, accommodationID string) ([]string, *errors.ReservationError) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	return append([]string(nil), ms.reserved[accommodationID]...), nil
+}
+
+func (ms *memoryStore) GetBlockedDates(ctx context.Context, accommodationID, from, to string) ([]domain.BlockedDate, *errors.ReservationError) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	var blocks []domain.BlockedDate
+	for date, reason := range ms.blocked[accommodationID] {
+		if date >= from && date <= to {
+			blocks = append(blocks, domain.BlockedDate{AccommodationID: accommodationID, Date: date, Reason: reason})
+		}
+	}
+	sort.Slice(blocks, func(i, j int) bool { return blocks[i].Date < blocks[j].Date })
+	return blocks, nil
+}
+
+func (ms *memoryStore) InsertBlockedDates(ctx context.Context, accommodationID string, dates []string, reason string) *errors.ReservationError {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if ms.blocked[accommodationID] == nil {
+		ms.blocked[accommodationID] = make(map[string]string)
+	}
+	for _, date := range dates {
+		ms.blocked[accommodationID][date] = reason
+	}
+	return nil
+}
+
+func (ms *memoryStore) DeleteBlockedDates(ctx context.Context, accommodationID string, dates []string) *errors.ReservationError {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	for _, date := range dates {
+		delete(ms.blocked[accommodationID], date)
+	}
+	return nil
+}
+
+func (ms *memoryStore) SaveCalendarFeed(ctx context.Context, feed domain.CalendarFeed) *errors.ReservationError {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	ms.feeds[feed.AccommodationID] = feed
+	return nil
+}
+
+func (ms *memoryStore) GetCalendarFeeds(ctx context.Context) ([]domain.CalendarFeed, *errors.ReservationError) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	var feeds []domain.CalendarFeed
+	for _, feed := range ms.feeds {
+		feeds = append(feeds, feed)
+	}
+	return feeds, nil
+}
+
+func (ms *memoryStore) payment(t *testing.T, reservationID gocql.UUID) domain.Payment {
+	t.Helper()
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	stored, ok := ms.payments[reservationID]
+	if !ok {
+		t.Fatalf("payment of reservation %s not stored", reservationID)
+	}
+	return stored
+}
+
+func newTestLogger(t *testing.T) *config.Logger {
+	return config.NewLogger(t.TempDir() + "/test.log")
+}
+
+func newTestTracer() trace.Tracer {
+	return trace.NewNoopTracerProvider().Tracer("test")
+}
@@ -0,0 +1,260 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"reservation-service/config"
+	"reservation-service/domain"
+	"reservation-service/errors"
+	"reservation-service/repository"
+	"reservation-service/utils"
+	"time"
+
+	"github.com/gocql/gocql"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TripService books several accommodations as one trip. Every leg passes the same checks as a
+// single reservation, and the legs are only stored once all of them passed and all payments
+// are authorized.
+type TripService struct {
+	repo         *repository.ReservationRepo
+	reservations *ReservationService
+	payments     *PaymentService
+	logger       *config.Logger
+	tracer       trace.Tracer
+}
+
+func NewTripService(repo *repository.ReservationRepo, reservations *ReservationService, payments *PaymentService, logger *config.Logger, tracer trace.Tracer) *TripService {
+	return &TripService{repo: repo, reservations: reservations, payments: payments, logger: logger, tracer: tracer}
+}
+
+// Quote prices a trip without booking it.
+func (ts *TripService) Quote(ctx context.Context, userID string, request domain.TripRequest) (*domain.TripQuote, *errors.ReservationError) {
+	ctx, span := ts.tracer.Start(ctx, "TripService.Quote")
+	defer span.End()
+	_, quote, _, err := ts.prepare(ctx, userID, request)
+	if err != nil {
+		return nil, err
+	}
+	return quote, nil
+}
+
+// CreateTrip reserves every leg of the trip or none of them. A payment is authorized for each
+// leg, so legs can be captured and refunded on their own, and all of them are voided if the
+// trip can't be completed.
+func (ts *TripService) CreateTrip(ctx context.Context, userID string, request domain.TripRequest) (*domain.Trip, *errors.ReservationError) {
+	ctx, span := ts.tracer.Start(ctx, "TripService.CreateTrip")
+	defer span.End()
+	reservations, quote, holdEntries, err := ts.prepare(ctx, userID, request)
+	if err != nil {
+		return nil, err
+	}
+	tripID, _ := gocql.RandomUUID()
+	trip := &domain.Trip{Id: tripID, UserID: userID, Legs: quote.Legs, Price: quote.Total, CreatedAt: time.Now().UTC()}
+
+	var authorized []*domain.Payment
+	voidAll := func() {
+		for _, p := range authorized {
+			ts.payments.Void(ctx, p)
+		}
+	}
+	for i, reservation := range reservations {
+		reservation.Id, _ = gocql.RandomUUID()
+		authorizedPayment, err := ts.payments.Authorize(ctx, reservation)
+		if err != nil {
+			voidAll()
+			return nil, errors.NewReservationError(err.Status, fmt.Sprintf("Leg %d: %s", i+1, err.Message))
+		}
+		reservation.PaymentToken = ""
+		authorized = append(authorized, authorizedPayment)
+	}
+	// Nights taken by another booking since prepare checked them fail the trip, its payments
+	// are voided.
+	if err := ts.repo.InsertTrip(ctx, trip, reservations); err != nil {
+		voidAll()
+		return nil, err
+	}
+	for i, reservation := range reservations {
+		reservation.Payment = authorized[i]
+		trip.Legs[i].Payment = authorized[i]
+		ts.reservations.reservationCreated(ctx, reservation, holdEntries[i])
+	}
+	ts.logger.LogInfo("tripService", fmt.Sprintf("Trip %s created for user %s with %d legs", trip.Id, userID, len(trip.Legs)))
+	return trip, nil
+}
+
+func (ts *TripService) GetTrip(ctx context.Context, userID, id string) (*domain.Trip, *errors.ReservationError) {
+	ctx, span := ts.tracer.Start(ctx, "TripService.GetTrip")
+	defer span.End()
+	tripID, parseErr := gocql.ParseUUID(id)
+	if parseErr != nil {
+		return nil, errors.NewReservationError(400, "Invalid trip id")
+	}
+	trip, err := ts.repo.GetTrip(ctx, tripID)
+	if err != nil {
+		return nil, err
+	}
+	if trip.UserID != userID {
+		return nil, errors.NewReservationError(404, "Trip not found")
+	}
+	return trip, nil
+}
+
+func (ts *TripService) GetTripsByUser(ctx context.Context, userID string) ([]domain.Trip, *errors.ReservationError) {
+	ctx, span := ts.tracer.Start(ctx, "TripService.GetTripsByUser")
+	defer span.End()
+	return ts.repo.GetTripsByUser(ctx, userID)
+}
+
+// CancelLeg cancels one reservation of a trip the way a single reservation is canceled, the
+// other legs stay booked.
+func (ts *TripService) CancelLeg(ctx context.Context, userID, id, reservationID string) (*domain.Trip, *errors.ReservationError) {
+	ctx, span := ts.tracer.Start(ctx, "TripService.CancelLeg")
+	defer span.End()
+	trip, err := ts.GetTrip(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := ts.cancelLegOf(ctx, trip, reservationID); err != nil {
+		return nil, err
+	}
+	return trip, nil
+}
+
+// CancelPendingTrips cancels the legs of a deleted user's trips that haven't started yet. Legs
+// that started or are over stay as they are.
+func (ts *TripService) CancelPendingTrips(ctx context.Context, userID string) *errors.ReservationError {
+	ctx, span := ts.tracer.Start(ctx, "TripService.CancelPendingTrips")
+	defer span.End()
+	trips, err := ts.repo.GetTripsByUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	today := time.Now().UTC().Format(dateLayout)
+	for i := range trips {
+		trip := &trips[i]
+		for _, leg := range trip.Legs {
+			if leg.Status != domain.TripLegActive || len(leg.DateRange) == 0 || leg.DateRange[0] <= today {
+				continue
+			}
+			if _, err := ts.cancelLegOf(ctx, trip, leg.ReservationID.String()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// cancelLegOf cancels the reservation of a leg of the trip and marks the leg canceled.
+func (ts *TripService) cancelLegOf(ctx context.Context, trip *domain.Trip, reservationID string) (*domain.Reservation, *errors.ReservationError) {
+	var leg *domain.TripLeg
+	for i := range trip.Legs {
+		if trip.Legs[i].ReservationID.String() == reservationID {
+			leg = &trip.Legs[i]
+		}
+	}
+	if leg == nil {
+		return nil, errors.NewReservationError(404, "Trip leg not found")
+	}
+	if leg.Status != domain.TripLegActive {
+		return nil, errors.NewReservationError(400, "Trip leg is already canceled")
+	}
+	deletedReservation, err := ts.reservations.DeleteReservationById(ctx, trip.UserID, reservationID)
+	if err != nil {
+		return nil, err
+	}
+	if err := ts.repo.UpdateTripLegStatus(ctx, trip.Id, leg.ReservationID, domain.TripLegCanceled); err != nil {
+		return nil, err
+	}
+	leg.Status = domain.TripLegCanceled
+	trip.Price = trip.ActivePrice()
+	ts.logger.LogInfo("tripService", fmt.Sprintf("Canceled leg %s of trip %s", reservationID, trip.Id))
+	return deletedReservation, nil
+}
+
+// CancelReservation cancels a reservation of the user. A reservation booked as part of a trip is
+// canceled as a leg of the trip, so the trip shows it canceled.
+func (ts *TripService) CancelReservation(ctx context.Context, userID, id string) (*domain.Reservation, *errors.ReservationError) {
+	ctx, span := ts.tracer.Start(ctx, "TripService.CancelReservation")
+	defer span.End()
+	reservationID, parseErr := gocql.ParseUUID(id)
+	if parseErr != nil {
+		return nil, errors.NewReservationError(400, "Invalid reservation id")
+	}
+	tripID, err := ts.repo.GetTripIDByReservation(ctx, reservationID)
+	if err != nil {
+		return nil, err
+	}
+	if tripID == nil {
+		return ts.reservations.DeleteReservationById(ctx, userID, id)
+	}
+	trip, err := ts.GetTrip(ctx, userID, tripID.String())
+	if err != nil {
+		return nil, err
+	}
+	return ts.cancelLegOf(ctx, trip, id)
+}
+
+// prepare runs the checks of a single reservation on every leg and prices the trip. Legs can't
+// take the same nights of an accommodation twice. Errors name the leg they belong to.
+func (ts *TripService) prepare(ctx context.Context, userID string, request domain.TripRequest) ([]*domain.Reservation, *domain.TripQuote, []*gocql.UUID, *errors.ReservationError) {
+	if len(request.Legs) == 0 || len(request.Legs) > utils.MaxTripLegs {
+		return nil, nil, nil, errors.NewReservationError(400, fmt.Sprintf("A trip must have between 1 and %d legs", utils.MaxTripLegs))
+	}
+	nights := 0
+	for _, leg := range request.Legs {
+		nights += len(leg.DateRange)
+	}
+	if nights > utils.MaxTripNights {
+		return nil, nil, nil, errors.NewReservationError(400, fmt.Sprintf("A trip can't have more than %d nights over all legs", utils.MaxTripNights))
+	}
+	reservations := make([]*domain.Reservation, 0, len(request.Legs))
+	holdEntries := make([]*gocql.UUID, 0, len(request.Legs))
+	quote := &domain.TripQuote{Legs: []domain.TripLeg{}, Currency: ts.payments.Currency()}
+	for i := range request.Legs {
+		reservation := request.Legs[i]
+		reservation.UserID = userID
+		reservation.PaymentToken = request.PaymentToken
+		for _, previous := range reservations {
+			if previous.AccommodationID == reservation.AccommodationID && len(intersect(previous.DateRange, reservation.DateRange)) > 0 {
+				return nil, nil, nil, errors.NewReservationErrorWithDetails(400, "Validation failed",
+					map[string]string{legField(i, "dateRange"): utils.TripLegOverlap})
+			}
+		}
+		holdEntry, err := ts.reservations.prepareReservation(ctx, &reservation)
+		if err != nil {
+			return nil, nil, nil, legError(i, err)
+		}
+		reservations = append(reservations, &reservation)
+		holdEntries = append(holdEntries, holdEntry)
+		quote.Legs = append(quote.Legs, domain.TripLeg{
+			AccommodationID:   reservation.AccommodationID,
+			AccommodationName: reservation.AccommodationName,
+			HostID:            reservation.HostID,
+			DateRange:         reservation.DateRange,
+			Guests:            reservation.Guests,
+			Price:             reservation.Price,
+			Status:            domain.TripLegActive,
+		})
+		quote.Total += reservation.Price
+	}
+	return reservations, quote, holdEntries, nil
+}
+
+func legField(index int, field string) string {
+	return fmt.Sprintf("legs[%d].%s", index, field)
+}
+
+// legError points an error of a single reservation at the leg it came from.
+func legError(index int, err *errors.ReservationError) *errors.ReservationError {
+	details, ok := err.Details.(map[string]string)
+	if !ok {
+		return errors.NewReservationError(err.Status, fmt.Sprintf("Leg %d: %s", index+1, err.Message))
+	}
+	legDetails := make(map[string]string, len(details))
+	for field, message := range details {
+		legDetails[legField(index, field)] = message
+	}
+	return errors.NewReservationErrorWithDetails(err.Status, err.Message, legDetails)
+}
@@ -0,0 +1,338 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"reservation-service/client"
+	"reservation-service/config"
+	"reservation-service/domain"
+	"reservation-service/errors"
+	"reservation-service/repository"
+	"reservation-service/utils"
+	"time"
+
+	"github.com/gocql/gocql"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// WaitlistService keeps guests waiting for booked dates. When a cancellation frees nights, the
+// waiting guests are offered them in the order they joined and the nights are held for the
+// offered guest for holdDuration.
+type WaitlistService struct {
+	repo           *repository.ReservationRepo
+	validator      *utils.Validator
+	accommodations *client.AccommodationsClient
+	notification   *client.NotificationClient
+	holdDuration   time.Duration
+	logger         *config.Logger
+	tracer         trace.Tracer
+}
+
+func NewWaitlistService(repo *repository.ReservationRepo, validator *utils.Validator, accommodations *client.AccommodationsClient, notification *client.NotificationClient, holdDuration time.Duration, logger *config.Logger, tracer trace.Tracer) *WaitlistService {
+	return &WaitlistService{repo: repo, validator: validator, accommodations: accommodations, notification: notification, holdDuration: holdDuration, logger: logger, tracer: tracer}
+}
+
+// Join puts the guest on the waitlist of an accommodation. Only dates that can't be reserved
+// right now can be waited for.
+func (ws *WaitlistService) Join(ctx context.Context, userID string, request domain.WaitlistRequest) (*domain.WaitlistEntry, *errors.ReservationError) {
+	ctx, span := ws.tracer.Start(ctx, "WaitlistService.Join")
+	defer span.End()
+	if validationErrors := ws.validator.ValidateDateRange(request.DateRange); len(validationErrors) > 0 {
+		return nil, errors.NewReservationErrorWithDetails(400, "Validation failed", validationErrors)
+	}
+	accommodation, err := ws.accommodations.GetAccommodation(ctx, request.AccommodationID)
+	if err != nil {
+		ws.logger.LogError("waitlistService", err.Message)
+		return nil, err
+	}
+	if validationErrors := ws.validator.ValidateGuests(request.Guests, accommodation); len(validationErrors) > 0 {
+		return nil, errors.NewReservationErrorWithDetails(400, "Validation failed", validationErrors)
+	}
+	bookable, err := ws.isBookable(ctx, request.AccommodationID, request.DateRange, userID)
+	if err != nil {
+		return nil, err
+	}
+	if bookable {
+		return nil, errors.NewReservationError(409, "Accommodation is available for the specified date range, reserve it instead")
+	}
+	entry := &domain.WaitlistEntry{
+		Id:                gocql.TimeUUID(),
+		AccommodationID:   request.AccommodationID,
+		AccommodationName: accommodation.Name,
+		UserID:            userID,
+		DateRange:         request.DateRange,
+		Guests:            request.Guests,
+		Status:            domain.WaitlistWaiting,
+	}
+	if err := ws.repo.InsertWaitlistEntry(ctx, entry); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+func (ws *WaitlistService) GetByUser(ctx context.Context, userID string) ([]domain.WaitlistEntry, *errors.ReservationError) {
+	ctx, span := ws.tracer.Start(ctx, "WaitlistService.GetByUser")
+	defer span.End()
+	return ws.repo.GetWaitlistByUser(ctx, userID)
+}
+
+// Leave takes the guest off a waitlist. Nights held for the guest go to the next in line.
+func (ws *WaitlistService) Leave(ctx context.Context, userID, accommodationID, id string) *errors.ReservationError {
+	ctx, span := ws.tracer.Start(ctx, "WaitlistService.Leave")
+	defer span.End()
+	entryID, parseErr := gocql.ParseUUID(id)
+	if parseErr != nil {
+		return errors.NewReservationError(400, "Invalid waitlist entry id")
+	}
+	entry, err := ws.repo.GetWaitlistEntry(ctx, accommodationID, entryID)
+	if err != nil {
+		return err
+	}
+	if entry.UserID != userID {
+		return errors.NewReservationError(404, "Waitlist entry not found")
+	}
+	return ws.leave(ctx, entry)
+}
+
+// LeaveAll takes a deleted user off every waitlist and releases the nights held for them.
+func (ws *WaitlistService) LeaveAll(ctx context.Context, userID string) *errors.ReservationError {
+	ctx, span := ws.tracer.Start(ctx, "WaitlistService.LeaveAll")
+	defer span.End()
+	entries, err := ws.repo.GetWaitlistByUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	for i := range entries {
+		if err := ws.leave(ctx, &entries[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (ws *WaitlistService) leave(ctx context.Context, entry *domain.WaitlistEntry) *errors.ReservationError {
+	if err := ws.repo.DeleteWaitlistEntry(ctx, entry); err != nil {
+		return err
+	}
+	if entry.Status == domain.WaitlistOffered {
+		if err := ws.releaseHolds(ctx, entry); err != nil {
+			return err
+		}
+		ws.Offer(ctx, entry.AccommodationID, entry.DateRange)
+	}
+	return nil
+}
+
+// Offer offers freed nights to the waitlist of an accommodation. Waiting guests whose dates
+// overlap the freed nights are gone through in the order they joined, every guest whose whole
+// stay can be reserved now gets the nights held and is notified. The held nights are no longer
+// free for the guests after them.
+func (ws *WaitlistService) Offer(ctx context.Context, accommodationID string, freedDates []string) {
+	ctx, span := ws.tracer.Start(ctx, "WaitlistService.Offer")
+	defer span.End()
+	entries, err := ws.repo.GetWaitlist(ctx, accommodationID)
+	if err != nil {
+		ws.logger.LogError("waitlistService", err.Message)
+		return
+	}
+	for i := range entries {
+		entry := &entries[i]
+		if entry.Status != domain.WaitlistWaiting || len(intersect(entry.DateRange, freedDates)) == 0 {
+			continue
+		}
+		bookable, err := ws.isBookable(ctx, accommodationID, entry.DateRange, "")
+		if err != nil {
+			ws.logger.LogError("waitlistService", err.Message)
+			return
+		}
+		if !bookable {
+			continue
+		}
+		if err := ws.offerTo(ctx, entry); err != nil {
+			ws.logger.LogError("waitlistService", err.Message)
+			return
+		}
+	}
+}
+
+func (ws *WaitlistService) offerTo(ctx context.Context, entry *domain.WaitlistEntry) *errors.ReservationError {
+	expiresAt := time.Now().Add(ws.holdDuration).UTC().Truncate(time.Second)
+	holds := make([]domain.Hold, 0, len(entry.DateRange))
+	for _, date := range entry.DateRange {
+		holds = append(holds, domain.Hold{AccommodationID: entry.AccommodationID, Date: date, UserID: entry.UserID, EntryID: entry.Id, ExpiresAt: expiresAt})
+	}
+	held, err := ws.repo.HoldNights(ctx, holds)
+	if err != nil {
+		return err
+	}
+	if !held {
+		ws.logger.LogInfo("waitlistService", fmt.Sprintf("Nights %v of accommodation %s were held for someone else first", entry.DateRange, entry.AccommodationID))
+		return nil
+	}
+	entry.Status = domain.WaitlistOffered
+	entry.HoldExpiresAt = &expiresAt
+	if err := ws.repo.UpdateWaitlistEntry(ctx, entry); err != nil {
+		return err
+	}
+	ws.notification.SendWaitlistNotification(ctx, entry.UserID,
+		fmt.Sprintf("%s is free from %s to %s. The dates are held for you until %s", entry.AccommodationName,
+			entry.DateRange[0], entry.DateRange[len(entry.DateRange)-1], expiresAt.Format(time.RFC1123)))
+	ws.logger.LogInfo("waitlistService", fmt.Sprintf("Offered %v of accommodation %s to user %s until %s", entry.DateRange, entry.AccommodationID, entry.UserID, expiresAt))
+	return nil
+}
+
+// HeldFor tells whether any night of the date range is held for someone other than the user,
+// and returns the user's own waitlist entry if the user holds the nights.
+func (ws *WaitlistService) HeldFor(ctx context.Context, accommodationID string, dateRange []string, userID string) (bool, *gocql.UUID, *errors.ReservationError) {
+	ctx, span := ws.tracer.Start(ctx, "WaitlistService.HeldFor")
+	defer span.End()
+	holds, err := ws.holdsOn(ctx, accommodationID, dateRange)
+	if err != nil {
+		return false, nil, err
+	}
+	var own *gocql.UUID
+	for _, hold := range holds {
+		if hold.UserID != userID {
+			return true, nil, nil
+		}
+		entryID := hold.EntryID
+		own = &entryID
+	}
+	return false, own, nil
+}
+
+// Fulfill marks the entry as booked once the guest reserved the held nights.
+func (ws *WaitlistService) Fulfill(ctx context.Context, accommodationID string, entryID gocql.UUID) {
+	ctx, span := ws.tracer.Start(ctx, "WaitlistService.Fulfill")
+	defer span.End()
+	entry, err := ws.repo.GetWaitlistEntry(ctx, accommodationID, entryID)
+	if err != nil {
+		ws.logger.LogError("waitlistService", err.Message)
+		return
+	}
+	if err := ws.releaseHolds(ctx, entry); err != nil {
+		ws.logger.LogError("waitlistService", err.Message)
+	}
+	entry.Status = domain.WaitlistBooked
+	entry.HoldExpiresAt = nil
+	if err := ws.repo.UpdateWaitlistEntry(ctx, entry); err != nil {
+		ws.logger.LogError("waitlistService", err.Message)
+	}
+}
+
+// ExpireHolds expires the offers whose hold ran out and offers their nights to the next in
+// line. Offers of the last week are looked at, so offers missed while the service was down
+// are expired as well.
+func (ws *WaitlistService) ExpireHolds(ctx context.Context) {
+	ctx, span := ws.tracer.Start(ctx, "WaitlistService.ExpireHolds")
+	defer span.End()
+	now := time.Now().UTC()
+	days := make([]string, 0, 7)
+	for i := 6; i >= 0; i-- {
+		days = append(days, now.AddDate(0, 0, -i).Format(dateLayout))
+	}
+	offers, err := ws.repo.GetExpiredOffers(ctx, days, now)
+	if err != nil {
+		ws.logger.LogError("waitlistService", err.Message)
+		return
+	}
+	for _, offer := range offers {
+		entry, err := ws.repo.GetWaitlistEntry(ctx, offer.AccommodationID, offer.EntryID)
+		if err != nil && err.Status != 404 {
+			ws.logger.LogError("waitlistService", err.Message)
+			continue
+		}
+		// The offer may have been taken or renewed since, only the current one expires.
+		if entry != nil && entry.Status == domain.WaitlistOffered && entry.HoldExpiresAt != nil && !entry.HoldExpiresAt.After(now) {
+			if err := ws.releaseHolds(ctx, entry); err != nil {
+				ws.logger.LogError("waitlistService", err.Message)
+				continue
+			}
+			entry.Status = domain.WaitlistExpired
+			entry.HoldExpiresAt = nil
+			if err := ws.repo.UpdateWaitlistEntry(ctx, entry); err != nil {
+				ws.logger.LogError("waitlistService", err.Message)
+				continue
+			}
+			ws.notification.SendWaitlistNotification(ctx, entry.UserID,
+				fmt.Sprintf("Your hold on %s from %s to %s has expired", entry.AccommodationName, entry.DateRange[0], entry.DateRange[len(entry.DateRange)-1]))
+			ws.Offer(ctx, entry.AccommodationID, entry.DateRange)
+		}
+		if err := ws.repo.DeleteWaitlistOffer(ctx, offer); err != nil {
+			ws.logger.LogError("waitlistService", err.Message)
+		}
+	}
+}
+
+// releaseHolds releases the nights still held for the entry. Nights held for another entry in
+// the meantime are left alone.
+func (ws *WaitlistService) releaseHolds(ctx context.Context, entry *domain.WaitlistEntry) *errors.ReservationError {
+	holds, err := ws.holdsOn(ctx, entry.AccommodationID, entry.DateRange)
+	if err != nil {
+		return err
+	}
+	var dates []string
+	for _, hold := range holds {
+		if hold.EntryID == entry.Id {
+			dates = append(dates, hold.Date)
+		}
+	}
+	if len(dates) == 0 {
+		return nil
+	}
+	return ws.repo.ReleaseHolds(ctx, entry.AccommodationID, dates)
+}
+
+// holdsOn returns the holds on the nights of the date range.
+func (ws *WaitlistService) holdsOn(ctx context.Context, accommodationID string, dateRange []string) ([]domain.Hold, *errors.ReservationError) {
+	dates, err := sortedDates(dateRange)
+	if err != nil {
+		return nil, err
+	}
+	holds, err := ws.repo.GetHolds(ctx, accommodationID, dates[0], dates[len(dates)-1])
+	if err != nil {
+		return nil, err
+	}
+	var result []domain.Hold
+	for _, date := range dates {
+		if hold, ok := holds[date]; ok {
+			result = append(result, hold)
+		}
+	}
+	return result, nil
+}
+
+// isBookable tells whether every night of the date range is offered, not reserved, not blocked
+// and not held for anyone but the user.
+func (ws *WaitlistService) isBookable(ctx context.Context, accommodationID string, dateRange []string, userID string) (bool, *errors.ReservationError) {
+	available, repoErr := ws.repo.IsAvailable(ctx, accommodationID, dateRange)
+	if repoErr != nil {
+		return false, repoErr
+	}
+	reserved, repoErr := ws.repo.IsReserved(ctx, accommodationID, dateRange)
+	if repoErr != nil {
+		return false, repoErr
+	}
+	if !available || reserved {
+		return false, nil
+	}
+	dates, err := sortedDates(dateRange)
+	if err != nil {
+		return false, err
+	}
+	blockedDates, err := ws.repo.GetBlockedDates(ctx, accommodationID, dates[0], dates[len(dates)-1])
+	if err != nil {
+		return false, err
+	}
+	wanted := toSet(dates)
+	for _, block := range blockedDates {
+		if _, ok := wanted[block.Date]; ok {
+			return false, nil
+		}
+	}
+	held, _, err := ws.HeldFor(ctx, accommodationID, dateRange, userID)
+	if err != nil {
+		return false, err
+	}
+	return !held, nil
+}
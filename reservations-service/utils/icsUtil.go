@@ -0,0 +1,190 @@
+package utils
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	icsDateLayout     = "20060102"
+	icsDateTimeLayout = "20060102T150405"
+	dateLayout        = "2006-01-02"
+	// icsMaxEventNights bounds the nights read from a single event, however long it claims to be.
+	icsMaxEventNights = 366
+)
+
+type CalendarEvent struct {
+	UID     string
+	Summary string
+	Dates   []string
+}
+
+// ParseICS reads the VEVENTs of an iCalendar body and returns the nights every event occupies
+// from from up to, not including, to. DTEND is exclusive, an event without DTEND occupies the
+// night of DTSTART only. Events without a night in the window are left out.
+func ParseICS(r io.Reader, from, to time.Time) ([]CalendarEvent, error) {
+	lines, err := unfoldICSLines(r)
+	if err != nil {
+		return nil, err
+	}
+	var events []CalendarEvent
+	var inEvent bool
+	var uid, summary, start, end string
+	for _, line := range lines {
+		name, value := splitICSProperty(line)
+		switch {
+		case name == "BEGIN" && value == "VEVENT":
+			inEvent = true
+			uid, summary, start, end = "", "", "", ""
+		case name == "END" && value == "VEVENT":
+			inEvent = false
+			dates, err := icsNights(start, end, from, to)
+			if err != nil {
+				return nil, fmt.Errorf("event %s: %v", uid, err)
+			}
+			if len(dates) == 0 {
+				continue
+			}
+			events = append(events, CalendarEvent{UID: uid, Summary: summary, Dates: dates})
+		case !inEvent:
+		case name == "UID":
+			uid = value
+		case name == "SUMMARY":
+			summary = value
+		case name == "DTSTART":
+			start = value
+		case name == "DTEND":
+			end = value
+		}
+	}
+	return events, nil
+}
+
+// WriteICS writes one all-day VEVENT per run of consecutive dates.
+func WriteICS(w io.Writer, calendarName string, events []CalendarEvent) error {
+	stamp := time.Now().UTC().Format(icsDateTimeLayout) + "Z"
+	var b strings.Builder
+	b.WriteString("BEGIN:VCALENDAR\r\n")
+	b.WriteString("VERSION:2.0\r\n")
+	b.WriteString("PRODID:-//airbnb-clone//reservations-service//EN\r\n")
+	b.WriteString("CALSCALE:GREGORIAN\r\n")
+	b.WriteString("X-WR-CALNAME:" + calendarName + "\r\n")
+	for _, event := range events {
+		for _, run := range consecutiveDates(event.Dates) {
+			first, _ := time.Parse(dateLayout, run[0])
+			last, _ := time.Parse(dateLayout, run[len(run)-1])
+			b.WriteString("BEGIN:VEVENT\r\n")
+			b.WriteString(fmt.Sprintf("UID:%s-%s@airbnb-clone\r\n", event.UID, first.Format(icsDateLayout)))
+			b.WriteString("DTSTAMP:" + stamp + "\r\n")
+			b.WriteString("DTSTART;VALUE=DATE:" + first.Format(icsDateLayout) + "\r\n")
+			b.WriteString("DTEND;VALUE=DATE:" + last.AddDate(0, 0, 1).Format(icsDateLayout) + "\r\n")
+			b.WriteString("SUMMARY:" + event.Summary + "\r\n")
+			b.WriteString("END:VEVENT\r\n")
+		}
+	}
+	b.WriteString("END:VCALENDAR\r\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func unfoldICSLines(r io.Reader) ([]string, error) {
+	scanner := bufio.NewScanner(r)
+	var lines []string
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines, scanner.Err()
+}
+
+// splitICSProperty splits "DTSTART;VALUE=DATE:20240101" into "DTSTART" and "20240101".
+func splitICSProperty(line string) (string, string) {
+	colon := strings.Index(line, ":")
+	if colon < 0 {
+		return strings.ToUpper(line), ""
+	}
+	name := line[:colon]
+	if semicolon := strings.Index(name, ";"); semicolon >= 0 {
+		name = name[:semicolon]
+	}
+	return strings.ToUpper(name), line[colon+1:]
+}
+
+func parseICSDate(value string) (time.Time, error) {
+	value = strings.TrimSuffix(value, "Z")
+	if len(value) >= len(icsDateTimeLayout) {
+		parsed, err := time.Parse(icsDateTimeLayout, value[:len(icsDateTimeLayout)])
+		if err != nil {
+			return time.Time{}, err
+		}
+		return time.Date(parsed.Year(), parsed.Month(), parsed.Day(), 0, 0, 0, 0, time.UTC), nil
+	}
+	return time.Parse(icsDateLayout, value)
+}
+
+// icsNights returns the nights of an event that fall in the window, at most icsMaxEventNights.
+func icsNights(start, end string, from, to time.Time) ([]string, error) {
+	if start == "" {
+		return nil, fmt.Errorf("missing DTSTART")
+	}
+	first, err := parseICSDate(start)
+	if err != nil {
+		return nil, err
+	}
+	last := first.AddDate(0, 0, 1)
+	if end != "" {
+		last, err = parseICSDate(end)
+		if err != nil {
+			return nil, err
+		}
+		if !last.After(first) {
+			last = first.AddDate(0, 0, 1)
+		}
+	}
+	if first.Before(from) {
+		first = from
+	}
+	if last.After(to) {
+		last = to
+	}
+	if limit := first.AddDate(0, 0, icsMaxEventNights); last.After(limit) {
+		last = limit
+	}
+	var dates []string
+	for day := first; day.Before(last); day = day.AddDate(0, 0, 1) {
+		dates = append(dates, day.Format(dateLayout))
+	}
+	return dates, nil
+}
+
+func consecutiveDates(dates []string) [][]string {
+	sorted := append([]string(nil), dates...)
+	sort.Strings(sorted)
+	var runs [][]string
+	var previous time.Time
+	for i, date := range sorted {
+		current, err := time.Parse(dateLayout, date)
+		if err != nil {
+			continue
+		}
+		if i > 0 && current.Equal(previous) {
+			continue
+		}
+		if len(runs) == 0 || !current.Equal(previous.AddDate(0, 0, 1)) {
+			runs = append(runs, []string{})
+		}
+		runs[len(runs)-1] = append(runs[len(runs)-1], date)
+		previous = current
+	}
+	return runs
+}
@@ -0,0 +1,50 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func parseTestICS(t *testing.T, events string, from, to time.Time) []CalendarEvent {
+	t.Helper()
+	body := "BEGIN:VCALENDAR\r\n" + events + "END:VCALENDAR\r\n"
+	parsed, err := ParseICS(strings.NewReader(body), from, to)
+	if err != nil {
+		t.Fatalf("parsing calendar: %v", err)
+	}
+	return parsed
+}
+
+func TestParseICSReadsNights(t *testing.T) {
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	events := parseTestICS(t, "BEGIN:VEVENT\r\nUID:stay\r\nDTSTART;VALUE=DATE:20240110\r\nDTEND;VALUE=DATE:20240113\r\nEND:VEVENT\r\n", from, from.AddDate(1, 0, 0))
+	if len(events) != 1 || strings.Join(events[0].Dates, ",") != "2024-01-10,2024-01-11,2024-01-12" {
+		t.Fatalf("got %+v", events)
+	}
+}
+
+func TestParseICSClampsEventToWindow(t *testing.T) {
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 0, 3)
+	events := parseTestICS(t, "BEGIN:VEVENT\r\nUID:forever\r\nDTSTART;VALUE=DATE:00010101\r\nDTEND;VALUE=DATE:99991231\r\nEND:VEVENT\r\n", from, to)
+	if len(events) != 1 || strings.Join(events[0].Dates, ",") != "2024-01-01,2024-01-02,2024-01-03" {
+		t.Fatalf("got %+v", events)
+	}
+}
+
+func TestParseICSCapsLongEvent(t *testing.T) {
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	events := parseTestICS(t, "BEGIN:VEVENT\r\nUID:long\r\nDTSTART;VALUE=DATE:20240101\r\nDTEND;VALUE=DATE:20300101\r\nEND:VEVENT\r\n", from, from.AddDate(10, 0, 0))
+	if len(events) != 1 || len(events[0].Dates) != icsMaxEventNights {
+		t.Fatalf("event has %d nights, want %d", len(events[0].Dates), icsMaxEventNights)
+	}
+}
+
+func TestParseICSDropsEventOutsideWindow(t *testing.T) {
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	events := parseTestICS(t, "BEGIN:VEVENT\r\nUID:past\r\nDTSTART;VALUE=DATE:20230601\r\nDTEND;VALUE=DATE:20230605\r\nEND:VEVENT\r\n", from, from.AddDate(1, 0, 0))
+	if len(events) != 0 {
+		t.Fatalf("got %+v, want no events", events)
+	}
+}
@@ -28,6 +28,17 @@ func WriteErrorResp(err string, status int, path string, w http.ResponseWriter)
 	writeJSONResponse(w, status, baseErrorResp)
 }
 
+func WriteErrorRespWithDetails(err string, status int, path string, details interface{}, w http.ResponseWriter) {
+	baseErrorResp := domain.BaseErrorHttpResponse{
+		Error:   err,
+		Path:    path,
+		Status:  status,
+		Time:    time.Now().String(),
+		Details: details,
+	}
+	writeJSONResponse(w, status, baseErrorResp)
+}
+
 func WriteResp(resp any, statusCode int, w http.ResponseWriter) {
 	if resp == nil {
 		return
@@ -1,8 +1,12 @@
 package utils
 
 import (
+	"encoding/base64"
 	"fmt"
+	"net/url"
 	"reservation-service/domain"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -11,6 +15,37 @@ const (
 	EndDate           = "End date must be after start date"
 	Username          = "Username field can't be empty"
 	AccommodationName = "Accommodation name can't be empty"
+	DateRange         = "Date range must hold consecutive dates in YYYY-MM-DD format, ordered from the first to the last night, for a stay of allowed length"
+	StayStart         = "Start date can't be in the past and must be the first date of the range"
+	StayEnd           = "End date must be the last date of the range"
+	NumOfDays         = "Number of days must match the number of dates in the range"
+	UsernameField     = "Username can't be empty, longer than 50 characters or hold forbidden words"
+	AccommodationText = "Accommodation name can't be empty, longer than 100 characters or hold forbidden words"
+	Location          = "Location must be in the format address,city,country"
+	Required          = "Field is required"
+	Adults            = "At least one adult is required"
+	NotNegative       = "Value can't be negative"
+	Visitors          = "Number of adults and children must be between %d and %d"
+	Infants           = "At most %d infants are allowed"
+	Pets              = "Pets are not allowed in this accommodation"
+	Status            = "Status must be upcoming, ongoing or completed"
+	FilterDate        = "Date must be in YYYY-MM-DD format"
+	FilterWindow      = "From date must not be after to date"
+	PageState         = "Page state must be the one returned with the previous page"
+	PageSize          = "Page size must be between 1 and %d"
+	TripLegOverlap    = "Legs of a trip can't reserve the same nights of an accommodation"
+
+	MinStayNights = 1
+	MaxStayNights = 90
+	MaxInfants    = 5
+
+	DefaultPageSize = 20
+	MaxPageSize     = 100
+
+	// MaxTripLegs and MaxTripNights keep a trip within one logged batch, every night of every leg
+	// is a row of the batch.
+	MaxTripLegs   = 10
+	MaxTripNights = 60
 )
 
 var errorMessages = map[string]string{
@@ -18,6 +53,16 @@ var errorMessages = map[string]string{
 	"EndDate":           EndDate,
 	"Username":          Username,
 	"AccommodationName": AccommodationName,
+	"dateRange":         DateRange,
+	"startDate":         StayStart,
+	"endDate":           StayEnd,
+	"numOfDays":         NumOfDays,
+	"username":          UsernameField,
+	"accommodationName": AccommodationText,
+	"location":          Location,
+	"userId":            Required,
+	"accommodationId":   Required,
+	"hostId":            Required,
 }
 
 type Validator struct {
@@ -164,55 +209,180 @@ func checkPair(pairs []time.Time) bool {
 	return false
 }
 
-/*
-	func DateNotInPast() ValidationRule {
-		return func(value string) bool {
-			today := time.Now().UTC()
-			date, err := time.Parse("2006-01-02", value)
-			if err != nil {
-				return false
+type ReservationRule func(reservation *domain.Reservation) bool
+
+// ValidateReservationField records the message of the first rule the reservation breaks under fieldName.
+func (v *Validator) ValidateReservationField(fieldName string, reservation *domain.Reservation, rules ...ReservationRule) {
+	for _, rule := range rules {
+		if !rule(reservation) {
+			if errorMessage, exists := errorMessages[fieldName]; exists {
+				v.Errors[fieldName] = errorMessage
+			} else {
+				v.Errors[fieldName] = "Validation failed for field " + fieldName
 			}
-			return !date.Before(today)
+			return
 		}
 	}
+	delete(v.Errors, fieldName)
+}
 
-	func MinLength(minLength int) ValidationRule {
-		return func(value string) bool {
-			return len(value) >= minLength
-		}
+func NotEmpty(value func(reservation *domain.Reservation) string) ReservationRule {
+	return func(reservation *domain.Reservation) bool {
+		return strings.TrimSpace(value(reservation)) != ""
 	}
+}
 
-	func MaxLength(maxLength int) ValidationRule {
-		return func(value string) bool {
-			return len(value) <= maxLength
-		}
+func MaxLength(value func(reservation *domain.Reservation) string, maxLength int) ReservationRule {
+	return func(reservation *domain.Reservation) bool {
+		return len(value(reservation)) <= maxLength
 	}
+}
 
-	func WordBan(value string) bool {
-		normalizedValue := strings.ReplaceAll(strings.ToUpper(value), " ", "")
+func WordBan(value func(reservation *domain.Reservation) string) ReservationRule {
+	return func(reservation *domain.Reservation) bool {
+		normalizedValue := strings.ReplaceAll(strings.ToUpper(value(reservation)), " ", "")
 		bannedWords := []string{"SELECT", "UPDATE", "DELETE", "FROM", "WHERE", "<", ">"}
 		for _, word := range bannedWords {
 			if strings.Contains(normalizedValue, word) {
 				return false
 			}
 		}
+		return true
+	}
+}
+
+func DateRangeNotEmpty() ReservationRule {
+	return func(reservation *domain.Reservation) bool {
+		return len(reservation.DateRange) > 0
+	}
+}
 
+func DatesParsable() ReservationRule {
+	return func(reservation *domain.Reservation) bool {
+		for _, date := range reservation.DateRange {
+			if _, err := getTimeFromString(date); err != nil {
+				return false
+			}
+		}
 		return true
 	}
+}
 
-	func (v *Validator) ValidateReservation(reservation *domain.Reservation) {
-		/*	v.ValidateField("username", reservation.Username, MinLength(2), MaxLength(15), WordBan)
-			v.ValidateField("accommodationName", reservation.AccommodationName, MinLength(2), MaxLength(15), WordBan)
-			v.ValidateField("startDate", reservation.StartDate, DateNotAfter(reservation.StartDate, reservation.EndDate), DateNotInPast())
-			v.ValidateField("endDate", reservation.EndDate, DateNotBefore(reservation.EndDate, reservation.StartDate), DateNotInPast())
-		foundErrors := v.GetErrors()
-		if len(foundErrors) > 0 {
-			for field, message := range foundErrors {
-				fmt.Printf("%s: %s\n", field, message)
+// DatesInOrder checks that every date comes strictly after the previous one.
+func DatesInOrder() ReservationRule {
+	return func(reservation *domain.Reservation) bool {
+		for i := 1; i < len(reservation.DateRange); i++ {
+			if reservation.DateRange[i] <= reservation.DateRange[i-1] {
+				return false
 			}
 		}
+		return true
 	}
-*/
+}
+
+// DatesContiguous checks that the dates follow each other day by day, without gaps.
+func DatesContiguous() ReservationRule {
+	return func(reservation *domain.Reservation) bool {
+		for i := 1; i < len(reservation.DateRange); i++ {
+			previous, err := getTimeFromString(reservation.DateRange[i-1])
+			if err != nil {
+				return false
+			}
+			current, err := getTimeFromString(reservation.DateRange[i])
+			if err != nil {
+				return false
+			}
+			if !current.Equal(previous.AddDate(0, 0, 1)) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+func DateNotInPast() ReservationRule {
+	return func(reservation *domain.Reservation) bool {
+		if len(reservation.DateRange) == 0 {
+			return true
+		}
+		date, err := getTimeFromString(reservation.DateRange[0])
+		if err != nil {
+			return false
+		}
+		now := time.Now().UTC()
+		today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+		return !date.Before(today)
+	}
+}
+
+// MatchesDateRange checks an optional boundary date against the first or the last date of the range.
+func MatchesDateRange(value func(reservation *domain.Reservation) string, last bool) ReservationRule {
+	return func(reservation *domain.Reservation) bool {
+		date := value(reservation)
+		if date == "" || len(reservation.DateRange) == 0 {
+			return true
+		}
+		if last {
+			return date == reservation.DateRange[len(reservation.DateRange)-1]
+		}
+		return date == reservation.DateRange[0]
+	}
+}
+
+func NumberOfDaysMatches() ReservationRule {
+	return func(reservation *domain.Reservation) bool {
+		return reservation.NumberOfDays == len(reservation.DateRange)
+	}
+}
+
+func StayLength(minNights, maxNights int) ReservationRule {
+	return func(reservation *domain.Reservation) bool {
+		return len(reservation.DateRange) >= minNights && len(reservation.DateRange) <= maxNights
+	}
+}
+
+func LocationParsable() ReservationRule {
+	return func(reservation *domain.Reservation) bool {
+		_, err := GetContinent(reservation.Location)
+		return err == nil
+	}
+}
+
+// ValidateReservation checks a reservation before it is booked and returns the broken fields with
+// their messages. Every call starts from a clean set of errors, so the shared Validator is not used
+// to keep them.
+func (v *Validator) ValidateReservation(reservation *domain.Reservation) map[string]string {
+	result := NewValidator()
+	result.ValidateReservationField("userId", reservation, NotEmpty(func(r *domain.Reservation) string { return r.UserID }))
+	result.ValidateReservationField("accommodationId", reservation, NotEmpty(func(r *domain.Reservation) string { return r.AccommodationID }))
+	result.ValidateReservationField("hostId", reservation, NotEmpty(func(r *domain.Reservation) string { return r.HostID }))
+	username := func(r *domain.Reservation) string { return r.Username }
+	result.ValidateReservationField("username", reservation, NotEmpty(username), MaxLength(username, 50), WordBan(username))
+	accommodationName := func(r *domain.Reservation) string { return r.AccommodationName }
+	result.ValidateReservationField("accommodationName", reservation, NotEmpty(accommodationName), MaxLength(accommodationName, 100), WordBan(accommodationName))
+	result.ValidateReservationField("location", reservation, LocationParsable())
+	result.validateStay(reservation)
+	return result.Errors
+}
+
+// ValidateDateRange applies the date rules of ValidateReservation to a new date range of a stay.
+func (v *Validator) ValidateDateRange(dateRange []string) map[string]string {
+	result := NewValidator()
+	reservation := &domain.Reservation{DateRange: dateRange, NumberOfDays: len(dateRange)}
+	result.validateStay(reservation)
+	return result.Errors
+}
+
+func (v *Validator) validateStay(reservation *domain.Reservation) {
+	v.ValidateReservationField("dateRange", reservation, DateRangeNotEmpty(), DatesParsable(), DatesInOrder(), DatesContiguous(),
+		StayLength(MinStayNights, MaxStayNights))
+	if _, invalid := v.Errors["dateRange"]; invalid {
+		return
+	}
+	v.ValidateReservationField("startDate", reservation, DateNotInPast(), MatchesDateRange(func(r *domain.Reservation) string { return r.StartDate }, false))
+	v.ValidateReservationField("endDate", reservation, MatchesDateRange(func(r *domain.Reservation) string { return r.EndDate }, true))
+	v.ValidateReservationField("numOfDays", reservation, NumberOfDaysMatches())
+}
 func (v *Validator) ValidateAvailability(reservation *domain.FreeReservation) {
 	v.ValidateField("dateRange", reservation.DateRange, DateNotSame())
 	foundErrors := v.GetErrors()
@@ -231,3 +401,71 @@ func getTimeFromString(str string) (time.Time, error) {
 	}
 	return tm, nil
 }
+
+// ValidateGuests checks the party of a reservation against the rules of the accommodation.
+func (v *Validator) ValidateGuests(guests domain.Guests, accommodation *domain.Accommodation) map[string]string {
+	result := make(map[string]string)
+	if guests.Adults < 1 {
+		result["guests.adults"] = Adults
+	}
+	if guests.Children < 0 {
+		result["guests.children"] = NotNegative
+	}
+	if guests.Infants < 0 {
+		result["guests.infants"] = NotNegative
+	} else if guests.Infants > MaxInfants {
+		result["guests.infants"] = fmt.Sprintf(Infants, MaxInfants)
+	}
+	if guests.Pets < 0 {
+		result["guests.pets"] = NotNegative
+	} else if guests.Pets > 0 && !accommodation.AllowsPets() {
+		result["guests.pets"] = Pets
+	}
+	if len(result) == 0 && accommodation.MaxNumOfVisitors > 0 &&
+		(guests.Visitors() < accommodation.MinNumOfVisitors || guests.Visitors() > accommodation.MaxNumOfVisitors) {
+		result["guests"] = fmt.Sprintf(Visitors, accommodation.MinNumOfVisitors, accommodation.MaxNumOfVisitors)
+	}
+	return result
+}
+
+// ParseReservationFilter reads a reservation filter from query parameters. Reservations are
+// only paginated when the client asks for it with size or pageState, a pageState without a size
+// continues with pages of DefaultPageSize reservations.
+func (v *Validator) ParseReservationFilter(query url.Values) (domain.ReservationFilter, map[string]string) {
+	result := make(map[string]string)
+	filter := domain.ReservationFilter{
+		Status:          query.Get("status"),
+		From:            query.Get("from"),
+		To:              query.Get("to"),
+		AccommodationID: query.Get("accommodationId"),
+	}
+	switch filter.Status {
+	case "", domain.ReservationUpcoming, domain.ReservationOngoing, domain.ReservationCompleted:
+	default:
+		result["status"] = Status
+	}
+	for field, value := range map[string]string{"from": filter.From, "to": filter.To} {
+		if _, err := getTimeFromString(value); value != "" && err != nil {
+			result[field] = FilterDate
+		}
+	}
+	if len(result) == 0 && filter.From != "" && filter.To != "" && filter.From > filter.To {
+		result["to"] = FilterWindow
+	}
+	if value := query.Get("pageState"); value != "" {
+		state, err := base64.RawURLEncoding.DecodeString(value)
+		if err != nil {
+			result["pageState"] = PageState
+		}
+		filter.PageState = state
+		filter.Size = DefaultPageSize
+	}
+	if value := query.Get("size"); value != "" {
+		size, err := strconv.Atoi(value)
+		if err != nil || size < 1 || size > MaxPageSize {
+			result["size"] = fmt.Sprintf(PageSize, MaxPageSize)
+		}
+		filter.Size = size
+	}
+	return filter, result
+}
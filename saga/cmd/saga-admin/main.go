@@ -0,0 +1,195 @@
+// Command saga-admin talks to the saga admin API of a service, to find stuck sagas, look
+// into them and retry or compensate them.
+//
+//	saga-admin list -status Running,Compensating -older-than 1h
+//	saga-admin show <id>
+//	saga-admin retry -reason "reservations-service was down" <id>
+//	saga-admin compensate -reason "host asked to cancel" <id>
+//
+// The API is found at -url or SAGA_ADMIN_URL, with the token in -token or SAGA_ADMIN_TOKEN.
+// Every operator has a token of their own, and actions are audited under the name the token
+// belongs to.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"example/saga/orchestration"
+)
+
+type client struct {
+	url   string
+	token string
+	http  *http.Client
+}
+
+func main() {
+	flags := flag.NewFlagSet("saga-admin", flag.ExitOnError)
+	c := &client{http: &http.Client{Timeout: 30 * time.Second}}
+	flags.StringVar(&c.url, "url", env("SAGA_ADMIN_URL", "http://localhost:8081"), "address of the saga admin API")
+	flags.StringVar(&c.token, "token", os.Getenv("SAGA_ADMIN_TOKEN"), "token of the saga admin API")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: saga-admin [flags] list|show|retry|compensate [args]")
+		flags.PrintDefaults()
+	}
+	_ = flags.Parse(os.Args[1:])
+	if flags.NArg() == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	var err error
+	switch command, args := flags.Arg(0), flags.Args()[1:]; command {
+	case "list":
+		err = c.list(args)
+	case "show":
+		err = c.show(args)
+	case orchestration.ActionRetry, orchestration.ActionCompensate:
+		err = c.act(command, args)
+	default:
+		flags.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "saga-admin:", err)
+		os.Exit(1)
+	}
+}
+
+func (c *client) list(args []string) error {
+	flags := flag.NewFlagSet("list", flag.ExitOnError)
+	status := flags.String("status", "", "comma separated statuses to list, all if empty")
+	olderThan := flags.Duration("older-than", 0, "list only sagas started at least this long ago")
+	limit := flags.Int("limit", 0, "most sagas to list")
+	_ = flags.Parse(args)
+	query := url.Values{}
+	if *status != "" {
+		query.Set("status", *status)
+	}
+	if *olderThan > 0 {
+		query.Set("olderThan", olderThan.String())
+	}
+	if *limit > 0 {
+		query.Set("limit", strconv.Itoa(*limit))
+	}
+	var sagas []orchestration.State[json.RawMessage]
+	if err := c.do(http.MethodGet, "/sagas?"+query.Encode(), nil, &sagas); err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tSAGA\tSTATUS\tSTEP\tATTEMPTS\tAGE\tLAST MOVE")
+	for _, state := range sagas {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\t%s\n", state.ID, state.Saga, state.Status, state.Step, state.Attempts, age(state.CreatedAt), age(state.UpdatedAt))
+	}
+	return w.Flush()
+}
+
+func (c *client) show(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: saga-admin show <id>")
+	}
+	var inspection orchestration.Inspection[json.RawMessage]
+	if err := c.do(http.MethodGet, "/sagas/"+url.PathEscape(args[0]), nil, &inspection); err != nil {
+		return err
+	}
+	state := inspection.Saga
+	fmt.Printf("Saga:     %s %s\n", state.Saga, state.ID)
+	fmt.Printf("Status:   %s at step %s, attempt %d\n", state.Status, state.Step, state.Attempts)
+	fmt.Printf("Started:  %s (%s ago)\n", state.CreatedAt.Format(time.RFC3339), age(state.CreatedAt))
+	if !state.Deadline.IsZero() {
+		fmt.Printf("Deadline: %s\n", state.Deadline.Format(time.RFC3339))
+	}
+	fmt.Printf("Data:     %s\n\nHistory:\n", state.Data)
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "AT\tSTEP\tSTATUS\tNOTE")
+	for _, record := range state.History {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", record.At.Format(time.RFC3339), record.Step, record.Status, record.Note)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if len(inspection.Audit) == 0 {
+		return nil
+	}
+	fmt.Println("\nOperator actions:")
+	fmt.Fprintln(w, "AT\tOPERATOR\tACTION\tOUTCOME\tAT STEP\tREASON")
+	for _, entry := range inspection.Audit {
+		outcome := entry.Outcome
+		if entry.Error != "" {
+			outcome += ": " + entry.Error
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s %s\t%s\n", entry.At.Format(time.RFC3339), entry.Operator, entry.Action, outcome, entry.Step, entry.Status, entry.Reason)
+	}
+	return w.Flush()
+}
+
+func (c *client) act(action string, args []string) error {
+	flags := flag.NewFlagSet(action, flag.ExitOnError)
+	reason := flags.String("reason", "", "why, for the audit log (required)")
+	_ = flags.Parse(args)
+	if flags.NArg() != 1 || *reason == "" {
+		return fmt.Errorf("usage: saga-admin %s -reason <reason> <id>", action)
+	}
+	request := orchestration.ActionRequest{Reason: *reason}
+	var state orchestration.State[json.RawMessage]
+	if err := c.do(http.MethodPost, "/sagas/"+url.PathEscape(flags.Arg(0))+"/"+action, request, &state); err != nil {
+		return err
+	}
+	fmt.Printf("Saga %s %s is %s at step %s\n", state.Saga, state.ID, state.Status, state.Step)
+	return nil
+}
+
+// do sends a request to the admin API and decodes its response into out.
+func (c *client) do(method, path string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		encoded, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(encoded)
+	}
+	req, err := http.NewRequest(method, strings.TrimRight(c.url, "/")+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var failure struct {
+			Error string `json:"error"`
+		}
+		if json.NewDecoder(resp.Body).Decode(&failure) != nil || failure.Error == "" {
+			failure.Error = resp.Status
+		}
+		return fmt.Errorf("%s", failure.Error)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// age tells how long ago t was, to the second.
+func age(t time.Time) string {
+	return time.Since(t).Truncate(time.Second).String()
+}
+
+func env(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
@@ -1,5 +1,7 @@
 package create_accommodation
 
+import "example/saga/messaging"
+
 type SagaCommandType int8
 
 // KOMANDE
@@ -36,15 +38,20 @@ type CreateAccommodationReplyType int8
 const (
 	AvailabilityCreated CreateAccommodationReplyType = iota
 	AvailabilityNotCreated
+	AccommodationApproved
+	AccommodationDenied
+	AvailabilityRolledBack
 	UnknownReply
 )
 
 type CreateAccommodationCommand struct {
+	messaging.Envelope
 	Type    CreateAccommodationCommandType
 	Payload SendCreateAccommodationAvailability
 }
 
 type CreateAccommodationReply struct {
+	messaging.Envelope
 	Type    CreateAccommodationReplyType
 	Payload SendCreateAccommodationAvailability
 }
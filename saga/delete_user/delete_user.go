@@ -0,0 +1,62 @@
+package delete_user
+
+import (
+	"time"
+
+	"example/saga/messaging"
+)
+
+// UserDetails identifies the account being deleted.
+type UserDetails struct {
+	UserID string
+	Role   string
+}
+
+type DeleteUserCommandType int8
+
+// komande
+const (
+	SuspendAccommodations DeleteUserCommandType = iota
+	RestoreAccommodations
+	CheckReservations
+	DisableCredentials
+	EnableCredentials
+	DeleteProfile
+	UnknownCommand
+)
+
+type DeleteUserReplyType int8
+
+// REPLY
+const (
+	AccommodationsSuspended DeleteUserReplyType = iota
+	AccommodationsNotSuspended
+	AccommodationsRestored
+	NoOpenReservations
+	OpenReservations
+	CredentialsDisabled
+	CredentialsNotDisabled
+	CredentialsEnabled
+	ProfileDeleted
+	UnknownReply
+)
+
+type DeleteUserCommand struct {
+	messaging.Envelope
+	Type    DeleteUserCommandType
+	Payload UserDetails
+}
+
+type DeleteUserReply struct {
+	messaging.Envelope
+	Type    DeleteUserReplyType
+	Payload UserDetails
+}
+
+// AccountDeleted is published once the saga deleted the account, so every service drops
+// what it still keeps of the user.
+type AccountDeleted struct {
+	UserID    string
+	Role      string
+	DeletedAt time.Time
+}
@@ -0,0 +1,52 @@
+package messaging
+
+import (
+	"context"
+	"time"
+
+	"github.com/nats-io/nuid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// Envelope is carried by every saga message. SagaID ties the message to the saga instance it
+// belongs to, MessageID identifies this message, and CausationID is the MessageID of the
+// message it answers. Trace holds the trace context of the sender, so the receiver's spans
+// continue the sender's trace. Deadline, if set, is when the sender stops waiting for the
+// message to be handled.
+type Envelope struct {
+	SagaID      string            `json:"sagaId"`
+	MessageID   string            `json:"messageId"`
+	CausationID string            `json:"causationId,omitempty"`
+	Timestamp   time.Time         `json:"timestamp"`
+	Deadline    time.Time         `json:"deadline"`
+	Trace       map[string]string `json:"trace,omitempty"`
+}
+
+// NewEnvelope creates the envelope of a message of the saga, sent with the trace context of ctx.
+func NewEnvelope(ctx context.Context, sagaID, causationID string) Envelope {
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+	return Envelope{
+		SagaID:      sagaID,
+		MessageID:   nuid.Next(),
+		CausationID: causationID,
+		Timestamp:   time.Now().UTC(),
+		Trace:       carrier,
+	}
+}
+
+// Reply creates the envelope of a message that answers the one e was sent with.
+func (e Envelope) Reply(ctx context.Context) Envelope {
+	return NewEnvelope(ctx, e.SagaID, e.MessageID)
+}
+
+// Context returns ctx carrying the sender's trace context.
+func (e Envelope) Context(ctx context.Context) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, propagation.MapCarrier(e.Trace))
+}
+
+// envelope lets Decode find the envelope of a message that embeds it.
+func (e Envelope) envelope() Envelope {
+	return e
+}
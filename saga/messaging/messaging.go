@@ -1,9 +1,116 @@
 package messaging
 
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+)
+
 type Publisher interface {
 	Publish(message interface{}) error
 }
 
 type Subscriber interface {
+	// Subscribe takes a func with a single argument, which messages are decoded into from
+	// JSON. It is kept for handlers written before Handler, new handlers are subscribed with
+	// the Subscribe func of this package.
 	Subscribe(function interface{}) error
+	// SubscribeRaw delivers messages as they were received. A message whose handler returns
+	// an error is delivered again if the subscriber can, unless the error is Permanent.
+	SubscribeRaw(handler RawHandler) error
+}
+
+// Handler handles a message decoded into T. ctx carries the trace context of the sender and,
+// for messages with a deadline, that deadline. A returned error means the message was not
+// handled.
+type Handler[T any] func(ctx context.Context, msg T) error
+
+// RawHandler handles the data of a message.
+type RawHandler func(ctx context.Context, data []byte) error
+
+// Subscribe subscribes a typed handler to the subscriber.
+func Subscribe[T any](subscriber Subscriber, handler Handler[T]) error {
+	return subscriber.SubscribeRaw(Decode(handler))
+}
+
+// Decode makes a RawHandler that decodes messages from JSON into T before handing them to
+// handler. Messages carrying an Envelope continue the sender's trace and have to be handled
+// by the envelope's deadline. Messages that can't be decoded fail with a Permanent error, and
+// a handler that panics fails with an error.
+func Decode[T any](handler Handler[T]) RawHandler {
+	return func(ctx context.Context, data []byte) (err error) {
+		var msg T
+		if err := json.Unmarshal(data, &msg); err != nil {
+			return Permanent(fmt.Errorf("undecodable message: %w", err))
+		}
+		defer recoverHandler(&err)
+		if enveloped, ok := any(msg).(interface{ envelope() Envelope }); ok {
+			envelope := enveloped.envelope()
+			ctx = envelope.Context(ctx)
+			if !envelope.Deadline.IsZero() {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithDeadline(ctx, envelope.Deadline)
+				defer cancel()
+			}
+		}
+		return handler(ctx, msg)
+	}
+}
+
+// Adapt makes a RawHandler of a func with a single argument, the kind of handler Subscribe of
+// a Subscriber takes. Such a handler can't fail, so only a panic fails the message.
+func Adapt(function interface{}) (RawHandler, error) {
+	handlerValue := reflect.ValueOf(function)
+	handlerType := handlerValue.Type()
+	if handlerType.Kind() != reflect.Func || handlerType.NumIn() != 1 {
+		return nil, fmt.Errorf("handler must be a func with a single argument, not %s", handlerType)
+	}
+	argType := handlerType.In(0)
+	return func(ctx context.Context, data []byte) (err error) {
+		arg := reflect.New(argType)
+		if argType.Kind() == reflect.Ptr {
+			arg = reflect.New(argType.Elem())
+		}
+		if err := json.Unmarshal(data, arg.Interface()); err != nil {
+			return Permanent(fmt.Errorf("undecodable message: %w", err))
+		}
+		if argType.Kind() != reflect.Ptr {
+			arg = arg.Elem()
+		}
+		defer recoverHandler(&err)
+		handlerValue.Call([]reflect.Value{arg})
+		return nil
+	}, nil
+}
+
+func recoverHandler(err *error) {
+	if r := recover(); r != nil {
+		*err = fmt.Errorf("handler panicked: %v", r)
+	}
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e permanentError) Unwrap() error {
+	return e.err
+}
+
+// Permanent marks the error of a message that fails however often it is delivered, so it is
+// not delivered again.
+func Permanent(err error) error {
+	return permanentError{err: err}
+}
+
+// IsPermanent tells whether err was marked Permanent.
+func IsPermanent(err error) bool {
+	var permanent permanentError
+	return errors.As(err, &permanent)
 }
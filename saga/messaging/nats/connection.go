@@ -1,16 +1,58 @@
 package nats
 
 import (
-	"fmt"
+	"strings"
+	"time"
 
 	"github.com/nats-io/nats.go"
 )
 
-func getConnection(host, port, user, password string) (*nats.Conn, error) {
-	url := fmt.Sprintf("nats://%s:%s@%s:%s", user, password, host, port)
-	connection, err := nats.Connect(url)
+// handleTimeout is how long a handler has to handle a message without a deadline of its own.
+const handleTimeout = 30 * time.Second
+
+// jsMaxAge is how long streams keep messages.
+const jsMaxAge = 7 * 24 * time.Hour
+
+// getJetStream connects to JetStream and makes sure the stream of the subject exists. The
+// stream also keeps the dead letters of the subject.
+func getJetStream(host, port, user, password, subject string) (nats.JetStreamContext, error) {
+	conn, err := getConnection(host, port, user, password)
 	if err != nil {
 		return nil, err
 	}
-	return connection, nil
+	js, err := conn.JetStream()
+	if err != nil {
+		return nil, err
+	}
+	stream := streamName(subject)
+	_, err = js.StreamInfo(stream)
+	if err == nats.ErrStreamNotFound {
+		_, err = js.AddStream(&nats.StreamConfig{
+			Name:       stream,
+			Subjects:   []string{subject, subject + DeadLetterSuffix},
+			Retention:  nats.LimitsPolicy,
+			Storage:    nats.FileStorage,
+			MaxAge:     jsMaxAge,
+			Duplicates: 2 * time.Minute,
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+	return js, nil
+}
+
+func streamName(subject string) string {
+	return strings.ToUpper(consumerName(subject))
+}
+
+// consumerName replaces the characters stream and consumer names can't contain.
+func consumerName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '.', '*', '>', ' ', '/', '\\':
+			return '_'
+		}
+		return r
+	}, name)
 }
@@ -0,0 +1,27 @@
+package nats
+
+import "example/saga/messaging"
+
+const (
+	// DriverCore publishes with core NATS, messages sent while a subscriber is down are lost.
+	DriverCore = "core"
+	// DriverJetStream keeps messages in JetStream streams until durable consumers got them.
+	DriverJetStream = "jetstream"
+)
+
+// NewPublisher creates a publisher of the driver, core NATS unless driver is DriverJetStream.
+func NewPublisher(driver, host, port, user, password, subject string) (messaging.Publisher, error) {
+	if driver == DriverJetStream {
+		return NewJetStreamPublisher(host, port, user, password, subject)
+	}
+	return NewNATSPublisher(host, port, user, password, subject)
+}
+
+// NewSubscriber creates a subscriber of the driver, core NATS unless driver is DriverJetStream.
+// With JetStream the queue group names the durable consumer.
+func NewSubscriber(driver, host, port, user, password, subject, queueGroup string) (messaging.Subscriber, error) {
+	if driver == DriverJetStream {
+		return NewJetStreamSubscriber(host, port, user, password, subject, queueGroup)
+	}
+	return NewNATSSubscriber(host, port, user, password, subject, queueGroup)
+}
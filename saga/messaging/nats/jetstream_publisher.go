@@ -0,0 +1,39 @@
+package nats
+
+import (
+	"encoding/json"
+	"example/saga/messaging"
+
+	"github.com/nats-io/nats.go"
+)
+
+// JetStreamPublisher publishes to a JetStream stream, so messages are kept until every
+// consumer got them. Messages carrying a saga envelope are published with their message id,
+// which lets the stream drop duplicates. Unlike core NATS, publishing fails while the
+// connection is reconnecting, as the stream has to acknowledge every message.
+type JetStreamPublisher struct {
+	js      nats.JetStreamContext
+	subject string
+}
+
+func NewJetStreamPublisher(host, port, user, password, subject string) (messaging.Publisher, error) {
+	js, err := getJetStream(host, port, user, password, subject)
+	if err != nil {
+		return nil, err
+	}
+	return &JetStreamPublisher{js: js, subject: subject}, nil
+}
+
+func (p *JetStreamPublisher) Publish(message interface{}) error {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	var opts []nats.PubOpt
+	var envelope messaging.Envelope
+	if json.Unmarshal(data, &envelope) == nil && envelope.MessageID != "" {
+		opts = append(opts, nats.MsgId(envelope.MessageID))
+	}
+	_, err = p.js.Publish(p.subject, data, opts...)
+	return err
+}
@@ -0,0 +1,136 @@
+package nats
+
+import (
+	"context"
+	"example/saga/messaging"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+const (
+	// jsMaxDeliver is how many times a message is delivered before it goes to the dead-letter
+	// subject.
+	jsMaxDeliver = 5
+	jsAckWait    = handleTimeout
+	// DeadLetterSuffix is appended to a subject to get the subject its dead letters go to.
+	DeadLetterSuffix = ".dlq"
+)
+
+// JetStreamSubscriber delivers the messages of a subject through a durable consumer, which
+// remembers what was acknowledged while the subscriber is down. A message whose handler fails
+// is delivered again with a growing delay, and after jsMaxDeliver deliveries it is moved to
+// the dead-letter subject, as is a message that fails with a Permanent error.
+type JetStreamSubscriber struct {
+	js      nats.JetStreamContext
+	subject string
+	stream  string
+	durable string
+}
+
+func NewJetStreamSubscriber(host, port, user, password, subject, durable string) (messaging.Subscriber, error) {
+	js, err := getJetStream(host, port, user, password, subject)
+	if err != nil {
+		return nil, err
+	}
+	return &JetStreamSubscriber{js: js, subject: subject, stream: streamName(subject), durable: consumerName(durable)}, nil
+}
+
+// Subscribe takes a func with a single argument, which messages are decoded into from JSON.
+func (s *JetStreamSubscriber) Subscribe(handler interface{}) error {
+	raw, err := messaging.Adapt(handler)
+	if err != nil {
+		return err
+	}
+	return s.SubscribeRaw(raw)
+}
+
+// SubscribeRaw acknowledges a message once its handler returned without an error. The
+// handler has until the message would be delivered again to handle it.
+func (s *JetStreamSubscriber) SubscribeRaw(handler messaging.RawHandler) error {
+	if err := s.ensureConsumer(); err != nil {
+		return err
+	}
+	_, err := s.js.QueueSubscribe(s.subject, s.durable, func(msg *nats.Msg) {
+		ctx, cancel := context.WithTimeout(context.Background(), jsAckWait)
+		defer cancel()
+		err := handler(ctx, msg.Data)
+		switch {
+		case messaging.IsPermanent(err):
+			s.deadLetter(msg, err.Error())
+		case err != nil:
+			s.retry(msg, err.Error())
+		default:
+			if err := msg.Ack(); err != nil {
+				log.Printf("Unable to ack message on %s: %v", s.subject, err)
+			}
+		}
+	},
+		nats.Bind(s.stream, s.durable),
+		nats.ManualAck(),
+	)
+	return err
+}
+
+// ensureConsumer creates the durable consumer unless it exists. A new consumer starts from the
+// first message the stream kept, so what was published before any subscriber came up is still
+// handled. The consumer is created here rather than by the subscription, as nats.go deletes a
+// consumer it created once its subscription is drained, and with it what the consumer
+// remembered.
+func (s *JetStreamSubscriber) ensureConsumer() error {
+	_, err := s.js.ConsumerInfo(s.stream, s.durable)
+	if err == nil {
+		return nil
+	}
+	if err != nats.ErrConsumerNotFound {
+		return err
+	}
+	// Every instance asks for the same config, so the one that loses the race gets the consumer
+	// the other one created.
+	_, err = s.js.AddConsumer(s.stream, &nats.ConsumerConfig{
+		Durable:        s.durable,
+		DeliverSubject: "deliver." + s.stream + "." + s.durable,
+		DeliverGroup:   s.durable,
+		DeliverPolicy:  nats.DeliverAllPolicy,
+		FilterSubject:  s.subject,
+		AckPolicy:      nats.AckExplicitPolicy,
+		AckWait:        jsAckWait,
+		MaxDeliver:     jsMaxDeliver,
+	})
+	return err
+}
+
+func (s *JetStreamSubscriber) retry(msg *nats.Msg, failure string) {
+	meta, err := msg.Metadata()
+	if err == nil && meta.NumDelivered >= jsMaxDeliver {
+		s.deadLetter(msg, fmt.Sprintf("%s, gave up after %d deliveries", failure, meta.NumDelivered))
+		return
+	}
+	delivered := uint64(1)
+	if err == nil {
+		delivered = meta.NumDelivered
+	}
+	log.Printf("Message on %s failed, delivery %d: %s", s.subject, delivered, failure)
+	if err := msg.NakWithDelay(time.Duration(delivered) * time.Second); err != nil {
+		log.Printf("Unable to nak message on %s: %v", s.subject, err)
+	}
+}
+
+// deadLetter moves a message to the dead-letter subject and stops its delivery. The reason is
+// kept in the Dead-Letter-Reason header.
+func (s *JetStreamSubscriber) deadLetter(msg *nats.Msg, reason string) {
+	log.Printf("Moving message on %s to %s: %s", s.subject, s.subject+DeadLetterSuffix, reason)
+	dead := nats.NewMsg(s.subject + DeadLetterSuffix)
+	dead.Data = msg.Data
+	dead.Header.Set("Dead-Letter-Reason", reason)
+	dead.Header.Set("Dead-Letter-Consumer", s.durable)
+	if _, err := s.js.PublishMsg(dead); err != nil {
+		log.Printf("Unable to dead-letter message on %s, leaving it for redelivery: %v", s.subject, err)
+		return
+	}
+	if err := msg.Term(); err != nil {
+		log.Printf("Unable to terminate message on %s: %v", s.subject, err)
+	}
+}
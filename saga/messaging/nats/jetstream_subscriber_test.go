@@ -0,0 +1,168 @@
+package nats
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	natsserver "github.com/nats-io/nats-server/v2/test"
+	"github.com/nats-io/nats.go"
+)
+
+const (
+	testUser     = "saga"
+	testPassword = "saga"
+)
+
+// runJetStream starts an embedded server with JetStream and returns its host and port. The
+// shared connections are drained before the server shuts down.
+func runJetStream(t *testing.T) (string, string) {
+	t.Helper()
+	opts := natsserver.DefaultTestOptions
+	opts.Port = -1
+	opts.JetStream = true
+	opts.StoreDir = t.TempDir()
+	opts.Username = testUser
+	opts.Password = testPassword
+	srv := natsserver.RunServer(&opts)
+	t.Cleanup(srv.Shutdown)
+	t.Cleanup(func() { _ = Drain() })
+	return "127.0.0.1", strconv.Itoa(srv.Addr().(*net.TCPAddr).Port)
+}
+
+// deliveries records what a handler was handed, and fails it the first fail times.
+type deliveries struct {
+	mu       sync.Mutex
+	fail     int
+	messages []string
+	received chan string
+}
+
+func newDeliveries(fail int) *deliveries {
+	return &deliveries{fail: fail, received: make(chan string, 100)}
+}
+
+func (d *deliveries) handle(ctx context.Context, data []byte) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.messages = append(d.messages, string(data))
+	d.received <- string(data)
+	if len(d.messages) <= d.fail {
+		return errors.New("handler failed")
+	}
+	return nil
+}
+
+func (d *deliveries) count() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.messages)
+}
+
+func (d *deliveries) await(t *testing.T, want string, timeout time.Duration) {
+	t.Helper()
+	select {
+	case got := <-d.received:
+		if got != want {
+			t.Fatalf("got message %q, want %q", got, want)
+		}
+	case <-time.After(timeout):
+		t.Fatalf("message %q was not delivered within %s", want, timeout)
+	}
+}
+
+func publish(t *testing.T, host, port, subject, data string) {
+	t.Helper()
+	publisher, err := NewJetStreamPublisher(host, port, testUser, testPassword, subject)
+	if err != nil {
+		t.Fatalf("creating publisher: %v", err)
+	}
+	if err := publisher.Publish(data); err != nil {
+		t.Fatalf("publishing %q: %v", data, err)
+	}
+}
+
+func subscribe(t *testing.T, host, port, subject, durable string, handler *deliveries) {
+	t.Helper()
+	subscriber, err := NewJetStreamSubscriber(host, port, testUser, testPassword, subject, durable)
+	if err != nil {
+		t.Fatalf("creating subscriber: %v", err)
+	}
+	if err := subscriber.SubscribeRaw(handler.handle); err != nil {
+		t.Fatalf("subscribing: %v", err)
+	}
+}
+
+func TestJetStreamSubscriberRedeliversFailedMessage(t *testing.T) {
+	host, port := runJetStream(t)
+	handler := newDeliveries(1)
+	subscribe(t, host, port, "test.redelivery", "redelivery", handler)
+
+	publish(t, host, port, "test.redelivery", "booking")
+	handler.await(t, `"booking"`, 5*time.Second)
+	handler.await(t, `"booking"`, 5*time.Second)
+
+	// The second delivery was acked, so there is no third one.
+	time.Sleep(3 * time.Second)
+	if got := handler.count(); got != 2 {
+		t.Fatalf("message was delivered %d times, want 2", got)
+	}
+}
+
+func TestJetStreamSubscriberDeadLettersAfterMaxDeliver(t *testing.T) {
+	host, port := runJetStream(t)
+	conn, err := nats.Connect("nats://"+host+":"+port, nats.UserInfo(testUser, testPassword))
+	if err != nil {
+		t.Fatalf("connecting: %v", err)
+	}
+	defer conn.Close()
+	dead, err := conn.SubscribeSync("test.poison" + DeadLetterSuffix)
+	if err != nil {
+		t.Fatalf("subscribing to dead letters: %v", err)
+	}
+	handler := newDeliveries(jsMaxDeliver)
+	subscribe(t, host, port, "test.poison", "poison", handler)
+
+	publish(t, host, port, "test.poison", "poison")
+	msg, err := dead.NextMsg(30 * time.Second)
+	if err != nil {
+		t.Fatalf("message was not dead-lettered: %v", err)
+	}
+	if string(msg.Data) != `"poison"` {
+		t.Fatalf("dead letter is %q, want %q", msg.Data, `"poison"`)
+	}
+	if msg.Header.Get("Dead-Letter-Reason") == "" || msg.Header.Get("Dead-Letter-Consumer") != "poison" {
+		t.Fatalf("dead letter headers are %v", msg.Header)
+	}
+	if got := handler.count(); got != jsMaxDeliver {
+		t.Fatalf("message was delivered %d times, want %d", got, jsMaxDeliver)
+	}
+}
+
+func TestJetStreamSubscriberResumesAfterRestart(t *testing.T) {
+	host, port := runJetStream(t)
+
+	// A message published before the consumer exists is still delivered.
+	publish(t, host, port, "test.restart", "before")
+	first := newDeliveries(0)
+	subscribe(t, host, port, "test.restart", "restart", first)
+	first.await(t, `"before"`, 5*time.Second)
+
+	// Shutting down drains the connection, the consumer has to outlive it.
+	if err := Drain(); err != nil {
+		t.Fatalf("draining: %v", err)
+	}
+	publish(t, host, port, "test.restart", "while down")
+
+	second := newDeliveries(0)
+	subscribe(t, host, port, "test.restart", "restart", second)
+	second.await(t, `"while down"`, 5*time.Second)
+	time.Sleep(time.Second)
+	if got := second.count(); got != 1 {
+		t.Fatalf("restarted subscriber got %d messages, want only the one published while it was down", got)
+	}
+}
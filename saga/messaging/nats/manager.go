@@ -0,0 +1,175 @@
+package nats
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+const (
+	// reconnectWait is how long to wait between attempts to reconnect. Attempts never stop.
+	reconnectWait = 2 * time.Second
+	// reconnectBufferSize is how much is published while reconnecting before Publish fails.
+	// What was buffered is sent once the connection is back.
+	reconnectBufferSize = 8 * 1024 * 1024
+	// drainTimeout is how long draining a connection may take before it is closed anyway.
+	drainTimeout = 20 * time.Second
+)
+
+// manager keeps one connection per server, which every publisher and subscriber of the
+// process shares.
+type manager struct {
+	mu          sync.Mutex
+	connections map[string]*managedConnection
+}
+
+type managedConnection struct {
+	conn   *nats.Conn
+	closed chan struct{}
+}
+
+var connections = &manager{connections: make(map[string]*managedConnection)}
+
+// getConnection returns the shared connection to the server, connecting to it first if no
+// publisher or subscriber did yet. A server that isn't up yet is retried in the background
+// like a lost connection.
+func getConnection(host, port, user, password string) (*nats.Conn, error) {
+	return connections.get(fmt.Sprintf("nats://%s:%s@%s:%s", user, password, host, port))
+}
+
+func (m *manager) get(url string) (*nats.Conn, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if managed, ok := m.connections[url]; ok && !managed.conn.IsClosed() {
+		return managed.conn, nil
+	}
+	managed := &managedConnection{closed: make(chan struct{})}
+	conn, err := nats.Connect(url,
+		nats.MaxReconnects(-1),
+		nats.ReconnectWait(reconnectWait),
+		nats.ReconnectBufSize(reconnectBufferSize),
+		nats.RetryOnFailedConnect(true),
+		nats.DrainTimeout(drainTimeout),
+		nats.DisconnectErrHandler(func(conn *nats.Conn, err error) {
+			log.Printf("Disconnected from NATS, reconnecting: %v", err)
+		}),
+		nats.ReconnectHandler(func(conn *nats.Conn) {
+			log.Printf("Reconnected to NATS at %s", conn.ConnectedUrlRedacted())
+		}),
+		nats.ClosedHandler(func(conn *nats.Conn) {
+			log.Printf("Connection to NATS closed")
+			close(managed.closed)
+		}),
+		nats.ErrorHandler(func(conn *nats.Conn, sub *nats.Subscription, err error) {
+			subject := ""
+			if sub != nil {
+				subject = sub.Subject
+			}
+			log.Printf("NATS error on %s: %v", subject, err)
+		}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	managed.conn = conn
+	m.connections[url] = managed
+	return conn, nil
+}
+
+// Drain stops every shared connection from receiving messages, lets the handlers running
+// finish, sends what is still buffered and closes the connections. It returns once they are
+// closed or after the drain timeout.
+func Drain() error {
+	return connections.drain()
+}
+
+func (m *manager) drain() error {
+	m.mu.Lock()
+	managed := make([]*managedConnection, 0, len(m.connections))
+	for _, connection := range m.connections {
+		managed = append(managed, connection)
+	}
+	m.mu.Unlock()
+	var errs []error
+	for _, connection := range managed {
+		if connection.conn.IsClosed() {
+			continue
+		}
+		if err := connection.conn.Drain(); err != nil {
+			errs = append(errs, err)
+			connection.conn.Close()
+		}
+	}
+	timeout := time.After(drainTimeout + time.Second)
+	for _, connection := range managed {
+		select {
+		case <-connection.closed:
+		case <-timeout:
+			return errors.Join(append(errs, errors.New("timed out draining NATS connections"))...)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ConnectionStatus describes a shared connection. State is CONNECTED, RECONNECTING, DRAINING
+// or CLOSED, among others. Buffered is how many bytes were published while reconnecting and
+// are not sent yet.
+type ConnectionStatus struct {
+	State      string `json:"state"`
+	Server     string `json:"server,omitempty"`
+	Reconnects uint64 `json:"reconnects"`
+	Buffered   int    `json:"buffered"`
+	LastError  string `json:"lastError,omitempty"`
+}
+
+// Connected tells whether messages go out right away.
+func (s ConnectionStatus) Connected() bool {
+	return s.State == nats.CONNECTED.String()
+}
+
+// Status describes every shared connection.
+func Status() []ConnectionStatus {
+	connections.mu.Lock()
+	defer connections.mu.Unlock()
+	statuses := make([]ConnectionStatus, 0, len(connections.connections))
+	for _, managed := range connections.connections {
+		conn := managed.conn
+		status := ConnectionStatus{
+			State:      conn.Status().String(),
+			Server:     conn.ConnectedUrlRedacted(),
+			Reconnects: conn.Stats().Reconnects,
+		}
+		status.Buffered, _ = conn.Buffered()
+		if err := conn.LastError(); err != nil {
+			status.LastError = err.Error()
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// HealthHandler reports the status of the shared connections, with 503 Service Unavailable
+// if any of them is not connected.
+func HealthHandler(rw http.ResponseWriter, r *http.Request) {
+	statuses := Status()
+	health := struct {
+		Status    string             `json:"status"`
+		Messaging []ConnectionStatus `json:"messaging"`
+	}{Status: "UP", Messaging: statuses}
+	code := http.StatusOK
+	for _, status := range statuses {
+		if !status.Connected() {
+			health.Status = "DOWN"
+			code = http.StatusServiceUnavailable
+		}
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(code)
+	_ = json.NewEncoder(rw).Encode(health)
+}
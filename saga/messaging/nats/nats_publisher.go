@@ -12,6 +12,9 @@ type Publisher struct {
 
 func NewNATSPublisher(host, port, user, password, subject string) (messaging.Publisher, error) {
 	conn, err := getConnection(host, port, user, password)
+	if err != nil {
+		return nil, err
+	}
 	encConn, err := nats.NewEncodedConn(conn, nats.JSON_ENCODER)
 	if err != nil {
 		return nil, err
@@ -1,12 +1,17 @@
 package nats
 
 import (
+	"context"
 	"example/saga/messaging"
+	"log"
+
 	"github.com/nats-io/nats.go"
 )
 
+// Subscriber delivers the messages of a subject with core NATS. Core NATS can't deliver a
+// message again, so a message whose handler fails is only logged.
 type Subscriber struct {
-	conn       *nats.EncodedConn
+	conn       *nats.Conn
 	subject    string
 	queueGroup string
 }
@@ -16,19 +21,29 @@ func NewNATSSubscriber(host, port, user, password, subject, queueGroup string) (
 	if err != nil {
 		return nil, err
 	}
-	encConn, err := nats.NewEncodedConn(conn, nats.JSON_ENCODER)
-	if err != nil {
-		return nil, err
-	}
 	return &Subscriber{
-		conn:       encConn,
+		conn:       conn,
 		subject:    subject,
 		queueGroup: queueGroup,
 	}, nil
 }
 
 func (s *Subscriber) Subscribe(handler interface{}) error {
-	_, err := s.conn.QueueSubscribe(s.subject, s.queueGroup, handler)
+	raw, err := messaging.Adapt(handler)
+	if err != nil {
+		return err
+	}
+	return s.SubscribeRaw(raw)
+}
+
+func (s *Subscriber) SubscribeRaw(handler messaging.RawHandler) error {
+	_, err := s.conn.QueueSubscribe(s.subject, s.queueGroup, func(msg *nats.Msg) {
+		ctx, cancel := context.WithTimeout(context.Background(), handleTimeout)
+		defer cancel()
+		if err := handler(ctx, msg.Data); err != nil {
+			log.Printf("Message on %s failed and is dropped: %v", s.subject, err)
+		}
+	})
 	if err != nil {
 		return err
 	}
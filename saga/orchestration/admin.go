@@ -0,0 +1,287 @@
+package orchestration
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	ActionRetry      = "retry"
+	ActionCompensate = "compensate"
+
+	OutcomeRequested = "requested"
+	OutcomeSucceeded = "succeeded"
+	OutcomeFailed    = "failed"
+
+	defaultListLimit = 100
+)
+
+// AuditEntry is an action an operator took on a saga. Every action is written twice: once
+// with OutcomeRequested and the step and status the saga was at before it was taken, and once
+// with the outcome and the step and status the saga was left at. Error tells why an action
+// failed.
+type AuditEntry struct {
+	Saga     string    `json:"saga"`
+	SagaID   string    `json:"sagaId"`
+	Action   string    `json:"action"`
+	Operator string    `json:"operator"`
+	Reason   string    `json:"reason"`
+	Outcome  string    `json:"outcome"`
+	Error    string    `json:"error,omitempty"`
+	Step     string    `json:"step"`
+	Status   Status    `json:"status"`
+	At       time.Time `json:"at"`
+}
+
+// AuditLog keeps the actions operators took on sagas.
+type AuditLog interface {
+	Append(ctx context.Context, entry AuditEntry) error
+	// Entries returns the actions taken on the saga with the given id, oldest first.
+	Entries(ctx context.Context, sagaID string) ([]AuditEntry, error)
+}
+
+// ActionRequest is what an operator sends to act on a saga. The reason is required, the
+// operator is known from their token.
+type ActionRequest struct {
+	Reason string `json:"reason"`
+}
+
+// Inspection is a saga along with the actions operators took on it.
+type Inspection[D any] struct {
+	Saga  *State[D]    `json:"saga"`
+	Audit []AuditEntry `json:"audit"`
+}
+
+// Admin is the HTTP API operators inspect and unstick the sagas of an orchestrator with:
+//
+//	GET  /sagas?status=Running&olderThan=1h&limit=50   sagas by status and age, oldest first
+//	GET  /sagas/{id}                                   a saga with its history and audit trail
+//	POST /sagas/{id}/retry                             publish the current step again
+//	POST /sagas/{id}/compensate                        give up on the saga and compensate it
+//
+// Every operator has a token of their own, which requests carry as a bearer token, and
+// actions are audited under the name of the operator the token belongs to. An action is
+// written to the audit log before it is taken, so an action that can't be audited is not
+// taken, and its outcome is written once it was taken.
+type Admin[D, C, R any] struct {
+	orchestrator *Orchestrator[D, C, R]
+	audit        AuditLog
+	operators    []operatorToken
+}
+
+type operatorToken struct {
+	name  string
+	token string
+}
+
+// NewAdmin creates the admin API of an orchestrator for the operators given as name=token
+// pairs separated by commas, like "ana=3f9c...,marko=a41e...".
+func NewAdmin[D, C, R any](orchestrator *Orchestrator[D, C, R], audit AuditLog, operatorTokens string) (*Admin[D, C, R], error) {
+	operators, err := parseOperatorTokens(operatorTokens)
+	if err != nil {
+		return nil, fmt.Errorf("admin API of saga %s: %w", orchestrator.definition.Name, err)
+	}
+	return &Admin[D, C, R]{orchestrator: orchestrator, audit: audit, operators: operators}, nil
+}
+
+func parseOperatorTokens(value string) ([]operatorToken, error) {
+	var operators []operatorToken
+	tokens := make(map[string]struct{})
+	for _, pair := range strings.Split(value, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		name, token, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || name == "" || token == "" {
+			return nil, fmt.Errorf("operator token %q must be name=token", pair)
+		}
+		if _, taken := tokens[token]; taken {
+			return nil, fmt.Errorf("operator %s shares a token with another operator", name)
+		}
+		tokens[token] = struct{}{}
+		operators = append(operators, operatorToken{name: name, token: token})
+	}
+	if len(operators) == 0 {
+		return nil, fmt.Errorf("no operator tokens")
+	}
+	return operators, nil
+}
+
+// operator returns the name of the operator the bearer token of the request belongs to. Every
+// token is compared, so how long it takes doesn't tell which one matched.
+func (a *Admin[D, C, R]) operator(r *http.Request) (string, bool) {
+	authorization := []byte(r.Header.Get("Authorization"))
+	var name string
+	for _, operator := range a.operators {
+		if subtle.ConstantTimeCompare(authorization, []byte("Bearer "+operator.token)) == 1 {
+			name = operator.name
+		}
+	}
+	return name, name != ""
+}
+
+func (a *Admin[D, C, R]) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	operator, ok := a.operator(r)
+	if !ok {
+		writeAdminError(rw, http.StatusUnauthorized, "invalid admin token")
+		return
+	}
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if parts[0] != "sagas" {
+		writeAdminError(rw, http.StatusNotFound, "not found")
+		return
+	}
+	switch {
+	case len(parts) == 1 && r.Method == http.MethodGet:
+		a.list(rw, r)
+	case len(parts) == 2 && r.Method == http.MethodGet:
+		a.inspect(rw, r, parts[1])
+	case len(parts) == 3 && r.Method == http.MethodPost && (parts[2] == ActionRetry || parts[2] == ActionCompensate):
+		a.act(rw, r, operator, parts[1], parts[2])
+	default:
+		writeAdminError(rw, http.StatusNotFound, "not found")
+	}
+}
+
+func (a *Admin[D, C, R]) list(rw http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := Filter{Limit: defaultListLimit}
+	for _, statuses := range query["status"] {
+		for _, status := range strings.Split(statuses, ",") {
+			filter.Statuses = append(filter.Statuses, Status(status))
+		}
+	}
+	if olderThan := query.Get("olderThan"); olderThan != "" {
+		age, err := time.ParseDuration(olderThan)
+		if err != nil {
+			writeAdminError(rw, http.StatusBadRequest, "olderThan must be a duration like 90m")
+			return
+		}
+		filter.CreatedBefore = a.orchestrator.now().Add(-age)
+	}
+	if limit := query.Get("limit"); limit != "" {
+		var err error
+		if filter.Limit, err = strconv.Atoi(limit); err != nil || filter.Limit <= 0 {
+			writeAdminError(rw, http.StatusBadRequest, "limit must be a positive number")
+			return
+		}
+	}
+	sagas, err := a.orchestrator.List(r.Context(), filter)
+	if err != nil {
+		writeAdminError(rw, adminErrorStatus(err), err.Error())
+		return
+	}
+	if sagas == nil {
+		sagas = []*State[D]{}
+	}
+	writeAdminResp(rw, http.StatusOK, sagas)
+}
+
+func (a *Admin[D, C, R]) inspect(rw http.ResponseWriter, r *http.Request, id string) {
+	state, err := a.orchestrator.Get(r.Context(), id)
+	if err != nil {
+		writeAdminError(rw, adminErrorStatus(err), err.Error())
+		return
+	}
+	entries, err := a.audit.Entries(r.Context(), id)
+	if err != nil {
+		writeAdminError(rw, adminErrorStatus(err), err.Error())
+		return
+	}
+	if entries == nil {
+		entries = []AuditEntry{}
+	}
+	writeAdminResp(rw, http.StatusOK, Inspection[D]{Saga: state, Audit: entries})
+}
+
+// act takes an operator's action on a saga. The saga is read first so the audit entry tells
+// where it stood; if it moves on in the meantime the action fails with a conflict.
+func (a *Admin[D, C, R]) act(rw http.ResponseWriter, r *http.Request, operator, id, action string) {
+	var request ActionRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Reason == "" {
+		writeAdminError(rw, http.StatusBadRequest, "reason is required")
+		return
+	}
+	state, err := a.orchestrator.Get(r.Context(), id)
+	if err != nil {
+		writeAdminError(rw, adminErrorStatus(err), err.Error())
+		return
+	}
+	entry := AuditEntry{
+		Saga:     a.orchestrator.definition.Name,
+		SagaID:   id,
+		Action:   action,
+		Operator: operator,
+		Reason:   request.Reason,
+		Outcome:  OutcomeRequested,
+		Step:     state.Step,
+		Status:   state.Status,
+		At:       a.orchestrator.now(),
+	}
+	if err := a.audit.Append(r.Context(), entry); err != nil {
+		a.orchestrator.logger.Printf("Unable to audit %s of saga %s %s by %s: %v", action, entry.Saga, id, operator, err)
+		writeAdminError(rw, http.StatusServiceUnavailable, "unable to write the audit log, nothing was done")
+		return
+	}
+	a.orchestrator.logger.Printf("Operator %s asked to %s saga %s %s: %s", operator, action, entry.Saga, id, request.Reason)
+	var acted *State[D]
+	if action == ActionRetry {
+		acted, err = a.orchestrator.Retry(r.Context(), id, fmt.Sprintf("Retried by %s: %s", operator, request.Reason))
+	} else {
+		acted, err = a.orchestrator.Compensate(r.Context(), id, fmt.Sprintf("Compensation forced by %s: %s", operator, request.Reason))
+	}
+	a.auditOutcome(r.Context(), entry, acted, err)
+	if err != nil {
+		writeAdminError(rw, adminErrorStatus(err), err.Error())
+		return
+	}
+	writeAdminResp(rw, http.StatusOK, acted)
+}
+
+// auditOutcome writes how an action went. The action was already taken, so an outcome that
+// can't be written is only logged.
+func (a *Admin[D, C, R]) auditOutcome(ctx context.Context, entry AuditEntry, state *State[D], err error) {
+	entry.Outcome = OutcomeSucceeded
+	if err != nil {
+		entry.Outcome = OutcomeFailed
+		entry.Error = err.Error()
+	}
+	if state != nil {
+		entry.Step = state.Step
+		entry.Status = state.Status
+	}
+	entry.At = a.orchestrator.now()
+	if auditErr := a.audit.Append(ctx, entry); auditErr != nil {
+		a.orchestrator.logger.Printf("Unable to audit outcome of %s of saga %s %s by %s, it %s: %v", entry.Action, entry.Saga, entry.SagaID, entry.Operator, entry.Outcome, auditErr)
+	}
+}
+
+func adminErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrFinished), errors.Is(err, ErrNotRunning), errors.Is(err, ErrConflict):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func writeAdminError(rw http.ResponseWriter, status int, message string) {
+	writeAdminResp(rw, status, struct {
+		Error string `json:"error"`
+	}{Error: message})
+}
+
+func writeAdminResp(rw http.ResponseWriter, status int, body interface{}) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(status)
+	_ = json.NewEncoder(rw).Encode(body)
+}
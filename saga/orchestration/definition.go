@@ -0,0 +1,90 @@
+package orchestration
+
+import (
+	"context"
+	"time"
+
+	"example/saga/messaging"
+)
+
+const (
+	defaultStepTimeout             = 30 * time.Second
+	defaultMaxAttempts             = 3
+	defaultMaxCompensationAttempts = 10
+	defaultMaxBackoff              = 15 * time.Minute
+)
+
+// Definition declares a saga: its steps in the order they run, and how its replies are read.
+// D is the data the saga carries from start to end, C the type of the commands it publishes
+// and R the type of the replies it receives.
+//
+// Steps run one after another, each waiting for the reply to its action. When a step fails,
+// the saga compensates it and every step before it, last step first. A failed step is
+// compensated too, since it may have been partly applied, so compensations must be safe to
+// run for a step that left nothing behind.
+type Definition[D, C, R any] struct {
+	Name  string
+	Steps []Step[D, C]
+	// Outcome returns the envelope of a reply and whether the command it answers succeeded.
+	Outcome func(reply *R) (messaging.Envelope, bool)
+
+	// StepTimeout is how long the first attempt of a step waits for its reply. Every further
+	// attempt waits twice as long, up to MaxBackoff.
+	StepTimeout time.Duration
+	MaxBackoff  time.Duration
+	// MaxAttempts is how many times an action is published before the step counts as failed.
+	MaxAttempts int
+	// MaxCompensationAttempts is how many times a compensation is published before the saga
+	// fails and is left to an operator.
+	MaxCompensationAttempts int
+}
+
+// Step is one step of a saga. Action builds the command that runs the step and Compensation
+// the command that undoes it, both sent with the given envelope. A step without an action
+// stands for work done before the saga started, and a step without a compensation has
+// nothing to undo.
+type Step[D, C any] struct {
+	Name         string
+	Action       func(envelope messaging.Envelope, data D) C
+	Compensation func(envelope messaging.Envelope, data D) C
+	// Check, if set, is asked before an action is published again whether an earlier attempt
+	// got through after all, so the saga can move on without running the step twice.
+	Check func(ctx context.Context, data D) (bool, error)
+}
+
+func (d Definition[D, C, R]) withDefaults() Definition[D, C, R] {
+	if d.StepTimeout <= 0 {
+		d.StepTimeout = defaultStepTimeout
+	}
+	if d.MaxBackoff <= 0 {
+		d.MaxBackoff = defaultMaxBackoff
+	}
+	if d.MaxAttempts <= 0 {
+		d.MaxAttempts = defaultMaxAttempts
+	}
+	if d.MaxCompensationAttempts <= 0 {
+		d.MaxCompensationAttempts = defaultMaxCompensationAttempts
+	}
+	return d
+}
+
+func (d Definition[D, C, R]) index(step string) int {
+	for i := range d.Steps {
+		if d.Steps[i].Name == step {
+			return i
+		}
+	}
+	return -1
+}
+
+// backoff is how long the given attempt of a step waits for its reply.
+func (d Definition[D, C, R]) backoff(attempt int) time.Duration {
+	timeout := d.StepTimeout
+	for i := 1; i < attempt && timeout < d.MaxBackoff; i++ {
+		timeout *= 2
+	}
+	if timeout > d.MaxBackoff {
+		return d.MaxBackoff
+	}
+	return timeout
+}
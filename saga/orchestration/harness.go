@@ -0,0 +1,170 @@
+package orchestration
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"example/saga/messaging"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Participant simulates the services a saga talks to. It answers a command with the reply
+// the service would send, a failure reply if fail is set. A participant that returns false
+// doesn't reply at all.
+type Participant[C, R any] func(command C, fail bool) (reply R, ok bool)
+
+// Harness runs sagas of a definition in memory against a simulated participant, so the way
+// a saga goes through failed, lost and late steps can be checked without a broker or a
+// database. Time only moves when Advance is called.
+//
+//	h, _ := orchestration.NewHarness(definition, participant)
+//	h.Fail("CreateAvailability")
+//	state, _ := h.Start(data)
+//	state, _ = h.State(state.ID) // Compensated, with both compensations in h.Sent
+type Harness[D, C, R any] struct {
+	Orchestrator *Orchestrator[D, C, R]
+	Store        *MemoryStore[D]
+	// Sent lists the commands published so far, as "<step> action" or "<step> compensation",
+	// with " dropped" added to those that got no reply.
+	Sent []string
+
+	participant Participant[C, R]
+	queue       []C
+	failing     map[string]bool
+	dropping    map[string]int
+	clock       time.Time
+}
+
+// NewHarness creates a harness for the definition. Its orchestrator logs nothing.
+func NewHarness[D, C, R any](definition Definition[D, C, R], participant Participant[C, R]) (*Harness[D, C, R], error) {
+	h := &Harness[D, C, R]{
+		Store:       NewMemoryStore[D](),
+		participant: participant,
+		failing:     make(map[string]bool),
+		dropping:    make(map[string]int),
+		clock:       time.Now().UTC(),
+	}
+	bus := &harnessBus[D, C, R]{harness: h}
+	orchestrator, err := New(definition, h.Store, bus, bus, trace.NewNoopTracerProvider().Tracer(""), log.New(io.Discard, "", 0))
+	if err != nil {
+		return nil, err
+	}
+	orchestrator.now = func() time.Time { return h.clock }
+	h.Orchestrator = orchestrator
+	return h, nil
+}
+
+// Fail makes the action of the step answer with a failure reply.
+func (h *Harness[D, C, R]) Fail(step string) {
+	h.failing[step] = true
+}
+
+// Drop makes the next times commands of the step, actions and compensations alike, get lost
+// without a reply.
+func (h *Harness[D, C, R]) Drop(step string, times int) {
+	h.dropping[step] += times
+}
+
+// Start starts a saga and runs it until it waits for a reply that doesn't come.
+func (h *Harness[D, C, R]) Start(data D) (*State[D], error) {
+	state, err := h.Orchestrator.Start(context.Background(), data)
+	if err != nil {
+		return nil, err
+	}
+	if err := h.Run(); err != nil {
+		return nil, err
+	}
+	return h.State(state.ID)
+}
+
+// Advance moves time on, retries the steps that timed out in the meantime and runs the sagas
+// on.
+func (h *Harness[D, C, R]) Advance(d time.Duration) error {
+	h.clock = h.clock.Add(d)
+	h.Orchestrator.RetryOverdue(context.Background())
+	return h.Run()
+}
+
+// Run delivers the published commands to the participant and its replies to the
+// orchestrator, until no command is left.
+func (h *Harness[D, C, R]) Run() error {
+	for len(h.queue) > 0 {
+		command := h.queue[0]
+		h.queue = h.queue[1:]
+		record, err := h.record(command)
+		if err != nil {
+			return err
+		}
+		sent := record.Step + " action"
+		if record.Status == Compensating {
+			sent = record.Step + " compensation"
+		}
+		if h.dropping[record.Step] > 0 {
+			h.dropping[record.Step]--
+			h.Sent = append(h.Sent, sent+" dropped")
+			continue
+		}
+		h.Sent = append(h.Sent, sent)
+		reply, ok := h.participant(command, record.Status == Running && h.failing[record.Step])
+		if ok {
+			if err := h.Orchestrator.Handle(context.Background(), &reply); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// State returns the saga with the given id as it is stored.
+func (h *Harness[D, C, R]) State(id string) (*State[D], error) {
+	return h.Store.Get(context.Background(), id)
+}
+
+// record returns the move of the saga that published the command.
+func (h *Harness[D, C, R]) record(command C) (*Record, error) {
+	encoded, err := json.Marshal(command)
+	if err != nil {
+		return nil, err
+	}
+	var envelope messaging.Envelope
+	if err := json.Unmarshal(encoded, &envelope); err != nil {
+		return nil, err
+	}
+	state, err := h.State(envelope.SagaID)
+	if err != nil {
+		return nil, err
+	}
+	record := state.command(envelope.MessageID)
+	if record == nil {
+		return nil, fmt.Errorf("saga %s never published command %s", envelope.SagaID, envelope.MessageID)
+	}
+	return record, nil
+}
+
+// harnessBus stands in for the broker between the orchestrator and the participant.
+type harnessBus[D, C, R any] struct {
+	harness *Harness[D, C, R]
+}
+
+func (b *harnessBus[D, C, R]) Publish(message interface{}) error {
+	command, ok := message.(C)
+	if !ok {
+		return fmt.Errorf("unexpected command %T", message)
+	}
+	b.harness.queue = append(b.harness.queue, command)
+	return nil
+}
+
+// Subscribe accepts a handler; replies are handed to the orchestrator by Run directly.
+func (b *harnessBus[D, C, R]) Subscribe(interface{}) error {
+	return nil
+}
+
+// SubscribeRaw accepts the orchestrator's handler; replies are handed to it by Run directly.
+func (b *harnessBus[D, C, R]) SubscribeRaw(messaging.RawHandler) error {
+	return nil
+}
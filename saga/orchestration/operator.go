@@ -0,0 +1,86 @@
+package orchestration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrFinished is returned when an operator retries a saga that already finished.
+	ErrFinished = errors.New("saga has finished")
+	// ErrNotRunning is returned when an operator forces compensation of a saga that isn't
+	// running its steps.
+	ErrNotRunning = errors.New("saga is not running")
+)
+
+// List returns the sagas that match the filter, oldest first.
+func (o *Orchestrator[D, C, R]) List(ctx context.Context, filter Filter) ([]*State[D], error) {
+	return o.store.List(ctx, filter)
+}
+
+// Retry publishes the current step of a saga again at an operator's request, with all its
+// attempts ahead of it. A Failed saga goes back to compensating the step it gave up on. note
+// is recorded in the history of the saga.
+func (o *Orchestrator[D, C, R]) Retry(ctx context.Context, id, note string) (*State[D], error) {
+	ctx, span := o.tracer.Start(ctx, "Orchestrator.Retry")
+	defer span.End()
+	state, step, err := o.current(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	status, build := Running, step.Action
+	switch state.Status {
+	case Running:
+	case Compensating, Failed:
+		status, build = Compensating, step.Compensation
+	default:
+		return nil, fmt.Errorf("%w: saga %s %s is %s", ErrFinished, o.definition.Name, id, state.Status)
+	}
+	if build == nil {
+		return nil, fmt.Errorf("step %s of saga %s %s has no command to publish", step.Name, o.definition.Name, id)
+	}
+	state.Attempts = 0
+	return o.settle(state, o.publish(ctx, state, step.Name, status, note, "", build))
+}
+
+// Compensate gives up on a running saga at an operator's request, and compensates its current
+// step and every step before it. note is recorded in the history of the saga.
+func (o *Orchestrator[D, C, R]) Compensate(ctx context.Context, id, note string) (*State[D], error) {
+	ctx, span := o.tracer.Start(ctx, "Orchestrator.Compensate")
+	defer span.End()
+	state, _, err := o.current(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if state.Status != Running {
+		return nil, fmt.Errorf("%w: saga %s %s is %s", ErrNotRunning, o.definition.Name, id, state.Status)
+	}
+	return o.settle(state, o.compensate(ctx, state, o.definition.index(state.Step), note, ""))
+}
+
+// current returns the saga with the given id and the step it is at.
+func (o *Orchestrator[D, C, R]) current(ctx context.Context, id string) (*State[D], Step[D, C], error) {
+	state, err := o.store.Get(ctx, id)
+	if err != nil {
+		return nil, Step[D, C]{}, err
+	}
+	i := o.definition.index(state.Step)
+	if i < 0 {
+		return nil, Step[D, C]{}, fmt.Errorf("saga %s %s is at unknown step %s", o.definition.Name, id, state.Step)
+	}
+	return state, o.definition.Steps[i], nil
+}
+
+// settle returns the saga an operator moved. A command that couldn't be published is published
+// again at its deadline, so the move stands.
+func (o *Orchestrator[D, C, R]) settle(state *State[D], err error) (*State[D], error) {
+	if errors.Is(err, errNotPublished) {
+		o.logger.Printf("Unable to move saga %s %s: %v", o.definition.Name, state.ID, err)
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return state, nil
+}
@@ -0,0 +1,273 @@
+package orchestration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"example/saga/messaging"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// errNotPublished is returned when a saga was moved to its next step but the command of that
+// step couldn't be published.
+var errNotPublished = errors.New("command not published")
+
+// Logger is what the orchestrator logs its moves to. *log.Logger and logrus loggers fit it.
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// Orchestrator runs the sagas of one definition. It publishes the command of the current
+// step of a saga, moves the saga on when the reply comes, and publishes a step again when
+// its reply doesn't come in time.
+type Orchestrator[D, C, R any] struct {
+	definition Definition[D, C, R]
+	store      Store[D]
+	publisher  messaging.Publisher
+	tracer     trace.Tracer
+	logger     Logger
+	now        func() time.Time
+}
+
+// New creates the orchestrator of the sagas of the definition and subscribes it to their
+// replies. A nil logger logs to the standard logger.
+func New[D, C, R any](definition Definition[D, C, R], store Store[D], publisher messaging.Publisher, replies messaging.Subscriber, tracer trace.Tracer, logger Logger) (*Orchestrator[D, C, R], error) {
+	if len(definition.Steps) == 0 {
+		return nil, fmt.Errorf("saga %s has no steps", definition.Name)
+	}
+	if definition.Outcome == nil {
+		return nil, fmt.Errorf("saga %s doesn't say how its replies are read", definition.Name)
+	}
+	if logger == nil {
+		logger = log.Default()
+	}
+	o := &Orchestrator[D, C, R]{
+		definition: definition.withDefaults(),
+		store:      store,
+		publisher:  publisher,
+		tracer:     tracer,
+		logger:     logger,
+		now:        func() time.Time { return time.Now().UTC() },
+	}
+	if err := messaging.Subscribe(replies, o.Handle); err != nil {
+		return nil, fmt.Errorf("unable to subscribe to replies of saga %s: %w", definition.Name, err)
+	}
+	return o, nil
+}
+
+// Start stores a new saga and publishes the action of its first step. If that command can't
+// be published the saga ends as Compensated right away and the error is returned, leaving
+// whatever was done before the saga started to the caller.
+func (o *Orchestrator[D, C, R]) Start(ctx context.Context, data D) (*State[D], error) {
+	ctx, span := o.tracer.Start(ctx, "Orchestrator.Start")
+	defer span.End()
+	state := &State[D]{
+		ID:        o.store.NewID(),
+		Saga:      o.definition.Name,
+		Data:      data,
+		CreatedAt: o.now(),
+	}
+	if err := o.forward(ctx, state, 0, "Started", ""); err != nil {
+		if state.Version > 0 {
+			state.moveTo(state.Step, Compensated, "Unable to publish command: "+err.Error(), o.now())
+			state.Deadline = time.Time{}
+			if saveErr := o.store.Save(ctx, state); saveErr != nil {
+				o.logger.Printf("Unable to end saga %s %s: %v", o.definition.Name, state.ID, saveErr)
+			}
+		}
+		return nil, err
+	}
+	return state, nil
+}
+
+// Get returns the saga with the given id.
+func (o *Orchestrator[D, C, R]) Get(ctx context.Context, id string) (*State[D], error) {
+	return o.store.Get(ctx, id)
+}
+
+// Resume publishes the current step of every saga that was in flight when the service
+// stopped, since replies sent in the meantime are lost.
+func (o *Orchestrator[D, C, R]) Resume(ctx context.Context) {
+	sagas, err := o.store.InFlight(ctx)
+	if err != nil {
+		o.logger.Printf("Unable to resume sagas %s: %v", o.definition.Name, err)
+		return
+	}
+	for _, state := range sagas {
+		o.retry(ctx, state, "Resumed after restart")
+	}
+}
+
+// RetryOverdue retries the sagas whose current step got no reply before its deadline.
+func (o *Orchestrator[D, C, R]) RetryOverdue(ctx context.Context) {
+	sagas, err := o.store.Overdue(ctx, o.now())
+	if err != nil {
+		o.logger.Printf("Unable to get overdue sagas %s: %v", o.definition.Name, err)
+		return
+	}
+	for _, state := range sagas {
+		o.retry(ctx, state, fmt.Sprintf("Step %s timed out", state.Step))
+	}
+}
+
+// StartTimeouts retries overdue sagas every interval until ctx is done.
+func (o *Orchestrator[D, C, R]) StartTimeouts(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				o.RetryOverdue(ctx)
+			}
+		}
+	}()
+}
+
+// Handle moves a saga on the reply to its current step. Replies to sagas that are no longer
+// in flight, replies already handled and replies to commands of earlier steps are ignored.
+// An error means the saga couldn't be read or stored, and the reply should come again.
+func (o *Orchestrator[D, C, R]) Handle(ctx context.Context, reply *R) error {
+	envelope, succeeded := o.definition.Outcome(reply)
+	ctx, span := o.tracer.Start(envelope.Context(ctx), "Orchestrator.Handle")
+	defer span.End()
+	state, err := o.store.Get(ctx, envelope.SagaID)
+	if errors.Is(err, ErrNotFound) {
+		o.logger.Printf("No saga %s %s for reply %s", o.definition.Name, envelope.SagaID, envelope.MessageID)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("unable to get saga %s %s: %w", o.definition.Name, envelope.SagaID, err)
+	}
+	if !state.InFlight() || state.HasReply(envelope.MessageID) {
+		o.logger.Printf("Ignoring reply %s to saga %s %s, already handled", envelope.MessageID, o.definition.Name, state.ID)
+		return nil
+	}
+	command := state.command(envelope.CausationID)
+	if command == nil || command.Step != state.Step || command.Status != state.Status {
+		o.logger.Printf("Ignoring reply %s to saga %s %s, it doesn't answer step %s", envelope.MessageID, o.definition.Name, state.ID, state.Step)
+		return nil
+	}
+	i := o.definition.index(state.Step)
+	switch {
+	case state.Status == Running && succeeded:
+		err = o.forward(ctx, state, i+1, fmt.Sprintf("Step %s succeeded", state.Step), envelope.MessageID)
+	case state.Status == Running:
+		err = o.compensate(ctx, state, i, fmt.Sprintf("Step %s failed", state.Step), envelope.MessageID)
+	case succeeded:
+		err = o.compensate(ctx, state, i-1, fmt.Sprintf("Step %s compensated", state.Step), envelope.MessageID)
+	default:
+		o.logger.Printf("Compensation of step %s of saga %s %s failed, it is published again at its deadline", state.Step, o.definition.Name, state.ID)
+		return nil
+	}
+	if errors.Is(err, errNotPublished) {
+		// The saga was stored at its next step, which is published again at its deadline.
+		o.logger.Printf("Unable to move saga %s %s: %v", o.definition.Name, state.ID, err)
+		return nil
+	}
+	return err
+}
+
+// retry publishes the current step of a saga again. An action that ran out of attempts fails
+// its step, and a compensation that ran out of attempts fails the saga.
+func (o *Orchestrator[D, C, R]) retry(ctx context.Context, state *State[D], note string) {
+	i := o.definition.index(state.Step)
+	if i < 0 {
+		o.logger.Printf("Saga %s %s is at unknown step %s", o.definition.Name, state.ID, state.Step)
+		return
+	}
+	step := o.definition.Steps[i]
+	var err error
+	switch {
+	case state.Status == Running && state.Attempts >= o.definition.MaxAttempts:
+		err = o.compensate(ctx, state, i, fmt.Sprintf("%s, gave up after %d attempts", note, state.Attempts), "")
+	case state.Status == Compensating && state.Attempts >= o.definition.MaxCompensationAttempts:
+		state.moveTo(state.Step, Failed, fmt.Sprintf("%s, gave up after %d attempts", note, state.Attempts), o.now())
+		state.Deadline = time.Time{}
+		if err = o.store.Save(ctx, state); err == nil {
+			o.logger.Printf("Saga %s %s failed to compensate step %s and needs an operator", o.definition.Name, state.ID, state.Step)
+		}
+	case state.Status == Running && step.Check != nil:
+		done, checkErr := step.Check(ctx, state.Data)
+		switch {
+		case checkErr != nil:
+			state.Attempts++
+			state.Deadline = o.now().Add(o.definition.backoff(state.Attempts))
+			err = o.store.Save(ctx, state)
+		case done:
+			err = o.forward(ctx, state, i+1, fmt.Sprintf("%s, step %s succeeded", note, step.Name), "")
+		default:
+			err = o.publish(ctx, state, step.Name, Running, note, "", step.Action)
+		}
+	case state.Status == Running:
+		err = o.publish(ctx, state, step.Name, Running, note, "", step.Action)
+	default:
+		err = o.publish(ctx, state, step.Name, Compensating, note, "", step.Compensation)
+	}
+	if err != nil {
+		o.logger.Printf("Unable to retry saga %s %s: %v", o.definition.Name, state.ID, err)
+	}
+}
+
+// forward runs the first step from the given one that has an action, or completes the saga
+// if there is none.
+func (o *Orchestrator[D, C, R]) forward(ctx context.Context, state *State[D], from int, note, replyID string) error {
+	for i := from; i < len(o.definition.Steps); i++ {
+		if step := o.definition.Steps[i]; step.Action != nil {
+			return o.publish(ctx, state, step.Name, Running, note, replyID, step.Action)
+		}
+	}
+	return o.publish(ctx, state, o.definition.Steps[len(o.definition.Steps)-1].Name, Completed, note, replyID, nil)
+}
+
+// compensate undoes the first step from the given one backwards that has a compensation, or
+// ends the saga as compensated if there is none.
+func (o *Orchestrator[D, C, R]) compensate(ctx context.Context, state *State[D], from int, note, replyID string) error {
+	for i := from; i >= 0; i-- {
+		if step := o.definition.Steps[i]; step.Compensation != nil {
+			return o.publish(ctx, state, step.Name, Compensating, note, replyID, step.Compensation)
+		}
+	}
+	return o.publish(ctx, state, o.definition.Steps[0].Name, Compensated, note, replyID, nil)
+}
+
+// publish stores the saga at its next step before publishing the command of that step, so a
+// command is never out without the saga knowing it waits for the reply. replyID is the
+// message id of the reply that moved the saga, if a reply did. Without a command the saga
+// has finished.
+func (o *Orchestrator[D, C, R]) publish(ctx context.Context, state *State[D], step string, status Status, note, replyID string, build func(messaging.Envelope, D) C) error {
+	now := o.now()
+	record := state.moveTo(step, status, note, now)
+	record.ReplyID = replyID
+	state.Deadline = time.Time{}
+	var command C
+	if build != nil {
+		state.Attempts++
+		state.Deadline = now.Add(o.definition.backoff(state.Attempts))
+		envelope := messaging.NewEnvelope(ctx, state.ID, replyID)
+		envelope.Deadline = state.Deadline
+		record.CommandID = envelope.MessageID
+		command = build(envelope, state.Data)
+	}
+	if err := o.store.Save(ctx, state); err != nil {
+		return err
+	}
+	if build == nil {
+		o.logger.Printf("Saga %s %s finished as %s", o.definition.Name, state.ID, status)
+		return nil
+	}
+	kind := "action"
+	if status == Compensating {
+		kind = "compensation"
+	}
+	o.logger.Printf("Publishing %s of step %s of saga %s %s, attempt %d", kind, step, o.definition.Name, state.ID, state.Attempts)
+	if err := o.publisher.Publish(command); err != nil {
+		return fmt.Errorf("%w: step %s of saga %s: %w", errNotPublished, step, state.ID, err)
+	}
+	return nil
+}
@@ -0,0 +1,254 @@
+package orchestration
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"example/saga/messaging"
+)
+
+const testStepTimeout = 10 * time.Second
+
+type testCommand struct {
+	messaging.Envelope
+	Step       string `json:"step"`
+	Compensate bool   `json:"compensate"`
+}
+
+type testReply struct {
+	messaging.Envelope
+	Step      string `json:"step"`
+	Succeeded bool   `json:"succeeded"`
+}
+
+type testData struct {
+	Name string `json:"name"`
+}
+
+func testStep(name string) Step[testData, testCommand] {
+	return Step[testData, testCommand]{
+		Name: name,
+		Action: func(envelope messaging.Envelope, _ testData) testCommand {
+			return testCommand{Envelope: envelope, Step: name}
+		},
+		Compensation: func(envelope messaging.Envelope, _ testData) testCommand {
+			return testCommand{Envelope: envelope, Step: name, Compensate: true}
+		},
+	}
+}
+
+// newTestHarness runs a saga of three steps, A, B and C, against a participant that answers
+// every command and keeps its replies in replies.
+func newTestHarness(t *testing.T, replies *[]testReply) *Harness[testData, testCommand, testReply] {
+	t.Helper()
+	definition := Definition[testData, testCommand, testReply]{
+		Name:  "test",
+		Steps: []Step[testData, testCommand]{testStep("A"), testStep("B"), testStep("C")},
+		Outcome: func(reply *testReply) (messaging.Envelope, bool) {
+			return reply.Envelope, reply.Succeeded
+		},
+		StepTimeout: testStepTimeout,
+		MaxAttempts: 2,
+	}
+	h, err := NewHarness(definition, func(command testCommand, fail bool) (testReply, bool) {
+		reply := testReply{Envelope: command.Reply(context.Background()), Step: command.Step, Succeeded: !fail}
+		*replies = append(*replies, reply)
+		return reply, true
+	})
+	if err != nil {
+		t.Fatalf("creating harness: %v", err)
+	}
+	return h
+}
+
+func assertSent(t *testing.T, h *Harness[testData, testCommand, testReply], want ...string) {
+	t.Helper()
+	if !reflect.DeepEqual(h.Sent, want) {
+		t.Fatalf("sent %q, want %q", h.Sent, want)
+	}
+}
+
+func assertStatus(t *testing.T, state *State[testData], step string, status Status) {
+	t.Helper()
+	if state.Step != step || state.Status != status {
+		t.Fatalf("saga is %s at step %s, want %s at step %s", state.Status, state.Step, status, step)
+	}
+}
+
+func TestOrchestratorCompletesSaga(t *testing.T) {
+	var replies []testReply
+	h := newTestHarness(t, &replies)
+	state, err := h.Start(testData{Name: "saga"})
+	if err != nil {
+		t.Fatalf("starting saga: %v", err)
+	}
+	assertStatus(t, state, "C", Completed)
+	assertSent(t, h, "A action", "B action", "C action")
+}
+
+func TestOrchestratorCompensatesInReverseOrderWhenStepFails(t *testing.T) {
+	var replies []testReply
+	h := newTestHarness(t, &replies)
+	h.Fail("C")
+	state, err := h.Start(testData{Name: "saga"})
+	if err != nil {
+		t.Fatalf("starting saga: %v", err)
+	}
+	assertStatus(t, state, "A", Compensated)
+	// The failed step is compensated too, it may have been partly applied.
+	assertSent(t, h, "A action", "B action", "C action", "C compensation", "B compensation", "A compensation")
+}
+
+func TestOrchestratorIgnoresDuplicateAndLateReplies(t *testing.T) {
+	var replies []testReply
+	h := newTestHarness(t, &replies)
+	h.Drop("C", 1)
+	started, err := h.Start(testData{Name: "saga"})
+	if err != nil {
+		t.Fatalf("starting saga: %v", err)
+	}
+	assertStatus(t, started, "C", Running)
+
+	// The reply to A comes again, and the reply to B is redelivered after it was handled.
+	for _, reply := range replies {
+		reply := reply
+		if err := h.Orchestrator.Handle(context.Background(), &reply); err != nil {
+			t.Fatalf("handling reply to %s again: %v", reply.Step, err)
+		}
+	}
+	state, err := h.State(started.ID)
+	if err != nil {
+		t.Fatalf("getting saga: %v", err)
+	}
+	if state.Version != started.Version || len(state.History) != len(started.History) {
+		t.Fatalf("saga moved on replies it already handled: %+v", state.History)
+	}
+
+	// A failure reply to A that comes once the saga is past it doesn't turn the saga around.
+	late := testReply{Envelope: messaging.NewEnvelope(context.Background(), started.ID, started.History[0].CommandID), Step: "A"}
+	if err := h.Orchestrator.Handle(context.Background(), &late); err != nil {
+		t.Fatalf("handling late reply: %v", err)
+	}
+	state, err = h.State(started.ID)
+	if err != nil {
+		t.Fatalf("getting saga: %v", err)
+	}
+	assertStatus(t, state, "C", Running)
+	if state.Version != started.Version {
+		t.Fatalf("saga moved on a late reply: %+v", state.History)
+	}
+}
+
+func TestOrchestratorRetriesStepThatTimedOut(t *testing.T) {
+	var replies []testReply
+	h := newTestHarness(t, &replies)
+	h.Drop("B", 1)
+	started, err := h.Start(testData{Name: "saga"})
+	if err != nil {
+		t.Fatalf("starting saga: %v", err)
+	}
+	assertStatus(t, started, "B", Running)
+
+	if err := h.Advance(testStepTimeout - time.Second); err != nil {
+		t.Fatalf("advancing: %v", err)
+	}
+	assertSent(t, h, "A action", "B action dropped")
+
+	if err := h.Advance(time.Second); err != nil {
+		t.Fatalf("advancing: %v", err)
+	}
+	state, err := h.State(started.ID)
+	if err != nil {
+		t.Fatalf("getting saga: %v", err)
+	}
+	assertStatus(t, state, "C", Completed)
+	assertSent(t, h, "A action", "B action dropped", "B action", "C action")
+}
+
+func TestOrchestratorCompensatesStepThatRanOutOfAttempts(t *testing.T) {
+	var replies []testReply
+	h := newTestHarness(t, &replies)
+	h.Drop("B", 2)
+	started, err := h.Start(testData{Name: "saga"})
+	if err != nil {
+		t.Fatalf("starting saga: %v", err)
+	}
+	// The second attempt waits twice as long as the first.
+	if err := h.Advance(testStepTimeout); err != nil {
+		t.Fatalf("advancing: %v", err)
+	}
+	if err := h.Advance(2 * testStepTimeout); err != nil {
+		t.Fatalf("advancing: %v", err)
+	}
+	state, err := h.State(started.ID)
+	if err != nil {
+		t.Fatalf("getting saga: %v", err)
+	}
+	assertStatus(t, state, "A", Compensated)
+	assertSent(t, h, "A action", "B action dropped", "B action dropped", "B compensation", "A compensation")
+}
+
+// racingStore lets another writer save a saga between the orchestrator reading it and saving
+// it.
+type racingStore struct {
+	*MemoryStore[testData]
+	race func()
+}
+
+func (s *racingStore) Save(ctx context.Context, state *State[testData]) error {
+	if race := s.race; race != nil {
+		s.race = nil
+		race()
+	}
+	return s.MemoryStore.Save(ctx, state)
+}
+
+func TestOrchestratorLeavesReplyForRedeliveryOnVersionConflict(t *testing.T) {
+	var replies []testReply
+	h := newTestHarness(t, &replies)
+	store := &racingStore{MemoryStore: h.Store}
+	h.Orchestrator.store = store
+	h.Drop("B", 1)
+	started, err := h.Start(testData{Name: "saga"})
+	if err != nil {
+		t.Fatalf("starting saga: %v", err)
+	}
+
+	store.race = func() {
+		concurrent, err := h.Store.Get(context.Background(), started.ID)
+		if err != nil {
+			t.Fatalf("getting saga: %v", err)
+		}
+		if err := h.Store.Save(context.Background(), concurrent); err != nil {
+			t.Fatalf("saving saga concurrently: %v", err)
+		}
+	}
+	reply := testReply{Envelope: messaging.NewEnvelope(context.Background(), started.ID, started.History[len(started.History)-1].CommandID), Step: "B", Succeeded: true}
+	if err := h.Orchestrator.Handle(context.Background(), &reply); !errors.Is(err, ErrConflict) {
+		t.Fatalf("handling reply got %v, want %v", err, ErrConflict)
+	}
+	state, err := h.State(started.ID)
+	if err != nil {
+		t.Fatalf("getting saga: %v", err)
+	}
+	assertStatus(t, state, "B", Running)
+	if len(state.History) != len(started.History) {
+		t.Fatalf("saga moved although its save conflicted: %+v", state.History)
+	}
+
+	// The reply comes again and moves the saga this time.
+	if err := h.Orchestrator.Handle(context.Background(), &reply); err != nil {
+		t.Fatalf("handling redelivered reply: %v", err)
+	}
+	if err := h.Run(); err != nil {
+		t.Fatalf("running saga: %v", err)
+	}
+	state, err = h.State(started.ID)
+	if err != nil {
+		t.Fatalf("getting saga: %v", err)
+	}
+	assertStatus(t, state, "C", Completed)
+}
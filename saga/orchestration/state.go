@@ -0,0 +1,81 @@
+package orchestration
+
+import "time"
+
+type Status string
+
+const (
+	Running      Status = "Running"
+	Compensating Status = "Compensating"
+	Completed    Status = "Completed"
+	Compensated  Status = "Compensated"
+	Failed       Status = "Failed"
+)
+
+// State is the progress of one saga instance. It is stored before every command the
+// orchestrator publishes, so a saga can be picked up again after a restart. Step is the step
+// whose action runs while the saga is Running, or whose compensation runs while it is
+// Compensating.
+type State[D any] struct {
+	ID        string    `json:"id"`
+	Saga      string    `json:"saga"`
+	Data      D         `json:"data"`
+	Step      string    `json:"step"`
+	Status    Status    `json:"status"`
+	Attempts  int       `json:"attempts"`
+	Deadline  time.Time `json:"deadline"`
+	Version   int       `json:"-"`
+	History   []Record  `json:"history"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// Record is one move of a saga. CommandID is the message id of the command published with
+// the move and ReplyID the message id of the reply that caused it, if any.
+type Record struct {
+	Step      string    `json:"step"`
+	Status    Status    `json:"status"`
+	Note      string    `json:"note,omitempty"`
+	CommandID string    `json:"commandId,omitempty"`
+	ReplyID   string    `json:"replyId,omitempty"`
+	At        time.Time `json:"at"`
+}
+
+// InFlight reports whether the saga still waits for a reply.
+func (s *State[D]) InFlight() bool {
+	return s.Status == Running || s.Status == Compensating
+}
+
+// HasReply reports whether the saga already moved on the reply with the given message id.
+func (s *State[D]) HasReply(messageID string) bool {
+	for _, record := range s.History {
+		if record.ReplyID == messageID {
+			return true
+		}
+	}
+	return false
+}
+
+// command returns the record of the move that published the command with the given message
+// id, or nil if the saga never published it.
+func (s *State[D]) command(messageID string) *Record {
+	for i := range s.History {
+		if s.History[i].CommandID == messageID {
+			return &s.History[i]
+		}
+	}
+	return nil
+}
+
+// moveTo sets the step and status of the saga and records the move in its history. Attempts
+// start over whenever the saga moves to another step or from running it to compensating it.
+func (s *State[D]) moveTo(step string, status Status, note string, now time.Time) *Record {
+	if s.Step != step || s.Status != status {
+		s.Attempts = 0
+	}
+	s.Step = step
+	s.Status = status
+	s.UpdatedAt = now
+	s.History = append(s.History, Record{Step: step, Status: status, Note: note, At: now})
+	return &s.History[len(s.History)-1]
+}
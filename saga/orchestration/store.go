@@ -0,0 +1,135 @@
+package orchestration
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nuid"
+)
+
+var (
+	ErrNotFound = errors.New("saga not found")
+	// ErrConflict is returned by Save when the saga was changed since it was read.
+	ErrConflict = errors.New("saga was changed concurrently")
+)
+
+// Store keeps the state of sagas between their steps.
+type Store[D any] interface {
+	// NewID returns the id of a saga that is about to start.
+	NewID() string
+	// Save stores the saga if nobody else changed it since it was read, and returns
+	// ErrConflict otherwise. A saga with version 0 was never saved; every save increments the
+	// version of the saga.
+	Save(ctx context.Context, state *State[D]) error
+	// Get returns the saga with the given id, or ErrNotFound.
+	Get(ctx context.Context, id string) (*State[D], error)
+	// InFlight returns the sagas that are Running or Compensating, oldest first.
+	InFlight(ctx context.Context) ([]*State[D], error)
+	// Overdue returns the sagas in flight whose current step passed its deadline.
+	Overdue(ctx context.Context, now time.Time) ([]*State[D], error)
+	// List returns the sagas that match the filter, oldest first.
+	List(ctx context.Context, filter Filter) ([]*State[D], error)
+}
+
+// Filter selects the sagas to list. Fields left empty don't filter.
+type Filter struct {
+	Statuses []Status
+	// CreatedBefore selects the sagas that started before it, so the ones stuck for a while
+	// can be told from the ones that just started.
+	CreatedBefore time.Time
+	Limit         int
+}
+
+// matches tells whether the filter selects the saga, Limit aside.
+func matches[D any](f Filter, state *State[D]) bool {
+	if !f.CreatedBefore.IsZero() && !state.CreatedAt.Before(f.CreatedBefore) {
+		return false
+	}
+	if len(f.Statuses) == 0 {
+		return true
+	}
+	for _, status := range f.Statuses {
+		if state.Status == status {
+			return true
+		}
+	}
+	return false
+}
+
+// MemoryStore keeps sagas in memory. It serves a single process, so it is meant for tests and
+// for sagas that don't need to survive a restart.
+type MemoryStore[D any] struct {
+	mu    sync.Mutex
+	sagas map[string]State[D]
+}
+
+func NewMemoryStore[D any]() *MemoryStore[D] {
+	return &MemoryStore[D]{sagas: make(map[string]State[D])}
+}
+
+func (m *MemoryStore[D]) NewID() string {
+	return nuid.Next()
+}
+
+func (m *MemoryStore[D]) Save(_ context.Context, state *State[D]) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored, exists := m.sagas[state.ID]
+	if (state.Version == 0 && exists) || (state.Version > 0 && (!exists || stored.Version != state.Version)) {
+		return ErrConflict
+	}
+	state.Version++
+	m.sagas[state.ID] = clone(state)
+	return nil
+}
+
+func (m *MemoryStore[D]) Get(_ context.Context, id string) (*State[D], error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored, exists := m.sagas[id]
+	if !exists {
+		return nil, ErrNotFound
+	}
+	state := clone(&stored)
+	return &state, nil
+}
+
+func (m *MemoryStore[D]) InFlight(_ context.Context) ([]*State[D], error) {
+	return m.find(func(state *State[D]) bool { return state.InFlight() }), nil
+}
+
+func (m *MemoryStore[D]) Overdue(_ context.Context, now time.Time) ([]*State[D], error) {
+	return m.find(func(state *State[D]) bool { return state.InFlight() && !state.Deadline.After(now) }), nil
+}
+
+func (m *MemoryStore[D]) List(_ context.Context, filter Filter) ([]*State[D], error) {
+	sagas := m.find(func(state *State[D]) bool { return matches(filter, state) })
+	if filter.Limit > 0 && len(sagas) > filter.Limit {
+		sagas = sagas[:filter.Limit]
+	}
+	return sagas, nil
+}
+
+func (m *MemoryStore[D]) find(match func(*State[D]) bool) []*State[D] {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var sagas []*State[D]
+	for _, stored := range m.sagas {
+		if match(&stored) {
+			state := clone(&stored)
+			sagas = append(sagas, &state)
+		}
+	}
+	sort.Slice(sagas, func(i, j int) bool { return sagas[i].CreatedAt.Before(sagas[j].CreatedAt) })
+	return sagas
+}
+
+// clone copies the saga so that the stored copy doesn't share its history with the caller's.
+func clone[D any](state *State[D]) State[D] {
+	copied := *state
+	copied.History = append([]Record(nil), state.History...)
+	return copied
+}
@@ -0,0 +1,9 @@
+package domain
+
+import (
+	events "example/saga/delete_user"
+	"example/saga/orchestration"
+)
+
+// DeleteUserSagaState is the progress of the deletion of a user account.
+type DeleteUserSagaState = orchestration.State[events.UserDetails]
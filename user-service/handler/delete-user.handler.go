@@ -0,0 +1,66 @@
+package handler
+
+import (
+	"context"
+	goerrors "errors"
+	events "example/saga/delete_user"
+	saga "example/saga/messaging"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+	"user-service/config"
+	"user-service/service"
+)
+
+const sagaSource = "delete-user-handler"
+
+// DeleteUserCommandHandler runs the step of the delete-user saga that belongs to
+// user-service: deleting the profile and announcing that the account is gone.
+type DeleteUserCommandHandler struct {
+	userService    *service.UserService
+	replyPublisher saga.Publisher
+	eventPublisher saga.Publisher
+	tracer         trace.Tracer
+	logger         *config.Logger
+}
+
+func NewDeleteUserCommandHandler(userService *service.UserService, replyPublisher, eventPublisher saga.Publisher, commandSubscriber saga.Subscriber, tracer trace.Tracer, logger *config.Logger) (*DeleteUserCommandHandler, error) {
+	handler := &DeleteUserCommandHandler{
+		userService:    userService,
+		replyPublisher: replyPublisher,
+		eventPublisher: eventPublisher,
+		tracer:         tracer,
+		logger:         logger,
+	}
+	if err := saga.Subscribe(commandSubscriber, handler.handle); err != nil {
+		logger.LogError(sagaSource, fmt.Sprintf("Unable to subscribe to commandSubscriber: %v", err))
+		return nil, err
+	}
+	return handler, nil
+}
+
+// handle deletes the profile and publishes AccountDeleted before replying. Both are safe to
+// repeat, so a command that failed is simply run again when it is delivered again.
+func (handler *DeleteUserCommandHandler) handle(ctx context.Context, command *events.DeleteUserCommand) error {
+	if command.Type != events.DeleteProfile {
+		return nil
+	}
+	ctx, span := handler.tracer.Start(ctx, "DeleteUserCommandHandler.handle")
+	defer span.End()
+	user := command.Payload
+	if err := handler.userService.DeleteProfile(ctx, user.UserID); err != nil {
+		return goerrors.New(err.GetErrorMessage())
+	}
+	event := events.AccountDeleted{UserID: user.UserID, Role: user.Role, DeletedAt: time.Now().UTC()}
+	if err := handler.eventPublisher.Publish(event); err != nil {
+		handler.logger.LogError(sagaSource, fmt.Sprintf("Unable to announce deletion of user %s: %v", user.UserID, err))
+		return err
+	}
+	reply := events.DeleteUserReply{Envelope: command.Envelope.Reply(ctx), Type: events.ProfileDeleted, Payload: user}
+	if err := handler.replyPublisher.Publish(reply); err != nil {
+		handler.logger.LogError(sagaSource, fmt.Sprintf("Unable to reply to command %v: %v", command.Type, err))
+		return err
+	}
+	return nil
+}
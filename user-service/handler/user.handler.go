@@ -175,10 +175,25 @@ func (u UserHandler) DeleteHandler(rw http.ResponseWriter, h *http.Request) {
 		utils.WriteErrorResponse("Not authorized", 401, "api/delete", rw)
 		return
 	}
-	err := u.UserService.DeleteUser(ctx, role.(string), id)
+	saga, err := u.UserService.DeleteUser(ctx, role.(string), id)
 	if err != nil {
 		utils.WriteErrorResponse(err.GetErrorMessage(), err.GetErrorStatus(), "api/delete", rw)
 		return
 	}
-	utils.WriteResp(id, 200, rw)
+	utils.WriteResp(saga, 202, rw)
+}
+
+func (u UserHandler) GetDeletionSaga(rw http.ResponseWriter, h *http.Request) {
+	ctx, cancel := context.WithTimeout(h.Context(), time.Second*3)
+	defer cancel()
+	ctx, span := u.Tracer.Start(ctx, "UserHandler.GetDeletionSaga")
+	defer span.End()
+	sagaID := mux.Vars(h)["id"]
+	userID, _ := ctx.Value("userID").(string)
+	saga, err := u.UserService.GetDeletionSaga(ctx, userID, sagaID)
+	if err != nil {
+		utils.WriteErrorResponse(err.GetErrorMessage(), err.GetErrorStatus(), "api/sagas", rw)
+		return
+	}
+	utils.WriteResp(saga, 200, rw)
 }
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"example/saga/messaging/nats"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/propagation"
 
@@ -14,11 +15,13 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"syscall"
 	"time"
 	"user-service/client"
 	"user-service/config"
 	"user-service/handler"
 	"user-service/middleware"
+	"user-service/orchestrator"
 	"user-service/repository"
 	"user-service/service"
 	"user-service/tracing"
@@ -45,10 +48,6 @@ func main() {
 
 	reservationsServiceHost := os.Getenv("RESERVATIONS_SERVICE_HOST")
 	reservationsServicePort := os.Getenv("RESERVATIONS_SERVICE_PORT")
-	authServiceHost := os.Getenv("AUTH_SERVICE_HOST")
-	authServicePort := os.Getenv("AUTH_SERVICE_PORT")
-	accServiceHost := os.Getenv("ACCOMMODATION_SERVICE_HOST")
-	accServicePort := os.Getenv("ACCOMMODATION_SERVICE_PORT")
 
 	//clients
 
@@ -60,34 +59,6 @@ func main() {
 		},
 	}
 
-	customAuthServiceClient := &http.Client{
-		Transport: &http.Transport{
-			MaxIdleConns:        10,
-			MaxIdleConnsPerHost: 10,
-			MaxConnsPerHost:     10,
-		},
-	}
-
-	customAccServiceClient := &http.Client{
-		Transport: &http.Transport{
-			MaxIdleConns:        10,
-			MaxIdleConnsPerHost: 10,
-			MaxConnsPerHost:     10,
-		},
-	}
-
-	authServiceCircuitBreaker := gobreaker.NewCircuitBreaker(
-		gobreaker.Settings{
-			Name:        "auth-service",
-			MaxRequests: 1,
-			Timeout:     10 * time.Second,
-			Interval:    0,
-			OnStateChange: func(name string, from gobreaker.State, to gobreaker.State) {
-				log.Printf("Circuit Breaker %v: %v -> %v", name, from, to)
-			},
-		},
-	)
-
 	reservationsServiceCircuitBreaker := gobreaker.NewCircuitBreaker(
 		gobreaker.Settings{
 			Name:        "reservations-service",
@@ -99,21 +70,8 @@ func main() {
 			},
 		},
 	)
-	accommodationServiceCircuitBreaker := gobreaker.NewCircuitBreaker(
-		gobreaker.Settings{
-			Name:        "accommodation-service",
-			MaxRequests: 1,
-			Timeout:     30 * time.Second,
-			Interval:    0,
-			OnStateChange: func(name string, from gobreaker.State, to gobreaker.State) {
-				log.Printf("Circuit Breaker %v: %v -> %v", name, from, to)
-			},
-		},
-	)
 
 	reservationsClient := client.NewReservationClient(reservationsServiceHost, reservationsServicePort, customReservationsServiceClient, reservationsServiceCircuitBreaker, tracer)
-	authClient := client.NewAuthClient(authServiceHost, authServicePort, customAuthServiceClient, authServiceCircuitBreaker, tracer)
-	accClient := client.NewAccClient(accServiceHost, accServicePort, customAccServiceClient, accommodationServiceCircuitBreaker, tracer)
 
 	// service
 
@@ -123,14 +81,96 @@ func main() {
 	}
 	userRepo := repository.NewUserRepository(mongoService.GetCli(), logger, tracer)
 	validator := utils.NewValidator()
-	userService := service.NewUserService(userRepo, validator, reservationsClient, authClient, accClient, logger, tracer)
+
+	// delete-user saga
+
+	commandPublisher, err := nats.NewPublisher(
+		os.Getenv("MESSAGING_DRIVER"),
+		os.Getenv("NATS_HOST"),
+		os.Getenv("NATS_PORT"),
+		os.Getenv("NATS_USER"),
+		os.Getenv("NATS_PASS"),
+		os.Getenv("DELETE_USER_COMMAND_SUBJECT"),
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+	replySubscriber, err := nats.NewSubscriber(
+		os.Getenv("MESSAGING_DRIVER"),
+		os.Getenv("NATS_HOST"),
+		os.Getenv("NATS_PORT"),
+		os.Getenv("NATS_USER"),
+		os.Getenv("NATS_PASS"),
+		os.Getenv("DELETE_USER_REPLY_SUBJECT"),
+		"user-service")
+	if err != nil {
+		log.Fatal(err)
+	}
+	sagaStepTimeout, err := time.ParseDuration(os.Getenv("SAGA_STEP_TIMEOUT"))
+	if err != nil {
+		sagaStepTimeout = 30 * time.Second
+	}
+	sagaTimeoutInterval, err := time.ParseDuration(os.Getenv("SAGA_TIMEOUT_INTERVAL"))
+	if err != nil {
+		sagaTimeoutInterval = 10 * time.Second
+	}
+	sagaRepo := repository.NewSagaRepository(mongoService.GetCli(), logger, tracer)
+	orch, err := orchestrator.NewDeleteUserOrchestrator(commandPublisher, replySubscriber, sagaRepo, sagaStepTimeout, tracer, logger)
+	if err != nil {
+		log.Fatal(err)
+	}
+	userService := service.NewUserService(userRepo, validator, reservationsClient, orch, logger, tracer)
 	profileHandler := handler.NewUserHandler(userService, logger, tracer)
 
+	replyPublisher, err := nats.NewPublisher(
+		os.Getenv("MESSAGING_DRIVER"),
+		os.Getenv("NATS_HOST"),
+		os.Getenv("NATS_PORT"),
+		os.Getenv("NATS_USER"),
+		os.Getenv("NATS_PASS"),
+		os.Getenv("DELETE_USER_REPLY_SUBJECT"),
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+	accountDeletedPublisher, err := nats.NewPublisher(
+		os.Getenv("MESSAGING_DRIVER"),
+		os.Getenv("NATS_HOST"),
+		os.Getenv("NATS_PORT"),
+		os.Getenv("NATS_USER"),
+		os.Getenv("NATS_PASS"),
+		os.Getenv("ACCOUNT_DELETED_SUBJECT"),
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+	commandSubscriber, err := nats.NewSubscriber(
+		os.Getenv("MESSAGING_DRIVER"),
+		os.Getenv("NATS_HOST"),
+		os.Getenv("NATS_PORT"),
+		os.Getenv("NATS_USER"),
+		os.Getenv("NATS_PASS"),
+		os.Getenv("DELETE_USER_COMMAND_SUBJECT"),
+		"user-service")
+	if err != nil {
+		log.Fatal(err)
+	}
+	_, err = handler.NewDeleteUserCommandHandler(userService, replyPublisher, accountDeletedPublisher, commandSubscriber, tracer, logger)
+	if err != nil {
+		log.Fatal(err)
+	}
+	orch.Resume(context.Background())
+	sagaTimeoutContext, stopSagaTimeouts := context.WithCancel(context.Background())
+	defer stopSagaTimeouts()
+	orch.StartTimeouts(sagaTimeoutContext, sagaTimeoutInterval)
+
 	// router
 
 	router := mux.NewRouter()
+	router.HandleFunc("/health", nats.HealthHandler).Methods("GET")
 
 	router.HandleFunc("/{id}", middleware.ValidateJWT(profileHandler.DeleteHandler)).Methods("DELETE")
+	router.HandleFunc("/sagas/{id}", middleware.ValidateJWT(profileHandler.GetDeletionSaga)).Methods("GET")
 	router.HandleFunc("/create", profileHandler.CreateHandler).Methods("POST")
 	router.HandleFunc("/{id}", middleware.ValidateJWT(profileHandler.UpdateHandler)).Methods("PUT")
 	router.HandleFunc("/all", profileHandler.GetAllHandler).Methods("GET")
@@ -167,18 +207,26 @@ func main() {
 		}
 	}()
 
-	sigCh := make(chan os.Signal)
+	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, os.Interrupt)
 	signal.Notify(sigCh, os.Kill)
+	signal.Notify(sigCh, syscall.SIGTERM)
 
 	sig := <-sigCh
 	logger.Println("Received terminate, graceful shutdown", sig)
 
 	//Try to shut down gracefully
-	if server.Shutdown(timeoutContext) != nil {
+	shutdownContext, cancelShutdown := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancelShutdown()
+	shutdownErr := server.Shutdown(shutdownContext)
+	// Handlers still running finish and buffered messages go out before the connection closes.
+	if err := nats.Drain(); err != nil {
+		logger.Println("Cannot drain messaging connections", err)
+	}
+	if shutdownErr != nil {
 		logger.Fatal("Error during graceful shutdown", log.Fields{
 			"module": source,
-			"error":  err.Error(),
+			"error":  shutdownErr.Error(),
 		})
 	}
 	logger.LogInfo(source, "Server shut down")
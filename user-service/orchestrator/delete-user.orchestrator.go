@@ -0,0 +1,129 @@
+package orchestrator
+
+import (
+	"context"
+	goerrors "errors"
+	events "example/saga/delete_user"
+	saga "example/saga/messaging"
+	"example/saga/orchestration"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+	"user-service/config"
+	"user-service/domain"
+	"user-service/errors"
+	"user-service/repository"
+)
+
+const (
+	source         = "delete-user-orchestrator"
+	sagaDeleteUser = "DeleteUser"
+
+	// Accommodations are suspended before reservations are checked, so no new reservation
+	// slips in between. The profile is deleted last, once nothing can be undone anymore.
+	sagaStepSuspendAccommodations = "SuspendAccommodations"
+	sagaStepCheckReservations     = "CheckReservations"
+	sagaStepDisableCredentials    = "DisableCredentials"
+	sagaStepDeleteProfile         = "DeleteProfile"
+)
+
+type DeleteUserOrchestrator struct {
+	saga   *orchestration.Orchestrator[events.UserDetails, events.DeleteUserCommand, events.DeleteUserReply]
+	repo   *repository.SagaRepository
+	logger *config.Logger
+}
+
+func NewDeleteUserOrchestrator(publisher saga.Publisher, replySubscriber saga.Subscriber, repo *repository.SagaRepository, stepTimeout time.Duration, tracer trace.Tracer, logger *config.Logger) (*DeleteUserOrchestrator, error) {
+	definition := orchestration.Definition[events.UserDetails, events.DeleteUserCommand, events.DeleteUserReply]{
+		Name: sagaDeleteUser,
+		Steps: []orchestration.Step[events.UserDetails, events.DeleteUserCommand]{
+			{
+				Name:         sagaStepSuspendAccommodations,
+				Action:       command(events.SuspendAccommodations),
+				Compensation: command(events.RestoreAccommodations),
+			},
+			{
+				Name:   sagaStepCheckReservations,
+				Action: command(events.CheckReservations),
+			},
+			{
+				Name:         sagaStepDisableCredentials,
+				Action:       command(events.DisableCredentials),
+				Compensation: command(events.EnableCredentials),
+			},
+			{
+				Name:   sagaStepDeleteProfile,
+				Action: command(events.DeleteProfile),
+			},
+		},
+		Outcome: func(reply *events.DeleteUserReply) (saga.Envelope, bool) {
+			switch reply.Type {
+			case events.AccommodationsSuspended, events.AccommodationsRestored, events.NoOpenReservations,
+				events.CredentialsDisabled, events.CredentialsEnabled, events.ProfileDeleted:
+				return reply.Envelope, true
+			default:
+				return reply.Envelope, false
+			}
+		},
+		StepTimeout: stepTimeout,
+	}
+	orchestrator, err := orchestration.New(definition, repo, publisher, replySubscriber, tracer, logger)
+	if err != nil {
+		logger.LogError(source, fmt.Sprintf("Unable to subscribe to reply Subscriber: %v", err))
+		return nil, err
+	}
+	return &DeleteUserOrchestrator{saga: orchestrator, repo: repo, logger: logger}, nil
+}
+
+// command builds the command of the given type for a step of the saga.
+func command(commandType events.DeleteUserCommandType) func(saga.Envelope, events.UserDetails) events.DeleteUserCommand {
+	return func(envelope saga.Envelope, user events.UserDetails) events.DeleteUserCommand {
+		return events.DeleteUserCommand{
+			Envelope: envelope,
+			Type:     commandType,
+			Payload:  user,
+		}
+	}
+}
+
+// Start starts deleting the account of the user, or returns the saga already deleting it.
+func (duo *DeleteUserOrchestrator) Start(ctx context.Context, userID, role string) (*domain.DeleteUserSagaState, *errors.ErrorStruct) {
+	running, err := duo.repo.InFlightForUser(ctx, userID)
+	if err != nil {
+		return nil, errors.NewError(err.Error(), 500)
+	}
+	if running != nil {
+		return running, nil
+	}
+	state, err := duo.saga.Start(ctx, events.UserDetails{UserID: userID, Role: role})
+	if err != nil {
+		duo.logger.LogError(source, fmt.Sprintf("Unable to start deleting user %s: %v", userID, err))
+		return nil, errors.NewError("Service is not responding correctly", 500)
+	}
+	duo.logger.LogInfo(source, fmt.Sprintf("Deleting user %s in saga %s", userID, state.ID))
+	return state, nil
+}
+
+// GetSaga returns the progress of a saga to the user whose account it deletes.
+func (duo *DeleteUserOrchestrator) GetSaga(ctx context.Context, userID, id string) (*domain.DeleteUserSagaState, *errors.ErrorStruct) {
+	state, err := duo.saga.Get(ctx, id)
+	if goerrors.Is(err, orchestration.ErrNotFound) || (err == nil && state.Data.UserID != userID) {
+		return nil, errors.NewError("Saga not found", 404)
+	}
+	if err != nil {
+		return nil, errors.NewError(err.Error(), 500)
+	}
+	return state, nil
+}
+
+// Resume publishes the current step of every saga that was in flight when the service
+// stopped.
+func (duo *DeleteUserOrchestrator) Resume(ctx context.Context) {
+	duo.saga.Resume(ctx)
+}
+
+// StartTimeouts retries overdue sagas every interval until ctx is done.
+func (duo *DeleteUserOrchestrator) StartTimeouts(ctx context.Context, interval time.Duration) {
+	duo.saga.StartTimeouts(ctx, interval)
+}
@@ -0,0 +1,160 @@
+package repository
+
+import (
+	"context"
+	events "example/saga/delete_user"
+	"example/saga/orchestration"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel/trace"
+	"user-service/config"
+	"user-service/domain"
+)
+
+const sagaCol = "sagas"
+
+// SagaRepository stores the sagas that delete user accounts.
+type SagaRepository struct {
+	cli    *mongo.Client
+	logger *config.Logger
+	tracer trace.Tracer
+}
+
+var _ orchestration.Store[events.UserDetails] = SagaRepository{}
+
+// sagaDocument keys the stored saga by its id.
+type sagaDocument struct {
+	ID    string                     `bson:"_id"`
+	State domain.DeleteUserSagaState `bson:",inline"`
+}
+
+func NewSagaRepository(cli *mongo.Client, logger *config.Logger, tracer trace.Tracer) *SagaRepository {
+	return &SagaRepository{
+		cli:    cli,
+		logger: logger,
+		tracer: tracer,
+	}
+}
+
+func (sr SagaRepository) collection() *mongo.Collection {
+	return sr.cli.Database(userDB).Collection(sagaCol)
+}
+
+func (sr SagaRepository) NewID() string {
+	return primitive.NewObjectID().Hex()
+}
+
+// Save inserts a saga that was never saved, and otherwise replaces it only if its version is
+// still the one it was read at.
+func (sr SagaRepository) Save(ctx context.Context, state *domain.DeleteUserSagaState) error {
+	ctx, span := sr.tracer.Start(ctx, "SagaRepo.Save")
+	defer span.End()
+	document := sagaDocument{ID: state.ID, State: *state}
+	document.State.Version++
+	var err error
+	if state.Version == 0 {
+		_, err = sr.collection().InsertOne(ctx, document)
+		if mongo.IsDuplicateKeyError(err) {
+			return orchestration.ErrConflict
+		}
+	} else {
+		var result *mongo.UpdateResult
+		result, err = sr.collection().ReplaceOne(ctx, bson.M{"_id": state.ID, "version": state.Version}, document)
+		if err == nil && result.MatchedCount == 0 {
+			return orchestration.ErrConflict
+		}
+	}
+	if err != nil {
+		sr.logger.LogError(source, fmt.Sprintf("Unable to save saga %s: %v", state.ID, err))
+		return fmt.Errorf("unable to save saga %s, database error", state.ID)
+	}
+	state.Version = document.State.Version
+	return nil
+}
+
+func (sr SagaRepository) Get(ctx context.Context, id string) (*domain.DeleteUserSagaState, error) {
+	ctx, span := sr.tracer.Start(ctx, "SagaRepo.Get")
+	defer span.End()
+	var document sagaDocument
+	err := sr.collection().FindOne(ctx, bson.M{"_id": id}).Decode(&document)
+	if err == mongo.ErrNoDocuments {
+		return nil, orchestration.ErrNotFound
+	}
+	if err != nil {
+		sr.logger.LogError(source, fmt.Sprintf("Unable to find saga %s: %v", id, err))
+		return nil, fmt.Errorf("unable to retrieve saga %s, database error", id)
+	}
+	return &document.State, nil
+}
+
+func (sr SagaRepository) InFlight(ctx context.Context) ([]*domain.DeleteUserSagaState, error) {
+	ctx, span := sr.tracer.Start(ctx, "SagaRepo.InFlight")
+	defer span.End()
+	return sr.find(ctx, bson.M{"status": bson.M{"$in": []orchestration.Status{orchestration.Running, orchestration.Compensating}}}, 0)
+}
+
+func (sr SagaRepository) Overdue(ctx context.Context, now time.Time) ([]*domain.DeleteUserSagaState, error) {
+	ctx, span := sr.tracer.Start(ctx, "SagaRepo.Overdue")
+	defer span.End()
+	return sr.find(ctx, bson.M{
+		"status":   bson.M{"$in": []orchestration.Status{orchestration.Running, orchestration.Compensating}},
+		"deadline": bson.M{"$lte": now},
+	}, 0)
+}
+
+// InFlightForUser returns the saga that is deleting the account of the user, or nil if none is.
+func (sr SagaRepository) InFlightForUser(ctx context.Context, userID string) (*domain.DeleteUserSagaState, error) {
+	ctx, span := sr.tracer.Start(ctx, "SagaRepo.InFlightForUser")
+	defer span.End()
+	sagas, err := sr.find(ctx, bson.M{
+		"status":      bson.M{"$in": []orchestration.Status{orchestration.Running, orchestration.Compensating}},
+		"data.userid": userID,
+	}, 1)
+	if err != nil || len(sagas) == 0 {
+		return nil, err
+	}
+	return sagas[0], nil
+}
+
+func (sr SagaRepository) List(ctx context.Context, filter orchestration.Filter) ([]*domain.DeleteUserSagaState, error) {
+	ctx, span := sr.tracer.Start(ctx, "SagaRepo.List")
+	defer span.End()
+	query := bson.M{}
+	if len(filter.Statuses) > 0 {
+		query["status"] = bson.M{"$in": filter.Statuses}
+	}
+	if !filter.CreatedBefore.IsZero() {
+		query["createdat"] = bson.M{"$lt": filter.CreatedBefore}
+	}
+	return sr.find(ctx, query, int64(filter.Limit))
+}
+
+// find returns the sagas that match the filter, oldest first and at most limit of them unless
+// limit is 0.
+func (sr SagaRepository) find(ctx context.Context, filter bson.M, limit int64) ([]*domain.DeleteUserSagaState, error) {
+	opts := options.Find().SetSort(bson.M{"createdat": 1})
+	if limit > 0 {
+		opts.SetLimit(limit)
+	}
+	cursor, err := sr.collection().Find(ctx, filter, opts)
+	if err != nil {
+		sr.logger.LogError(source, fmt.Sprintf("Unable to find sagas: %v", err))
+		return nil, fmt.Errorf("unable to retrieve sagas, database error")
+	}
+	defer cursor.Close(ctx)
+	var documents []sagaDocument
+	if err := cursor.All(ctx, &documents); err != nil {
+		sr.logger.LogError(source, fmt.Sprintf("Unable to decode sagas: %v", err))
+		return nil, fmt.Errorf("unable to retrieve sagas, database error")
+	}
+	sagas := make([]*domain.DeleteUserSagaState, 0, len(documents))
+	for i := range documents {
+		sagas = append(sagas, &documents[i].State)
+	}
+	return sagas, nil
+}
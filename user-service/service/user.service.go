@@ -10,6 +10,7 @@ import (
 	"user-service/client"
 	"user-service/domain"
 	"user-service/errors"
+	"user-service/orchestrator"
 	"user-service/repository"
 	"user-service/utils"
 )
@@ -18,8 +19,7 @@ type UserService struct {
 	userRepository    *repository.UserRepository
 	validator         *utils.Validator
 	reservationClient *client.ReservationClient
-	authClient        *client.AuthClient
-	accClient         *client.AccClient
+	orchestrator      *orchestrator.DeleteUserOrchestrator
 	logger            *config.Logger
 	tracer            trace.Tracer
 }
@@ -29,16 +29,14 @@ const source = "user-service"
 func NewUserService(userRepo *repository.UserRepository,
 	validator *utils.Validator,
 	reservationClient *client.ReservationClient,
-	authClient *client.AuthClient,
-	accClient *client.AccClient,
+	orchestrator *orchestrator.DeleteUserOrchestrator,
 	logger *config.Logger,
 	tracer trace.Tracer) *UserService {
 	return &UserService{
 		userRepository:    userRepo,
 		validator:         validator,
 		reservationClient: reservationClient,
-		authClient:        authClient,
-		accClient:         accClient,
+		orchestrator:      orchestrator,
 		logger:            logger,
 		tracer:            tracer,
 	}
@@ -214,39 +212,40 @@ func (u *UserService) isDistinguished(ctx context.Context, id string, rating flo
 	return false, nil
 }
 
-func (u *UserService) DeleteUser(ctx context.Context, role string, id string) *errors.ErrorStruct {
+// DeleteUser starts the saga that deletes the account across the services. The profile is
+// deleted by the last step of the saga, once the user's accommodations, reservations and
+// credentials allow it.
+func (u *UserService) DeleteUser(ctx context.Context, role string, id string) (*domain.DeleteUserSagaState, *errors.ErrorStruct) {
 	ctx, span := u.tracer.Start(ctx, "UserService.DeleteUser")
 	defer span.End()
-	err := u.reservationClient.UserDeleteAllowed(ctx, id, role)
-	if err != nil {
-		message := err.GetErrorMessage()
-		u.logger.LogError(source, message)
-		return err
-	}
-	if role == "Host" {
-		err := u.accClient.DeleteUserAccommodations(ctx, id)
-		if err != nil {
-			message := err.GetErrorMessage()
-			u.logger.LogError(source, message)
-			return err
-		}
-	}
 	if role != "Guest" && role != "Host" {
-		err2 := errors.NewError(fmt.Sprintf("User by id: %v not allowed by role: %s", id, role), 401)
-		u.logger.LogError(source, err2.GetErrorMessage())
-		return err2
+		err := errors.NewError(fmt.Sprintf("User by id: %v not allowed by role: %s", id, role), 401)
+		u.logger.LogError(source, err.GetErrorMessage())
+		return nil, err
 	}
-	newErr := u.authClient.DeleteUserAuth(ctx, id)
-	if newErr != nil {
-		message := newErr.GetErrorMessage()
-		u.logger.LogError(source, message)
-		return newErr
+	saga, err := u.orchestrator.Start(ctx, id, role)
+	if err != nil {
+		u.logger.LogError(source, err.GetErrorMessage())
+		return nil, err
 	}
-	err3 := u.userRepository.DeleteUser(ctx, id)
-	if err3 != nil {
-		message := err3.GetErrorMessage()
-		u.logger.LogError(source, message)
-		return err3
+	return saga, nil
+}
+
+// GetDeletionSaga returns how far the deletion of a user's account got.
+func (u *UserService) GetDeletionSaga(ctx context.Context, userID, sagaID string) (*domain.DeleteUserSagaState, *errors.ErrorStruct) {
+	ctx, span := u.tracer.Start(ctx, "UserService.GetDeletionSaga")
+	defer span.End()
+	return u.orchestrator.GetSaga(ctx, userID, sagaID)
+}
+
+// DeleteProfile deletes the profile of a user whose account is being deleted.
+func (u *UserService) DeleteProfile(ctx context.Context, id string) *errors.ErrorStruct {
+	ctx, span := u.tracer.Start(ctx, "UserService.DeleteProfile")
+	defer span.End()
+	err := u.userRepository.DeleteUser(ctx, id)
+	if err != nil {
+		u.logger.LogError(source, err.GetErrorMessage())
+		return err
 	}
 	u.logger.LogInfo(source, fmt.Sprintf("User by id: %v deleted", id))
 	return nil